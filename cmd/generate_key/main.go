@@ -1,21 +1,36 @@
 package main
 
 import (
+	"crypto/rand"
+	"encoding/base64"
+	"flag"
 	"fmt"
 
+	"github.com/rinnothing/simple-jwt/utils/envelope"
 	"github.com/rinnothing/simple-jwt/utils/jwt"
 )
 
+// prints secrets ready to be put into config/config.yaml, they are used as they are, without decoding
 func main() {
-	key := jwt.GenerateKey()
-	fmt.Print("[]byte {")
+	explicit := flag.Bool("explicit", false, "print separate access, refresh and refresh hash keys instead of master secret")
+	kek := flag.Bool("kek", false, "print key encryption key for kek.file or environment variable from kek.env")
+	flag.Parse()
 
-	for i := 0; i < len(key); i++ {
-		fmt.Print(key[i])
-		if i != len(key)-1 {
-			fmt.Print(", ")
-		}
+	switch {
+	case *kek:
+		key := make([]byte, envelope.KeySize)
+		rand.Read(key)
+		fmt.Println(base64.StdEncoding.EncodeToString(key))
+	case *explicit:
+		printSecret("access_key")
+		printSecret("refresh_key")
+		printSecret("refresh_hash_key")
+	default:
+		printSecret("master_secret")
 	}
+}
 
-	fmt.Println("}")
+// secret is base64 of 512 random bits, so it fits into yaml
+func printSecret(name string) {
+	fmt.Printf("  %s: %q\n", name, base64.RawURLEncoding.EncodeToString([]byte(jwt.GenerateKey())))
 }
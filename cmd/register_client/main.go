@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"go.uber.org/zap"
+
+	"github.com/rinnothing/simple-jwt/internal/config"
+	"github.com/rinnothing/simple-jwt/internal/repository/postgres"
+	"github.com/rinnothing/simple-jwt/internal/service/oauth"
+)
+
+// registers confidential oauth client acting on behalf of guid, the secret is printed to stdout once.
+// registering the same client again replaces its secret
+func main() {
+	id := flag.String("id", "", "client id")
+	guid := flag.String("guid", "", "GUID the client acts for, it's created if doesn't exist")
+	scopes := flag.String("scopes", "", "space separated scopes the client may get")
+	refresh := flag.Bool("refresh", false, "give the client refresh tokens")
+	flag.Parse()
+
+	if *id == "" || *guid == "" || *scopes == "" {
+		fmt.Fprintln(os.Stderr, "id, guid and scopes are required")
+		os.Exit(2)
+	}
+
+	cfg, err := config.GetConfig("config/config.yaml")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "can't read config: %s", err.Error())
+		panic(err)
+	}
+
+	loggerCfg, err := config.ConfigureLogger(cfg.Logger)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "can't read logger configuration: %s", err.Error())
+		panic(err)
+	}
+
+	logger, err := loggerCfg.Build()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "can't start logger: %s", err.Error())
+		panic(err)
+	}
+
+	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer cancel()
+
+	dbPool, err := pgxpool.New(ctx, cfg.Postgres.URL)
+	if err != nil {
+		logger.Error("cannot connect to database", zap.Error(err))
+		panic(err)
+	}
+	defer dbPool.Close()
+
+	// keys aren't touched, so key encryption keys aren't needed
+	repo := postgres.NewRepo(cfg.Postgres, dbPool, nil, nil, logger)
+
+	uuid, err := repo.PutGUID(ctx, *guid)
+	if err != nil {
+		logger.Error("cannot put guid", zap.Error(err))
+		panic(err)
+	}
+
+	secret, err := oauth.NewService(repo, logger).Register(ctx, *id, uuid, strings.Fields(*scopes), *refresh)
+	if err != nil {
+		logger.Error("cannot register client", zap.Error(err))
+		panic(err)
+	}
+
+	logger.Info("client is registered", zap.String("client_id", *id), zap.String("guid", *guid))
+	fmt.Println(secret)
+}
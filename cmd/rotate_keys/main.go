@@ -0,0 +1,72 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"go.uber.org/zap"
+
+	"github.com/rinnothing/simple-jwt/internal/config"
+	"github.com/rinnothing/simple-jwt/internal/repository/postgres"
+	"github.com/rinnothing/simple-jwt/internal/service/auth"
+	webhook "github.com/rinnothing/simple-jwt/internal/service/webhook_caller"
+)
+
+func main() {
+	cfg, err := config.GetConfig("config/config.yaml")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "can't read config: %s", err.Error())
+		panic(err)
+	}
+
+	loggerCfg, err := config.ConfigureLogger(cfg.Logger)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "can't read logger configuration: %s", err.Error())
+		panic(err)
+	}
+
+	logger, err := loggerCfg.Build()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "can't start logger: %s", err.Error())
+		panic(err)
+	}
+
+	kek, err := cfg.KEK.Wrapper()
+	if err != nil {
+		logger.Error("cannot read key encryption keys", zap.Error(err))
+		panic(err)
+	}
+
+	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer cancel()
+
+	dbPool, err := pgxpool.New(ctx, cfg.Postgres.URL)
+	if err != nil {
+		logger.Error("cannot connect to database", zap.Error(err))
+		panic(err)
+	}
+	defer dbPool.Close()
+
+	repo := postgres.NewRepo(cfg.Postgres, dbPool, nil, kek, logger)
+
+	authService, err := auth.NewService(&cfg.Auth, repo, webhook.NewService(cfg.Webhook, logger), logger)
+	if err != nil {
+		logger.Error("cannot create auth service", zap.Error(err))
+		panic(err)
+	}
+
+	logger.Info("rotate keys")
+
+	// rotation holds the keys lock as servers do, running servers pick the new key up on their next reload
+	err = authService.RotateKeys(ctx)
+	if err != nil {
+		logger.Error("cannot rotate keys", zap.Error(err))
+		panic(err)
+	}
+
+	logger.Info("successfully published new keys")
+}
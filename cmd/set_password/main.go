@@ -0,0 +1,77 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"go.uber.org/zap"
+
+	"github.com/rinnothing/simple-jwt/internal/config"
+	"github.com/rinnothing/simple-jwt/internal/repository/postgres"
+	"github.com/rinnothing/simple-jwt/internal/service/authenticator"
+)
+
+// sets password of guid, the password is read from the first line of stdin so it doesn't stay in shell history
+func main() {
+	guid := flag.String("guid", "", "GUID of the user, it's created if doesn't exist")
+	flag.Parse()
+
+	if *guid == "" {
+		fmt.Fprintln(os.Stderr, "guid is required")
+		os.Exit(2)
+	}
+
+	cfg, err := config.GetConfig("config/config.yaml")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "can't read config: %s", err.Error())
+		panic(err)
+	}
+
+	loggerCfg, err := config.ConfigureLogger(cfg.Logger)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "can't read logger configuration: %s", err.Error())
+		panic(err)
+	}
+
+	logger, err := loggerCfg.Build()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "can't start logger: %s", err.Error())
+		panic(err)
+	}
+
+	password, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && password == "" {
+		logger.Error("cannot read password", zap.Error(err))
+		panic(err)
+	}
+	password = strings.TrimRight(password, "\r\n")
+
+	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer cancel()
+
+	dbPool, err := pgxpool.New(ctx, cfg.Postgres.URL)
+	if err != nil {
+		logger.Error("cannot connect to database", zap.Error(err))
+		panic(err)
+	}
+	defer dbPool.Close()
+
+	// keys aren't touched, so key encryption keys aren't needed
+	repo := postgres.NewRepo(cfg.Postgres, dbPool, nil, nil, logger)
+
+	params := authenticator.ParamsFromConfig(cfg.Authenticator.Argon2)
+	err = authenticator.NewPasswordAuthenticator(repo, params, nil, logger).SetPassword(ctx, *guid, password)
+	if err != nil {
+		logger.Error("cannot set password", zap.Error(err))
+		panic(err)
+	}
+
+	logger.Info("password is set", zap.String("guid", *guid))
+}
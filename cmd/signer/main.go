@@ -0,0 +1,86 @@
+//go:build unix
+
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/rinnothing/simple-jwt/utils/jwt"
+)
+
+// reference remote signer, it keeps private key in its own process and signs for the server over a unix socket
+func main() {
+	socket := flag.String("socket", "/tmp/simple-jwt-signer.sock", "unix socket to listen on")
+	alg := flag.String("alg", jwt.EdDSA, "signing algorithm, one of RS256, PS256, ES256, EdDSA")
+	keyFile := flag.String("key", "", "PKCS #8 private key in PEM, a new key is generated if not set")
+	flag.Parse()
+
+	err := run(*socket, *alg, *keyFile)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "signer failed: %s\n", err.Error())
+		os.Exit(1)
+	}
+}
+
+func run(socket, alg, keyFile string) error {
+	var key string
+	if keyFile != "" {
+		content, err := os.ReadFile(keyFile)
+		if err != nil {
+			return fmt.Errorf("can't read key: %w", err)
+		}
+		key = string(content)
+	} else {
+		var err error
+		key, err = jwt.GenerateSigningKey(alg)
+		if err != nil {
+			return err
+		}
+	}
+
+	signer, err := jwt.NewSigner(alg, key)
+	if err != nil {
+		return err
+	}
+	handler, err := jwt.NewSignerHandler(signer)
+	if err != nil {
+		return err
+	}
+
+	// socket left by a previous run
+	os.Remove(socket)
+
+	// only the owner, that is the server, may ask for signatures. Socket is created with these permissions,
+	// changing them after Listen would leave a moment when anyone could connect
+	oldMask := syscall.Umask(0o177)
+	listener, err := net.Listen("unix", socket)
+	syscall.Umask(oldMask)
+	if err != nil {
+		return fmt.Errorf("can't listen: %w", err)
+	}
+	defer os.Remove(socket)
+
+	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer cancel()
+
+	server := &http.Server{Handler: handler}
+	go func() {
+		<-ctx.Done()
+		server.Close()
+	}()
+
+	fmt.Printf("signing with %s key %s on %s\n", alg, signer.KeyID(), socket)
+	err = server.Serve(listener)
+	if !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
@@ -1,17 +1,37 @@
+//go:build integration
+
 package integration
 
 import (
+	"bytes"
 	"context"
+	"encoding/base32"
+	"encoding/base64"
+	"encoding/json"
 	"fmt"
 	"net/http"
+	"net/url"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/rinnothing/simple-jwt/internal/api"
 	"github.com/rinnothing/simple-jwt/internal/api/schema"
 	"github.com/rinnothing/simple-jwt/internal/config"
+	"github.com/rinnothing/simple-jwt/internal/repository/postgres"
+	"github.com/rinnothing/simple-jwt/internal/service/apikey"
+	"github.com/rinnothing/simple-jwt/internal/service/authenticator"
+	"github.com/rinnothing/simple-jwt/internal/service/oauth"
+	"github.com/rinnothing/simple-jwt/utils/envelope"
+	"github.com/rinnothing/simple-jwt/utils/jwt"
+	"github.com/rinnothing/simple-jwt/utils/totp"
+	"github.com/rinnothing/simple-jwt/utils/webauthn"
+	"github.com/rinnothing/simple-jwt/utils/webauthn/webauthntest"
 	"github.com/stretchr/testify/require"
 
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/labstack/echo/v4"
+
 	"go.uber.org/zap"
 )
 
@@ -22,6 +42,11 @@ func TestIntegration(t *testing.T) {
 	require.NoError(t, err)
 	cfg.Webhook.HttpAddress = address
 	cfg.Logger.Env = "dev"
+	cfg.Auth.RefreshGracePeriod = time.Minute
+	cfg.KEK.Env = "SIMPLE_JWT_TEST_KEK"
+	cfg.WebAuthn.RPID = "localhost"
+	cfg.WebAuthn.Origins = []string{"http://localhost"}
+	t.Setenv(cfg.KEK.Env, base64.StdEncoding.EncodeToString(make([]byte, envelope.KeySize)))
 
 	loggerCfg, err := config.ConfigureLogger(cfg.Logger)
 	require.NoError(t, err)
@@ -45,9 +70,44 @@ func TestIntegration(t *testing.T) {
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
-	// put guid
+	// set password, the server has already migrated database
 	guid := "111111"
-	authResp, err := client.AuthorizeGUIDWithResponse(ctx, guid)
+	password := "correct horse battery staple"
+
+	dbPool, err := pgxpool.New(ctx, cfg.Postgres.URL)
+	require.NoError(t, err)
+	defer dbPool.Close()
+
+	repo := postgres.NewRepo(cfg.Postgres, dbPool, nil, nil, logger)
+	passwords := authenticator.NewPasswordAuthenticator(repo, authenticator.ParamsFromConfig(cfg.Authenticator.Argon2), nil, logger)
+	require.NoError(t, passwords.SetPassword(ctx, guid, password))
+
+	// password is given with HTTP Basic, user name is the guid
+	withPassword := func(password string) schema.RequestEditorFn {
+		return func(ctx context.Context, req *http.Request) error {
+			req.SetBasicAuth(guid, password)
+			return nil
+		}
+	}
+
+	authResp, err := client.AuthorizeGUIDWithResponse(ctx, guid, withPassword("wrong"))
+	require.NoError(t, err)
+	require.Equal(t, http.StatusUnauthorized, authResp.StatusCode())
+
+	authResp, err = client.AuthorizeGUIDWithResponse(ctx, guid)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusUnauthorized, authResp.StatusCode())
+
+	authResp, err = client.AuthorizeGUIDWithResponse(ctx, guid, func(ctx context.Context, req *http.Request) error {
+		req.SetBasicAuth("222222", password)
+		return nil
+	})
+	require.NoError(t, err)
+	require.Equal(t, http.StatusBadRequest, authResp.StatusCode())
+
+	// put guid
+	credentials := withPassword(password)
+	authResp, err = client.AuthorizeGUIDWithResponse(ctx, guid, credentials)
 	require.NoError(t, err)
 	require.Equal(t, http.StatusCreated, authResp.StatusCode())
 
@@ -93,6 +153,381 @@ func TestIntegration(t *testing.T) {
 	require.NoError(t, err)
 	require.Equal(t, http.StatusUnauthorized, guidResp.StatusCode())
 
+	// sessions of one guid are independent
+
+	first, err := client.AuthorizeGUIDWithResponse(ctx, guid, credentials)
+	require.NoError(t, err)
+	second, err := client.AuthorizeGUIDWithResponse(ctx, guid, credentials)
+	require.NoError(t, err)
+
+	unResp, err = client.UnauthorizeWithResponse(ctx, &schema.UnauthorizeParams{AccessToken: *first.JSON201.AccessToken})
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, unResp.StatusCode())
+
+	guidResp, err = client.GetGUIDWithResponse(ctx, &schema.GetGUIDParams{AccessToken: *second.JSON201.AccessToken})
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, guidResp.StatusCode())
+
+	listResp, err := client.ListSessionsWithResponse(ctx, &schema.ListSessionsParams{AccessToken: *second.JSON201.AccessToken})
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, listResp.StatusCode())
+	current := 0
+	for _, session := range *listResp.JSON200 {
+		if session.Current {
+			current++
+		}
+	}
+	require.Equal(t, 1, current)
+
+	revokeResp, err := client.RevokeSessionWithResponse(ctx, "unknown", &schema.RevokeSessionParams{AccessToken: *second.JSON201.AccessToken})
+	require.NoError(t, err)
+	require.Equal(t, http.StatusNotFound, revokeResp.StatusCode())
+
+	third, err := client.AuthorizeGUIDWithResponse(ctx, guid, credentials)
+	require.NoError(t, err)
+
+	othersResp, err := client.RevokeOtherSessionsWithResponse(ctx, &schema.RevokeOtherSessionsParams{AccessToken: *third.JSON201.AccessToken})
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, othersResp.StatusCode())
+
+	guidResp, err = client.GetGUIDWithResponse(ctx, &schema.GetGUIDParams{AccessToken: *second.JSON201.AccessToken})
+	require.NoError(t, err)
+	require.Equal(t, http.StatusUnauthorized, guidResp.StatusCode())
+
+	all := true
+	unResp, err = client.UnauthorizeWithResponse(ctx, &schema.UnauthorizeParams{AccessToken: *third.JSON201.AccessToken, All: &all})
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, unResp.StatusCode())
+
+	guidResp, err = client.GetGUIDWithResponse(ctx, &schema.GetGUIDParams{AccessToken: *third.JSON201.AccessToken})
+	require.NoError(t, err)
+	require.Equal(t, http.StatusUnauthorized, guidResp.StatusCode())
+
+	// parallel refreshes of one pair are serialized and get the same new pair within grace period
+
+	parallel, err := client.AuthorizeGUIDWithResponse(ctx, guid, credentials)
+	require.NoError(t, err)
+
+	results := make(chan *schema.RefreshTokensResponse, 2)
+	for range 2 {
+		go func() {
+			resp, _ := client.RefreshTokensWithResponse(ctx, *parallel.JSON201)
+			results <- resp
+		}()
+	}
+	firstResp, secondResp := <-results, <-results
+	require.NotNil(t, firstResp)
+	require.NotNil(t, secondResp)
+	require.Equal(t, http.StatusOK, firstResp.StatusCode())
+	require.Equal(t, http.StatusOK, secondResp.StatusCode())
+	require.Equal(t, *firstResp.JSON200, *secondResp.JSON200)
+
+	guidResp, err = client.GetGUIDWithResponse(ctx, &schema.GetGUIDParams{AccessToken: *firstResp.JSON200.AccessToken})
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, guidResp.StatusCode())
+
+	// reuse of rotated refresh token revokes the whole session, once its successor was rotated too
+
+	reuse, err := client.AuthorizeGUIDWithResponse(ctx, guid, credentials)
+	require.NoError(t, err)
+	rotated, err := client.RefreshTokensWithResponse(ctx, *reuse.JSON201)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, rotated.StatusCode())
+	rotatedAgain, err := client.RefreshTokensWithResponse(ctx, *rotated.JSON200)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, rotatedAgain.StatusCode())
+
+	replay, err := client.RefreshTokensWithResponse(ctx, *reuse.JSON201)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusConflict, replay.StatusCode())
+
+	guidResp, err = client.GetGUIDWithResponse(ctx, &schema.GetGUIDParams{AccessToken: *rotatedAgain.JSON200.AccessToken})
+	require.NoError(t, err)
+	require.Equal(t, http.StatusUnauthorized, guidResp.StatusCode())
+
+	// second factor, login takes a code once mfa is confirmed
+
+	mfaLogin, err := client.AuthorizeGUIDWithResponse(ctx, guid, credentials)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusCreated, mfaLogin.StatusCode())
+	mfaAccess := *mfaLogin.JSON201.AccessToken
+
+	enrollResp, err := client.EnrollTOTPWithResponse(ctx, &schema.EnrollTOTPParams{AccessToken: mfaAccess})
+	require.NoError(t, err)
+	require.Equal(t, http.StatusCreated, enrollResp.StatusCode())
+	secret, err := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(enrollResp.JSON201.Secret)
+	require.NoError(t, err)
+
+	code := totp.Code(secret, time.Now(), totp.Options{})
+	confirmResp, err := client.ConfirmTOTPWithResponse(ctx, &schema.ConfirmTOTPParams{AccessToken: mfaAccess}, schema.MFACode{Code: &code})
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, confirmResp.StatusCode())
+	recoveryCodes := confirmResp.JSON200.RecoveryCodes
+
+	// rotation of key encryption key rewraps totp secrets together with keys, then it's rotated back
+	mfaUUID, found, err := repo.GetUUID(ctx, guid)
+	require.NoError(t, err)
+	require.True(t, found)
+	currentKEK, err := envelope.NewKEK(make([]byte, envelope.KeySize))
+	require.NoError(t, err)
+	rotatedKEK, err := envelope.NewKEK(bytes.Repeat([]byte{1}, envelope.KeySize))
+	require.NoError(t, err)
+	repoWith := func(keks ...*envelope.KEK) postgres.PostgresService {
+		wrapper, err := envelope.NewWrapper(keks...)
+		require.NoError(t, err)
+		return postgres.NewRepo(cfg.Postgres, dbPool, nil, wrapper, logger)
+	}
+
+	_, err = repoWith(rotatedKEK, currentKEK).RewrapKeys(ctx)
+	require.NoError(t, err)
+	rotatedTOTP, found, err := repoWith(rotatedKEK).GetTOTP(ctx, mfaUUID)
+	require.NoError(t, err)
+	require.True(t, found)
+	require.Equal(t, secret, rotatedTOTP.Secret)
+	_, err = repoWith(currentKEK, rotatedKEK).RewrapKeys(ctx)
+	require.NoError(t, err)
+
+	challengeResp, err := client.AuthorizeGUIDWithResponse(ctx, guid, credentials)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusAccepted, challengeResp.StatusCode())
+
+	wrongCode := "000000"
+	verifyResp, err := client.VerifyMFAWithResponse(ctx, schema.MFAVerification{MfaToken: challengeResp.JSON202.MfaToken, Code: &wrongCode})
+	require.NoError(t, err)
+	require.Equal(t, http.StatusUnauthorized, verifyResp.StatusCode())
+
+	verifyResp, err = client.VerifyMFAWithResponse(ctx, schema.MFAVerification{MfaToken: challengeResp.JSON202.MfaToken, RecoveryCode: &recoveryCodes[0]})
+	require.NoError(t, err)
+	require.Equal(t, http.StatusCreated, verifyResp.StatusCode())
+
+	payload, err := jwt.AccessToken(*verifyResp.JSON201.AccessToken).GetPayload()
+	require.NoError(t, err)
+	require.Equal(t, []string{jwt.AMRPassword, jwt.AMRMFA, jwt.AMROTP}, payload.AuthMethods)
+	require.NotZero(t, payload.AuthTime)
+
+	disableResp, err := client.DisableTOTPWithResponse(ctx, &schema.DisableTOTPParams{AccessToken: *verifyResp.JSON201.AccessToken},
+		schema.MFACode{RecoveryCode: &recoveryCodes[1]})
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, disableResp.StatusCode())
+
+	// passkey registered with access token logs in without password
+
+	device := webauthntest.New("http://localhost")
+	registerResp, err := client.BeginWebAuthnRegistrationWithResponse(ctx, &schema.BeginWebAuthnRegistrationParams{AccessToken: mfaAccess})
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, registerResp.StatusCode())
+
+	var creationOptions webauthn.CreationOptions
+	require.NoError(t, json.Unmarshal(registerResp.Body, &creationOptions))
+	created, err := device.Create(creationOptions)
+	require.NoError(t, err)
+	body, err := json.Marshal(created)
+	require.NoError(t, err)
+
+	finishRegisterResp, err := client.FinishWebAuthnRegistrationWithBodyWithResponse(ctx,
+		&schema.FinishWebAuthnRegistrationParams{AccessToken: mfaAccess}, echo.MIMEApplicationJSON, bytes.NewReader(body))
+	require.NoError(t, err)
+	require.Equal(t, http.StatusCreated, finishRegisterResp.StatusCode())
+
+	loginResp, err := client.BeginWebAuthnLoginWithResponse(ctx, &schema.BeginWebAuthnLoginParams{Guid: &guid})
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, loginResp.StatusCode())
+
+	var requestOptions webauthn.RequestOptions
+	require.NoError(t, json.Unmarshal(loginResp.Body, &requestOptions))
+	require.Len(t, requestOptions.AllowCredentials, 1)
+	asserted, err := device.Get(requestOptions)
+	require.NoError(t, err)
+	body, err = json.Marshal(asserted)
+	require.NoError(t, err)
+
+	finishLoginResp, err := client.FinishWebAuthnLoginWithBodyWithResponse(ctx, echo.MIMEApplicationJSON, bytes.NewReader(body))
+	require.NoError(t, err)
+	require.Equal(t, http.StatusCreated, finishLoginResp.StatusCode())
+
+	payload, err = jwt.AccessToken(*finishLoginResp.JSON201.AccessToken).GetPayload()
+	require.NoError(t, err)
+	require.Equal(t, []string{jwt.AMRHardwareKey, jwt.AMRMFA}, payload.AuthMethods)
+
+	// the assertion can't be replayed
+	finishLoginResp, err = client.FinishWebAuthnLoginWithBodyWithResponse(ctx, echo.MIMEApplicationJSON, bytes.NewReader(body))
+	require.NoError(t, err)
+	require.Equal(t, http.StatusUnauthorized, finishLoginResp.StatusCode())
+
+	// api key works in place of access token within its scopes, and can be exchanged for one
+
+	keyResp, err := client.CreateAPIKeyWithResponse(ctx, &schema.CreateAPIKeyParams{AccessToken: mfaAccess},
+		schema.APIKeyRequest{Label: "ci", Scopes: []string{apikey.ScopeGUIDRead}})
+	require.NoError(t, err)
+	require.Equal(t, http.StatusCreated, keyResp.StatusCode())
+	key := keyResp.JSON201.Key
+
+	guidResp, err = client.GetGUIDWithResponse(ctx, &schema.GetGUIDParams{AccessToken: key})
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, guidResp.StatusCode())
+	require.Equal(t, guid, string(*guidResp.JSON200))
+
+	keySessionsResp, err := client.ListSessionsWithResponse(ctx, &schema.ListSessionsParams{AccessToken: key})
+	require.NoError(t, err)
+	require.Equal(t, http.StatusForbidden, keySessionsResp.StatusCode())
+
+	sessionsResp, err := client.ListSessionsWithResponse(ctx, &schema.ListSessionsParams{AccessToken: mfaAccess})
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, sessionsResp.StatusCode())
+	sessionCount := len(*sessionsResp.JSON200)
+
+	exchangeResp, err := client.ExchangeAPIKeyWithResponse(ctx, &schema.ExchangeAPIKeyParams{ApiKey: key})
+	require.NoError(t, err)
+	require.Equal(t, http.StatusCreated, exchangeResp.StatusCode())
+	require.Nil(t, exchangeResp.JSON201.RefreshToken)
+	exchanged := *exchangeResp.JSON201.AccessToken
+
+	guidResp, err = client.GetGUIDWithResponse(ctx, &schema.GetGUIDParams{AccessToken: exchanged})
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, guidResp.StatusCode())
+
+	// session of exchanged token belongs to the key, so it isn't listed to the user
+	sessionsResp, err = client.ListSessionsWithResponse(ctx, &schema.ListSessionsParams{AccessToken: mfaAccess})
+	require.NoError(t, err)
+	require.Len(t, *sessionsResp.JSON200, sessionCount)
+
+	// scoped token can't manage the account
+	listKeysResp, err := client.ListAPIKeysWithResponse(ctx, &schema.ListAPIKeysParams{AccessToken: exchanged})
+	require.NoError(t, err)
+	require.Equal(t, http.StatusForbidden, listKeysResp.StatusCode())
+
+	listKeysResp, err = client.ListAPIKeysWithResponse(ctx, &schema.ListAPIKeysParams{AccessToken: mfaAccess})
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, listKeysResp.StatusCode())
+	require.Len(t, *listKeysResp.JSON200, 1)
+	require.NotNil(t, (*listKeysResp.JSON200)[0].LastUsedAt)
+
+	revokeKeyResp, err := client.RevokeAPIKeyWithResponse(ctx, keyResp.JSON201.ApiKey.Id, &schema.RevokeAPIKeyParams{AccessToken: mfaAccess})
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, revokeKeyResp.StatusCode())
+
+	// revoking the key ends tokens it was exchanged for
+	guidResp, err = client.GetGUIDWithResponse(ctx, &schema.GetGUIDParams{AccessToken: exchanged})
+	require.NoError(t, err)
+	require.Equal(t, http.StatusUnauthorized, guidResp.StatusCode())
+
+	exchangeResp, err = client.ExchangeAPIKeyWithResponse(ctx, &schema.ExchangeAPIKeyParams{ApiKey: key})
+	require.NoError(t, err)
+	require.Equal(t, http.StatusUnauthorized, exchangeResp.StatusCode())
+
+	// oauth clients get scoped tokens with client_credentials, and refresh them with refresh_token grant
+
+	serviceUUID, err := repo.PutGUID(ctx, "billing-service")
+	require.NoError(t, err)
+	clientSecret, err := oauth.NewService(repo, logger).Register(ctx, "billing", serviceUUID, []string{apikey.ScopeGUIDRead, "invoices:write"}, true)
+	require.NoError(t, err)
+	basicAuth := func(ctx context.Context, req *http.Request) error {
+		req.SetBasicAuth("billing", clientSecret)
+		return nil
+	}
+	tokenRequest := func(form url.Values, reqEditors ...schema.RequestEditorFn) *schema.OAuthTokenResponse {
+		resp, err := client.OAuthTokenWithBodyWithResponse(ctx, echo.MIMEApplicationForm, strings.NewReader(form.Encode()), reqEditors...)
+		require.NoError(t, err)
+		return resp
+	}
+
+	oauthResp := tokenRequest(url.Values{"grant_type": {"client_credentials"}, "scope": {apikey.ScopeGUIDRead}}, basicAuth)
+	require.Equal(t, http.StatusOK, oauthResp.StatusCode())
+	require.Equal(t, "no-store", oauthResp.HTTPResponse.Header.Get(echo.HeaderCacheControl))
+	require.Equal(t, "Bearer", oauthResp.JSON200.TokenType)
+	require.Equal(t, apikey.ScopeGUIDRead, oauthResp.JSON200.Scope)
+	require.NotNil(t, oauthResp.JSON200.RefreshToken)
+
+	guidResp, err = client.GetGUIDWithResponse(ctx, &schema.GetGUIDParams{AccessToken: oauthResp.JSON200.AccessToken})
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, guidResp.StatusCode())
+	require.Equal(t, "billing-service", string(*guidResp.JSON200))
+
+	oauthRefresh := *oauthResp.JSON200.RefreshToken
+	refreshForm := url.Values{"grant_type": {"refresh_token"}, "refresh_token": {oauthRefresh}, "client_id": {"billing"}, "client_secret": {clientSecret}}
+	// client sessions aren't bound to user agent, so client may be updated between refreshes
+	oauthResp = tokenRequest(refreshForm, func(ctx context.Context, req *http.Request) error {
+		req.Header.Set("User-Agent", "billing/2.0")
+		return nil
+	})
+	require.Equal(t, http.StatusOK, oauthResp.StatusCode())
+	require.Equal(t, apikey.ScopeGUIDRead, oauthResp.JSON200.Scope)
+	require.NotEqual(t, oauthRefresh, *oauthResp.JSON200.RefreshToken)
+	require.NotContains(t, oauthRefresh, oauthResp.JSON200.AccessToken)
+	rotatedRefresh := *oauthResp.JSON200.RefreshToken
+	rotatedAccess := oauthResp.JSON200.AccessToken
+
+	// duplicate refresh within grace period gets the same new pair, sealed again
+	oauthResp = tokenRequest(refreshForm)
+	require.Equal(t, http.StatusOK, oauthResp.StatusCode())
+	require.Equal(t, rotatedAccess, oauthResp.JSON200.AccessToken)
+
+	// sessions of clients are bound to them and aren't listed to the owner
+	serviceSessions, err := repo.ListSessions(ctx, serviceUUID)
+	require.NoError(t, err)
+	require.Empty(t, serviceSessions)
+
+	// refresh token is bound to the client it was issued to
+	reportsSecret, err := oauth.NewService(repo, logger).Register(ctx, "reports", serviceUUID, []string{apikey.ScopeGUIDRead}, true)
+	require.NoError(t, err)
+	oauthResp = tokenRequest(url.Values{"grant_type": {"refresh_token"}, "refresh_token": {rotatedRefresh}, "client_id": {"reports"}, "client_secret": {reportsSecret}})
+	require.Equal(t, http.StatusBadRequest, oauthResp.StatusCode())
+	require.Equal(t, schema.InvalidGrant, oauthResp.JSON400.Error)
+
+	// clients which may not refresh get access token alone, its session ends with the token
+	auditSecret, err := oauth.NewService(repo, logger).Register(ctx, "audit", serviceUUID, []string{apikey.ScopeGUIDRead}, false)
+	require.NoError(t, err)
+	auditForm := url.Values{"grant_type": {"client_credentials"}, "client_id": {"audit"}, "client_secret": {auditSecret}}
+	oauthResp = tokenRequest(auditForm)
+	require.Equal(t, http.StatusOK, oauthResp.StatusCode())
+	require.Nil(t, oauthResp.JSON200.RefreshToken)
+
+	guidResp, err = client.GetGUIDWithResponse(ctx, &schema.GetGUIDParams{AccessToken: oauthResp.JSON200.AccessToken})
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, guidResp.StatusCode())
+
+	oauthResp = tokenRequest(url.Values{"grant_type": {"client_credentials"}, "scope": {"admin"}}, basicAuth)
+	require.Equal(t, http.StatusBadRequest, oauthResp.StatusCode())
+	require.Equal(t, schema.InvalidScope, oauthResp.JSON400.Error)
+
+	oauthResp = tokenRequest(url.Values{"grant_type": {"password"}}, basicAuth)
+	require.Equal(t, http.StatusBadRequest, oauthResp.StatusCode())
+	require.Equal(t, schema.UnsupportedGrantType, oauthResp.JSON400.Error)
+
+	oauthResp = tokenRequest(url.Values{"grant_type": {"refresh_token"}, "refresh_token": {"garbage"}}, basicAuth)
+	require.Equal(t, http.StatusBadRequest, oauthResp.StatusCode())
+	require.Equal(t, schema.InvalidGrant, oauthResp.JSON400.Error)
+
+	oauthResp = tokenRequest(url.Values{"grant_type": {"client_credentials"}}, func(ctx context.Context, req *http.Request) error {
+		req.SetBasicAuth("billing", "wrong")
+		return nil
+	})
+	require.Equal(t, http.StatusUnauthorized, oauthResp.StatusCode())
+	require.Equal(t, schema.InvalidClient, oauthResp.JSON401.Error)
+	require.Contains(t, oauthResp.HTTPResponse.Header.Get(echo.HeaderWWWAuthenticate), "Basic")
+
+	// deleting the client removes its sessions
+	countClientSessions := func() int {
+		var count int
+		err := dbPool.QueryRow(ctx, `SELECT count(*) FROM sessions WHERE oauth_client_id = 'billing'`).Scan(&count)
+		require.NoError(t, err)
+		return count
+	}
+	require.NotZero(t, countClientSessions())
+	_, err = dbPool.Exec(ctx, `DELETE FROM oauth_clients WHERE client_id = 'billing'`)
+	require.NoError(t, err)
+	require.Zero(t, countClientSessions())
+
+	// keys are published, but hmac ones never
+
+	jwksResp, err := client.GetJWKSWithResponse(ctx)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, jwksResp.StatusCode())
+	require.NotEmpty(t, jwksResp.HTTPResponse.Header.Get("ETag"))
+	if cfg.Auth.Algorithm == "" || cfg.Auth.Algorithm == "HS512" {
+		require.Empty(t, jwksResp.JSON200.Keys)
+	}
+
 	// stopped server
 
 	server.Stop()
@@ -20,10 +20,16 @@ import (
 	"github.com/rinnothing/simple-jwt/internal/api/schema"
 	"github.com/rinnothing/simple-jwt/internal/config"
 	"github.com/rinnothing/simple-jwt/internal/repository/postgres"
+	"github.com/rinnothing/simple-jwt/internal/service/apikey"
 	"github.com/rinnothing/simple-jwt/internal/service/auth"
+	"github.com/rinnothing/simple-jwt/internal/service/authenticator"
+	"github.com/rinnothing/simple-jwt/internal/service/mfa"
+	"github.com/rinnothing/simple-jwt/internal/service/oauth"
+	"github.com/rinnothing/simple-jwt/internal/service/passkey"
 	storage "github.com/rinnothing/simple-jwt/internal/service/secure_storage"
 	webhook "github.com/rinnothing/simple-jwt/internal/service/webhook_caller"
 	migrations "github.com/rinnothing/simple-jwt/postgres"
+	"github.com/rinnothing/simple-jwt/utils/limiter"
 )
 
 type Server struct {
@@ -36,6 +42,12 @@ func (s *Server) Run(cfg config.Config, logger *zap.Logger) error {
 
 	s.cancel = cancel
 
+	kek, err := cfg.KEK.Wrapper()
+	if err != nil {
+		logger.Error("cannot read key encryption keys", zap.Error(err))
+		return err
+	}
+
 	dbPool, err := pgxpool.New(ctx, cfg.Postgres.URL)
 	if err != nil {
 		logger.Error("cannot connect to database", zap.Error(err))
@@ -45,7 +57,8 @@ func (s *Server) Run(cfg config.Config, logger *zap.Logger) error {
 
 	migrations.SetupPostgres(dbPool, logger)
 
-	repo := postgres.NewRepo(cfg.Postgres, dbPool, logger)
+	hasher := limiter.New(cfg.Hashing.Workers, cfg.Hashing.QueueSize, cfg.Hashing.QueueTimeout, cfg.Hashing.RetryAfter)
+	repo := postgres.NewRepo(cfg.Postgres, dbPool, hasher, kek, logger)
 
 	webhook := webhook.NewService(cfg.Webhook, logger)
 
@@ -57,7 +70,21 @@ func (s *Server) Run(cfg config.Config, logger *zap.Logger) error {
 		return err
 	}
 
-	serviceAPI := authapi.NewAPI(auth, storage, logger)
+	authenticator, err := authenticator.NewService(cfg.Authenticator, repo, hasher, logger)
+	if err != nil {
+		logger.Error("cannot create authenticator", zap.Error(err))
+		return err
+	}
+
+	mfa := mfa.NewService(cfg.MFA, repo, logger)
+	passkey := passkey.NewService(cfg.WebAuthn, repo, logger)
+	apikeys := apikey.NewService(cfg.APIKeys, repo, logger)
+	oauth := oauth.NewService(repo, logger)
+
+	go auth.RunKeyRotation(ctx)
+	go auth.RunSessionEvents(ctx)
+
+	serviceAPI := authapi.NewAPI(auth, authenticator, mfa, passkey, apikeys, oauth, storage, cfg.Auth.JWKSMaxAge, logger)
 
 	e := echo.New()
 	e.Use(echomiddleware.Recover())
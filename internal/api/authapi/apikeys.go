@@ -0,0 +1,199 @@
+package authapi
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/rinnothing/simple-jwt/internal/api/schema"
+	"github.com/rinnothing/simple-jwt/internal/service/apikey"
+	"github.com/rinnothing/simple-jwt/internal/service/auth"
+
+	"go.uber.org/zap"
+)
+
+func (a *APIImpl) CreateAPIKey(e echo.Context, params schema.CreateAPIKeyParams) error {
+	ctx := e.Request().Context()
+	a.logRequest(e, "create_api_key", credentialField(params.AccessToken))
+
+	authorized, err := a.tryAuthorize(e, params.AccessToken)
+	if !authorized {
+		return err
+	}
+
+	var request schema.APIKeyRequest
+	err = e.Bind(&request)
+	if err != nil {
+		a.logger.Error("can't unmarshal request", zap.Error(err))
+		return BadRequest(e, err.Error())
+	}
+
+	uuid, err := a.auth.GetUUID(ctx, params.AccessToken)
+	if err != nil {
+		a.logger.Error("can't get uuid from access token", zap.Error(err))
+		return InternalError(e)
+	}
+
+	var expiresAt time.Time
+	if request.ExpiresAt != nil {
+		expiresAt = *request.ExpiresAt
+	}
+
+	secret, key, err := a.apikeys.Create(ctx, uuid, request.Label, request.Scopes, expiresAt)
+	if errors.Is(err, apikey.ErrInvalidLabel) || errors.Is(err, apikey.ErrInvalidScope) || errors.Is(err, apikey.ErrExpiry) {
+		return BadRequest(e, err.Error())
+	}
+	if errors.Is(err, apikey.ErrTooManyKeys) {
+		return Conflict(e, err.Error())
+	}
+	if err != nil {
+		a.logger.Error("can't create api key", zap.Error(err))
+		return InternalError(e)
+	}
+
+	return e.JSON(http.StatusCreated, schema.CreatedAPIKey{
+		Key:    secret,
+		ApiKey: apiKeyOf(key),
+	})
+}
+
+func (a *APIImpl) ListAPIKeys(e echo.Context, params schema.ListAPIKeysParams) error {
+	ctx := e.Request().Context()
+	a.logRequest(e, "list_api_keys", credentialField(params.AccessToken))
+
+	authorized, err := a.tryAuthorize(e, params.AccessToken)
+	if !authorized {
+		return err
+	}
+
+	uuid, err := a.auth.GetUUID(ctx, params.AccessToken)
+	if err != nil {
+		a.logger.Error("can't get uuid from access token", zap.Error(err))
+		return InternalError(e)
+	}
+
+	keys, err := a.apikeys.List(ctx, uuid)
+	if err != nil {
+		a.logger.Error("can't list api keys", zap.Error(err))
+		return InternalError(e)
+	}
+
+	res := make([]schema.APIKey, 0, len(keys))
+	for _, key := range keys {
+		res = append(res, apiKeyOf(key))
+	}
+	return e.JSON(http.StatusOK, res)
+}
+
+func (a *APIImpl) LabelAPIKey(e echo.Context, keyID string, params schema.LabelAPIKeyParams) error {
+	ctx := e.Request().Context()
+	a.logRequest(e, "label_api_key", credentialField(params.AccessToken), zap.String("key_id", keyID))
+
+	authorized, err := a.tryAuthorize(e, params.AccessToken)
+	if !authorized {
+		return err
+	}
+
+	var body schema.APIKeyLabel
+	err = e.Bind(&body)
+	if err != nil {
+		a.logger.Error("can't unmarshal request", zap.Error(err))
+		return BadRequest(e, err.Error())
+	}
+
+	uuid, err := a.auth.GetUUID(ctx, params.AccessToken)
+	if err != nil {
+		a.logger.Error("can't get uuid from access token", zap.Error(err))
+		return InternalError(e)
+	}
+
+	err = a.apikeys.Label(ctx, uuid, keyID, body.Label)
+	if errors.Is(err, apikey.ErrInvalidLabel) {
+		return BadRequest(e, err.Error())
+	}
+	if errors.Is(err, apikey.ErrNotFound) {
+		return NotFound(e)
+	}
+	if err != nil {
+		a.logger.Error("can't label api key", zap.Error(err))
+		return InternalError(e)
+	}
+
+	return e.NoContent(http.StatusOK)
+}
+
+func (a *APIImpl) RevokeAPIKey(e echo.Context, keyID string, params schema.RevokeAPIKeyParams) error {
+	ctx := e.Request().Context()
+	a.logRequest(e, "revoke_api_key", credentialField(params.AccessToken), zap.String("key_id", keyID))
+
+	authorized, err := a.tryAuthorize(e, params.AccessToken)
+	if !authorized {
+		return err
+	}
+
+	uuid, err := a.auth.GetUUID(ctx, params.AccessToken)
+	if err != nil {
+		a.logger.Error("can't get uuid from access token", zap.Error(err))
+		return InternalError(e)
+	}
+
+	err = a.apikeys.Revoke(ctx, uuid, keyID)
+	if errors.Is(err, apikey.ErrNotFound) {
+		return NotFound(e)
+	}
+	if err != nil {
+		a.logger.Error("can't revoke api key", zap.Error(err))
+		return InternalError(e)
+	}
+
+	return e.NoContent(http.StatusOK)
+}
+
+// ExchangeAPIKey issues access token limited to scopes of the key. Refresh token isn't given out,
+// the token is bound to the key and stops working when the key is revoked
+func (a *APIImpl) ExchangeAPIKey(e echo.Context, params schema.ExchangeAPIKeyParams) error {
+	ctx := e.Request().Context()
+	a.logRequest(e, "exchange_api_key", zap.String("api_key", apikey.Shown(params.ApiKey)))
+
+	uuid, key, err := a.apikeys.Authenticate(ctx, params.ApiKey)
+	if errors.Is(err, apikey.ErrInvalidKey) {
+		a.logger.Info("api key denied")
+		return InvalidToken(e, http.StatusUnauthorized, schema.InvalidApiKey)
+	}
+	if err != nil {
+		a.logger.Error("can't authenticate api key", zap.Error(err))
+		return InternalError(e)
+	}
+
+	claims := map[string]any{auth.ScopeClaim: strings.Join(key.Scopes, " ")}
+	access, err := a.auth.IssueKeyToken(ctx, uuid, key.ID, claims, e.Request().UserAgent(), e.RealIP())
+	if overloaded, respErr := Overloaded(e, err); overloaded {
+		a.logger.Warn("issuing tokens rejected", zap.Error(err))
+		return respErr
+	}
+	if err != nil {
+		a.logger.Error("can't issue tokens", zap.Error(err))
+		return InternalError(e)
+	}
+
+	return e.JSON(http.StatusCreated, schema.TokenPair{AccessToken: &access})
+}
+
+func apiKeyOf(key apikey.Key) schema.APIKey {
+	res := schema.APIKey{
+		Id:        key.ID,
+		Label:     key.Label,
+		Prefix:    key.Prefix,
+		Scopes:    key.Scopes,
+		CreatedAt: key.CreatedAt,
+	}
+	if !key.ExpiresAt.IsZero() {
+		res.ExpiresAt = &key.ExpiresAt
+	}
+	if !key.LastUsedAt.IsZero() {
+		res.LastUsedAt = &key.LastUsedAt
+	}
+	return res
+}
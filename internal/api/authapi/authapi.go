@@ -1,15 +1,27 @@
 package authapi
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
 	"errors"
+	"fmt"
 	"net/http"
 	"slices"
+	"time"
 
 	"github.com/labstack/echo/v4"
 	"github.com/rinnothing/simple-jwt/internal/api/schema"
 	"github.com/rinnothing/simple-jwt/internal/repository/postgres"
+	"github.com/rinnothing/simple-jwt/internal/service/apikey"
 	"github.com/rinnothing/simple-jwt/internal/service/auth"
+	"github.com/rinnothing/simple-jwt/internal/service/authenticator"
+	"github.com/rinnothing/simple-jwt/internal/service/mfa"
+	"github.com/rinnothing/simple-jwt/internal/service/oauth"
+	"github.com/rinnothing/simple-jwt/internal/service/passkey"
 	storage "github.com/rinnothing/simple-jwt/internal/service/secure_storage"
+	"github.com/rinnothing/simple-jwt/utils/digest"
+	"github.com/rinnothing/simple-jwt/utils/jwt"
 
 	"go.uber.org/zap"
 )
@@ -19,34 +31,146 @@ type AuthAPI interface {
 	GetGUID(ctx echo.Context, params schema.GetGUIDParams) error
 	RefreshTokens(ctx echo.Context) error
 	Unauthorize(ctx echo.Context, params schema.UnauthorizeParams) error
+	GetJWKS(ctx echo.Context) error
+
+	ListSessions(ctx echo.Context, params schema.ListSessionsParams) error
+	RevokeSession(ctx echo.Context, sessionID string, params schema.RevokeSessionParams) error
+	RevokeOtherSessions(ctx echo.Context, params schema.RevokeOtherSessionsParams) error
+
+	VerifyMFA(ctx echo.Context) error
+	EnrollTOTP(ctx echo.Context, params schema.EnrollTOTPParams) error
+	ConfirmTOTP(ctx echo.Context, params schema.ConfirmTOTPParams) error
+	DisableTOTP(ctx echo.Context, params schema.DisableTOTPParams) error
+
+	CreateAPIKey(ctx echo.Context, params schema.CreateAPIKeyParams) error
+	ListAPIKeys(ctx echo.Context, params schema.ListAPIKeysParams) error
+	LabelAPIKey(ctx echo.Context, keyID string, params schema.LabelAPIKeyParams) error
+	RevokeAPIKey(ctx echo.Context, keyID string, params schema.RevokeAPIKeyParams) error
+	ExchangeAPIKey(ctx echo.Context, params schema.ExchangeAPIKeyParams) error
+
+	BeginWebAuthnRegistration(ctx echo.Context, params schema.BeginWebAuthnRegistrationParams) error
+	FinishWebAuthnRegistration(ctx echo.Context, params schema.FinishWebAuthnRegistrationParams) error
+	BeginWebAuthnLogin(ctx echo.Context, params schema.BeginWebAuthnLoginParams) error
+	FinishWebAuthnLogin(ctx echo.Context) error
+
+	OAuthToken(ctx echo.Context) error
 }
 
+const defaultJWKSMaxAge = 5 * time.Minute
+
+// fingerprintSize is how many bytes of token hash are logged
+const fingerprintSize = 8
+
 type APIImpl struct {
 	logger *zap.Logger
 
-	auth    auth.AuthService
-	storage storage.StorageService
+	auth          auth.AuthService
+	authenticator authenticator.Authenticator
+	mfa           mfa.MFAService
+	passkey       passkey.PasskeyService
+	apikeys       apikey.APIKeyService
+	oauth         oauth.OAuthService
+	storage       storage.StorageService
+
+	jwksMaxAge time.Duration
 }
 
-func NewAPI(auth auth.AuthService, storage storage.StorageService, logger *zap.Logger) AuthAPI {
+func NewAPI(auth auth.AuthService, authenticator authenticator.Authenticator, mfa mfa.MFAService, passkey passkey.PasskeyService,
+	apikeys apikey.APIKeyService, oauth oauth.OAuthService, storage storage.StorageService, jwksMaxAge time.Duration, logger *zap.Logger) AuthAPI {
+	if jwksMaxAge == 0 {
+		jwksMaxAge = defaultJWKSMaxAge
+	}
+
 	return &APIImpl{
-		logger:  logger,
-		auth:    auth,
-		storage: storage,
+		logger:        logger,
+		auth:          auth,
+		authenticator: authenticator,
+		mfa:           mfa,
+		passkey:       passkey,
+		apikeys:       apikeys,
+		oauth:         oauth,
+		storage:       storage,
+		jwksMaxAge:    jwksMaxAge,
 	}
 }
 
+// AuthorizeGUID takes password from HTTP Basic, so it isn't in the url or a custom header which proxies may log
 func (a *APIImpl) AuthorizeGUID(e echo.Context, guid string) error {
 	ctx := e.Request().Context()
 	a.logRequest(e, "authorize", zap.String("guid", guid))
 
+	var credentials authenticator.Credentials
+	if e.Request().Header.Get(echo.HeaderAuthorization) != "" {
+		user, password, ok := e.Request().BasicAuth()
+		if !ok {
+			return BadRequest(e, "Authorization header must be HTTP Basic")
+		}
+		if user != guid {
+			return BadRequest(e, "user name in Authorization header must be the guid")
+		}
+		credentials.Password = password
+	}
+
+	methods, err := a.authenticator.Authenticate(ctx, guid, credentials)
+	if errors.Is(err, authenticator.ErrInvalidCredentials) {
+		a.logger.Info("authorization denied", zap.String("guid", guid))
+		return Unauthorized(e)
+	}
+	if overloaded, respErr := Overloaded(e, err); overloaded {
+		a.logger.Warn("authentication rejected", zap.Error(err))
+		return respErr
+	}
+	if err != nil {
+		a.logger.Error("can't authenticate user", zap.Error(err))
+		return InternalError(e)
+	}
+
 	uuid, err := a.storage.PutGUID(ctx, guid)
 	if err != nil {
 		a.logger.Error("can't put guid in storage", zap.Error(err))
 		return InternalError(e)
 	}
+	authn := jwt.Authentication{Methods: methods, Time: time.Now().Unix()}
+
+	return a.login(e, uuid, authn)
+}
+
+// login issues tokens, or responds with mfa challenge if the user has mfa and it wasn't passed yet
+func (a *APIImpl) login(e echo.Context, uuid string, authn jwt.Authentication) error {
+	ctx := e.Request().Context()
+	if slices.Contains(authn.Methods, jwt.AMRMFA) {
+		return a.issueTokens(e, uuid, authn)
+	}
 
-	pair, err := a.auth.IssueTokens(ctx, string(uuid), e.Request().UserAgent(), e.RealIP())
+	// users with mfa get tokens only after the second step
+	mfaEnabled, err := a.mfa.Enabled(ctx, uuid)
+	if err != nil {
+		a.logger.Error("can't check if mfa is enabled", zap.Error(err))
+		return InternalError(e)
+	}
+	if mfaEnabled {
+		token, lifetime, err := a.mfa.Challenge(ctx, uuid, authn)
+		if err != nil {
+			a.logger.Error("can't make mfa challenge", zap.Error(err))
+			return InternalError(e)
+		}
+
+		return e.JSON(http.StatusAccepted, schema.MFAChallenge{
+			MfaToken:  token,
+			ExpiresIn: int(lifetime.Seconds()),
+		})
+	}
+
+	return a.issueTokens(e, uuid, authn)
+}
+
+// issueTokens responds with a new pair, claims are never taken from the caller, anyone could give themselves any role
+func (a *APIImpl) issueTokens(e echo.Context, uuid string, authn jwt.Authentication) error {
+	pair, err := a.auth.IssueTokens(e.Request().Context(), uuid, authn, nil, e.Request().UserAgent(), e.RealIP())
+	if overloaded, respErr := Overloaded(e, err); overloaded {
+		a.logger.Warn("issuing tokens rejected", zap.Error(err))
+		return respErr
+	}
 	if err != nil {
 		a.logger.Error("can't issue tokens", zap.Error(err))
 		return InternalError(e)
@@ -57,19 +181,13 @@ func (a *APIImpl) AuthorizeGUID(e echo.Context, guid string) error {
 
 func (a *APIImpl) GetGUID(e echo.Context, params schema.GetGUIDParams) error {
 	ctx := e.Request().Context()
-	a.logRequest(e, "get_guid", zap.String("access_token", params.AccessToken))
+	a.logRequest(e, "get_guid", credentialField(params.AccessToken))
 
-	authorized, err := a.tryAuthorize(e, params.AccessToken)
+	uuid, authorized, err := a.authorizeScoped(e, params.AccessToken, apikey.ScopeGUIDRead)
 	if !authorized {
 		return err
 	}
 
-	uuid, err := a.auth.GetUUID(ctx, params.AccessToken)
-	if err != nil {
-		a.logger.Error("can't get uuid from access token", zap.Error(err))
-		return InternalError(e)
-	}
-
 	guid, err := a.storage.GetGUID(ctx, uuid)
 	if err != nil {
 		a.logger.Error("can't get guid from storage", zap.Error(err))
@@ -89,18 +207,25 @@ func (a *APIImpl) RefreshTokens(e echo.Context) error {
 		return BadRequest(e, err.Error())
 	}
 
-	a.logRequest(e, "refresh", zap.String("access_token", *pair.AccessToken), zap.String("refresh_token", *pair.RefreshToken))
-
-	authorized, err := a.tryAuthorize(e, *pair.AccessToken)
-	if !authorized {
-		return err
+	if pair.AccessToken == nil || pair.RefreshToken == nil {
+		return BadRequest(e, "both access_token and refresh_token are required")
 	}
 
+	a.logRequest(e, "refresh", fingerprintField("access_token", *pair.AccessToken), fingerprintField("refresh_token", *pair.RefreshToken))
+
 	newPair, err := a.auth.RefreshTokens(ctx, pair, e.Request().UserAgent(), e.RealIP())
+	if errors.Is(err, auth.ErrInvalidTokens) {
+		a.logger.Info("refresh denied", zap.Error(err))
+		return TokenError(e, err)
+	}
 	if errors.Is(err, postgres.ErrWrongUserAgent) {
-		a.logger.Info("refresh token denied", zap.String("access_token", string(*pair.AccessToken)),
-			zap.String("refresh_token", string(*pair.RefreshToken)))
-		return Unauthorized(e)
+		a.logger.Info("refresh token denied", fingerprintField("access_token", *pair.AccessToken),
+			fingerprintField("refresh_token", *pair.RefreshToken))
+		return InvalidToken(e, http.StatusUnauthorized, schema.UserAgentMismatch)
+	}
+	if overloaded, respErr := Overloaded(e, err); overloaded {
+		a.logger.Warn("refresh rejected", zap.Error(err))
+		return respErr
 	}
 	if err != nil {
 		a.logger.Error("can't refresh tokens", zap.Error(err))
@@ -113,14 +238,19 @@ func (a *APIImpl) RefreshTokens(e echo.Context) error {
 func (a *APIImpl) Unauthorize(e echo.Context, params schema.UnauthorizeParams) error {
 	ctx := e.Request().Context()
 
-	a.logRequest(e, "unauthorize", zap.String("access_token", params.AccessToken))
+	all := params.All != nil && *params.All
+	a.logRequest(e, "unauthorize", credentialField(params.AccessToken), zap.Bool("all", all))
 
 	authorized, err := a.tryAuthorize(e, params.AccessToken)
 	if !authorized {
 		return err
 	}
 
-	err = a.auth.Unauthorize(ctx, params.AccessToken)
+	if all {
+		err = a.auth.UnauthorizeAll(ctx, params.AccessToken)
+	} else {
+		err = a.auth.Unauthorize(ctx, params.AccessToken)
+	}
 	if err != nil {
 		a.logger.Error("can't unauthorize user", zap.Error(err))
 		return InternalError(e)
@@ -129,19 +259,193 @@ func (a *APIImpl) Unauthorize(e echo.Context, params schema.UnauthorizeParams) e
 	return e.NoContent(http.StatusOK)
 }
 
+func (a *APIImpl) ListSessions(e echo.Context, params schema.ListSessionsParams) error {
+	ctx := e.Request().Context()
+	a.logRequest(e, "list_sessions", credentialField(params.AccessToken))
+
+	uuid, authorized, err := a.authorizeScoped(e, params.AccessToken, apikey.ScopeSessionsRead)
+	if !authorized {
+		return err
+	}
+
+	// api key has no session to be the current one
+	var sessions []schema.Session
+	if apikey.IsKey(params.AccessToken) {
+		sessions, err = a.auth.ListUserSessions(ctx, uuid)
+	} else {
+		sessions, err = a.auth.ListSessions(ctx, params.AccessToken)
+	}
+	if err != nil {
+		a.logger.Error("can't list sessions", zap.Error(err))
+		return InternalError(e)
+	}
+
+	return e.JSON(http.StatusOK, sessions)
+}
+
+func (a *APIImpl) RevokeSession(e echo.Context, sessionID string, params schema.RevokeSessionParams) error {
+	ctx := e.Request().Context()
+	a.logRequest(e, "revoke_session", credentialField(params.AccessToken), zap.String("session_id", sessionID))
+
+	authorized, err := a.tryAuthorize(e, params.AccessToken)
+	if !authorized {
+		return err
+	}
+
+	err = a.auth.RevokeSession(ctx, params.AccessToken, sessionID)
+	if errors.Is(err, postgres.ErrSessionNotFound) {
+		return NotFound(e)
+	}
+	if err != nil {
+		a.logger.Error("can't revoke session", zap.Error(err))
+		return InternalError(e)
+	}
+
+	return e.NoContent(http.StatusOK)
+}
+
+func (a *APIImpl) RevokeOtherSessions(e echo.Context, params schema.RevokeOtherSessionsParams) error {
+	ctx := e.Request().Context()
+	a.logRequest(e, "revoke_other_sessions", credentialField(params.AccessToken))
+
+	authorized, err := a.tryAuthorize(e, params.AccessToken)
+	if !authorized {
+		return err
+	}
+
+	err = a.auth.RevokeOtherSessions(ctx, params.AccessToken)
+	if err != nil {
+		a.logger.Error("can't revoke other sessions", zap.Error(err))
+		return InternalError(e)
+	}
+
+	return e.NoContent(http.StatusOK)
+}
+
+func (a *APIImpl) GetJWKS(e echo.Context) error {
+	jwks, err := a.auth.GetJWKS(e.Request().Context())
+	if err != nil {
+		a.logger.Error("can't get jwks", zap.Error(err))
+		return InternalError(e)
+	}
+
+	body, err := json.Marshal(jwks)
+	if err != nil {
+		a.logger.Error("can't marshal jwks", zap.Error(err))
+		return InternalError(e)
+	}
+
+	// etag changes together with the keys, so consumers can revalidate cheaply after max-age
+	etag := fmt.Sprintf(`"%x"`, sha256.Sum256(body))
+	e.Response().Header().Set("Cache-Control", fmt.Sprintf("public, max-age=%d, must-revalidate", int(a.jwksMaxAge.Seconds())))
+	e.Response().Header().Set("ETag", etag)
+
+	if e.Request().Header.Get("If-None-Match") == etag {
+		return e.NoContent(http.StatusNotModified)
+	}
+
+	return e.JSONBlob(http.StatusOK, body)
+}
+
 func (a *APIImpl) tryAuthorize(e echo.Context, token schema.AccessToken) (bool, error) {
-	allow, err := a.auth.HasAccess(e.Request().Context(), token)
+	err := a.auth.HasAccess(e.Request().Context(), token)
+	if errors.Is(err, auth.ErrInvalidTokens) {
+		a.logger.Info("access denied", credentialField(string(token)), zap.Error(err))
+		return false, TokenError(e, err)
+	}
+	if overloaded, respErr := Overloaded(e, err); overloaded {
+		a.logger.Warn("access check rejected", zap.Error(err))
+		return false, respErr
+	}
 	if err != nil {
 		a.logger.Error("can't check access", zap.Error(err))
 		return false, InternalError(e)
 	}
-	if !allow {
-		a.logger.Info("access denied", zap.String("access_token", string(token)))
-		return false, Unauthorized(e)
+
+	// tokens exchanged for api keys are let in only by routes which take their scopes
+	scopes, err := a.auth.Scopes(e.Request().Context(), token)
+	if err != nil {
+		a.logger.Error("can't get scopes of access token", zap.Error(err))
+		return false, InternalError(e)
+	}
+	if len(scopes) != 0 {
+		a.logger.Info("scoped token refused", zap.Strings("scopes", scopes))
+		return false, InsufficientScope(e, "")
 	}
+
 	return true, nil
 }
 
+// authorizeScoped lets in tokens of users who logged in themselves, and api keys or tokens exchanged
+// for them which have the scope. It returns uuid of the user
+func (a *APIImpl) authorizeScoped(e echo.Context, token schema.AccessToken, scope string) (string, bool, error) {
+	ctx := e.Request().Context()
+
+	var uuid string
+	var scopes []string
+	if apikey.IsKey(token) {
+		var key apikey.Key
+		var err error
+		uuid, key, err = a.apikeys.Authenticate(ctx, token)
+		if errors.Is(err, apikey.ErrInvalidKey) {
+			a.logger.Info("api key denied")
+			return "", false, InvalidToken(e, http.StatusUnauthorized, schema.InvalidApiKey)
+		}
+		if err != nil {
+			a.logger.Error("can't authenticate api key", zap.Error(err))
+			return "", false, InternalError(e)
+		}
+		scopes = key.Scopes
+	} else {
+		err := a.auth.HasAccess(ctx, token)
+		if errors.Is(err, auth.ErrInvalidTokens) {
+			a.logger.Info("access denied", credentialField(string(token)), zap.Error(err))
+			return "", false, TokenError(e, err)
+		}
+		if overloaded, respErr := Overloaded(e, err); overloaded {
+			a.logger.Warn("access check rejected", zap.Error(err))
+			return "", false, respErr
+		}
+		if err != nil {
+			a.logger.Error("can't check access", zap.Error(err))
+			return "", false, InternalError(e)
+		}
+
+		uuid, err = a.auth.GetUUID(ctx, token)
+		if err != nil {
+			a.logger.Error("can't get uuid from access token", zap.Error(err))
+			return "", false, InternalError(e)
+		}
+		scopes, err = a.auth.Scopes(ctx, token)
+		if err != nil {
+			a.logger.Error("can't get scopes of access token", zap.Error(err))
+			return "", false, InternalError(e)
+		}
+		if len(scopes) == 0 {
+			return uuid, true, nil
+		}
+	}
+
+	if !slices.Contains(scopes, scope) {
+		a.logger.Info("scope is missing", zap.String("scope", scope), zap.Strings("scopes", scopes))
+		return "", false, InsufficientScope(e, scope)
+	}
+	return uuid, true, nil
+}
+
+// credentialField keeps credentials out of logs, only beginning of api key or fingerprint of access token is logged
+func credentialField(token string) zap.Field {
+	if apikey.IsKey(token) {
+		return zap.String("api_key", apikey.Shown(token))
+	}
+	return fingerprintField("access_token", token)
+}
+
+// fingerprintField logs short hash of the token instead of the token, it's enough to match log lines
+func fingerprintField(name, token string) zap.Field {
+	return zap.String(name+"_fingerprint", hex.EncodeToString(digest.Random(token)[:fingerprintSize]))
+}
+
 func (a *APIImpl) logRequest(e echo.Context, name string, fields ...zap.Field) {
 	a.logger.Info("got request",
 		slices.Concat(
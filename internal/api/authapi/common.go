@@ -1,10 +1,19 @@
 package authapi
 
 import (
+	"errors"
 	"fmt"
+	"math"
 	"net/http"
+	"strconv"
+	"time"
 
 	"github.com/labstack/echo/v4"
+	"github.com/rinnothing/simple-jwt/internal/api/schema"
+	"github.com/rinnothing/simple-jwt/internal/service/auth"
+	"github.com/rinnothing/simple-jwt/internal/service/mfa"
+	"github.com/rinnothing/simple-jwt/utils/jwt"
+	"github.com/rinnothing/simple-jwt/utils/limiter"
 )
 
 func InternalError(e echo.Context) error {
@@ -15,6 +24,117 @@ func Unauthorized(e echo.Context) error {
 	return e.String(http.StatusUnauthorized, "unauthorized\n")
 }
 
+func NotFound(e echo.Context) error {
+	return e.String(http.StatusNotFound, "not found\n")
+}
+
+// Overloaded responds with 503 if err is rejection of limited work, returns false otherwise
+func Overloaded(e echo.Context, err error) (bool, error) {
+	var overloaded *limiter.OverloadedError
+	if !errors.As(err, &overloaded) {
+		return false, nil
+	}
+
+	e.Response().Header().Set(echo.HeaderRetryAfter, strconv.Itoa(int(math.Ceil(overloaded.RetryAfter.Seconds()))))
+	return true, e.String(http.StatusServiceUnavailable, "service unavailable, try again later\n")
+}
+
+// Locked responds with 429 if err is mfa lockout, returns false otherwise
+func Locked(e echo.Context, err error) (bool, error) {
+	var locked *mfa.LockedError
+	if !errors.As(err, &locked) {
+		return false, nil
+	}
+
+	retryAfter := max(int(math.Ceil(time.Until(locked.Until).Seconds())), 1)
+	e.Response().Header().Set(echo.HeaderRetryAfter, strconv.Itoa(retryAfter))
+	return true, e.String(http.StatusTooManyRequests, "too many attempts, try again later\n")
+}
+
+// tokenErrors maps token check failures to response codes and stable error codes of the body, the code is also put
+// into WWW-Authenticate header as RFC 6750 suggests. Tokens which can't be parsed or don't make a pair are
+// bad requests, reuse of rotated refresh token conflicts with the rotation, the rest are unauthorized
+var tokenErrors = []struct {
+	err    error
+	status int
+	code   schema.TokenErrorError
+}{
+	{jwt.ErrMalformed, http.StatusBadRequest, schema.MalformedToken},
+	{jwt.ErrPairMismatch, http.StatusBadRequest, schema.TokenPairMismatch},
+	{auth.ErrReused, http.StatusConflict, schema.TokenReused},
+	{jwt.ErrUnknownKey, http.StatusUnauthorized, schema.UnknownKey},
+	{jwt.ErrSignature, http.StatusUnauthorized, schema.InvalidSignature},
+	{jwt.ErrDecryption, http.StatusUnauthorized, schema.DecryptionFailed},
+	{jwt.ErrExpired, http.StatusUnauthorized, schema.TokenExpired},
+	{jwt.ErrNotYetValid, http.StatusUnauthorized, schema.TokenNotYetValid},
+	{jwt.ErrIssuer, http.StatusUnauthorized, schema.InvalidIssuer},
+	{jwt.ErrAudience, http.StatusForbidden, schema.InvalidAudience},
+	{auth.ErrRevoked, http.StatusUnauthorized, schema.TokenRevoked},
+}
+
+// TokenError responds with the code matching token check failure, other errors are internal,
+// like key of unsuitable type, as the token itself wasn't found wrong
+func TokenError(e echo.Context, err error) error {
+	for _, tokenErr := range tokenErrors {
+		if errors.Is(err, tokenErr.err) {
+			return InvalidToken(e, tokenErr.status, tokenErr.code)
+		}
+	}
+	return InternalError(e)
+}
+
+// InvalidToken responds with the status and the code in both WWW-Authenticate header and the body
+func InvalidToken(e echo.Context, status int, code schema.TokenErrorError) error {
+	e.Response().Header().Set(echo.HeaderWWWAuthenticate, fmt.Sprintf(`Bearer error="invalid_token", error_description="%s"`, code))
+	return tokenErrorBody(e, status, code)
+}
+
+// InsufficientScope responds with 403 to token or api key limited to other scopes, as RFC 6750 says.
+// Scope is empty for routes which take only tokens of users who logged in themselves
+func InsufficientScope(e echo.Context, scope string) error {
+	challenge := `Bearer error="insufficient_scope"`
+	if scope != "" {
+		challenge += fmt.Sprintf(`, scope="%s"`, scope)
+	}
+
+	e.Response().Header().Set(echo.HeaderWWWAuthenticate, challenge)
+	return tokenErrorBody(e, http.StatusForbidden, schema.InsufficientScope)
+}
+
+func tokenErrorBody(e echo.Context, status int, code schema.TokenErrorError) error {
+	description := http.StatusText(status)
+	return e.JSON(status, schema.TokenError{Error: code, ErrorDescription: &description})
+}
+
+// OAuthError responds as RFC 6749 section 5.2 says, every error but invalid_client is 400
+func OAuthError(e echo.Context, code schema.OAuthErrorError, description string) error {
+	status := http.StatusBadRequest
+	if code == schema.InvalidClient {
+		status = http.StatusUnauthorized
+	}
+
+	noStore(e)
+	return e.JSON(status, schema.OAuthError{Error: code, ErrorDescription: &description})
+}
+
+// InvalidClient responds to failed client authentication, client which tried HTTP Basic is challenged with it
+func InvalidClient(e echo.Context, basic bool) error {
+	if basic {
+		e.Response().Header().Set(echo.HeaderWWWAuthenticate, `Basic realm="oauth", charset="UTF-8"`)
+	}
+	return OAuthError(e, schema.InvalidClient, "client authentication failed")
+}
+
+// token responses mustn't be cached, RFC 6749 section 5.1
+func noStore(e echo.Context) {
+	e.Response().Header().Set(echo.HeaderCacheControl, "no-store")
+	e.Response().Header().Set("Pragma", "no-cache")
+}
+
 func BadRequest(e echo.Context, reason string) error {
 	return e.String(http.StatusBadRequest, fmt.Sprintf("bad request, reason: %s\n", reason))
 }
+
+func Conflict(e echo.Context, reason string) error {
+	return e.String(http.StatusConflict, fmt.Sprintf("conflict, reason: %s\n", reason))
+}
@@ -0,0 +1,91 @@
+package authapi
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/rinnothing/simple-jwt/internal/api/schema"
+	"github.com/rinnothing/simple-jwt/internal/service/auth"
+	"github.com/rinnothing/simple-jwt/utils/jwt"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTokenError(t *testing.T) {
+	tests := []struct {
+		err    error
+		status int
+		code   schema.TokenErrorError
+	}{
+		{jwt.ErrMalformed, http.StatusBadRequest, schema.MalformedToken},
+		{jwt.ErrPairMismatch, http.StatusBadRequest, schema.TokenPairMismatch},
+		{auth.ErrReused, http.StatusConflict, schema.TokenReused},
+		{jwt.ErrUnknownKey, http.StatusUnauthorized, schema.UnknownKey},
+		{jwt.ErrSignature, http.StatusUnauthorized, schema.InvalidSignature},
+		{jwt.ErrDecryption, http.StatusUnauthorized, schema.DecryptionFailed},
+		{jwt.ErrExpired, http.StatusUnauthorized, schema.TokenExpired},
+		{jwt.ErrNotYetValid, http.StatusUnauthorized, schema.TokenNotYetValid},
+		{jwt.ErrIssuer, http.StatusUnauthorized, schema.InvalidIssuer},
+		{jwt.ErrAudience, http.StatusForbidden, schema.InvalidAudience},
+		{auth.ErrRevoked, http.StatusUnauthorized, schema.TokenRevoked},
+	}
+
+	for _, test := range tests {
+		t.Run(string(test.code), func(t *testing.T) {
+			// errors come wrapped the way auth service wraps them
+			rec := tokenError(t, fmt.Errorf("%w: %w", auth.ErrInvalidTokens, test.err))
+			require.Equal(t, test.status, rec.Code)
+			require.Equal(t, test.code, errorCode(t, rec))
+			require.Contains(t, rec.Header().Get(echo.HeaderWWWAuthenticate), string(test.code))
+		})
+	}
+
+	// failure which isn't about the token itself is internal
+	rec := tokenError(t, fmt.Errorf("%w: %w", auth.ErrInvalidTokens, jwt.ErrWrongKeyType))
+	require.Equal(t, http.StatusInternalServerError, rec.Code)
+	require.Empty(t, rec.Header().Get(echo.HeaderWWWAuthenticate))
+
+	rec = tokenError(t, errors.New("connection refused"))
+	require.Equal(t, http.StatusInternalServerError, rec.Code)
+}
+
+func tokenError(t *testing.T, err error) *httptest.ResponseRecorder {
+	rec, e := recorder()
+	require.NoError(t, TokenError(e, err))
+	return rec
+}
+
+func TestInvalidToken(t *testing.T) {
+	for _, code := range []schema.TokenErrorError{schema.UserAgentMismatch, schema.InvalidApiKey} {
+		t.Run(string(code), func(t *testing.T) {
+			rec, e := recorder()
+			require.NoError(t, InvalidToken(e, http.StatusUnauthorized, code))
+			require.Equal(t, http.StatusUnauthorized, rec.Code)
+			require.Equal(t, code, errorCode(t, rec))
+			require.Contains(t, rec.Header().Get(echo.HeaderWWWAuthenticate), string(code))
+		})
+	}
+}
+
+func TestInsufficientScope(t *testing.T) {
+	rec, e := recorder()
+	require.NoError(t, InsufficientScope(e, "guid:read"))
+	require.Equal(t, http.StatusForbidden, rec.Code)
+	require.Equal(t, schema.InsufficientScope, errorCode(t, rec))
+	require.Contains(t, rec.Header().Get(echo.HeaderWWWAuthenticate), `scope="guid:read"`)
+}
+
+func recorder() (*httptest.ResponseRecorder, echo.Context) {
+	rec := httptest.NewRecorder()
+	return rec, echo.New().NewContext(httptest.NewRequest(http.MethodGet, "/guid", nil), rec)
+}
+
+func errorCode(t *testing.T, rec *httptest.ResponseRecorder) schema.TokenErrorError {
+	var body schema.TokenError
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &body))
+	return body.Error
+}
@@ -0,0 +1,177 @@
+package authapi
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"github.com/rinnothing/simple-jwt/internal/api/schema"
+	"github.com/rinnothing/simple-jwt/internal/service/mfa"
+
+	"go.uber.org/zap"
+)
+
+func (a *APIImpl) VerifyMFA(e echo.Context) error {
+	ctx := e.Request().Context()
+	a.logRequest(e, "verify_mfa")
+
+	var verification schema.MFAVerification
+	err := e.Bind(&verification)
+	if err != nil {
+		a.logger.Error("can't unmarshal request", zap.Error(err))
+		return BadRequest(e, err.Error())
+	}
+
+	code := codeOf(verification.Code, verification.RecoveryCode)
+	if verification.MfaToken == "" || code == (mfa.Code{}) {
+		return BadRequest(e, "mfa_token and either code or recovery_code are required")
+	}
+
+	uuid, authn, err := a.mfa.Verify(ctx, verification.MfaToken, code)
+	if locked, respErr := Locked(e, err); locked {
+		a.logger.Info("mfa locked out", zap.Error(err))
+		return respErr
+	}
+	if errors.Is(err, mfa.ErrInvalidCode) || errors.Is(err, mfa.ErrInvalidChallenge) || errors.Is(err, mfa.ErrNotEnabled) {
+		a.logger.Info("mfa denied", zap.Error(err))
+		return Unauthorized(e)
+	}
+	if err != nil {
+		a.logger.Error("can't verify mfa", zap.Error(err))
+		return InternalError(e)
+	}
+
+	return a.issueTokens(e, uuid, authn)
+}
+
+func (a *APIImpl) EnrollTOTP(e echo.Context, params schema.EnrollTOTPParams) error {
+	ctx := e.Request().Context()
+	a.logRequest(e, "enroll_totp", credentialField(params.AccessToken))
+
+	authorized, err := a.tryAuthorize(e, params.AccessToken)
+	if !authorized {
+		return err
+	}
+
+	uuid, err := a.auth.GetUUID(ctx, params.AccessToken)
+	if err != nil {
+		a.logger.Error("can't get uuid from access token", zap.Error(err))
+		return InternalError(e)
+	}
+
+	guid, err := a.storage.GetGUID(ctx, uuid)
+	if err != nil {
+		a.logger.Error("can't get guid from storage", zap.Error(err))
+		return InternalError(e)
+	}
+
+	enrollment, err := a.mfa.Enroll(ctx, uuid, guid)
+	if errors.Is(err, mfa.ErrAlreadyEnabled) {
+		return Conflict(e, err.Error())
+	}
+	if err != nil {
+		a.logger.Error("can't enroll totp", zap.Error(err))
+		return InternalError(e)
+	}
+
+	return e.JSON(http.StatusCreated, schema.TOTPEnrollment{
+		Secret: enrollment.Secret,
+		Uri:    enrollment.URI,
+	})
+}
+
+func (a *APIImpl) ConfirmTOTP(e echo.Context, params schema.ConfirmTOTPParams) error {
+	ctx := e.Request().Context()
+	a.logRequest(e, "confirm_totp", credentialField(params.AccessToken))
+
+	authorized, err := a.tryAuthorize(e, params.AccessToken)
+	if !authorized {
+		return err
+	}
+
+	var body schema.MFACode
+	err = e.Bind(&body)
+	if err != nil {
+		a.logger.Error("can't unmarshal request", zap.Error(err))
+		return BadRequest(e, err.Error())
+	}
+	if body.Code == nil {
+		return BadRequest(e, "code is required")
+	}
+
+	uuid, err := a.auth.GetUUID(ctx, params.AccessToken)
+	if err != nil {
+		a.logger.Error("can't get uuid from access token", zap.Error(err))
+		return InternalError(e)
+	}
+
+	codes, err := a.mfa.Confirm(ctx, uuid, *body.Code)
+	if errors.Is(err, mfa.ErrInvalidCode) {
+		return BadRequest(e, err.Error())
+	}
+	if errors.Is(err, mfa.ErrNotEnrolled) || errors.Is(err, mfa.ErrAlreadyEnabled) {
+		return Conflict(e, err.Error())
+	}
+	if err != nil {
+		a.logger.Error("can't confirm totp", zap.Error(err))
+		return InternalError(e)
+	}
+
+	return e.JSON(http.StatusOK, schema.RecoveryCodes{RecoveryCodes: codes})
+}
+
+func (a *APIImpl) DisableTOTP(e echo.Context, params schema.DisableTOTPParams) error {
+	ctx := e.Request().Context()
+	a.logRequest(e, "disable_totp", credentialField(params.AccessToken))
+
+	authorized, err := a.tryAuthorize(e, params.AccessToken)
+	if !authorized {
+		return err
+	}
+
+	var body schema.MFACode
+	err = e.Bind(&body)
+	if err != nil {
+		a.logger.Error("can't unmarshal request", zap.Error(err))
+		return BadRequest(e, err.Error())
+	}
+	code := codeOf(body.Code, body.RecoveryCode)
+	if code == (mfa.Code{}) {
+		return BadRequest(e, "either code or recovery_code is required")
+	}
+
+	uuid, err := a.auth.GetUUID(ctx, params.AccessToken)
+	if err != nil {
+		a.logger.Error("can't get uuid from access token", zap.Error(err))
+		return InternalError(e)
+	}
+
+	err = a.mfa.Disable(ctx, uuid, code)
+	if locked, respErr := Locked(e, err); locked {
+		a.logger.Info("mfa locked out", zap.Error(err))
+		return respErr
+	}
+	if errors.Is(err, mfa.ErrInvalidCode) {
+		return BadRequest(e, err.Error())
+	}
+	if errors.Is(err, mfa.ErrNotEnabled) {
+		return Conflict(e, err.Error())
+	}
+	if err != nil {
+		a.logger.Error("can't disable totp", zap.Error(err))
+		return InternalError(e)
+	}
+
+	return e.NoContent(http.StatusOK)
+}
+
+func codeOf(code, recovery *string) mfa.Code {
+	var result mfa.Code
+	if code != nil {
+		result.TOTP = *code
+	}
+	if recovery != nil {
+		result.Recovery = *recovery
+	}
+	return result
+}
@@ -0,0 +1,194 @@
+package authapi
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+	"github.com/rinnothing/simple-jwt/internal/api/schema"
+	"github.com/rinnothing/simple-jwt/internal/repository/postgres"
+	"github.com/rinnothing/simple-jwt/internal/service/auth"
+	"github.com/rinnothing/simple-jwt/internal/service/oauth"
+
+	"go.uber.org/zap"
+)
+
+// OAuthToken is token endpoint of RFC 6749, unlike the rest of api it takes form and answers with oauth errors
+func (a *APIImpl) OAuthToken(e echo.Context) error {
+	ctx := e.Request().Context()
+
+	form, err := tokenForm(e)
+	if err != nil {
+		a.logRequest(e, "oauth_token")
+		return OAuthError(e, schema.InvalidRequest, err.Error())
+	}
+	grantType := form.Get("grant_type")
+	clientID, secret, basic, err := clientCredentials(e, form)
+	a.logRequest(e, "oauth_token", zap.String("grant_type", grantType), zap.String("client_id", clientID))
+	if err != nil {
+		return OAuthError(e, schema.InvalidRequest, err.Error())
+	}
+
+	if grantType == "" {
+		return OAuthError(e, schema.InvalidRequest, "grant_type is required")
+	}
+	if grantType != oauth.GrantClientCredentials && grantType != oauth.GrantRefreshToken {
+		return OAuthError(e, schema.UnsupportedGrantType, "supported grants are client_credentials and refresh_token")
+	}
+
+	client, err := a.oauth.Authenticate(ctx, clientID, secret)
+	if errors.Is(err, oauth.ErrInvalidClient) {
+		a.logger.Info("oauth client denied", zap.String("client_id", clientID))
+		return InvalidClient(e, basic)
+	}
+	if err != nil {
+		a.logger.Error("can't authenticate oauth client", zap.Error(err))
+		return InternalError(e)
+	}
+
+	if grantType == oauth.GrantRefreshToken {
+		return a.refreshGrant(e, client, form)
+	}
+
+	scopes, err := a.oauth.Grant(client, form.Get("scope"))
+	if errors.Is(err, oauth.ErrInvalidScope) {
+		return OAuthError(e, schema.InvalidScope, err.Error())
+	}
+	if err != nil {
+		a.logger.Error("can't grant scopes", zap.Error(err))
+		return InternalError(e)
+	}
+
+	claims := map[string]any{
+		auth.ScopeClaim:     strings.Join(scopes, " "),
+		oauth.ClientIDClaim: client.ID,
+	}
+	// RFC 6749 section 4.4.3, refresh token is given only to clients which are allowed to refresh
+	pair, err := a.auth.IssueClientTokens(ctx, client.UUID, client.ID, claims, client.Refresh, e.Request().UserAgent(), e.RealIP())
+	if overloaded, respErr := Overloaded(e, err); overloaded {
+		a.logger.Warn("issuing tokens rejected", zap.Error(err))
+		return respErr
+	}
+	if err != nil {
+		a.logger.Error("can't issue tokens", zap.Error(err))
+		return InternalError(e)
+	}
+
+	return a.oauthToken(e, pair, scopes)
+}
+
+// refreshGrant rotates pair inside of oauth refresh token, so reuse of rotated one revokes the session as on /refresh
+func (a *APIImpl) refreshGrant(e echo.Context, client oauth.Client, form url.Values) error {
+	ctx := e.Request().Context()
+	if !client.Refresh {
+		return OAuthError(e, schema.UnauthorizedClient, oauth.ErrUnauthorized.Error())
+	}
+	if form.Get("refresh_token") == "" {
+		return OAuthError(e, schema.InvalidRequest, "refresh_token is required")
+	}
+
+	pair, err := a.auth.OpenClientRefresh(form.Get("refresh_token"))
+	if errors.Is(err, auth.ErrInvalidTokens) {
+		a.logger.Info("oauth refresh denied", zap.String("client_id", client.ID), zap.Error(err))
+		return OAuthError(e, schema.InvalidGrant, oauth.ErrInvalidGrant.Error())
+	}
+	if err != nil {
+		a.logger.Error("can't open oauth refresh token", zap.Error(err))
+		return InternalError(e)
+	}
+
+	// pair isn't checked yet, but forged claims fail the refresh, and the pair isn't rotated before
+	// it's known to be issued to the client
+	claims, err := a.auth.Claims(ctx, *pair.AccessToken)
+	if err != nil || claims[oauth.ClientIDClaim] != client.ID {
+		a.logger.Info("oauth refresh denied", zap.String("client_id", client.ID), zap.Error(err))
+		return OAuthError(e, schema.InvalidGrant, oauth.ErrInvalidGrant.Error())
+	}
+
+	// rotation keeps claims, so scope can't be narrowed on refresh
+	granted, _ := claims[auth.ScopeClaim].(string)
+	scopes := strings.Fields(granted)
+	if requested := strings.Fields(form.Get("scope")); len(requested) != 0 &&
+		!slices.Equal(slices.Compact(slices.Sorted(slices.Values(requested))), scopes) {
+		return OAuthError(e, schema.InvalidScope, "scope on refresh must be the same as granted")
+	}
+
+	newPair, err := a.auth.RefreshTokens(ctx, pair, e.Request().UserAgent(), e.RealIP())
+	if errors.Is(err, auth.ErrInvalidTokens) || errors.Is(err, postgres.ErrWrongUserAgent) {
+		a.logger.Info("oauth refresh denied", zap.String("client_id", client.ID), zap.Error(err))
+		return OAuthError(e, schema.InvalidGrant, oauth.ErrInvalidGrant.Error())
+	}
+	if overloaded, respErr := Overloaded(e, err); overloaded {
+		a.logger.Warn("refresh rejected", zap.Error(err))
+		return respErr
+	}
+	if err != nil {
+		a.logger.Error("can't refresh tokens", zap.Error(err))
+		return InternalError(e)
+	}
+
+	return a.oauthToken(e, newPair, scopes)
+}
+
+func (a *APIImpl) oauthToken(e echo.Context, pair schema.TokenPair, scopes []string) error {
+	res := schema.OAuthToken{
+		AccessToken: *pair.AccessToken,
+		TokenType:   "Bearer",
+		ExpiresIn:   int(a.auth.AccessLifetime().Seconds()),
+		Scope:       strings.Join(scopes, " "),
+	}
+	if pair.RefreshToken != nil {
+		refresh, err := a.auth.SealClientRefresh(pair)
+		if err != nil {
+			a.logger.Error("can't encode refresh token", zap.Error(err))
+			return InternalError(e)
+		}
+		res.RefreshToken = &refresh
+	}
+
+	noStore(e)
+	return e.JSON(http.StatusOK, res)
+}
+
+// tokenForm returns parameters of token request, RFC 6749 section 3.2 allows each of them only once
+func tokenForm(e echo.Context) (url.Values, error) {
+	mediaType, _, _ := strings.Cut(e.Request().Header.Get(echo.HeaderContentType), ";")
+	if strings.TrimSpace(mediaType) != echo.MIMEApplicationForm {
+		return nil, errors.New("request must be application/x-www-form-urlencoded")
+	}
+
+	err := e.Request().ParseForm()
+	if err != nil {
+		return nil, errors.New("request body isn't a valid form")
+	}
+
+	form := e.Request().PostForm
+	for name, values := range form {
+		if len(values) > 1 {
+			return nil, errors.New(name + " is repeated")
+		}
+	}
+	return form, nil
+}
+
+// clientCredentials returns client id and secret from HTTP Basic or from the form, basic is true for the former.
+// RFC 6749 section 2.3.1 says both are form-urlencoded before put into Basic, and only one method may be used
+func clientCredentials(e echo.Context, form url.Values) (string, string, bool, error) {
+	id, secret, basic := e.Request().BasicAuth()
+	if !basic {
+		return form.Get("client_id"), form.Get("client_secret"), false, nil
+	}
+
+	id, idErr := url.QueryUnescape(id)
+	secret, secretErr := url.QueryUnescape(secret)
+	if idErr != nil || secretErr != nil {
+		return "", "", true, errors.New("client credentials in Authorization header aren't form-urlencoded")
+	}
+	if form.Has("client_secret") || (form.Has("client_id") && form.Get("client_id") != id) {
+		return id, "", true, errors.New("only one client authentication method may be used")
+	}
+	return id, secret, true, nil
+}
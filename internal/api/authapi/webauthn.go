@@ -0,0 +1,139 @@
+package authapi
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"github.com/rinnothing/simple-jwt/internal/api/schema"
+	"github.com/rinnothing/simple-jwt/internal/service/passkey"
+	"github.com/rinnothing/simple-jwt/utils/webauthn"
+
+	"go.uber.org/zap"
+)
+
+func (a *APIImpl) BeginWebAuthnRegistration(e echo.Context, params schema.BeginWebAuthnRegistrationParams) error {
+	ctx := e.Request().Context()
+	a.logRequest(e, "begin_webauthn_registration", credentialField(params.AccessToken))
+
+	authorized, err := a.tryAuthorize(e, params.AccessToken)
+	if !authorized {
+		return err
+	}
+
+	uuid, err := a.auth.GetUUID(ctx, params.AccessToken)
+	if err != nil {
+		a.logger.Error("can't get uuid from access token", zap.Error(err))
+		return InternalError(e)
+	}
+
+	guid, err := a.storage.GetGUID(ctx, uuid)
+	if err != nil {
+		a.logger.Error("can't get guid from storage", zap.Error(err))
+		return InternalError(e)
+	}
+
+	options, err := a.passkey.BeginRegistration(ctx, uuid, guid)
+	if errors.Is(err, passkey.ErrDisabled) {
+		return NotFound(e)
+	}
+	if err != nil {
+		a.logger.Error("can't begin webauthn registration", zap.Error(err))
+		return InternalError(e)
+	}
+
+	return e.JSON(http.StatusOK, options)
+}
+
+func (a *APIImpl) FinishWebAuthnRegistration(e echo.Context, params schema.FinishWebAuthnRegistrationParams) error {
+	ctx := e.Request().Context()
+	a.logRequest(e, "finish_webauthn_registration", credentialField(params.AccessToken))
+
+	authorized, err := a.tryAuthorize(e, params.AccessToken)
+	if !authorized {
+		return err
+	}
+
+	var credential webauthn.Credential
+	err = e.Bind(&credential)
+	if err != nil {
+		a.logger.Error("can't unmarshal request", zap.Error(err))
+		return BadRequest(e, err.Error())
+	}
+
+	uuid, err := a.auth.GetUUID(ctx, params.AccessToken)
+	if err != nil {
+		a.logger.Error("can't get uuid from access token", zap.Error(err))
+		return InternalError(e)
+	}
+
+	err = a.passkey.FinishRegistration(ctx, uuid, credential)
+	if errors.Is(err, passkey.ErrDisabled) {
+		return NotFound(e)
+	}
+	if errors.Is(err, passkey.ErrInvalidCredential) || errors.Is(err, passkey.ErrInvalidChallenge) {
+		a.logger.Info("webauthn registration denied", zap.Error(err))
+		return BadRequest(e, err.Error())
+	}
+	if errors.Is(err, passkey.ErrCredentialExists) {
+		return Conflict(e, err.Error())
+	}
+	if err != nil {
+		a.logger.Error("can't finish webauthn registration", zap.Error(err))
+		return InternalError(e)
+	}
+
+	return e.NoContent(http.StatusCreated)
+}
+
+func (a *APIImpl) BeginWebAuthnLogin(e echo.Context, params schema.BeginWebAuthnLoginParams) error {
+	ctx := e.Request().Context()
+
+	var guid schema.GUID
+	if params.Guid != nil {
+		guid = *params.Guid
+	}
+	a.logRequest(e, "begin_webauthn_login", zap.String("guid", guid))
+
+	options, err := a.passkey.BeginLogin(ctx, guid)
+	if errors.Is(err, passkey.ErrDisabled) {
+		return NotFound(e)
+	}
+	if err != nil {
+		a.logger.Error("can't begin webauthn login", zap.Error(err))
+		return InternalError(e)
+	}
+
+	return e.JSON(http.StatusOK, options)
+}
+
+func (a *APIImpl) FinishWebAuthnLogin(e echo.Context) error {
+	ctx := e.Request().Context()
+	a.logRequest(e, "finish_webauthn_login")
+
+	var credential webauthn.Credential
+	err := e.Bind(&credential)
+	if err != nil {
+		a.logger.Error("can't unmarshal request", zap.Error(err))
+		return BadRequest(e, err.Error())
+	}
+
+	uuid, authn, err := a.passkey.FinishLogin(ctx, credential)
+	if errors.Is(err, passkey.ErrDisabled) {
+		return NotFound(e)
+	}
+	if errors.Is(err, webauthn.ErrMalformed) {
+		return BadRequest(e, err.Error())
+	}
+	if errors.Is(err, passkey.ErrInvalidCredential) || errors.Is(err, passkey.ErrInvalidChallenge) ||
+		errors.Is(err, passkey.ErrUnknownCredential) || errors.Is(err, passkey.ErrCloned) {
+		a.logger.Info("webauthn login denied", zap.Error(err))
+		return Unauthorized(e)
+	}
+	if err != nil {
+		a.logger.Error("can't finish webauthn login", zap.Error(err))
+		return InternalError(e)
+	}
+
+	return a.login(e, uuid, authn)
+}
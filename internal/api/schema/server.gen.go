@@ -13,18 +13,72 @@ import (
 
 // ServerInterface represents all server handlers.
 type ServerInterface interface {
+	// Get public keys which can be used to verify access tokens
+	// (GET /.well-known/jwks.json)
+	GetJWKS(ctx echo.Context) error
+	// List api keys of the user, keys themselves are never shown again
+	// (GET /apikeys)
+	ListAPIKeys(ctx echo.Context, params ListAPIKeysParams) error
+	// Make api key for scripts and ci jobs
+	// (POST /apikeys)
+	CreateAPIKey(ctx echo.Context, params CreateAPIKeyParams) error
+	// Exchange api key for access token limited to the key scopes, no refresh token is given, exchange the key again instead
+	// (POST /apikeys/token)
+	ExchangeAPIKey(ctx echo.Context, params ExchangeAPIKeyParams) error
+	// Revoke the api key, tokens it was exchanged for stop working too
+	// (DELETE /apikeys/{key_id})
+	RevokeAPIKey(ctx echo.Context, keyId string, params RevokeAPIKeyParams) error
+	// Change label of the api key
+	// (PATCH /apikeys/{key_id})
+	LabelAPIKey(ctx echo.Context, keyId string, params LabelAPIKeyParams) error
+	// Second step of login of users with mfa, issues tokens for the challenge and a code
+	// (POST /auth/mfa)
+	VerifyMFA(ctx echo.Context) error
 	// Issues a pair of access and refresh tokens for given guid
 	// (GET /auth/{guid})
 	AuthorizeGUID(ctx echo.Context, guid string) error
 	// Get user GUID by the access token
 	// (GET /get)
 	GetGUID(ctx echo.Context, params GetGUIDParams) error
+	// Start totp enrolment, it takes effect once confirmed with a code
+	// (POST /mfa/totp)
+	EnrollTOTP(ctx echo.Context, params EnrollTOTPParams) error
+	// Confirm totp enrolment with a code from authenticator app, enables mfa
+	// (POST /mfa/totp/confirm)
+	ConfirmTOTP(ctx echo.Context, params ConfirmTOTPParams) error
+	// Disable mfa, it takes a code or a recovery code
+	// (POST /mfa/totp/disable)
+	DisableTOTP(ctx echo.Context, params DisableTOTPParams) error
+	// OAuth 2.0 token endpoint of RFC 6749 for registered confidential clients
+	// (POST /oauth/token)
+	OAuthToken(ctx echo.Context) error
 	// Update a pair of access and refresh tokens
 	// (POST /refresh)
 	RefreshTokens(ctx echo.Context) error
-	// Unauthorize user by access token
+	// List active sessions of the user access token belongs to, sessions of tokens exchanged for api keys aren't listed
+	// (GET /sessions)
+	ListSessions(ctx echo.Context, params ListSessionsParams) error
+	// End all sessions of the user except the one access token belongs to
+	// (POST /sessions/revoke_others)
+	RevokeOtherSessions(ctx echo.Context, params RevokeOtherSessionsParams) error
+	// End one of the user's sessions
+	// (DELETE /sessions/{session_id})
+	RevokeSession(ctx echo.Context, sessionId string, params RevokeSessionParams) error
+	// End the session of access token, or all sessions of its user
 	// (POST /unauthorize)
 	Unauthorize(ctx echo.Context, params UnauthorizeParams) error
+	// Start passkey login, options are passed to navigator.credentials.get()
+	// (POST /webauthn/login/begin)
+	BeginWebAuthnLogin(ctx echo.Context, params BeginWebAuthnLoginParams) error
+	// Issue tokens for the passkey assertion
+	// (POST /webauthn/login/finish)
+	FinishWebAuthnLogin(ctx echo.Context) error
+	// Start adding a passkey to the user, options are passed to navigator.credentials.create()
+	// (POST /webauthn/register/begin)
+	BeginWebAuthnRegistration(ctx echo.Context, params BeginWebAuthnRegistrationParams) error
+	// Store the passkey made for the registration challenge
+	// (POST /webauthn/register/finish)
+	FinishWebAuthnRegistration(ctx echo.Context, params FinishWebAuthnRegistrationParams) error
 }
 
 // ServerInterfaceWrapper converts echo contexts to parameters.
@@ -32,6 +86,193 @@ type ServerInterfaceWrapper struct {
 	Handler ServerInterface
 }
 
+// GetJWKS converts echo context to params.
+func (w *ServerInterfaceWrapper) GetJWKS(ctx echo.Context) error {
+	var err error
+
+	// Invoke the callback with all the unmarshaled arguments
+	err = w.Handler.GetJWKS(ctx)
+	return err
+}
+
+// ListAPIKeys converts echo context to params.
+func (w *ServerInterfaceWrapper) ListAPIKeys(ctx echo.Context) error {
+	var err error
+
+	// Parameter object where we will unmarshal all parameters from the context
+	var params ListAPIKeysParams
+
+	headers := ctx.Request().Header
+	// ------------- Required header parameter "access_token" -------------
+	if valueList, found := headers[http.CanonicalHeaderKey("access_token")]; found {
+		var AccessToken string
+		n := len(valueList)
+		if n != 1 {
+			return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Expected one value for access_token, got %d", n))
+		}
+
+		err = runtime.BindStyledParameterWithOptions("simple", "access_token", valueList[0], &AccessToken, runtime.BindStyledParameterOptions{ParamLocation: runtime.ParamLocationHeader, Explode: false, Required: true})
+		if err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Invalid format for parameter access_token: %s", err))
+		}
+
+		params.AccessToken = AccessToken
+	} else {
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Header parameter access_token is required, but not found"))
+	}
+
+	// Invoke the callback with all the unmarshaled arguments
+	err = w.Handler.ListAPIKeys(ctx, params)
+	return err
+}
+
+// CreateAPIKey converts echo context to params.
+func (w *ServerInterfaceWrapper) CreateAPIKey(ctx echo.Context) error {
+	var err error
+
+	// Parameter object where we will unmarshal all parameters from the context
+	var params CreateAPIKeyParams
+
+	headers := ctx.Request().Header
+	// ------------- Required header parameter "access_token" -------------
+	if valueList, found := headers[http.CanonicalHeaderKey("access_token")]; found {
+		var AccessToken string
+		n := len(valueList)
+		if n != 1 {
+			return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Expected one value for access_token, got %d", n))
+		}
+
+		err = runtime.BindStyledParameterWithOptions("simple", "access_token", valueList[0], &AccessToken, runtime.BindStyledParameterOptions{ParamLocation: runtime.ParamLocationHeader, Explode: false, Required: true})
+		if err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Invalid format for parameter access_token: %s", err))
+		}
+
+		params.AccessToken = AccessToken
+	} else {
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Header parameter access_token is required, but not found"))
+	}
+
+	// Invoke the callback with all the unmarshaled arguments
+	err = w.Handler.CreateAPIKey(ctx, params)
+	return err
+}
+
+// ExchangeAPIKey converts echo context to params.
+func (w *ServerInterfaceWrapper) ExchangeAPIKey(ctx echo.Context) error {
+	var err error
+
+	// Parameter object where we will unmarshal all parameters from the context
+	var params ExchangeAPIKeyParams
+
+	headers := ctx.Request().Header
+	// ------------- Required header parameter "api_key" -------------
+	if valueList, found := headers[http.CanonicalHeaderKey("api_key")]; found {
+		var ApiKey string
+		n := len(valueList)
+		if n != 1 {
+			return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Expected one value for api_key, got %d", n))
+		}
+
+		err = runtime.BindStyledParameterWithOptions("simple", "api_key", valueList[0], &ApiKey, runtime.BindStyledParameterOptions{ParamLocation: runtime.ParamLocationHeader, Explode: false, Required: true})
+		if err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Invalid format for parameter api_key: %s", err))
+		}
+
+		params.ApiKey = ApiKey
+	} else {
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Header parameter api_key is required, but not found"))
+	}
+
+	// Invoke the callback with all the unmarshaled arguments
+	err = w.Handler.ExchangeAPIKey(ctx, params)
+	return err
+}
+
+// RevokeAPIKey converts echo context to params.
+func (w *ServerInterfaceWrapper) RevokeAPIKey(ctx echo.Context) error {
+	var err error
+	// ------------- Path parameter "key_id" -------------
+	var keyId string
+
+	err = runtime.BindStyledParameterWithOptions("simple", "key_id", ctx.Param("key_id"), &keyId, runtime.BindStyledParameterOptions{ParamLocation: runtime.ParamLocationPath, Explode: false, Required: true})
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Invalid format for parameter key_id: %s", err))
+	}
+
+	// Parameter object where we will unmarshal all parameters from the context
+	var params RevokeAPIKeyParams
+
+	headers := ctx.Request().Header
+	// ------------- Required header parameter "access_token" -------------
+	if valueList, found := headers[http.CanonicalHeaderKey("access_token")]; found {
+		var AccessToken string
+		n := len(valueList)
+		if n != 1 {
+			return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Expected one value for access_token, got %d", n))
+		}
+
+		err = runtime.BindStyledParameterWithOptions("simple", "access_token", valueList[0], &AccessToken, runtime.BindStyledParameterOptions{ParamLocation: runtime.ParamLocationHeader, Explode: false, Required: true})
+		if err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Invalid format for parameter access_token: %s", err))
+		}
+
+		params.AccessToken = AccessToken
+	} else {
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Header parameter access_token is required, but not found"))
+	}
+
+	// Invoke the callback with all the unmarshaled arguments
+	err = w.Handler.RevokeAPIKey(ctx, keyId, params)
+	return err
+}
+
+// LabelAPIKey converts echo context to params.
+func (w *ServerInterfaceWrapper) LabelAPIKey(ctx echo.Context) error {
+	var err error
+	// ------------- Path parameter "key_id" -------------
+	var keyId string
+
+	err = runtime.BindStyledParameterWithOptions("simple", "key_id", ctx.Param("key_id"), &keyId, runtime.BindStyledParameterOptions{ParamLocation: runtime.ParamLocationPath, Explode: false, Required: true})
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Invalid format for parameter key_id: %s", err))
+	}
+
+	// Parameter object where we will unmarshal all parameters from the context
+	var params LabelAPIKeyParams
+
+	headers := ctx.Request().Header
+	// ------------- Required header parameter "access_token" -------------
+	if valueList, found := headers[http.CanonicalHeaderKey("access_token")]; found {
+		var AccessToken string
+		n := len(valueList)
+		if n != 1 {
+			return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Expected one value for access_token, got %d", n))
+		}
+
+		err = runtime.BindStyledParameterWithOptions("simple", "access_token", valueList[0], &AccessToken, runtime.BindStyledParameterOptions{ParamLocation: runtime.ParamLocationHeader, Explode: false, Required: true})
+		if err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Invalid format for parameter access_token: %s", err))
+		}
+
+		params.AccessToken = AccessToken
+	} else {
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Header parameter access_token is required, but not found"))
+	}
+
+	// Invoke the callback with all the unmarshaled arguments
+	err = w.Handler.LabelAPIKey(ctx, keyId, params)
+	return err
+}
+
+// VerifyMFA converts echo context to params.
+func (w *ServerInterfaceWrapper) VerifyMFA(ctx echo.Context) error {
+	var err error
+
+	// Invoke the callback with all the unmarshaled arguments
+	err = w.Handler.VerifyMFA(ctx)
+	return err
+}
+
 // AuthorizeGUID converts echo context to params.
 func (w *ServerInterfaceWrapper) AuthorizeGUID(ctx echo.Context) error {
 	var err error
@@ -79,6 +320,108 @@ func (w *ServerInterfaceWrapper) GetGUID(ctx echo.Context) error {
 	return err
 }
 
+// EnrollTOTP converts echo context to params.
+func (w *ServerInterfaceWrapper) EnrollTOTP(ctx echo.Context) error {
+	var err error
+
+	// Parameter object where we will unmarshal all parameters from the context
+	var params EnrollTOTPParams
+
+	headers := ctx.Request().Header
+	// ------------- Required header parameter "access_token" -------------
+	if valueList, found := headers[http.CanonicalHeaderKey("access_token")]; found {
+		var AccessToken string
+		n := len(valueList)
+		if n != 1 {
+			return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Expected one value for access_token, got %d", n))
+		}
+
+		err = runtime.BindStyledParameterWithOptions("simple", "access_token", valueList[0], &AccessToken, runtime.BindStyledParameterOptions{ParamLocation: runtime.ParamLocationHeader, Explode: false, Required: true})
+		if err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Invalid format for parameter access_token: %s", err))
+		}
+
+		params.AccessToken = AccessToken
+	} else {
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Header parameter access_token is required, but not found"))
+	}
+
+	// Invoke the callback with all the unmarshaled arguments
+	err = w.Handler.EnrollTOTP(ctx, params)
+	return err
+}
+
+// ConfirmTOTP converts echo context to params.
+func (w *ServerInterfaceWrapper) ConfirmTOTP(ctx echo.Context) error {
+	var err error
+
+	// Parameter object where we will unmarshal all parameters from the context
+	var params ConfirmTOTPParams
+
+	headers := ctx.Request().Header
+	// ------------- Required header parameter "access_token" -------------
+	if valueList, found := headers[http.CanonicalHeaderKey("access_token")]; found {
+		var AccessToken string
+		n := len(valueList)
+		if n != 1 {
+			return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Expected one value for access_token, got %d", n))
+		}
+
+		err = runtime.BindStyledParameterWithOptions("simple", "access_token", valueList[0], &AccessToken, runtime.BindStyledParameterOptions{ParamLocation: runtime.ParamLocationHeader, Explode: false, Required: true})
+		if err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Invalid format for parameter access_token: %s", err))
+		}
+
+		params.AccessToken = AccessToken
+	} else {
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Header parameter access_token is required, but not found"))
+	}
+
+	// Invoke the callback with all the unmarshaled arguments
+	err = w.Handler.ConfirmTOTP(ctx, params)
+	return err
+}
+
+// DisableTOTP converts echo context to params.
+func (w *ServerInterfaceWrapper) DisableTOTP(ctx echo.Context) error {
+	var err error
+
+	// Parameter object where we will unmarshal all parameters from the context
+	var params DisableTOTPParams
+
+	headers := ctx.Request().Header
+	// ------------- Required header parameter "access_token" -------------
+	if valueList, found := headers[http.CanonicalHeaderKey("access_token")]; found {
+		var AccessToken string
+		n := len(valueList)
+		if n != 1 {
+			return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Expected one value for access_token, got %d", n))
+		}
+
+		err = runtime.BindStyledParameterWithOptions("simple", "access_token", valueList[0], &AccessToken, runtime.BindStyledParameterOptions{ParamLocation: runtime.ParamLocationHeader, Explode: false, Required: true})
+		if err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Invalid format for parameter access_token: %s", err))
+		}
+
+		params.AccessToken = AccessToken
+	} else {
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Header parameter access_token is required, but not found"))
+	}
+
+	// Invoke the callback with all the unmarshaled arguments
+	err = w.Handler.DisableTOTP(ctx, params)
+	return err
+}
+
+// OAuthToken converts echo context to params.
+func (w *ServerInterfaceWrapper) OAuthToken(ctx echo.Context) error {
+	var err error
+
+	// Invoke the callback with all the unmarshaled arguments
+	err = w.Handler.OAuthToken(ctx)
+	return err
+}
+
 // RefreshTokens converts echo context to params.
 func (w *ServerInterfaceWrapper) RefreshTokens(ctx echo.Context) error {
 	var err error
@@ -88,12 +431,118 @@ func (w *ServerInterfaceWrapper) RefreshTokens(ctx echo.Context) error {
 	return err
 }
 
+// ListSessions converts echo context to params.
+func (w *ServerInterfaceWrapper) ListSessions(ctx echo.Context) error {
+	var err error
+
+	// Parameter object where we will unmarshal all parameters from the context
+	var params ListSessionsParams
+
+	headers := ctx.Request().Header
+	// ------------- Required header parameter "access_token" -------------
+	if valueList, found := headers[http.CanonicalHeaderKey("access_token")]; found {
+		var AccessToken string
+		n := len(valueList)
+		if n != 1 {
+			return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Expected one value for access_token, got %d", n))
+		}
+
+		err = runtime.BindStyledParameterWithOptions("simple", "access_token", valueList[0], &AccessToken, runtime.BindStyledParameterOptions{ParamLocation: runtime.ParamLocationHeader, Explode: false, Required: true})
+		if err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Invalid format for parameter access_token: %s", err))
+		}
+
+		params.AccessToken = AccessToken
+	} else {
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Header parameter access_token is required, but not found"))
+	}
+
+	// Invoke the callback with all the unmarshaled arguments
+	err = w.Handler.ListSessions(ctx, params)
+	return err
+}
+
+// RevokeOtherSessions converts echo context to params.
+func (w *ServerInterfaceWrapper) RevokeOtherSessions(ctx echo.Context) error {
+	var err error
+
+	// Parameter object where we will unmarshal all parameters from the context
+	var params RevokeOtherSessionsParams
+
+	headers := ctx.Request().Header
+	// ------------- Required header parameter "access_token" -------------
+	if valueList, found := headers[http.CanonicalHeaderKey("access_token")]; found {
+		var AccessToken string
+		n := len(valueList)
+		if n != 1 {
+			return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Expected one value for access_token, got %d", n))
+		}
+
+		err = runtime.BindStyledParameterWithOptions("simple", "access_token", valueList[0], &AccessToken, runtime.BindStyledParameterOptions{ParamLocation: runtime.ParamLocationHeader, Explode: false, Required: true})
+		if err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Invalid format for parameter access_token: %s", err))
+		}
+
+		params.AccessToken = AccessToken
+	} else {
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Header parameter access_token is required, but not found"))
+	}
+
+	// Invoke the callback with all the unmarshaled arguments
+	err = w.Handler.RevokeOtherSessions(ctx, params)
+	return err
+}
+
+// RevokeSession converts echo context to params.
+func (w *ServerInterfaceWrapper) RevokeSession(ctx echo.Context) error {
+	var err error
+	// ------------- Path parameter "session_id" -------------
+	var sessionId string
+
+	err = runtime.BindStyledParameterWithOptions("simple", "session_id", ctx.Param("session_id"), &sessionId, runtime.BindStyledParameterOptions{ParamLocation: runtime.ParamLocationPath, Explode: false, Required: true})
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Invalid format for parameter session_id: %s", err))
+	}
+
+	// Parameter object where we will unmarshal all parameters from the context
+	var params RevokeSessionParams
+
+	headers := ctx.Request().Header
+	// ------------- Required header parameter "access_token" -------------
+	if valueList, found := headers[http.CanonicalHeaderKey("access_token")]; found {
+		var AccessToken string
+		n := len(valueList)
+		if n != 1 {
+			return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Expected one value for access_token, got %d", n))
+		}
+
+		err = runtime.BindStyledParameterWithOptions("simple", "access_token", valueList[0], &AccessToken, runtime.BindStyledParameterOptions{ParamLocation: runtime.ParamLocationHeader, Explode: false, Required: true})
+		if err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Invalid format for parameter access_token: %s", err))
+		}
+
+		params.AccessToken = AccessToken
+	} else {
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Header parameter access_token is required, but not found"))
+	}
+
+	// Invoke the callback with all the unmarshaled arguments
+	err = w.Handler.RevokeSession(ctx, sessionId, params)
+	return err
+}
+
 // Unauthorize converts echo context to params.
 func (w *ServerInterfaceWrapper) Unauthorize(ctx echo.Context) error {
 	var err error
 
 	// Parameter object where we will unmarshal all parameters from the context
 	var params UnauthorizeParams
+	// ------------- Optional query parameter "all" -------------
+
+	err = runtime.BindQueryParameter("form", true, false, "all", ctx.QueryParams(), &params.All)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Invalid format for parameter all: %s", err))
+	}
 
 	headers := ctx.Request().Header
 	// ------------- Required header parameter "access_token" -------------
@@ -119,6 +568,95 @@ func (w *ServerInterfaceWrapper) Unauthorize(ctx echo.Context) error {
 	return err
 }
 
+// BeginWebAuthnLogin converts echo context to params.
+func (w *ServerInterfaceWrapper) BeginWebAuthnLogin(ctx echo.Context) error {
+	var err error
+
+	// Parameter object where we will unmarshal all parameters from the context
+	var params BeginWebAuthnLoginParams
+	// ------------- Optional query parameter "guid" -------------
+
+	err = runtime.BindQueryParameter("form", true, false, "guid", ctx.QueryParams(), &params.Guid)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Invalid format for parameter guid: %s", err))
+	}
+
+	// Invoke the callback with all the unmarshaled arguments
+	err = w.Handler.BeginWebAuthnLogin(ctx, params)
+	return err
+}
+
+// FinishWebAuthnLogin converts echo context to params.
+func (w *ServerInterfaceWrapper) FinishWebAuthnLogin(ctx echo.Context) error {
+	var err error
+
+	// Invoke the callback with all the unmarshaled arguments
+	err = w.Handler.FinishWebAuthnLogin(ctx)
+	return err
+}
+
+// BeginWebAuthnRegistration converts echo context to params.
+func (w *ServerInterfaceWrapper) BeginWebAuthnRegistration(ctx echo.Context) error {
+	var err error
+
+	// Parameter object where we will unmarshal all parameters from the context
+	var params BeginWebAuthnRegistrationParams
+
+	headers := ctx.Request().Header
+	// ------------- Required header parameter "access_token" -------------
+	if valueList, found := headers[http.CanonicalHeaderKey("access_token")]; found {
+		var AccessToken string
+		n := len(valueList)
+		if n != 1 {
+			return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Expected one value for access_token, got %d", n))
+		}
+
+		err = runtime.BindStyledParameterWithOptions("simple", "access_token", valueList[0], &AccessToken, runtime.BindStyledParameterOptions{ParamLocation: runtime.ParamLocationHeader, Explode: false, Required: true})
+		if err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Invalid format for parameter access_token: %s", err))
+		}
+
+		params.AccessToken = AccessToken
+	} else {
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Header parameter access_token is required, but not found"))
+	}
+
+	// Invoke the callback with all the unmarshaled arguments
+	err = w.Handler.BeginWebAuthnRegistration(ctx, params)
+	return err
+}
+
+// FinishWebAuthnRegistration converts echo context to params.
+func (w *ServerInterfaceWrapper) FinishWebAuthnRegistration(ctx echo.Context) error {
+	var err error
+
+	// Parameter object where we will unmarshal all parameters from the context
+	var params FinishWebAuthnRegistrationParams
+
+	headers := ctx.Request().Header
+	// ------------- Required header parameter "access_token" -------------
+	if valueList, found := headers[http.CanonicalHeaderKey("access_token")]; found {
+		var AccessToken string
+		n := len(valueList)
+		if n != 1 {
+			return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Expected one value for access_token, got %d", n))
+		}
+
+		err = runtime.BindStyledParameterWithOptions("simple", "access_token", valueList[0], &AccessToken, runtime.BindStyledParameterOptions{ParamLocation: runtime.ParamLocationHeader, Explode: false, Required: true})
+		if err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Invalid format for parameter access_token: %s", err))
+		}
+
+		params.AccessToken = AccessToken
+	} else {
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Header parameter access_token is required, but not found"))
+	}
+
+	// Invoke the callback with all the unmarshaled arguments
+	err = w.Handler.FinishWebAuthnRegistration(ctx, params)
+	return err
+}
+
 // This is a simple interface which specifies echo.Route addition functions which
 // are present on both echo.Echo and echo.Group, since we want to allow using
 // either of them for path registration
@@ -147,9 +685,27 @@ func RegisterHandlersWithBaseURL(router EchoRouter, si ServerInterface, baseURL
 		Handler: si,
 	}
 
+	router.GET(baseURL+"/.well-known/jwks.json", wrapper.GetJWKS)
+	router.GET(baseURL+"/apikeys", wrapper.ListAPIKeys)
+	router.POST(baseURL+"/apikeys", wrapper.CreateAPIKey)
+	router.POST(baseURL+"/apikeys/token", wrapper.ExchangeAPIKey)
+	router.DELETE(baseURL+"/apikeys/:key_id", wrapper.RevokeAPIKey)
+	router.PATCH(baseURL+"/apikeys/:key_id", wrapper.LabelAPIKey)
+	router.POST(baseURL+"/auth/mfa", wrapper.VerifyMFA)
 	router.GET(baseURL+"/auth/:guid", wrapper.AuthorizeGUID)
 	router.GET(baseURL+"/get", wrapper.GetGUID)
+	router.POST(baseURL+"/mfa/totp", wrapper.EnrollTOTP)
+	router.POST(baseURL+"/mfa/totp/confirm", wrapper.ConfirmTOTP)
+	router.POST(baseURL+"/mfa/totp/disable", wrapper.DisableTOTP)
+	router.POST(baseURL+"/oauth/token", wrapper.OAuthToken)
 	router.POST(baseURL+"/refresh", wrapper.RefreshTokens)
+	router.GET(baseURL+"/sessions", wrapper.ListSessions)
+	router.POST(baseURL+"/sessions/revoke_others", wrapper.RevokeOtherSessions)
+	router.DELETE(baseURL+"/sessions/:session_id", wrapper.RevokeSession)
 	router.POST(baseURL+"/unauthorize", wrapper.Unauthorize)
+	router.POST(baseURL+"/webauthn/login/begin", wrapper.BeginWebAuthnLogin)
+	router.POST(baseURL+"/webauthn/login/finish", wrapper.FinishWebAuthnLogin)
+	router.POST(baseURL+"/webauthn/register/begin", wrapper.BeginWebAuthnRegistration)
+	router.POST(baseURL+"/webauthn/register/finish", wrapper.FinishWebAuthnRegistration)
 
 }
@@ -3,35 +3,344 @@
 // Code generated by github.com/oapi-codegen/oapi-codegen/v2 version v2.5.0 DO NOT EDIT.
 package schema
 
-// AccessToken A JWT Token consisting of three base 64 strings separated by dots
+import (
+	"time"
+)
+
+// Defines values for OAuthErrorError.
+const (
+	InvalidClient        OAuthErrorError = "invalid_client"
+	InvalidGrant         OAuthErrorError = "invalid_grant"
+	InvalidRequest       OAuthErrorError = "invalid_request"
+	InvalidScope         OAuthErrorError = "invalid_scope"
+	UnauthorizedClient   OAuthErrorError = "unauthorized_client"
+	UnsupportedGrantType OAuthErrorError = "unsupported_grant_type"
+)
+
+// Defines values for OAuthTokenRequestGrantType.
+const (
+	OAuthTokenRequestGrantTypeClientCredentials OAuthTokenRequestGrantType = "client_credentials"
+	OAuthTokenRequestGrantTypeRefreshToken      OAuthTokenRequestGrantType = "refresh_token"
+)
+
+// Defines values for TokenErrorError.
+const (
+	DecryptionFailed  TokenErrorError = "decryption_failed"
+	InsufficientScope TokenErrorError = "insufficient_scope"
+	InvalidApiKey     TokenErrorError = "invalid_api_key"
+	InvalidAudience   TokenErrorError = "invalid_audience"
+	InvalidIssuer     TokenErrorError = "invalid_issuer"
+	InvalidSignature  TokenErrorError = "invalid_signature"
+	MalformedToken    TokenErrorError = "malformed_token"
+	TokenExpired      TokenErrorError = "token_expired"
+	TokenNotYetValid  TokenErrorError = "token_not_yet_valid"
+	TokenPairMismatch TokenErrorError = "token_pair_mismatch"
+	TokenReused       TokenErrorError = "token_reused"
+	TokenRevoked      TokenErrorError = "token_revoked"
+	UnknownKey        TokenErrorError = "unknown_key"
+	UserAgentMismatch TokenErrorError = "user_agent_mismatch"
+)
+
+// APIKey defines model for APIKey.
+type APIKey struct {
+	CreatedAt time.Time `json:"created_at"`
+
+	// ExpiresAt Not set for keys which never expire
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+	Id         string     `json:"id"`
+	Label      string     `json:"label"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+
+	// Prefix Beginning of the key to tell keys apart
+	Prefix string   `json:"prefix"`
+	Scopes []string `json:"scopes"`
+}
+
+// APIKeyLabel defines model for APIKeyLabel.
+type APIKeyLabel struct {
+	Label string `json:"label"`
+}
+
+// APIKeyRequest defines model for APIKeyRequest.
+type APIKeyRequest struct {
+	// ExpiresAt The key never expires without it, if server allows it
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	Label     string     `json:"label"`
+
+	// Scopes Any of guid:read and sessions:read
+	Scopes []string `json:"scopes"`
+}
+
+// AccessToken Access token, a JWT (optionally encrypted into JWE) or a PASETO v4 token depending on server configuration
 type AccessToken = string
 
+// CreatedAPIKey defines model for CreatedAPIKey.
+type CreatedAPIKey struct {
+	ApiKey APIKey `json:"api_key"`
+
+	// Key The key itself, it isn't shown again
+	Key string `json:"key"`
+}
+
 // GUID A unique string representing a user (and given by them)
 type GUID = string
 
+// JWK A public key in RFC 7517 format
+type JWK struct {
+	Alg *string `json:"alg,omitempty"`
+	Crv *string `json:"crv,omitempty"`
+	E   *string `json:"e,omitempty"`
+	Kid *string `json:"kid,omitempty"`
+	Kty string  `json:"kty"`
+	N   *string `json:"n,omitempty"`
+	Use *string `json:"use,omitempty"`
+	X   *string `json:"x,omitempty"`
+	Y   *string `json:"y,omitempty"`
+}
+
+// JWKS A set of public keys
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// MFAChallenge First step of login of a user with mfa
+type MFAChallenge struct {
+	// ExpiresIn Seconds the challenge stays valid
+	ExpiresIn int    `json:"expires_in"`
+	MfaToken  string `json:"mfa_token"`
+}
+
+// MFACode Either a code from authenticator app or one of recovery codes
+type MFACode struct {
+	Code         *string `json:"code,omitempty"`
+	RecoveryCode *string `json:"recovery_code,omitempty"`
+}
+
+// MFAVerification defines model for MFAVerification.
+type MFAVerification struct {
+	Code         *string `json:"code,omitempty"`
+	MfaToken     string  `json:"mfa_token"`
+	RecoveryCode *string `json:"recovery_code,omitempty"`
+}
+
+// OAuthError Error response of RFC 6749 section 5.2
+type OAuthError struct {
+	Error            OAuthErrorError `json:"error"`
+	ErrorDescription *string         `json:"error_description,omitempty"`
+}
+
+// OAuthErrorError defines model for OAuthError.Error.
+type OAuthErrorError string
+
+// OAuthToken Successful token response of RFC 6749 section 5.1
+type OAuthToken struct {
+	// AccessToken Access token, a JWT (optionally encrypted into JWE) or a PASETO v4 token depending on server configuration
+	AccessToken AccessToken `json:"access_token"`
+
+	// ExpiresIn Lifetime of the access token in seconds
+	ExpiresIn int `json:"expires_in"`
+
+	// RefreshToken Opaque token for refresh_token grant, given only to clients allowed to refresh
+	RefreshToken *string `json:"refresh_token,omitempty"`
+	Scope        string  `json:"scope"`
+	TokenType    string  `json:"token_type"`
+}
+
+// OAuthTokenRequest defines model for OAuthTokenRequest.
+type OAuthTokenRequest struct {
+	ClientId     *string                    `json:"client_id,omitempty"`
+	ClientSecret *string                    `json:"client_secret,omitempty"`
+	GrantType    OAuthTokenRequestGrantType `json:"grant_type"`
+
+	// RefreshToken Required for refresh_token grant
+	RefreshToken *string `json:"refresh_token,omitempty"`
+
+	// Scope Space separated scopes, all scopes of the client if omitted. On refresh it may only repeat the granted scope
+	Scope *string `json:"scope,omitempty"`
+}
+
+// OAuthTokenRequestGrantType defines model for OAuthTokenRequest.GrantType.
+type OAuthTokenRequestGrantType string
+
+// RecoveryCodes defines model for RecoveryCodes.
+type RecoveryCodes struct {
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
 // RefreshToken A base64 encoded string used for issuing new pair of tokens
 type RefreshToken = string
 
+// Session A device holding tokens of the user
+type Session struct {
+	CreatedAt time.Time `json:"created_at"`
+
+	// Current Session is the one of the access token used for the request
+	Current bool   `json:"current"`
+	Id      string `json:"id"`
+	Ip      string `json:"ip"`
+
+	// LastUsedAt When tokens of the session were issued or refreshed last time
+	LastUsedAt time.Time `json:"last_used_at"`
+	UserAgent  string    `json:"user_agent"`
+}
+
+// TOTPEnrollment defines model for TOTPEnrollment.
+type TOTPEnrollment struct {
+	// Secret Base32 secret for manual entry
+	Secret string `json:"secret"`
+
+	// Uri otpauth uri, usually shown as QR code
+	Uri string `json:"uri"`
+}
+
+// TokenError Why the token was refused, error is a stable code clients can check
+type TokenError struct {
+	Error            TokenErrorError `json:"error"`
+	ErrorDescription *string         `json:"error_description,omitempty"`
+}
+
+// TokenErrorError defines model for TokenError.Error.
+type TokenErrorError string
+
 // TokenPair A pair of access and refresh tokens
 type TokenPair struct {
-	// AccessToken A JWT Token consisting of three base 64 strings separated by dots
+	// AccessToken Access token, a JWT (optionally encrypted into JWE) or a PASETO v4 token depending on server configuration
 	AccessToken *AccessToken `json:"access_token,omitempty"`
 
 	// RefreshToken A base64 encoded string used for issuing new pair of tokens
 	RefreshToken *RefreshToken `json:"refresh_token,omitempty"`
 }
 
+// WebAuthnCreationOptions PublicKeyCredentialCreationOptionsJSON, decode it with PublicKeyCredential.parseCreationOptionsFromJSON
+type WebAuthnCreationOptions map[string]interface{}
+
+// WebAuthnCredential PublicKeyCredential serialized with toJSON(), binary fields are unpadded base64url
+type WebAuthnCredential map[string]interface{}
+
+// WebAuthnRequestOptions PublicKeyCredentialRequestOptionsJSON, decode it with PublicKeyCredential.parseRequestOptionsFromJSON
+type WebAuthnRequestOptions map[string]interface{}
+
+// ListAPIKeysParams defines parameters for ListAPIKeys.
+type ListAPIKeysParams struct {
+	// AccessToken User's access token
+	AccessToken string `json:"access_token"`
+}
+
+// CreateAPIKeyParams defines parameters for CreateAPIKey.
+type CreateAPIKeyParams struct {
+	// AccessToken User's access token
+	AccessToken string `json:"access_token"`
+}
+
+// ExchangeAPIKeyParams defines parameters for ExchangeAPIKey.
+type ExchangeAPIKeyParams struct {
+	ApiKey string `json:"api_key"`
+}
+
+// RevokeAPIKeyParams defines parameters for RevokeAPIKey.
+type RevokeAPIKeyParams struct {
+	// AccessToken User's access token
+	AccessToken string `json:"access_token"`
+}
+
+// LabelAPIKeyParams defines parameters for LabelAPIKey.
+type LabelAPIKeyParams struct {
+	// AccessToken User's access token
+	AccessToken string `json:"access_token"`
+}
+
 // GetGUIDParams defines parameters for GetGUID.
 type GetGUIDParams struct {
+	// AccessToken User's access token, or api key or token exchanged for it with guid:read scope
+	AccessToken string `json:"access_token"`
+}
+
+// EnrollTOTPParams defines parameters for EnrollTOTP.
+type EnrollTOTPParams struct {
+	// AccessToken User's access token
+	AccessToken string `json:"access_token"`
+}
+
+// ConfirmTOTPParams defines parameters for ConfirmTOTP.
+type ConfirmTOTPParams struct {
+	// AccessToken User's access token
+	AccessToken string `json:"access_token"`
+}
+
+// DisableTOTPParams defines parameters for DisableTOTP.
+type DisableTOTPParams struct {
+	// AccessToken User's access token
+	AccessToken string `json:"access_token"`
+}
+
+// ListSessionsParams defines parameters for ListSessions.
+type ListSessionsParams struct {
+	// AccessToken User's access token, or api key or token exchanged for it with sessions:read scope
+	AccessToken string `json:"access_token"`
+}
+
+// RevokeOtherSessionsParams defines parameters for RevokeOtherSessions.
+type RevokeOtherSessionsParams struct {
+	// AccessToken User's access token
+	AccessToken string `json:"access_token"`
+}
+
+// RevokeSessionParams defines parameters for RevokeSession.
+type RevokeSessionParams struct {
 	// AccessToken User's access token
 	AccessToken string `json:"access_token"`
 }
 
 // UnauthorizeParams defines parameters for Unauthorize.
 type UnauthorizeParams struct {
+	// All End all sessions of the user, not only the current one
+	All *bool `form:"all,omitempty" json:"all,omitempty"`
+
+	// AccessToken User's access token
+	AccessToken string `json:"access_token"`
+}
+
+// BeginWebAuthnLoginParams defines parameters for BeginWebAuthnLogin.
+type BeginWebAuthnLoginParams struct {
+	// Guid User who logs in, any discoverable passkey may be used without it
+	Guid *GUID `form:"guid,omitempty" json:"guid,omitempty"`
+}
+
+// BeginWebAuthnRegistrationParams defines parameters for BeginWebAuthnRegistration.
+type BeginWebAuthnRegistrationParams struct {
 	// AccessToken User's access token
 	AccessToken string `json:"access_token"`
 }
 
+// FinishWebAuthnRegistrationParams defines parameters for FinishWebAuthnRegistration.
+type FinishWebAuthnRegistrationParams struct {
+	// AccessToken User's access token
+	AccessToken string `json:"access_token"`
+}
+
+// CreateAPIKeyJSONRequestBody defines body for CreateAPIKey for application/json ContentType.
+type CreateAPIKeyJSONRequestBody = APIKeyRequest
+
+// LabelAPIKeyJSONRequestBody defines body for LabelAPIKey for application/json ContentType.
+type LabelAPIKeyJSONRequestBody = APIKeyLabel
+
+// VerifyMFAJSONRequestBody defines body for VerifyMFA for application/json ContentType.
+type VerifyMFAJSONRequestBody = MFAVerification
+
+// ConfirmTOTPJSONRequestBody defines body for ConfirmTOTP for application/json ContentType.
+type ConfirmTOTPJSONRequestBody = MFACode
+
+// DisableTOTPJSONRequestBody defines body for DisableTOTP for application/json ContentType.
+type DisableTOTPJSONRequestBody = MFACode
+
+// OAuthTokenFormdataRequestBody defines body for OAuthToken for application/x-www-form-urlencoded ContentType.
+type OAuthTokenFormdataRequestBody = OAuthTokenRequest
+
 // RefreshTokensJSONRequestBody defines body for RefreshTokens for application/json ContentType.
 type RefreshTokensJSONRequestBody = TokenPair
+
+// FinishWebAuthnLoginJSONRequestBody defines body for FinishWebAuthnLogin for application/json ContentType.
+type FinishWebAuthnLoginJSONRequestBody = WebAuthnCredential
+
+// FinishWebAuthnRegistrationJSONRequestBody defines body for FinishWebAuthnRegistration for application/json ContentType.
+type FinishWebAuthnRegistrationJSONRequestBody = WebAuthnCredential
@@ -0,0 +1,11 @@
+package config
+
+import "time"
+
+// APIKeyConfig limits api keys users make for scripts and ci jobs
+type APIKeyConfig struct {
+	// keys a user may have at once
+	MaxKeys int `yaml:"max_keys"`
+	// keys must expire within it, 0 lets keys never expire
+	MaxLifetime time.Duration `yaml:"max_lifetime"`
+}
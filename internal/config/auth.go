@@ -1,7 +1,54 @@
 package config
 
+import "time"
+
 type AuthConfig struct {
+	// one of HS512, RS256, PS256, ES256, EdDSA, HS512 is used if empty
+	Algorithm string `yaml:"algorithm"`
+	// keys which aren't set are derived from it with HKDF-SHA512, access key only for HS512 and EdDSA.
+	// derived access key is never rotated, like the one set explicitly
+	MasterSecret string `yaml:"master_secret"`
+	// raw secret for HS512, PKCS #8 private key in PEM for the others
 	AccessKey      string `yaml:"access_key"`
 	RefreshKey     string `yaml:"refresh_key" `
 	RefreshHashKey string `yaml:"refresh_hash_key"`
+
+	Issuer          string        `yaml:"issuer"`
+	Audience        string        `yaml:"audience"`
+	AccessLifetime  time.Duration `yaml:"access_lifetime"`
+	RefreshLifetime time.Duration `yaml:"refresh_lifetime"`
+	Leeway          time.Duration `yaml:"leeway"`
+	// v1 refresh tokens are accepted until then, refresh lifetime after v2 rollout recorded in database if not set
+	RefreshV1Until time.Time `yaml:"refresh_v1_until"`
+	// duplicate refresh with just rotated tokens gets the same new pair within this period, disabled if zero.
+	// new pair is kept sealed in database meanwhile
+	RefreshGracePeriod time.Duration `yaml:"refresh_grace_period"`
+
+	// jwt, v4.local or v4.public, jwt is used if empty. v4.local wants HS512 algorithm, v4.public wants EdDSA
+	TokenFormat string `yaml:"token_format"`
+
+	// access tokens are encrypted into JWE if set, one of dir, RSA-OAEP, RSA-OAEP-256
+	Encryption string `yaml:"encryption"`
+	// base64 of 32 bytes for dir, PKCS #8 private key in PEM for RSA-OAEP
+	EncryptionKey string `yaml:"encryption_key"`
+	// tokens are encrypted without being signed, only allowed with dir
+	EncryptOnly bool `yaml:"encrypt_only"`
+
+	// access tokens are signed by external process listening on the unix socket, it must use the algorithm above.
+	// stored keys are still used for refresh tokens and verification of tokens signed before
+	SignerSocket string `yaml:"signer_socket"`
+	// limits every request to the signer
+	SignerTimeout time.Duration `yaml:"signer_timeout"`
+
+	// new signing key is generated every period, rotation is disabled if it's zero
+	KeyRotationPeriod time.Duration `yaml:"key_rotation_period"`
+	// how often keys are reloaded from database, new keys are published this long before use
+	KeyReloadInterval time.Duration `yaml:"key_reload_interval"`
+
+	// how many sessions may be checked by HasAccess without database, cache is disabled if zero.
+	// it's kept consistent between instances by session events
+	AccessCacheSize int `yaml:"access_cache_size"`
+
+	// how long consumers may cache /.well-known/jwks.json
+	JWKSMaxAge time.Duration `yaml:"jwks_max_age"`
 }
@@ -0,0 +1,16 @@
+package config
+
+// AuthenticatorConfig sets how callers of /auth/{guid} prove who they are
+type AuthenticatorConfig struct {
+	// password (default) or trust, the latter issues tokens to anyone who knows guid
+	Type   string       `yaml:"type"`
+	Argon2 Argon2Config `yaml:"argon2"`
+}
+
+// Argon2Config sets argon2id cost of new password hashes, old hashes are upgraded on login
+type Argon2Config struct {
+	// in KiB
+	Memory      uint32 `yaml:"memory"`
+	Iterations  uint32 `yaml:"iterations"`
+	Parallelism uint8  `yaml:"parallelism"`
+}
@@ -8,11 +8,17 @@ import (
 )
 
 type Config struct {
-	Auth     AuthConfig     `yaml:"auth"`
-	Postgres PostgresConfig `yaml:"postgres"`
-	Webhook  WebhookConfig  `yaml:"webhook"`
-	Logger   LoggerConfig   `yaml:"logger"`
-	Port     string         `yaml:"port"`
+	Auth          AuthConfig          `yaml:"auth"`
+	Authenticator AuthenticatorConfig `yaml:"authenticator"`
+	MFA           MFAConfig           `yaml:"mfa"`
+	WebAuthn      WebAuthnConfig      `yaml:"webauthn"`
+	APIKeys       APIKeyConfig        `yaml:"api_keys"`
+	Postgres      PostgresConfig      `yaml:"postgres"`
+	KEK           KEKConfig           `yaml:"kek"`
+	Hashing       HashingConfig       `yaml:"hashing"`
+	Webhook       WebhookConfig       `yaml:"webhook"`
+	Logger        LoggerConfig        `yaml:"logger"`
+	Port          string              `yaml:"port"`
 }
 
 func GetConfig(path string) (Config, error) {
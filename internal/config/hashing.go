@@ -0,0 +1,14 @@
+package config
+
+import "time"
+
+// HashingConfig limits concurrent bcrypt and argon2 work, so bursts of requests are rejected instead of starving the CPU
+type HashingConfig struct {
+	// number of CPUs if not set
+	Workers int `yaml:"workers"`
+	// how many requests may wait for a worker, others are rejected right away
+	QueueSize    int           `yaml:"queue_size"`
+	QueueTimeout time.Duration `yaml:"queue_timeout"`
+	// put into Retry-After of rejected requests
+	RetryAfter time.Duration `yaml:"retry_after"`
+}
@@ -0,0 +1,41 @@
+package config
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/rinnothing/simple-jwt/utils/envelope"
+)
+
+// KEKConfig tells where key encryption keys are, they are base64 of 32 bytes separated by new lines or commas.
+// The first one wraps keys stored in database, the others are previous ones, rows wrapped by them are re-wrapped
+type KEKConfig struct {
+	File string `yaml:"file"`
+	// name of environment variable, used if file isn't set
+	Env string `yaml:"env"`
+}
+
+// Wrapper reads the keys, server can't start without them
+func (c KEKConfig) Wrapper() (*envelope.Wrapper, error) {
+	var text string
+	if c.File != "" {
+		content, err := os.ReadFile(c.File)
+		if err != nil {
+			return nil, fmt.Errorf("can't read key encryption keys: %w", err)
+		}
+		text = string(content)
+	} else if c.Env != "" {
+		text = os.Getenv(c.Env)
+	}
+
+	keks, err := envelope.ParseKEKs(text)
+	if err != nil {
+		return nil, err
+	}
+
+	wrapper, err := envelope.NewWrapper(keks...)
+	if err != nil {
+		return nil, fmt.Errorf("%w: set kek.file or environment variable from kek.env", err)
+	}
+	return wrapper, nil
+}
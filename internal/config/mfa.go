@@ -0,0 +1,15 @@
+package config
+
+import "time"
+
+// MFAConfig sets up totp second factor, users who enabled it get challenge token from /auth/{guid}
+// and exchange it together with a code for tokens
+type MFAConfig struct {
+	// shown in authenticator apps, simple-jwt if not set
+	Issuer            string        `yaml:"issuer"`
+	ChallengeLifetime time.Duration `yaml:"challenge_lifetime"`
+	// wrong codes in a row after which the user is locked out for lockout
+	MaxAttempts   int           `yaml:"max_attempts"`
+	Lockout       time.Duration `yaml:"lockout"`
+	RecoveryCodes int           `yaml:"recovery_codes"`
+}
@@ -0,0 +1,17 @@
+package config
+
+import "time"
+
+// WebAuthnConfig sets up passkey login, it's off while rp_id isn't set
+type WebAuthnConfig struct {
+	// domain passkeys are bound to, origins must be on it or its subdomains
+	RPID    string   `yaml:"rp_id"`
+	RPName  string   `yaml:"rp_name"`
+	Origins []string `yaml:"origins"`
+	// how long the ceremony may take
+	Timeout time.Duration `yaml:"timeout"`
+	// required, preferred or discouraged
+	UserVerification string `yaml:"user_verification"`
+	// none or direct
+	Attestation string `yaml:"attestation"`
+}
@@ -0,0 +1,166 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+var ErrTooManyKeys = errors.New("user has too many api keys")
+
+// APIKey is api key without the key itself, only its hash is stored
+type APIKey struct {
+	ID     string
+	UUID   string
+	Prefix string
+	Label  string
+	Scopes []string
+	// zero if the key never expires
+	ExpiresAt time.Time
+	CreatedAt time.Time
+	// zero if the key was never used
+	LastUsedAt time.Time
+}
+
+// PutAPIKey stores new key, it fails with ErrTooManyKeys if the user already has maxKeys of them.
+// ID and CreatedAt of the stored key are returned
+func (p *PostgresServiceImpl) PutAPIKey(ctx context.Context, key APIKey, keyHash []byte, maxKeys int) (APIKey, error) {
+	query := `
+INSERT INTO api_keys (user_id, key_hash, prefix, label, scopes, expires_at)
+SELECT $1, $2, $3, $4, $5, $6
+WHERE (SELECT count(*) FROM api_keys WHERE user_id = $1) < $7
+RETURNING id, created_at
+`
+	var expiresAt *time.Time
+	if !key.ExpiresAt.IsZero() {
+		expiresAt = &key.ExpiresAt
+	}
+
+	err := p.pool.QueryRow(ctx, query, key.UUID, keyHash, key.Prefix, key.Label, key.Scopes, expiresAt, maxKeys).
+		Scan(&key.ID, &key.CreatedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return APIKey{}, ErrTooManyKeys
+	}
+	if err != nil {
+		return APIKey{}, fmt.Errorf("can't insert api key: %w", err)
+	}
+
+	return key, nil
+}
+
+// ListAPIKeys returns keys of the user including expired ones, the newest first
+func (p *PostgresServiceImpl) ListAPIKeys(ctx context.Context, uuid string) ([]APIKey, error) {
+	query := `
+SELECT id, user_id, prefix, label, scopes, expires_at, created_at, last_used_at
+FROM api_keys
+WHERE user_id = $1
+ORDER BY created_at DESC
+`
+	rows, err := p.pool.Query(ctx, query, uuid)
+	if err != nil {
+		return nil, fmt.Errorf("can't query api keys: %w", err)
+	}
+	defer rows.Close()
+
+	var keys []APIKey
+	for rows.Next() {
+		key, err := scanAPIKey(rows)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("can't read api keys: %w", err)
+	}
+
+	return keys, nil
+}
+
+// UseAPIKey finds key which hasn't expired by its hash and marks it used, found is false if there is none
+func (p *PostgresServiceImpl) UseAPIKey(ctx context.Context, keyHash []byte) (APIKey, bool, error) {
+	query := `
+UPDATE api_keys
+SET last_used_at = now()
+WHERE key_hash = $1 AND (expires_at IS NULL OR expires_at > now())
+RETURNING id, user_id, prefix, label, scopes, expires_at, created_at, last_used_at
+`
+	key, err := scanAPIKey(p.pool.QueryRow(ctx, query, keyHash))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return APIKey{}, false, nil
+	}
+	if err != nil {
+		return APIKey{}, false, err
+	}
+
+	return key, true, nil
+}
+
+// LabelAPIKey changes label of the user's key, it's false if the user has no such key
+func (p *PostgresServiceImpl) LabelAPIKey(ctx context.Context, uuid, id, label string) (bool, error) {
+	tag, err := p.pool.Exec(ctx, `UPDATE api_keys SET label = $3 WHERE user_id = $1 AND id::TEXT = $2`, uuid, id, label)
+	if err != nil {
+		return false, fmt.Errorf("can't label api key: %w", err)
+	}
+
+	return tag.RowsAffected() == 1, nil
+}
+
+// RemoveAPIKey revokes the user's key together with sessions of tokens it was exchanged for,
+// it's false if the user has no such key. Removals of the sessions are announced in SessionEventsChannel
+func (p *PostgresServiceImpl) RemoveAPIKey(ctx context.Context, uuid, id string) (bool, error) {
+	sessions := `
+WITH removed AS (
+    DELETE FROM sessions
+    WHERE user_id = $1 AND api_key_id::TEXT = $2
+    RETURNING id
+)
+SELECT pg_notify($3, id) FROM removed
+`
+
+	tx, err := p.pool.Begin(ctx)
+	if err != nil {
+		return false, fmt.Errorf("can't start transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	_, err = tx.Exec(ctx, sessions, uuid, id, SessionEventsChannel)
+	if err != nil {
+		return false, fmt.Errorf("can't remove sessions of api key: %w", err)
+	}
+
+	tag, err := tx.Exec(ctx, `DELETE FROM api_keys WHERE user_id = $1 AND id::TEXT = $2`, uuid, id)
+	if err != nil {
+		return false, fmt.Errorf("can't remove api key: %w", err)
+	}
+
+	err = tx.Commit(ctx)
+	if err != nil {
+		return false, fmt.Errorf("can't commit transaction: %w", err)
+	}
+
+	return tag.RowsAffected() == 1, nil
+}
+
+func scanAPIKey(row pgx.Row) (APIKey, error) {
+	var key APIKey
+	var expiresAt, lastUsedAt *time.Time
+	err := row.Scan(&key.ID, &key.UUID, &key.Prefix, &key.Label, &key.Scopes, &expiresAt, &key.CreatedAt, &lastUsedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return APIKey{}, err
+	}
+	if err != nil {
+		return APIKey{}, fmt.Errorf("can't scan api key: %w", err)
+	}
+	if expiresAt != nil {
+		key.ExpiresAt = *expiresAt
+	}
+	if lastUsedAt != nil {
+		key.LastUsedAt = *lastUsedAt
+	}
+
+	return key, nil
+}
@@ -0,0 +1,67 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/rinnothing/simple-jwt/internal/api/schema"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// GetPasswordHash returns password hash of guid, found is false if it has no password
+func (p *PostgresServiceImpl) GetPasswordHash(ctx context.Context, guid schema.GUID) (string, bool, error) {
+	query := `
+SELECT c.password_hash
+FROM credentials c
+JOIN storage s ON s.id = c.user_id
+WHERE s.guid = $1
+`
+	var hash string
+	err := p.pool.QueryRow(ctx, query, guid).Scan(&hash)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, fmt.Errorf("can't get password hash: %w", err)
+	}
+
+	return hash, true, nil
+}
+
+// PutPasswordHash sets password hash of guid, creating the user on first use
+func (p *PostgresServiceImpl) PutPasswordHash(ctx context.Context, guid schema.GUID, hash string) error {
+	uuid, err := p.PutGUID(ctx, guid)
+	if err != nil {
+		return err
+	}
+
+	query := `
+INSERT INTO credentials (user_id, password_hash)
+VALUES ($1, $2)
+ON CONFLICT (user_id) DO UPDATE SET password_hash = EXCLUDED.password_hash, updated_at = now()
+`
+	_, err = p.pool.Exec(ctx, query, uuid, hash)
+	if err != nil {
+		return fmt.Errorf("can't put password hash: %w", err)
+	}
+
+	return nil
+}
+
+// UpdatePasswordHash replaces password hash only if it's still oldHash, so concurrent password change isn't lost
+func (p *PostgresServiceImpl) UpdatePasswordHash(ctx context.Context, guid schema.GUID, oldHash, newHash string) (bool, error) {
+	query := `
+UPDATE credentials c
+SET password_hash = $3, updated_at = now()
+FROM storage s
+WHERE s.id = c.user_id AND s.guid = $1 AND c.password_hash = $2
+`
+	tag, err := p.pool.Exec(ctx, query, guid, oldHash, newHash)
+	if err != nil {
+		return false, fmt.Errorf("can't update password hash: %w", err)
+	}
+
+	return tag.RowsAffected() == 1, nil
+}
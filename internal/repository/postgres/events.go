@@ -0,0 +1,67 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// SessionEventsChannel is notified with session id whenever session is removed or its tokens change
+const SessionEventsChannel = "session_events"
+
+const listenRetryDelay = time.Second
+
+// SessionHandler gets events of all instances sharing the database
+type SessionHandler interface {
+	// SessionChanged is called for removed or refreshed session
+	SessionChanged(sessionID string)
+	// Resync is called once subscription is (re)established, events before it could be missed
+	Resync()
+	// Lost is called when subscription is broken, no events are received until Resync
+	Lost()
+}
+
+// ListenSessions passes session events to handler, reconnecting when connection is lost,
+// it returns when ctx is done
+func (p *PostgresServiceImpl) ListenSessions(ctx context.Context, handler SessionHandler) {
+	for {
+		err := p.listenSessions(ctx, handler)
+		handler.Lost()
+		if ctx.Err() != nil {
+			return
+		}
+		p.l.Warn("lost session events subscription, reconnecting", zap.Error(err))
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(listenRetryDelay):
+		}
+	}
+}
+
+func (p *PostgresServiceImpl) listenSessions(ctx context.Context, handler SessionHandler) error {
+	poolConn, err := p.pool.Acquire(ctx)
+	if err != nil {
+		return fmt.Errorf("can't acquire connection: %w", err)
+	}
+	// listening connection can't go back to the pool
+	conn := poolConn.Hijack()
+	defer conn.Close(context.Background())
+
+	_, err = conn.Exec(ctx, "LISTEN "+SessionEventsChannel)
+	if err != nil {
+		return fmt.Errorf("can't listen to session events: %w", err)
+	}
+	handler.Resync()
+
+	for {
+		notification, err := conn.WaitForNotification(ctx)
+		if err != nil {
+			return fmt.Errorf("can't wait for session events: %w", err)
+		}
+		handler.SessionChanged(notification.Payload)
+	}
+}
@@ -0,0 +1,371 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/rinnothing/simple-jwt/utils/envelope"
+
+	"github.com/jackc/pgx/v5"
+	"go.uber.org/zap"
+)
+
+type KeyState string
+
+const (
+	KeyActive     KeyState = "active"
+	KeyVerifyOnly KeyState = "verify-only"
+	KeyRetired    KeyState = "retired"
+)
+
+// keysLockID is advisory lock taken by instances which change keys, it's "simplejw" in ascii
+const keysLockID int64 = 0x73696d706c656a77
+
+// KeyVersion is a single row of keys table, verify-only version without RetiredAt is pending activation
+type KeyVersion struct {
+	ID             int
+	Algorithm      string
+	AccessKey      string
+	RefreshKey     string
+	RefreshHashKey string
+	State          KeyState
+	ActivatedAt    time.Time
+	RetiredAt      *time.Time
+}
+
+func (k KeyVersion) Pending() bool {
+	return k.State == KeyVerifyOnly && k.RetiredAt == nil
+}
+
+// LockKeys runs fn holding advisory lock of keys table, so instances starting or rotating at once
+// make changes one after another and every next one sees what the previous did.
+// Lock is taken by transaction on its own connection, so it's released even if the instance dies
+func (p *PostgresServiceImpl) LockKeys(ctx context.Context, fn func(ctx context.Context) error) error {
+	tx, err := p.pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("can't start transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	_, err = tx.Exec(ctx, "SELECT pg_advisory_xact_lock($1)", keysLockID)
+	if err != nil {
+		return fmt.Errorf("can't lock keys: %w", err)
+	}
+
+	err = fn(ctx)
+	if err != nil {
+		return err
+	}
+
+	err = tx.Commit(ctx)
+	if err != nil {
+		return fmt.Errorf("can't unlock keys: %w", err)
+	}
+	return nil
+}
+
+// ReviveKeys returns all versions which aren't retired yet, ordered by activation time
+func (p *PostgresServiceImpl) ReviveKeys(ctx context.Context) ([]KeyVersion, error) {
+	query := `
+SELECT id, algorithm, access_key, refresh_key, refresh_hash_key, kek_id, wrapped_dek, state, activated_at, retired_at
+FROM keys
+WHERE state <> 'retired' AND (retired_at IS NULL OR retired_at > now())
+ORDER BY activated_at
+`
+	rows, err := p.pool.Query(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("can't revive keys: %w", err)
+	}
+	defer rows.Close()
+
+	var versions []KeyVersion
+	for rows.Next() {
+		var version KeyVersion
+		var stored storedKeys
+		err = rows.Scan(&version.ID, &version.Algorithm, &stored.accessKey, &stored.refreshKey, &stored.refreshHashKey,
+			&stored.kekID, &stored.wrappedDEK, &version.State, &version.ActivatedAt, &version.RetiredAt)
+		if err != nil {
+			return nil, fmt.Errorf("can't scan keys: %w", err)
+		}
+
+		err = p.unwrapKeys(stored, &version)
+		if err != nil {
+			return nil, fmt.Errorf("can't unwrap keys %d: %w", version.ID, err)
+		}
+		versions = append(versions, version)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("can't revive keys: %w", err)
+	}
+
+	for _, version := range versions {
+		p.l.Debug("revived keys", zap.Int("id", version.ID), zap.String("state", string(version.State)))
+	}
+
+	return versions, nil
+}
+
+// StoreKeys inserts a new version, to publish a key before it's used store it as verify-only with ActivatedAt in future
+func (p *PostgresServiceImpl) StoreKeys(ctx context.Context, key KeyVersion) (int, error) {
+	p.l.Debug("storing keys", zap.String("state", string(key.State)), zap.String("algorithm", key.Algorithm))
+
+	stored, err := p.wrapKeys(key)
+	if err != nil {
+		return 0, err
+	}
+
+	query := `
+INSERT INTO keys (algorithm, access_key, refresh_key, refresh_hash_key, kek_id, wrapped_dek, state, activated_at)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+RETURNING id
+`
+	var id int
+	err = p.pool.QueryRow(ctx, query, key.Algorithm, stored.accessKey, stored.refreshKey, stored.refreshHashKey,
+		stored.kekID, stored.wrappedDEK, key.State, key.ActivatedAt).Scan(&id)
+	if err != nil {
+		return 0, fmt.Errorf("can't store keys: %w", err)
+	}
+
+	return id, nil
+}
+
+// RewrapKeys wraps rows which are still in plain text or wrapped by previous key encryption key,
+// retired rows and totp secrets included. Returns number of changed rows
+func (p *PostgresServiceImpl) RewrapKeys(ctx context.Context) (int, error) {
+	tx, err := p.pool.Begin(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("can't start transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	query := `
+SELECT id, access_key, refresh_key, refresh_hash_key, kek_id, wrapped_dek
+FROM keys
+WHERE kek_id IS DISTINCT FROM $1
+FOR UPDATE
+`
+	rows, err := tx.Query(ctx, query, p.kek.CurrentID())
+	if err != nil {
+		return 0, fmt.Errorf("can't find keys to rewrap: %w", err)
+	}
+
+	stale := make(map[int]storedKeys)
+	for rows.Next() {
+		var id int
+		var stored storedKeys
+		err = rows.Scan(&id, &stored.accessKey, &stored.refreshKey, &stored.refreshHashKey, &stored.kekID, &stored.wrappedDEK)
+		if err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("can't scan keys: %w", err)
+		}
+		stale[id] = stored
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return 0, fmt.Errorf("can't find keys to rewrap: %w", err)
+	}
+
+	queryUpdate := `
+UPDATE keys
+SET access_key = $1, refresh_key = $2, refresh_hash_key = $3, kek_id = $4, wrapped_dek = $5
+WHERE id = $6
+`
+	for id, stored := range stale {
+		rewrapped, err := p.rewrapKeys(stored)
+		if err != nil {
+			return 0, fmt.Errorf("can't rewrap keys %d: %w", id, err)
+		}
+
+		_, err = tx.Exec(ctx, queryUpdate, rewrapped.accessKey, rewrapped.refreshKey, rewrapped.refreshHashKey,
+			rewrapped.kekID, rewrapped.wrappedDEK, id)
+		if err != nil {
+			return 0, fmt.Errorf("can't update keys %d: %w", id, err)
+		}
+	}
+
+	// totp secrets are wrapped by the same key encryption key, so they are rewrapped together
+	totps, err := p.rewrapTOTPs(ctx, tx)
+	if err != nil {
+		return 0, err
+	}
+
+	err = tx.Commit(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("can't commit transaction: %w", err)
+	}
+
+	if len(stale)+totps != 0 {
+		p.l.Info("rewrapped keys", zap.Int("count", len(stale)), zap.Int("totp_count", totps), zap.String("kek_id", p.kek.CurrentID()))
+	}
+	return len(stale) + totps, nil
+}
+
+// PromoteKeys activates the newest pending version which activation time has come,
+// previous active version stays verify-only for overlap. Expired verify-only versions are retired.
+// Returns true if active version has changed
+func (p *PostgresServiceImpl) PromoteKeys(ctx context.Context, overlap time.Duration) (bool, error) {
+	tx, err := p.pool.Begin(ctx)
+	if err != nil {
+		return false, fmt.Errorf("can't start transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	queryRetire := `
+UPDATE keys
+SET state = 'retired'
+WHERE state = 'verify-only' AND retired_at <= now()
+`
+	_, err = tx.Exec(ctx, queryRetire)
+	if err != nil {
+		return false, fmt.Errorf("can't retire expired keys: %w", err)
+	}
+
+	// row lock makes concurrent promotions from other instances wait and then skip
+	queryPending := `
+SELECT id
+FROM keys
+WHERE state = 'verify-only' AND retired_at IS NULL AND activated_at <= now()
+ORDER BY activated_at DESC
+LIMIT 1
+FOR UPDATE
+`
+	var id int
+	err = tx.QueryRow(ctx, queryPending).Scan(&id)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return false, tx.Commit(ctx)
+	} else if err != nil {
+		return false, fmt.Errorf("can't find pending keys: %w", err)
+	}
+
+	queryDemote := `
+UPDATE keys
+SET state = 'verify-only', retired_at = now() + make_interval(secs => $1)
+WHERE state = 'active'
+`
+	_, err = tx.Exec(ctx, queryDemote, overlap.Seconds())
+	if err != nil {
+		return false, fmt.Errorf("can't demote active keys: %w", err)
+	}
+
+	queryActivate := `
+UPDATE keys
+SET state = 'active', activated_at = now()
+WHERE id = $1
+`
+	_, err = tx.Exec(ctx, queryActivate, id)
+	if err != nil {
+		return false, fmt.Errorf("can't activate keys: %w", err)
+	}
+
+	// older pending versions lost the race and will never be used for signing
+	queryStale := `
+UPDATE keys
+SET state = 'retired', retired_at = now()
+WHERE state = 'verify-only' AND retired_at IS NULL AND activated_at <= now()
+`
+	_, err = tx.Exec(ctx, queryStale)
+	if err != nil {
+		return false, fmt.Errorf("can't retire stale pending keys: %w", err)
+	}
+
+	err = tx.Commit(ctx)
+	if err != nil {
+		return false, fmt.Errorf("can't commit transaction: %w", err)
+	}
+
+	p.l.Info("activated new keys", zap.Int("id", id))
+	return true, nil
+}
+
+// storedKeys are key columns of keys table, keys are sealed by data key unless kekID is nil
+type storedKeys struct {
+	accessKey, refreshKey, refreshHashKey []byte
+
+	kekID      *string
+	wrappedDEK []byte
+}
+
+// column names are used as additional data, so sealed keys can't be swapped
+const (
+	accessKeyColumn      = "access_key"
+	refreshKeyColumn     = "refresh_key"
+	refreshHashKeyColumn = "refresh_hash_key"
+)
+
+func (p *PostgresServiceImpl) wrapKeys(key KeyVersion) (storedKeys, error) {
+	dek, wrappedDEK, kekID, err := p.kek.NewDEK()
+	if err != nil {
+		return storedKeys{}, fmt.Errorf("can't make data key: %w", err)
+	}
+
+	stored := storedKeys{
+		kekID:      &kekID,
+		wrappedDEK: wrappedDEK,
+	}
+	for _, column := range []struct {
+		dst   *[]byte
+		key   string
+		label string
+	}{
+		{&stored.accessKey, key.AccessKey, accessKeyColumn},
+		{&stored.refreshKey, key.RefreshKey, refreshKeyColumn},
+		{&stored.refreshHashKey, key.RefreshHashKey, refreshHashKeyColumn},
+	} {
+		*column.dst, err = envelope.Seal(dek, []byte(column.key), []byte(column.label))
+		if err != nil {
+			return storedKeys{}, fmt.Errorf("can't seal %s: %w", column.label, err)
+		}
+	}
+
+	return stored, nil
+}
+
+func (p *PostgresServiceImpl) unwrapKeys(stored storedKeys, version *KeyVersion) error {
+	if stored.kekID == nil {
+		return fmt.Errorf("keys aren't wrapped yet")
+	}
+
+	dek, err := p.kek.UnwrapDEK(*stored.kekID, stored.wrappedDEK)
+	if err != nil {
+		return err
+	}
+
+	for _, column := range []struct {
+		dst    *string
+		sealed []byte
+		label  string
+	}{
+		{&version.AccessKey, stored.accessKey, accessKeyColumn},
+		{&version.RefreshKey, stored.refreshKey, refreshKeyColumn},
+		{&version.RefreshHashKey, stored.refreshHashKey, refreshHashKeyColumn},
+	} {
+		key, err := envelope.Open(dek, column.sealed, []byte(column.label))
+		if err != nil {
+			return fmt.Errorf("can't open %s: %w", column.label, err)
+		}
+		*column.dst = string(key)
+	}
+
+	return nil
+}
+
+// rewrapKeys wraps plain text keys, wrapped ones only get their data key rewrapped
+func (p *PostgresServiceImpl) rewrapKeys(stored storedKeys) (storedKeys, error) {
+	if stored.kekID == nil {
+		return p.wrapKeys(KeyVersion{
+			AccessKey:      string(stored.accessKey),
+			RefreshKey:     string(stored.refreshKey),
+			RefreshHashKey: string(stored.refreshHashKey),
+		})
+	}
+
+	wrappedDEK, kekID, err := p.kek.Rewrap(*stored.kekID, stored.wrappedDEK)
+	if err != nil {
+		return storedKeys{}, err
+	}
+	stored.kekID = &kekID
+	stored.wrappedDEK = wrappedDEK
+	return stored, nil
+}
@@ -0,0 +1,387 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/rinnothing/simple-jwt/utils/envelope"
+
+	"github.com/jackc/pgx/v5"
+)
+
+var ErrMFAEnabled = errors.New("mfa is already enabled")
+
+// TOTP is totp enrolment of a user, Secret is already unsealed
+type TOTP struct {
+	Secret   []byte
+	Enabled  bool
+	LastStep int64
+	// zero if the user isn't locked out
+	LockedUntil time.Time
+}
+
+// Challenge is the first step of login of a user with mfa, it's found by sha256 of the token given to the user
+type Challenge struct {
+	IDHash      []byte
+	UUID        string
+	AuthMethods []string
+	ExpiresAt   time.Time
+}
+
+// totpAAD binds sealed secret to its user, so secrets can't be swapped between rows
+func totpAAD(uuid string) []byte {
+	return []byte("mfa_totp.secret:" + uuid)
+}
+
+// storedTOTP is secret column of mfa_totp together with wrapped data key it's sealed by
+type storedTOTP struct {
+	secret     []byte
+	kekID      string
+	wrappedDEK []byte
+}
+
+func (p *PostgresServiceImpl) sealTOTP(uuid string, secret []byte) (storedTOTP, error) {
+	dek, wrappedDEK, kekID, err := p.kek.NewDEK()
+	if err != nil {
+		return storedTOTP{}, fmt.Errorf("can't make data key: %w", err)
+	}
+	sealed, err := envelope.Seal(dek, secret, totpAAD(uuid))
+	if err != nil {
+		return storedTOTP{}, fmt.Errorf("can't seal totp secret: %w", err)
+	}
+
+	return storedTOTP{secret: sealed, kekID: kekID, wrappedDEK: wrappedDEK}, nil
+}
+
+func (p *PostgresServiceImpl) openTOTP(uuid string, stored storedTOTP) ([]byte, error) {
+	dek, err := p.kek.UnwrapDEK(stored.kekID, stored.wrappedDEK)
+	if err != nil {
+		return nil, fmt.Errorf("can't unwrap totp data key: %w", err)
+	}
+	secret, err := envelope.Open(dek, stored.secret, totpAAD(uuid))
+	if err != nil {
+		return nil, fmt.Errorf("can't open totp secret: %w", err)
+	}
+
+	return secret, nil
+}
+
+// rewrapTOTP wraps data key of the secret with the current key encryption key, the secret stays sealed as is
+func (p *PostgresServiceImpl) rewrapTOTP(stored storedTOTP) (storedTOTP, error) {
+	wrappedDEK, kekID, err := p.kek.Rewrap(stored.kekID, stored.wrappedDEK)
+	if err != nil {
+		return storedTOTP{}, fmt.Errorf("can't rewrap totp data key: %w", err)
+	}
+
+	stored.kekID, stored.wrappedDEK = kekID, wrappedDEK
+	return stored, nil
+}
+
+// rewrapTOTPs rewraps secrets wrapped by previous key encryption key inside of RewrapKeys transaction,
+// returns number of changed rows
+func (p *PostgresServiceImpl) rewrapTOTPs(ctx context.Context, tx pgx.Tx) (int, error) {
+	query := `
+SELECT user_id, kek_id, wrapped_dek
+FROM mfa_totp
+WHERE kek_id <> $1
+FOR UPDATE
+`
+	rows, err := tx.Query(ctx, query, p.kek.CurrentID())
+	if err != nil {
+		return 0, fmt.Errorf("can't find totp secrets to rewrap: %w", err)
+	}
+
+	stale := make(map[string]storedTOTP)
+	for rows.Next() {
+		var uuid string
+		var stored storedTOTP
+		err = rows.Scan(&uuid, &stored.kekID, &stored.wrappedDEK)
+		if err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("can't scan totp secret: %w", err)
+		}
+		stale[uuid] = stored
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return 0, fmt.Errorf("can't find totp secrets to rewrap: %w", err)
+	}
+
+	for uuid, stored := range stale {
+		rewrapped, err := p.rewrapTOTP(stored)
+		if err != nil {
+			return 0, fmt.Errorf("can't rewrap totp secret of %s: %w", uuid, err)
+		}
+
+		_, err = tx.Exec(ctx, `UPDATE mfa_totp SET kek_id = $1, wrapped_dek = $2 WHERE user_id = $3`,
+			rewrapped.kekID, rewrapped.wrappedDEK, uuid)
+		if err != nil {
+			return 0, fmt.Errorf("can't update totp secret of %s: %w", uuid, err)
+		}
+	}
+
+	return len(stale), nil
+}
+
+// PutTOTP starts enrolment with new secret, it replaces unconfirmed one and fails with ErrMFAEnabled if there is a confirmed one
+func (p *PostgresServiceImpl) PutTOTP(ctx context.Context, uuid string, secret []byte) error {
+	stored, err := p.sealTOTP(uuid, secret)
+	if err != nil {
+		return err
+	}
+
+	query := `
+INSERT INTO mfa_totp (user_id, secret, kek_id, wrapped_dek)
+VALUES ($1, $2, $3, $4)
+ON CONFLICT (user_id) DO UPDATE
+SET secret = EXCLUDED.secret, kek_id = EXCLUDED.kek_id, wrapped_dek = EXCLUDED.wrapped_dek,
+    last_step = 0, failed_attempts = 0, locked_until = NULL, created_at = now()
+WHERE mfa_totp.enabled_at IS NULL
+`
+	tag, err := p.pool.Exec(ctx, query, uuid, stored.secret, stored.kekID, stored.wrappedDEK)
+	if err != nil {
+		return fmt.Errorf("can't put totp secret: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrMFAEnabled
+	}
+
+	return nil
+}
+
+// GetTOTP returns totp enrolment of the user, found is false if there is none
+func (p *PostgresServiceImpl) GetTOTP(ctx context.Context, uuid string) (TOTP, bool, error) {
+	query := `
+SELECT secret, kek_id, wrapped_dek, enabled_at IS NOT NULL, last_step, locked_until
+FROM mfa_totp
+WHERE user_id = $1
+`
+	var totp TOTP
+	var stored storedTOTP
+	var lockedUntil *time.Time
+	err := p.pool.QueryRow(ctx, query, uuid).Scan(&stored.secret, &stored.kekID, &stored.wrappedDEK, &totp.Enabled, &totp.LastStep, &lockedUntil)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return TOTP{}, false, nil
+	}
+	if err != nil {
+		return TOTP{}, false, fmt.Errorf("can't get totp: %w", err)
+	}
+	if lockedUntil != nil {
+		totp.LockedUntil = *lockedUntil
+	}
+
+	totp.Secret, err = p.openTOTP(uuid, stored)
+	if err != nil {
+		return TOTP{}, false, err
+	}
+
+	return totp, true, nil
+}
+
+// MFAEnabled tells if the user has confirmed totp enrolment
+func (p *PostgresServiceImpl) MFAEnabled(ctx context.Context, uuid string) (bool, error) {
+	query := `
+SELECT EXISTS (SELECT 1 FROM mfa_totp WHERE user_id = $1 AND enabled_at IS NOT NULL)
+`
+	var enabled bool
+	err := p.pool.QueryRow(ctx, query, uuid).Scan(&enabled)
+	if err != nil {
+		return false, fmt.Errorf("can't check if mfa is enabled: %w", err)
+	}
+
+	return enabled, nil
+}
+
+// EnableTOTP confirms enrolment, the step of confirming code is used up and recovery codes replace previous ones
+func (p *PostgresServiceImpl) EnableTOTP(ctx context.Context, uuid string, step int64, recoveryHashes [][]byte) error {
+	tx, err := p.pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("can't start transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	queryEnable := `
+UPDATE mfa_totp
+SET enabled_at = now(), last_step = $2, failed_attempts = 0, locked_until = NULL
+WHERE user_id = $1 AND enabled_at IS NULL
+`
+	tag, err := tx.Exec(ctx, queryEnable, uuid, step)
+	if err != nil {
+		return fmt.Errorf("can't enable totp: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrMFAEnabled
+	}
+
+	err = replaceRecoveryCodes(ctx, tx, uuid, recoveryHashes)
+	if err != nil {
+		return err
+	}
+
+	err = tx.Commit(ctx)
+	if err != nil {
+		return fmt.Errorf("can't commit transaction: %w", err)
+	}
+
+	return nil
+}
+
+func replaceRecoveryCodes(ctx context.Context, tx pgx.Tx, uuid string, hashes [][]byte) error {
+	_, err := tx.Exec(ctx, `DELETE FROM mfa_recovery_codes WHERE user_id = $1`, uuid)
+	if err != nil {
+		return fmt.Errorf("can't remove recovery codes: %w", err)
+	}
+
+	_, err = tx.Exec(ctx, `
+INSERT INTO mfa_recovery_codes (user_id, code_hash)
+SELECT $1, unnest($2::BYTEA[])
+`, uuid, hashes)
+	if err != nil {
+		return fmt.Errorf("can't insert recovery codes: %w", err)
+	}
+
+	return nil
+}
+
+// UseTOTPStep marks the step as used, it's false if the step or a later one was already used
+func (p *PostgresServiceImpl) UseTOTPStep(ctx context.Context, uuid string, step int64) (bool, error) {
+	query := `
+UPDATE mfa_totp
+SET last_step = $2, failed_attempts = 0, locked_until = NULL
+WHERE user_id = $1 AND enabled_at IS NOT NULL AND last_step < $2
+`
+	tag, err := p.pool.Exec(ctx, query, uuid, step)
+	if err != nil {
+		return false, fmt.Errorf("can't use totp step: %w", err)
+	}
+
+	return tag.RowsAffected() == 1, nil
+}
+
+// UseRecoveryCode marks recovery code as used, it's false if there is no such unused code
+func (p *PostgresServiceImpl) UseRecoveryCode(ctx context.Context, uuid string, codeHash []byte) (bool, error) {
+	query := `
+WITH used AS (
+    UPDATE mfa_recovery_codes
+    SET used_at = now()
+    WHERE user_id = $1 AND code_hash = $2 AND used_at IS NULL
+    RETURNING user_id
+)
+UPDATE mfa_totp
+SET failed_attempts = 0, locked_until = NULL
+WHERE user_id IN (SELECT user_id FROM used)
+`
+	tag, err := p.pool.Exec(ctx, query, uuid, codeHash)
+	if err != nil {
+		return false, fmt.Errorf("can't use recovery code: %w", err)
+	}
+
+	return tag.RowsAffected() == 1, nil
+}
+
+// TakeMFAAttempt counts attempt to enter a code before the code is checked, the right code resets the count.
+// Attempt which reaches maxAttempts locks the user out for lockout. Check and count are a single update,
+// so parallel guesses wait for each other and can't get past the limit. While the user is locked out
+// allowed is false and lockedUntil tells when it ends
+func (p *PostgresServiceImpl) TakeMFAAttempt(ctx context.Context, uuid string, maxAttempts int, lockout time.Duration) (bool, time.Time, error) {
+	query := `
+UPDATE mfa_totp
+SET failed_attempts = CASE WHEN failed_attempts + 1 >= $2 THEN 0 ELSE failed_attempts + 1 END,
+    locked_until = CASE WHEN failed_attempts + 1 >= $2 THEN now() + make_interval(secs => $3) ELSE NULL END
+WHERE user_id = $1 AND (locked_until IS NULL OR locked_until <= now())
+`
+	tag, err := p.pool.Exec(ctx, query, uuid, maxAttempts, lockout.Seconds())
+	if err != nil {
+		return false, time.Time{}, fmt.Errorf("can't count mfa attempt: %w", err)
+	}
+	if tag.RowsAffected() == 1 {
+		return true, time.Time{}, nil
+	}
+
+	var lockedUntil *time.Time
+	err = p.pool.QueryRow(ctx, `SELECT locked_until FROM mfa_totp WHERE user_id = $1`, uuid).Scan(&lockedUntil)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		return false, time.Time{}, fmt.Errorf("can't get mfa lockout: %w", err)
+	}
+	if lockedUntil == nil {
+		return false, time.Time{}, nil
+	}
+	return false, *lockedUntil, nil
+}
+
+// RemoveTOTP disables mfa of the user, recovery codes and pending challenges are removed too
+func (p *PostgresServiceImpl) RemoveTOTP(ctx context.Context, uuid string) error {
+	tx, err := p.pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("can't start transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	for _, query := range []string{
+		`DELETE FROM mfa_totp WHERE user_id = $1`,
+		`DELETE FROM mfa_recovery_codes WHERE user_id = $1`,
+		`DELETE FROM mfa_challenges WHERE user_id = $1`,
+	} {
+		_, err = tx.Exec(ctx, query, uuid)
+		if err != nil {
+			return fmt.Errorf("can't remove mfa: %w", err)
+		}
+	}
+
+	err = tx.Commit(ctx)
+	if err != nil {
+		return fmt.Errorf("can't commit transaction: %w", err)
+	}
+
+	return nil
+}
+
+// CreateChallenge stores challenge, expired ones are cleaned up on the way
+func (p *PostgresServiceImpl) CreateChallenge(ctx context.Context, challenge Challenge) error {
+	_, err := p.pool.Exec(ctx, `DELETE FROM mfa_challenges WHERE expires_at < now()`)
+	if err != nil {
+		return fmt.Errorf("can't remove expired challenges: %w", err)
+	}
+
+	query := `
+INSERT INTO mfa_challenges (id_hash, user_id, auth_methods, expires_at)
+VALUES ($1, $2, $3, $4)
+`
+	_, err = p.pool.Exec(ctx, query, challenge.IDHash, challenge.UUID, challenge.AuthMethods, challenge.ExpiresAt)
+	if err != nil {
+		return fmt.Errorf("can't insert challenge: %w", err)
+	}
+
+	return nil
+}
+
+// GetChallenge returns challenge which hasn't expired yet, found is false otherwise
+func (p *PostgresServiceImpl) GetChallenge(ctx context.Context, idHash []byte) (Challenge, bool, error) {
+	query := `
+SELECT user_id, auth_methods, expires_at
+FROM mfa_challenges
+WHERE id_hash = $1 AND expires_at > now()
+`
+	challenge := Challenge{IDHash: idHash}
+	err := p.pool.QueryRow(ctx, query, idHash).Scan(&challenge.UUID, &challenge.AuthMethods, &challenge.ExpiresAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return Challenge{}, false, nil
+	}
+	if err != nil {
+		return Challenge{}, false, fmt.Errorf("can't get challenge: %w", err)
+	}
+
+	return challenge, true, nil
+}
+
+// RemoveChallenge uses the challenge up, it's false if it was already used
+func (p *PostgresServiceImpl) RemoveChallenge(ctx context.Context, idHash []byte) (bool, error) {
+	tag, err := p.pool.Exec(ctx, `DELETE FROM mfa_challenges WHERE id_hash = $1`, idHash)
+	if err != nil {
+		return false, fmt.Errorf("can't remove challenge: %w", err)
+	}
+
+	return tag.RowsAffected() == 1, nil
+}
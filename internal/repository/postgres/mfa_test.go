@@ -0,0 +1,50 @@
+package postgres
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/rinnothing/simple-jwt/utils/envelope"
+	"github.com/stretchr/testify/require"
+)
+
+func newKEK(t *testing.T, fill byte) *envelope.KEK {
+	kek, err := envelope.NewKEK(bytes.Repeat([]byte{fill}, envelope.KeySize))
+	require.NoError(t, err)
+	return kek
+}
+
+func repoWith(t *testing.T, keks ...*envelope.KEK) *PostgresServiceImpl {
+	wrapper, err := envelope.NewWrapper(keks...)
+	require.NoError(t, err)
+	return &PostgresServiceImpl{kek: wrapper}
+}
+
+// secret sealed before key encryption key rotation is read with only the new key after rewrap
+func TestRewrapTOTP(t *testing.T) {
+	previous, current := newKEK(t, 1), newKEK(t, 2)
+	secret := []byte("12345678901234567890")
+
+	stored, err := repoWith(t, previous).sealTOTP("uuid", secret)
+	require.NoError(t, err)
+
+	_, err = repoWith(t, current).openTOTP("uuid", stored)
+	require.ErrorIs(t, err, envelope.ErrUnknownKEK)
+
+	rewrapped, err := repoWith(t, current, previous).rewrapTOTP(stored)
+	require.NoError(t, err)
+	require.Equal(t, current.ID, rewrapped.kekID)
+	require.Equal(t, stored.secret, rewrapped.secret)
+
+	opened, err := repoWith(t, current).openTOTP("uuid", rewrapped)
+	require.NoError(t, err)
+	require.Equal(t, secret, opened)
+
+	// secret is still bound to its user
+	_, err = repoWith(t, current).openTOTP("other", rewrapped)
+	require.Error(t, err)
+
+	// secret wrapped by unknown key can't be rewrapped
+	_, err = repoWith(t, current).rewrapTOTP(stored)
+	require.ErrorIs(t, err, envelope.ErrUnknownKEK)
+}
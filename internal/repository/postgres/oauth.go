@@ -0,0 +1,54 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// OAuthClient is confidential client of the token endpoint, it gets tokens of the user it acts for
+type OAuthClient struct {
+	ID     string
+	UUID   string
+	Scopes []string
+	// client may use refresh_token grant
+	Refresh bool
+}
+
+// PutOAuthClient registers the client, registering it again replaces the secret and the rest of it
+func (p *PostgresServiceImpl) PutOAuthClient(ctx context.Context, client OAuthClient, secretHash []byte) error {
+	query := `
+INSERT INTO oauth_clients (client_id, user_id, secret_hash, scopes, refresh)
+VALUES ($1, $2, $3, $4, $5)
+ON CONFLICT (client_id) DO UPDATE
+SET user_id = EXCLUDED.user_id, secret_hash = EXCLUDED.secret_hash, scopes = EXCLUDED.scopes, refresh = EXCLUDED.refresh
+`
+	_, err := p.pool.Exec(ctx, query, client.ID, client.UUID, secretHash, client.Scopes, client.Refresh)
+	if err != nil {
+		return fmt.Errorf("can't insert oauth client: %w", err)
+	}
+
+	return nil
+}
+
+// GetOAuthClient returns the client together with hash of its secret, found is false if there is no such client
+func (p *PostgresServiceImpl) GetOAuthClient(ctx context.Context, id string) (OAuthClient, []byte, bool, error) {
+	query := `
+SELECT user_id, secret_hash, scopes, refresh
+FROM oauth_clients
+WHERE client_id = $1
+`
+	client := OAuthClient{ID: id}
+	var secretHash []byte
+	err := p.pool.QueryRow(ctx, query, id).Scan(&client.UUID, &secretHash, &client.Scopes, &client.Refresh)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return OAuthClient{}, nil, false, nil
+	}
+	if err != nil {
+		return OAuthClient{}, nil, false, fmt.Errorf("can't get oauth client: %w", err)
+	}
+
+	return client, secretHash, true, nil
+}
@@ -3,12 +3,14 @@ package postgres
 import (
 	"context"
 	"crypto/sha512"
-	"encoding/hex"
 	"errors"
 	"fmt"
+	"time"
 
 	"github.com/rinnothing/simple-jwt/internal/api/schema"
 	"github.com/rinnothing/simple-jwt/internal/config"
+	"github.com/rinnothing/simple-jwt/utils/envelope"
+	"github.com/rinnothing/simple-jwt/utils/limiter"
 
 	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
@@ -17,41 +19,98 @@ import (
 )
 
 var (
-	ErrWrongUserAgent = errors.New("different user agent")
+	ErrWrongUserAgent  = errors.New("different user agent")
+	ErrSessionNotFound = errors.New("session not found")
+	ErrRefreshReused   = errors.New("refresh token was already rotated")
+	ErrAlreadyRotated  = errors.New("refresh token was just rotated")
+	ErrStaleRefresh    = errors.New("refresh token isn't the current one of the session")
 )
 
 type PostgresService interface {
-	ReviveKeys(ctx context.Context) ([]string, error)
-	StoreKeys(ctx context.Context, keys []string) error
-
-	PutRefresh(ctx context.Context, uuid string, oldRefresh, newRefresh schema.RefreshToken, userAgent, IP string) (bool, error)
-	Remove(ctx context.Context, uuid string) error
-	FindRefresh(ctx context.Context, uuid string, refresh schema.RefreshToken) (bool, error)
+	ReviveKeys(ctx context.Context) ([]KeyVersion, error)
+	StoreKeys(ctx context.Context, key KeyVersion) (int, error)
+	PromoteKeys(ctx context.Context, overlap time.Duration) (bool, error)
+	LockKeys(ctx context.Context, fn func(ctx context.Context) error) error
+	RewrapKeys(ctx context.Context) (int, error)
+
+	CreateSession(ctx context.Context, session Session, refreshID string, refresh schema.RefreshToken) error
+	CreateAccessSession(ctx context.Context, session Session, lifetime time.Duration) error
+	PutRefresh(ctx context.Context, rotation Rotation, grace time.Duration) (bool, error)
+	ClearSuccessors(ctx context.Context, grace time.Duration) (int64, error)
+	FindAccess(ctx context.Context, sessionID, fingerprint string, refresh schema.RefreshToken) (bool, error)
+	ListSessions(ctx context.Context, uuid string) ([]Session, error)
+	RemoveSession(ctx context.Context, uuid, sessionID string) (bool, error)
+	RemoveOtherSessions(ctx context.Context, uuid, keepSessionID string) error
+	RemoveSessions(ctx context.Context, uuid string) error
+	ListenSessions(ctx context.Context, handler SessionHandler)
+	RefreshV2Since(ctx context.Context) (time.Time, error)
 
 	PutGUID(ctx context.Context, guid schema.GUID) (string, error)
 	GetGUID(ctx context.Context, uuid string) (schema.GUID, error)
+	GetUUID(ctx context.Context, guid schema.GUID) (string, bool, error)
+
+	GetPasswordHash(ctx context.Context, guid schema.GUID) (string, bool, error)
+	PutPasswordHash(ctx context.Context, guid schema.GUID, hash string) error
+	UpdatePasswordHash(ctx context.Context, guid schema.GUID, oldHash, newHash string) (bool, error)
+
+	PutTOTP(ctx context.Context, uuid string, secret []byte) error
+	GetTOTP(ctx context.Context, uuid string) (TOTP, bool, error)
+	MFAEnabled(ctx context.Context, uuid string) (bool, error)
+	EnableTOTP(ctx context.Context, uuid string, step int64, recoveryHashes [][]byte) error
+	UseTOTPStep(ctx context.Context, uuid string, step int64) (bool, error)
+	UseRecoveryCode(ctx context.Context, uuid string, codeHash []byte) (bool, error)
+	TakeMFAAttempt(ctx context.Context, uuid string, maxAttempts int, lockout time.Duration) (bool, time.Time, error)
+	RemoveTOTP(ctx context.Context, uuid string) error
+	CreateChallenge(ctx context.Context, challenge Challenge) error
+	GetChallenge(ctx context.Context, idHash []byte) (Challenge, bool, error)
+	RemoveChallenge(ctx context.Context, idHash []byte) (bool, error)
+
+	CreateWebAuthnChallenge(ctx context.Context, challenge WebAuthnChallenge) error
+	TakeWebAuthnChallenge(ctx context.Context, challengeHash []byte, ceremony string) (WebAuthnChallenge, bool, error)
+	PutWebAuthnCredential(ctx context.Context, credential WebAuthnCredential) error
+	ListWebAuthnCredentials(ctx context.Context, uuid string) ([][]byte, error)
+	GetWebAuthnCredential(ctx context.Context, id []byte) (WebAuthnCredential, bool, error)
+	UseWebAuthnCredential(ctx context.Context, id []byte, signCount uint32) (bool, error)
+
+	PutAPIKey(ctx context.Context, key APIKey, keyHash []byte, maxKeys int) (APIKey, error)
+	ListAPIKeys(ctx context.Context, uuid string) ([]APIKey, error)
+	UseAPIKey(ctx context.Context, keyHash []byte) (APIKey, bool, error)
+	LabelAPIKey(ctx context.Context, uuid, id, label string) (bool, error)
+	RemoveAPIKey(ctx context.Context, uuid, id string) (bool, error)
+
+	PutOAuthClient(ctx context.Context, client OAuthClient, secretHash []byte) error
+	GetOAuthClient(ctx context.Context, id string) (OAuthClient, []byte, bool, error)
 }
 
 type PostgresServiceImpl struct {
 	l *zap.Logger
 
 	pool *pgxpool.Pool
+	// bcrypt work goes through it, rejected work fails with limiter.ErrOverloaded
+	hasher *limiter.Limiter
+	// wraps keys stored in keys table
+	kek *envelope.Wrapper
 
 	cfg config.PostgresConfig
 }
 
-func NewRepo(cfg config.PostgresConfig, pool *pgxpool.Pool, l *zap.Logger) PostgresService {
+// NewRepo makes repository, hasher may be nil if bcrypt work shouldn't be limited
+func NewRepo(cfg config.PostgresConfig, pool *pgxpool.Pool, hasher *limiter.Limiter, kek *envelope.Wrapper, l *zap.Logger) PostgresService {
 	return &PostgresServiceImpl{
-		l:    l,
-		pool: pool,
-		cfg:  cfg,
+		l:      l,
+		pool:   pool,
+		hasher: hasher,
+		kek:    kek,
+		cfg:    cfg,
 	}
 }
 
+// PutGUID returns uuid of the guid, creating it on first use, so all sessions of a user share it
 func (p *PostgresServiceImpl) PutGUID(ctx context.Context, guid schema.GUID) (string, error) {
 	query := `
 INSERT INTO storage (guid)
 VALUES ($1)
+ON CONFLICT (guid) DO UPDATE SET guid = EXCLUDED.guid
 RETURNING id
 `
 	var uuid string
@@ -78,6 +137,25 @@ WHERE id = $1
 	return guid, nil
 }
 
+// GetUUID returns uuid of the guid without creating it, found is false if the user was never seen
+func (p *PostgresServiceImpl) GetUUID(ctx context.Context, guid schema.GUID) (string, bool, error) {
+	query := `
+SELECT id
+FROM storage
+WHERE guid = $1
+`
+	var uuid string
+	err := p.pool.QueryRow(ctx, query, guid).Scan(&uuid)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, fmt.Errorf("can't find uuid for guid %s: %w", guid, err)
+	}
+
+	return uuid, true, nil
+}
+
 func hash512(refresh schema.RefreshToken) ([]byte, error) {
 	var partRefresh []byte
 	if len(refresh) > 72 {
@@ -105,187 +183,22 @@ func hashRefresh(refresh schema.RefreshToken) ([]byte, error) {
 	return res, nil
 }
 
-func (p *PostgresServiceImpl) insertRefresh(ctx context.Context, tx pgx.Tx, uuid string, refresh schema.RefreshToken, userAgent string, IP string) error {
-	query := `
-INSERT INTO auth (id, refresh_hash, user_agent, ip)
-VALUES ($1, $2, $3, $4)
-`
-
-	refreshHash, err := hashRefresh(refresh)
-	if err != nil {
-		return fmt.Errorf("can't hash refresh token: %w", err)
-	}
-
-	_, err = tx.Exec(ctx, query, uuid, refreshHash, userAgent, IP)
-	if err != nil {
-		return fmt.Errorf("can't insert refresh token: %w", err)
-	}
-
-	p.l.Debug("done insert", zap.String("uuid", uuid), zap.String("refresh", refresh), zap.ByteString("refresh_hash", refreshHash))
-
-	return nil
-}
-
-func (p *PostgresServiceImpl) PutRefresh(ctx context.Context, uuid string, oldRefresh, newRefresh schema.RefreshToken, userAgent string, IP string) (bool, error) {
-	tx, err := p.pool.Begin(ctx)
-	if err != nil {
-		return false, fmt.Errorf("can't start transaction: %w", err)
-	}
-	defer tx.Rollback(ctx)
-
-	if oldRefresh == "" {
-		err = p.insertRefresh(ctx, tx, uuid, newRefresh, userAgent, IP)
-		if err != nil {
-			return false, fmt.Errorf("can't insert refresh token: %w", err)
-		}
-
-		err = tx.Commit(ctx)
-		if err != nil {
-			return false, fmt.Errorf("can't commit transaction: %w", err)
-		}
-		return true, nil
-	}
-
-	queryGet := `
-SELECT user_agent, ip
-FROM auth
-WHERE id = $1
-`
-	var storedUserAgent, storedIP string
-	err = tx.QueryRow(ctx, queryGet, uuid).Scan(&storedUserAgent, &storedIP)
-	if errors.Is(err, pgx.ErrNoRows) {
-		p.l.Info("auth info not found", zap.String("uuid", uuid))
-		err = p.insertRefresh(ctx, tx, uuid, newRefresh, userAgent, IP)
-		if err != nil {
-			return false, fmt.Errorf("can't insert refresh token: %w", err)
-		}
-
-		err = tx.Commit(ctx)
-		if err != nil {
-			return false, fmt.Errorf("can't commit transaction: %w", err)
-		}
-		return true, nil
-	} else if err != nil {
-		return false, fmt.Errorf("can't ask for refresh token: %w", err)
-	} else if storedUserAgent != userAgent {
-		return false, fmt.Errorf("%w: was %s, now %s", ErrWrongUserAgent, storedUserAgent, userAgent)
-	}
-
-	querySet := `
-UPDATE auth
-SET refresh_hash = $1, ip = $2
-WHERE id = $3
-`
-
-	newRefreshHash, err := hashRefresh(newRefresh)
-	if err != nil {
-		return false, fmt.Errorf("can't generate refresh hash: %w", err)
-	}
-
-	_, err = tx.Exec(ctx, querySet, newRefreshHash, IP, uuid)
-	if err != nil {
-		return false, fmt.Errorf("can't update refresh token: %w", err)
-	}
-
-	err = tx.Commit(ctx)
-	if err != nil {
-		return false, fmt.Errorf("can't commit transaction: %w", err)
-	}
-
-	return storedIP != IP, nil
-}
-
-func (p *PostgresServiceImpl) FindRefresh(ctx context.Context, uuid string, refresh schema.RefreshToken) (bool, error) {
-	query := `
-SELECT refresh_hash
-FROM auth
-WHERE id = $1
-`
-	var retrievedHash []byte
-	err := p.pool.QueryRow(ctx, query, uuid).Scan(&retrievedHash)
-	if errors.Is(err, pgx.ErrNoRows) {
-		return false, nil
-	} else if err != nil {
-		return false, fmt.Errorf("can't find refresh_hash for uuid %s: %w", uuid, err)
-	}
-
-	partRefreshHash, err := hash512(refresh)
-	if err != nil {
-		return false, fmt.Errorf("can't generate refresh hash: %w", err)
-	}
-
-	p.l.Debug("compare hashes", zap.ByteString("found", retrievedHash), zap.ByteString("got", partRefreshHash), zap.String("refresh", refresh))
-
-	err = bcrypt.CompareHashAndPassword(retrievedHash, partRefreshHash)
-	if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
-		return false, nil
-	} else if err != nil {
-		return false, fmt.Errorf("can't compare refresh hashes: %w", err)
-	}
-	return true, nil
-}
-
-func (p *PostgresServiceImpl) Remove(ctx context.Context, uuid string) error {
-	query := `
-DELETE FROM storage
-WHERE id = $1
-`
-
-	_, err := p.pool.Exec(ctx, query, uuid)
-	if err != nil {
-		fmt.Errorf("failed to remove uuid %s from authorized: %w", uuid, err)
-	}
-
-	return nil
-}
-
-func (p *PostgresServiceImpl) ReviveKeys(ctx context.Context) ([]string, error) {
-	query := `
-SELECT encode(access_key, 'hex'), encode(refresh_key, 'hex'), encode(refresh_hash_key, 'hex')
-FROM keys
-ORDER BY created_at DESC
-LIMIT 1
-`
-	keys := make([]string, 3)
-	hexKeys := make([]string, 3)
-	err := p.pool.QueryRow(ctx, query).Scan(&hexKeys[0], &hexKeys[1], &hexKeys[2])
-	if err != nil {
-		return nil, fmt.Errorf("can't revive keys: %w", err)
-	}
-
-	for i, encKey := range hexKeys {
-		key, err := hex.DecodeString(encKey)
-		if err != nil {
-			return nil, fmt.Errorf("can't decode key: %w", err)
-		}
-		keys[i] = string(key)
-	}
-
-	p.l.Debug("revived keys", zap.Strings("keys", keys))
-
-	return keys, nil
+// hashRefresh runs bcrypt hashing in the hasher
+func (p *PostgresServiceImpl) hashRefresh(ctx context.Context, refresh schema.RefreshToken) ([]byte, error) {
+	var res []byte
+	err := p.hasher.Do(ctx, func() (err error) {
+		res, err = hashRefresh(refresh)
+		return err
+	})
+	return res, err
 }
 
-func (p *PostgresServiceImpl) StoreKeys(ctx context.Context, keys []string) error {
-	if len(keys) < 3 {
-		return fmt.Errorf("not enough keys to store, want 3 but has %d", len(keys))
-	}
-
-	p.l.Debug("storing keys", zap.Strings("keys", keys))
-
-	hexVals := make([]string, 3)
-	for i, key := range keys {
-		hexVals[i] = hex.EncodeToString([]byte(key))
-	}
-
-	query := `
-INSERT INTO keys (access_key, refresh_key, refresh_hash_key)
-VALUES (decode($1, 'hex'), decode($2, 'hex'), decode($3, 'hex'))
-`
-	_, err := p.pool.Exec(ctx, query, hexVals[0], hexVals[1], hexVals[2])
-	if err != nil {
-		fmt.Errorf("can't store keys: %w", err)
-	}
-
-	return nil
+// compareRefresh runs bcrypt comparison in the hasher
+func (p *PostgresServiceImpl) compareRefresh(ctx context.Context, hash []byte, refresh schema.RefreshToken) (bool, error) {
+	var res bool
+	err := p.hasher.Do(ctx, func() (err error) {
+		res, err = compareRefresh(hash, refresh)
+		return err
+	})
+	return res, err
 }
@@ -0,0 +1,452 @@
+package postgres
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/rinnothing/simple-jwt/internal/api/schema"
+
+	"github.com/jackc/pgx/v5"
+	"go.uber.org/zap"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Session is a single row of sessions table, user may have one per device
+type Session struct {
+	ID         string
+	UUID       string
+	UserAgent  string
+	IP         string
+	CreatedAt  time.Time
+	LastUsedAt time.Time
+
+	// keyed hash of the latest access token, only written
+	AccessFingerprint string
+	// session of api key or oauth client belongs to it, at most one of them is set, they are only written
+	APIKeyID      string
+	OAuthClientID string
+}
+
+// CreateSession stores a new session together with the first refresh token of its family,
+// refreshID is empty for tokens which have no id
+func (p *PostgresServiceImpl) CreateSession(ctx context.Context, session Session, refreshID string, refresh schema.RefreshToken) error {
+	query := `
+INSERT INTO sessions (id, user_id, refresh_hash, access_fingerprint, user_agent, ip, api_key_id, oauth_client_id)
+VALUES ($1, $2, $3, $4, $5, $6, NULLIF($7::TEXT, '')::UUID, NULLIF($8, ''))
+`
+
+	refreshHash, err := p.hashRefresh(ctx, refresh)
+	if err != nil {
+		return fmt.Errorf("can't hash refresh token: %w", err)
+	}
+
+	tx, err := p.pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("can't start transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	_, err = tx.Exec(ctx, query, session.ID, session.UUID, refreshHash, session.AccessFingerprint, session.UserAgent, session.IP,
+		session.APIKeyID, session.OAuthClientID)
+	if err != nil {
+		return fmt.Errorf("can't insert session: %w", err)
+	}
+
+	err = p.insertFamilyMember(ctx, tx, session.ID, "", refreshID)
+	if err != nil {
+		return err
+	}
+
+	err = tx.Commit(ctx)
+	if err != nil {
+		return fmt.Errorf("can't commit transaction: %w", err)
+	}
+
+	p.l.Debug("session created", zap.String("session", session.ID), zap.String("uuid", session.UUID))
+
+	return nil
+}
+
+// CreateAccessSession stores session of access token issued without refresh token for api key or oauth client.
+// Sessions of the same key or client older than lifetime have only expired tokens, so they are removed on the way
+func (p *PostgresServiceImpl) CreateAccessSession(ctx context.Context, session Session, lifetime time.Duration) error {
+	cleanup := `
+DELETE FROM sessions
+WHERE (api_key_id = NULLIF($1::TEXT, '')::UUID OR oauth_client_id = NULLIF($2, ''))
+    AND created_at < now() - make_interval(secs => $3)
+`
+	// refresh_hash stays empty, there is no refresh token to check against it
+	query := `
+INSERT INTO sessions (id, user_id, refresh_hash, access_fingerprint, user_agent, ip, api_key_id, oauth_client_id)
+VALUES ($1, $2, '', $3, $4, $5, NULLIF($6::TEXT, '')::UUID, NULLIF($7, ''))
+`
+
+	tx, err := p.pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("can't start transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	tag, err := tx.Exec(ctx, cleanup, session.APIKeyID, session.OAuthClientID, lifetime.Seconds())
+	if err != nil {
+		return fmt.Errorf("can't remove expired sessions: %w", err)
+	}
+
+	_, err = tx.Exec(ctx, query, session.ID, session.UUID, session.AccessFingerprint, session.UserAgent, session.IP,
+		session.APIKeyID, session.OAuthClientID)
+	if err != nil {
+		return fmt.Errorf("can't insert session: %w", err)
+	}
+
+	err = tx.Commit(ctx)
+	if err != nil {
+		return fmt.Errorf("can't commit transaction: %w", err)
+	}
+
+	p.l.Debug("access session created", zap.String("session", session.ID), zap.String("uuid", session.UUID),
+		zap.Int64("expired_removed", tag.RowsAffected()))
+
+	return nil
+}
+
+// ListSessions returns sessions the user logged in to, the most recently used first.
+// Sessions of api keys and oauth clients are left out, they are managed with the keys and clients
+func (p *PostgresServiceImpl) ListSessions(ctx context.Context, uuid string) ([]Session, error) {
+	query := `
+SELECT id, user_id, user_agent, ip, created_at, last_used_at
+FROM sessions
+WHERE user_id = $1 AND api_key_id IS NULL AND oauth_client_id IS NULL
+ORDER BY last_used_at DESC
+`
+
+	rows, err := p.pool.Query(ctx, query, uuid)
+	if err != nil {
+		return nil, fmt.Errorf("can't query sessions: %w", err)
+	}
+	defer rows.Close()
+
+	var sessions []Session
+	for rows.Next() {
+		var session Session
+		err = rows.Scan(&session.ID, &session.UUID, &session.UserAgent, &session.IP, &session.CreatedAt, &session.LastUsedAt)
+		if err != nil {
+			return nil, fmt.Errorf("can't scan session: %w", err)
+		}
+		sessions = append(sessions, session)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("can't read sessions: %w", err)
+	}
+
+	return sessions, nil
+}
+
+// Rotation describes replacement of session refresh token, refresh tokens are v1 forms computed from access tokens
+type Rotation struct {
+	SessionID string
+	// ids of presented and new refresh tokens, empty for tokens which have none
+	ParentID  string
+	RefreshID string
+
+	OldRefresh schema.RefreshToken
+	NewRefresh schema.RefreshToken
+	// fingerprint of the new access token
+	NewFingerprint string
+	// sealed new pair, duplicates of the rotation within grace period get it instead of failing
+	Successor []byte
+
+	UserAgent string
+	IP        string
+}
+
+// PutRefresh rotates refresh token of the session, rotations of one session are serialized by the row lock,
+// so presented token is checked and replaced atomically. Returns true if IP has changed.
+// If presented token was rotated less than grace ago and its successor is still current, AlreadyRotatedError
+// with the sealed successor is returned, if it was rotated before, ErrRefreshReused is returned
+func (p *PostgresServiceImpl) PutRefresh(ctx context.Context, rotation Rotation, grace time.Duration) (bool, error) {
+	// hashing and comparing wait for bcrypt limiter, they are done before the transaction
+	// to hold neither row lock nor connection meanwhile, the compared hash is checked again under the lock
+	newRefreshHash, err := p.hashRefresh(ctx, rotation.NewRefresh)
+	if err != nil {
+		return false, fmt.Errorf("can't generate refresh hash: %w", err)
+	}
+
+	var comparedHash []byte
+	err = p.pool.QueryRow(ctx, `SELECT refresh_hash FROM sessions WHERE id = $1`, rotation.SessionID).Scan(&comparedHash)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return false, fmt.Errorf("%w: %s", ErrSessionNotFound, rotation.SessionID)
+	} else if err != nil {
+		return false, fmt.Errorf("can't ask for session: %w", err)
+	}
+	matched, err := p.compareRefresh(ctx, comparedHash, rotation.OldRefresh)
+	if err != nil {
+		return false, err
+	}
+
+	tx, err := p.pool.Begin(ctx)
+	if err != nil {
+		return false, fmt.Errorf("can't start transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	// sessions of oauth clients aren't bound to user agent, clients authenticate with their secret instead
+	queryGet := `
+SELECT user_agent, ip, refresh_hash, oauth_client_id IS NOT NULL
+FROM sessions
+WHERE id = $1
+FOR UPDATE
+`
+	var storedUserAgent, storedIP string
+	var storedHash []byte
+	var ofClient bool
+	err = tx.QueryRow(ctx, queryGet, rotation.SessionID).Scan(&storedUserAgent, &storedIP, &storedHash, &ofClient)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return false, fmt.Errorf("%w: %s", ErrSessionNotFound, rotation.SessionID)
+	} else if err != nil {
+		return false, fmt.Errorf("can't ask for session: %w", err)
+	} else if !ofClient && storedUserAgent != rotation.UserAgent {
+		return false, fmt.Errorf("%w: was %s, now %s", ErrWrongUserAgent, storedUserAgent, rotation.UserAgent)
+	}
+
+	// hash changed since the compare means concurrent rotation replaced the presented token
+	current := matched && subtle.ConstantTimeCompare(storedHash, comparedHash) == 1
+	if !current {
+		return false, p.staleRefresh(ctx, tx, rotation, grace)
+	}
+
+	if rotation.ParentID != "" {
+		// only the latest rotated token keeps its successor, the older ones can't be returned anymore
+		queryRotate := `
+UPDATE refresh_tokens
+SET rotated_at = COALESCE(rotated_at, now()), successor = CASE WHEN id = $1 THEN $3::BYTEA END
+WHERE session_id = $2 AND (id = $1 OR successor IS NOT NULL)
+`
+		_, err = tx.Exec(ctx, queryRotate, rotation.ParentID, rotation.SessionID, rotation.Successor)
+		if err != nil {
+			return false, fmt.Errorf("can't mark refresh token as rotated: %w", err)
+		}
+	}
+
+	err = p.insertFamilyMember(ctx, tx, rotation.SessionID, rotation.ParentID, rotation.RefreshID)
+	if err != nil {
+		return false, err
+	}
+
+	querySet := `
+UPDATE sessions
+SET refresh_hash = $1, access_fingerprint = $2, ip = $3, user_agent = $4, last_used_at = now()
+WHERE id = $5
+`
+
+	_, err = tx.Exec(ctx, querySet, newRefreshHash, rotation.NewFingerprint, rotation.IP, rotation.UserAgent, rotation.SessionID)
+	if err != nil {
+		return false, fmt.Errorf("can't update refresh token: %w", err)
+	}
+
+	err = notifySession(ctx, tx, rotation.SessionID)
+	if err != nil {
+		return false, err
+	}
+
+	err = tx.Commit(ctx)
+	if err != nil {
+		return false, fmt.Errorf("can't commit transaction: %w", err)
+	}
+
+	return storedIP != rotation.IP, nil
+}
+
+// ClearSuccessors drops sealed pairs of rotations older than grace, duplicates can't get them anymore.
+// It's run periodically rather than on each rotation, returns how many were dropped
+func (p *PostgresServiceImpl) ClearSuccessors(ctx context.Context, grace time.Duration) (int64, error) {
+	query := `
+UPDATE refresh_tokens
+SET successor = NULL
+WHERE successor IS NOT NULL AND rotated_at <= now() - make_interval(secs => $1)
+`
+	tag, err := p.pool.Exec(ctx, query, grace.Seconds())
+	if err != nil {
+		return 0, fmt.Errorf("can't clear successors: %w", err)
+	}
+	return tag.RowsAffected(), nil
+}
+
+// staleRefresh tells why presented token isn't the current one of the session
+func (p *PostgresServiceImpl) staleRefresh(ctx context.Context, tx pgx.Tx, rotation Rotation, grace time.Duration) error {
+	if rotation.ParentID == "" {
+		return fmt.Errorf("%w: %s", ErrStaleRefresh, rotation.SessionID)
+	}
+
+	query := `
+SELECT rotated_at > now() - make_interval(secs => $3), successor
+FROM refresh_tokens
+WHERE id = $1 AND session_id = $2 AND rotated_at IS NOT NULL
+`
+	var inGrace bool
+	var successor []byte
+	err := tx.QueryRow(ctx, query, rotation.ParentID, rotation.SessionID, grace.Seconds()).Scan(&inGrace, &successor)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return fmt.Errorf("%w: %s", ErrStaleRefresh, rotation.SessionID)
+	} else if err != nil {
+		return fmt.Errorf("can't check refresh token %s: %w", rotation.ParentID, err)
+	}
+
+	// successor is cleared once it's rotated itself, so it's still the current pair of the session
+	if inGrace && successor != nil {
+		return &AlreadyRotatedError{Successor: successor}
+	}
+	return fmt.Errorf("%w: %s", ErrRefreshReused, rotation.ParentID)
+}
+
+// AlreadyRotatedError is returned for duplicate rotation within grace period, it matches ErrAlreadyRotated
+type AlreadyRotatedError struct {
+	Successor []byte
+}
+
+func (e *AlreadyRotatedError) Error() string {
+	return ErrAlreadyRotated.Error()
+}
+
+func (e *AlreadyRotatedError) Unwrap() error {
+	return ErrAlreadyRotated
+}
+
+func (p *PostgresServiceImpl) insertFamilyMember(ctx context.Context, tx pgx.Tx, sessionID, parentID, refreshID string) error {
+	if refreshID == "" {
+		return nil
+	}
+
+	query := `
+INSERT INTO refresh_tokens (id, session_id, parent_id)
+VALUES ($1, $2, NULLIF($3, ''))
+`
+	_, err := tx.Exec(ctx, query, refreshID, sessionID, parentID)
+	if err != nil {
+		return fmt.Errorf("can't insert refresh token into family: %w", err)
+	}
+
+	return nil
+}
+
+// FindAccess tells if access token with the fingerprint is the latest one of the session,
+// refresh is compared with bcrypt only for sessions which have no fingerprint yet
+func (p *PostgresServiceImpl) FindAccess(ctx context.Context, sessionID, fingerprint string, refresh schema.RefreshToken) (bool, error) {
+	query := `
+SELECT access_fingerprint, refresh_hash
+FROM sessions
+WHERE id = $1
+`
+	var storedFingerprint *string
+	var retrievedHash []byte
+	err := p.pool.QueryRow(ctx, query, sessionID).Scan(&storedFingerprint, &retrievedHash)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return false, nil
+	} else if err != nil {
+		return false, fmt.Errorf("can't find access fingerprint for session %s: %w", sessionID, err)
+	}
+
+	if storedFingerprint != nil {
+		return matchFingerprint(*storedFingerprint, fingerprint), nil
+	}
+	return p.compareRefresh(ctx, retrievedHash, refresh)
+}
+
+func matchFingerprint(stored, fingerprint string) bool {
+	return subtle.ConstantTimeCompare([]byte(stored), []byte(fingerprint)) == 1
+}
+
+// RemoveSession ends session of the user, returns false if user has no such session.
+// Removals are announced to other instances in SessionEventsChannel
+func (p *PostgresServiceImpl) RemoveSession(ctx context.Context, uuid, sessionID string) (bool, error) {
+	query := `
+WITH removed AS (
+    DELETE FROM sessions
+    WHERE id = $1 AND user_id = $2
+    RETURNING id
+)
+SELECT pg_notify($3, id) FROM removed
+`
+
+	tag, err := p.pool.Exec(ctx, query, sessionID, uuid, SessionEventsChannel)
+	if err != nil {
+		return false, fmt.Errorf("failed to remove session %s: %w", sessionID, err)
+	}
+
+	return tag.RowsAffected() != 0, nil
+}
+
+// RemoveOtherSessions ends all sessions of the user except the kept one
+func (p *PostgresServiceImpl) RemoveOtherSessions(ctx context.Context, uuid, keepSessionID string) error {
+	query := `
+WITH removed AS (
+    DELETE FROM sessions
+    WHERE user_id = $1 AND id <> $2
+    RETURNING id
+)
+SELECT pg_notify($3, id) FROM removed
+`
+
+	_, err := p.pool.Exec(ctx, query, uuid, keepSessionID, SessionEventsChannel)
+	if err != nil {
+		return fmt.Errorf("failed to remove other sessions of uuid %s: %w", uuid, err)
+	}
+
+	return nil
+}
+
+// RemoveSessions ends all sessions of the user, uuid itself stays bound to the guid
+func (p *PostgresServiceImpl) RemoveSessions(ctx context.Context, uuid string) error {
+	query := `
+WITH removed AS (
+    DELETE FROM sessions
+    WHERE user_id = $1
+    RETURNING id
+)
+SELECT pg_notify($2, id) FROM removed
+`
+
+	_, err := p.pool.Exec(ctx, query, uuid, SessionEventsChannel)
+	if err != nil {
+		return fmt.Errorf("failed to remove sessions of uuid %s: %w", uuid, err)
+	}
+
+	return nil
+}
+
+func compareRefresh(hash []byte, refresh schema.RefreshToken) (bool, error) {
+	partRefreshHash, err := hash512(refresh)
+	if err != nil {
+		return false, fmt.Errorf("can't generate refresh hash: %w", err)
+	}
+
+	err = bcrypt.CompareHashAndPassword(hash, partRefreshHash)
+	if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+		return false, nil
+	} else if err != nil {
+		return false, fmt.Errorf("can't compare refresh hashes: %w", err)
+	}
+	return true, nil
+}
+
+// notifySession announces change of the session, it's delivered on commit
+func notifySession(ctx context.Context, tx pgx.Tx, sessionID string) error {
+	_, err := tx.Exec(ctx, "SELECT pg_notify($1, $2)", SessionEventsChannel, sessionID)
+	if err != nil {
+		return fmt.Errorf("can't notify about session %s: %w", sessionID, err)
+	}
+	return nil
+}
+
+// RefreshV2Since returns when v2 refresh tokens were rolled out, it doesn't change between restarts
+func (p *PostgresServiceImpl) RefreshV2Since(ctx context.Context) (time.Time, error) {
+	var since time.Time
+	err := p.pool.QueryRow(ctx, `SELECT v2_since FROM refresh_rollout`).Scan(&since)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("can't get v2 refresh rollout time: %w", err)
+	}
+
+	return since, nil
+}
@@ -0,0 +1,43 @@
+package postgres
+
+import (
+	"testing"
+
+	"github.com/rinnothing/simple-jwt/internal/api/schema"
+	"github.com/rinnothing/simple-jwt/utils/jwt"
+	"github.com/stretchr/testify/require"
+)
+
+// access check of session which has no fingerprint yet, it's how every check was made before
+func BenchmarkMatchAccessBcrypt(b *testing.B) {
+	tool, access := benchTool(b)
+	refresh := schema.RefreshToken(tool.AccessToRefresh(access))
+	storedHash, err := hashRefresh(refresh)
+	require.NoError(b, err)
+
+	for b.Loop() {
+		found, err := compareRefresh(storedHash, schema.RefreshToken(tool.AccessToRefresh(access)))
+		require.NoError(b, err)
+		require.True(b, found)
+	}
+}
+
+func BenchmarkMatchAccessFingerprint(b *testing.B) {
+	tool, access := benchTool(b)
+	storedFingerprint := tool.Fingerprint(access)
+
+	for b.Loop() {
+		require.True(b, matchFingerprint(storedFingerprint, tool.Fingerprint(access)))
+	}
+}
+
+func benchTool(b *testing.B) (*jwt.Tool, jwt.AccessToken) {
+	signer, err := jwt.NewSigner(jwt.HS512, jwt.GenerateKey())
+	require.NoError(b, err)
+
+	tool := jwt.NewJWTTool(jwt.NewKeyring(signer), jwt.GenerateKey(), jwt.GenerateKey())
+	access, _, err := tool.IssueTokens(b.Context(), "12345", nil)
+	require.NoError(b, err)
+
+	return tool, access
+}
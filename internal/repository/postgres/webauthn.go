@@ -0,0 +1,151 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+var ErrCredentialExists = errors.New("webauthn credential is already registered")
+
+// WebAuthnCredential is registered passkey, PublicKey is COSE_Key
+type WebAuthnCredential struct {
+	ID        []byte
+	UUID      string
+	PublicKey []byte
+	SignCount uint32
+	AAGUID    []byte
+	Format    string
+}
+
+// WebAuthnChallenge is pending ceremony, it's found by sha256 of the challenge.
+// UUID is empty for login, where user is known only from the credential
+type WebAuthnChallenge struct {
+	ChallengeHash []byte
+	UUID          string
+	Ceremony      string
+	ExpiresAt     time.Time
+}
+
+// CreateWebAuthnChallenge stores challenge, expired ones are cleaned up on the way
+func (p *PostgresServiceImpl) CreateWebAuthnChallenge(ctx context.Context, challenge WebAuthnChallenge) error {
+	_, err := p.pool.Exec(ctx, `DELETE FROM webauthn_challenges WHERE expires_at < now()`)
+	if err != nil {
+		return fmt.Errorf("can't remove expired webauthn challenges: %w", err)
+	}
+
+	query := `
+INSERT INTO webauthn_challenges (challenge_hash, user_id, ceremony, expires_at)
+VALUES ($1, NULLIF($2, '')::UUID, $3, $4)
+`
+	_, err = p.pool.Exec(ctx, query, challenge.ChallengeHash, challenge.UUID, challenge.Ceremony, challenge.ExpiresAt)
+	if err != nil {
+		return fmt.Errorf("can't insert webauthn challenge: %w", err)
+	}
+
+	return nil
+}
+
+// TakeWebAuthnChallenge removes challenge of the ceremony and returns it, found is false if it's used or expired
+func (p *PostgresServiceImpl) TakeWebAuthnChallenge(ctx context.Context, challengeHash []byte, ceremony string) (WebAuthnChallenge, bool, error) {
+	query := `
+DELETE FROM webauthn_challenges
+WHERE challenge_hash = $1 AND ceremony = $2 AND expires_at > now()
+RETURNING COALESCE(user_id::TEXT, ''), expires_at
+`
+	challenge := WebAuthnChallenge{ChallengeHash: challengeHash, Ceremony: ceremony}
+	err := p.pool.QueryRow(ctx, query, challengeHash, ceremony).Scan(&challenge.UUID, &challenge.ExpiresAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return WebAuthnChallenge{}, false, nil
+	}
+	if err != nil {
+		return WebAuthnChallenge{}, false, fmt.Errorf("can't take webauthn challenge: %w", err)
+	}
+
+	return challenge, true, nil
+}
+
+// PutWebAuthnCredential stores new credential, it fails with ErrCredentialExists if the id is already taken
+func (p *PostgresServiceImpl) PutWebAuthnCredential(ctx context.Context, credential WebAuthnCredential) error {
+	query := `
+INSERT INTO webauthn_credentials (id, user_id, public_key, sign_count, aaguid, attestation_format)
+VALUES ($1, $2, $3, $4, $5, $6)
+ON CONFLICT (id) DO NOTHING
+`
+	tag, err := p.pool.Exec(ctx, query, credential.ID, credential.UUID, credential.PublicKey,
+		int64(credential.SignCount), credential.AAGUID, credential.Format)
+	if err != nil {
+		return fmt.Errorf("can't insert webauthn credential: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrCredentialExists
+	}
+
+	return nil
+}
+
+// ListWebAuthnCredentials returns ids of credentials of the user
+func (p *PostgresServiceImpl) ListWebAuthnCredentials(ctx context.Context, uuid string) ([][]byte, error) {
+	rows, err := p.pool.Query(ctx, `SELECT id FROM webauthn_credentials WHERE user_id = $1 ORDER BY created_at`, uuid)
+	if err != nil {
+		return nil, fmt.Errorf("can't list webauthn credentials: %w", err)
+	}
+
+	defer rows.Close()
+
+	var ids [][]byte
+	for rows.Next() {
+		var id []byte
+		err = rows.Scan(&id)
+		if err != nil {
+			return nil, fmt.Errorf("can't scan webauthn credential: %w", err)
+		}
+		ids = append(ids, id)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("can't read webauthn credentials: %w", err)
+	}
+
+	return ids, nil
+}
+
+// GetWebAuthnCredential returns credential by its id, found is false if there is none
+func (p *PostgresServiceImpl) GetWebAuthnCredential(ctx context.Context, id []byte) (WebAuthnCredential, bool, error) {
+	query := `
+SELECT user_id, public_key, sign_count, aaguid, attestation_format
+FROM webauthn_credentials
+WHERE id = $1
+`
+	credential := WebAuthnCredential{ID: id}
+	var signCount int64
+	err := p.pool.QueryRow(ctx, query, id).Scan(&credential.UUID, &credential.PublicKey, &signCount,
+		&credential.AAGUID, &credential.Format)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return WebAuthnCredential{}, false, nil
+	}
+	if err != nil {
+		return WebAuthnCredential{}, false, fmt.Errorf("can't get webauthn credential: %w", err)
+	}
+	credential.SignCount = uint32(signCount)
+
+	return credential, true, nil
+}
+
+// UseWebAuthnCredential moves sign count of the credential forward, it's false if the count didn't grow,
+// which means the authenticator may be cloned. Credentials which never count stay at zero
+func (p *PostgresServiceImpl) UseWebAuthnCredential(ctx context.Context, id []byte, signCount uint32) (bool, error) {
+	query := `
+UPDATE webauthn_credentials
+SET sign_count = $2, last_used_at = now()
+WHERE id = $1 AND (sign_count < $2 OR (sign_count = 0 AND $2 = 0))
+`
+	tag, err := p.pool.Exec(ctx, query, id, int64(signCount))
+	if err != nil {
+		return false, fmt.Errorf("can't update webauthn sign count: %w", err)
+	}
+
+	return tag.RowsAffected() == 1, nil
+}
@@ -0,0 +1,228 @@
+package apikey
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/rinnothing/simple-jwt/internal/config"
+	"github.com/rinnothing/simple-jwt/internal/repository/postgres"
+	"github.com/rinnothing/simple-jwt/utils/digest"
+
+	"go.uber.org/zap"
+)
+
+const (
+	// keys are told apart from access tokens by it
+	Prefix = "sjwt_"
+
+	// what keys and tokens exchanged for them may be used for
+	ScopeGUIDRead     = "guid:read"
+	ScopeSessionsRead = "sessions:read"
+
+	defaultMaxKeys = 20
+	maxLabelLength = 100
+	keySize        = 32
+	// characters of the key kept to tell keys apart
+	shownSize = 6
+)
+
+var Scopes = []string{ScopeGUIDRead, ScopeSessionsRead}
+
+var (
+	ErrInvalidKey   = errors.New("api key is unknown, expired or revoked")
+	ErrNotFound     = errors.New("api key not found")
+	ErrTooManyKeys  = errors.New("too many api keys")
+	ErrInvalidScope = errors.New("unknown scope")
+	ErrInvalidLabel = errors.New("label must be from 1 to 100 characters")
+	ErrExpiry       = errors.New("api key expiry is in the past or beyond the allowed lifetime")
+)
+
+// Key is api key without the secret, which is shown only once on creation
+type Key struct {
+	ID     string
+	Label  string
+	Prefix string
+	Scopes []string
+	// zero if the key never expires
+	ExpiresAt  time.Time
+	CreatedAt  time.Time
+	LastUsedAt time.Time
+}
+
+type APIKeyService interface {
+	Create(ctx context.Context, uuid, label string, scopes []string, expiresAt time.Time) (string, Key, error)
+	List(ctx context.Context, uuid string) ([]Key, error)
+	Label(ctx context.Context, uuid, id, label string) error
+	Revoke(ctx context.Context, uuid, id string) error
+
+	Authenticate(ctx context.Context, key string) (string, Key, error)
+}
+
+type APIKeyRepo interface {
+	PutAPIKey(ctx context.Context, key postgres.APIKey, keyHash []byte, maxKeys int) (postgres.APIKey, error)
+	ListAPIKeys(ctx context.Context, uuid string) ([]postgres.APIKey, error)
+	UseAPIKey(ctx context.Context, keyHash []byte) (postgres.APIKey, bool, error)
+	LabelAPIKey(ctx context.Context, uuid, id, label string) (bool, error)
+	RemoveAPIKey(ctx context.Context, uuid, id string) (bool, error)
+}
+
+type APIKeyServiceImpl struct {
+	l *zap.Logger
+
+	cfg  config.APIKeyConfig
+	repo APIKeyRepo
+	now  func() time.Time
+}
+
+func NewService(cfg config.APIKeyConfig, repo APIKeyRepo, l *zap.Logger) APIKeyService {
+	if cfg.MaxKeys <= 0 {
+		cfg.MaxKeys = defaultMaxKeys
+	}
+
+	return &APIKeyServiceImpl{
+		l:    l,
+		cfg:  cfg,
+		repo: repo,
+		now:  time.Now,
+	}
+}
+
+// IsKey tells if the credential is api key rather than access token
+func IsKey(credential string) bool {
+	return strings.HasPrefix(credential, Prefix)
+}
+
+// Shown is the beginning of the key, it's enough to tell keys apart and safe to log
+func Shown(key string) string {
+	return key[:min(len(key), len(Prefix)+shownSize)]
+}
+
+// Create makes new key, it's returned only here. Zero expiresAt means the key never expires,
+// if it's allowed by max_lifetime
+func (s *APIKeyServiceImpl) Create(ctx context.Context, uuid, label string, scopes []string, expiresAt time.Time) (string, Key, error) {
+	err := checkLabel(label)
+	if err != nil {
+		return "", Key{}, err
+	}
+	// key without scopes would give tokens which aren't limited at all
+	if len(scopes) == 0 {
+		return "", Key{}, fmt.Errorf("%w: at least one scope is required", ErrInvalidScope)
+	}
+	for _, scope := range scopes {
+		if !slices.Contains(Scopes, scope) {
+			return "", Key{}, fmt.Errorf("%w: %s", ErrInvalidScope, scope)
+		}
+	}
+	now := s.now()
+	if !expiresAt.IsZero() && !expiresAt.After(now) {
+		return "", Key{}, ErrExpiry
+	}
+	if s.cfg.MaxLifetime > 0 && (expiresAt.IsZero() || expiresAt.After(now.Add(s.cfg.MaxLifetime))) {
+		return "", Key{}, fmt.Errorf("%w: keys must expire within %s", ErrExpiry, s.cfg.MaxLifetime)
+	}
+
+	raw := make([]byte, keySize)
+	rand.Read(raw)
+	key := Prefix + base64.RawURLEncoding.EncodeToString(raw)
+
+	stored, err := s.repo.PutAPIKey(ctx, postgres.APIKey{
+		UUID:      uuid,
+		Prefix:    Shown(key),
+		Label:     label,
+		Scopes:    slices.Compact(slices.Sorted(slices.Values(scopes))),
+		ExpiresAt: expiresAt,
+	}, digest.Random(key), s.cfg.MaxKeys)
+	if errors.Is(err, postgres.ErrTooManyKeys) {
+		return "", Key{}, fmt.Errorf("%w: at most %d are allowed", ErrTooManyKeys, s.cfg.MaxKeys)
+	}
+	if err != nil {
+		return "", Key{}, err
+	}
+
+	return key, keyOf(stored), nil
+}
+
+func (s *APIKeyServiceImpl) List(ctx context.Context, uuid string) ([]Key, error) {
+	stored, err := s.repo.ListAPIKeys(ctx, uuid)
+	if err != nil {
+		return nil, err
+	}
+
+	keys := make([]Key, 0, len(stored))
+	for _, key := range stored {
+		keys = append(keys, keyOf(key))
+	}
+	return keys, nil
+}
+
+func (s *APIKeyServiceImpl) Label(ctx context.Context, uuid, id, label string) error {
+	err := checkLabel(label)
+	if err != nil {
+		return err
+	}
+
+	found, err := s.repo.LabelAPIKey(ctx, uuid, id, label)
+	if err != nil {
+		return err
+	}
+	if !found {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// Revoke removes the key, tokens it was already exchanged for stop working with it
+func (s *APIKeyServiceImpl) Revoke(ctx context.Context, uuid, id string) error {
+	found, err := s.repo.RemoveAPIKey(ctx, uuid, id)
+	if err != nil {
+		return err
+	}
+	if !found {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// Authenticate returns uuid of the key owner and the key
+func (s *APIKeyServiceImpl) Authenticate(ctx context.Context, key string) (string, Key, error) {
+	if !IsKey(key) {
+		return "", Key{}, ErrInvalidKey
+	}
+
+	stored, found, err := s.repo.UseAPIKey(ctx, digest.Random(key))
+	if err != nil {
+		return "", Key{}, err
+	}
+	if !found {
+		return "", Key{}, ErrInvalidKey
+	}
+
+	return stored.UUID, keyOf(stored), nil
+}
+
+func checkLabel(label string) error {
+	length := utf8.RuneCountInString(strings.TrimSpace(label))
+	if length == 0 || length > maxLabelLength {
+		return ErrInvalidLabel
+	}
+	return nil
+}
+
+func keyOf(key postgres.APIKey) Key {
+	return Key{
+		ID:         key.ID,
+		Label:      key.Label,
+		Prefix:     key.Prefix,
+		Scopes:     key.Scopes,
+		ExpiresAt:  key.ExpiresAt,
+		CreatedAt:  key.CreatedAt,
+		LastUsedAt: key.LastUsedAt,
+	}
+}
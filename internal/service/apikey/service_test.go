@@ -0,0 +1,166 @@
+package apikey
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/rinnothing/simple-jwt/internal/config"
+	"github.com/rinnothing/simple-jwt/internal/repository/postgres"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+type memoryRepo struct {
+	now func() time.Time
+
+	keys   []postgres.APIKey
+	hashes map[string]string
+}
+
+func (m *memoryRepo) PutAPIKey(_ context.Context, key postgres.APIKey, keyHash []byte, maxKeys int) (postgres.APIKey, error) {
+	count := 0
+	for _, stored := range m.keys {
+		if stored.UUID == key.UUID {
+			count++
+		}
+	}
+	if count >= maxKeys {
+		return postgres.APIKey{}, postgres.ErrTooManyKeys
+	}
+
+	key.ID, key.CreatedAt = strconv.Itoa(len(m.hashes)), m.now()
+	m.keys = append(m.keys, key)
+	m.hashes[string(keyHash)] = key.ID
+	return key, nil
+}
+
+func (m *memoryRepo) ListAPIKeys(_ context.Context, uuid string) ([]postgres.APIKey, error) {
+	var keys []postgres.APIKey
+	for _, key := range m.keys {
+		if key.UUID == uuid {
+			keys = append(keys, key)
+		}
+	}
+	return keys, nil
+}
+
+func (m *memoryRepo) find(uuid, id string) *postgres.APIKey {
+	for i := range m.keys {
+		if m.keys[i].ID == id && (uuid == "" || m.keys[i].UUID == uuid) {
+			return &m.keys[i]
+		}
+	}
+	return nil
+}
+
+func (m *memoryRepo) UseAPIKey(_ context.Context, keyHash []byte) (postgres.APIKey, bool, error) {
+	id, ok := m.hashes[string(keyHash)]
+	key := m.find("", id)
+	if !ok || key == nil || (!key.ExpiresAt.IsZero() && !m.now().Before(key.ExpiresAt)) {
+		return postgres.APIKey{}, false, nil
+	}
+	key.LastUsedAt = m.now()
+	return *key, true, nil
+}
+
+func (m *memoryRepo) LabelAPIKey(_ context.Context, uuid, id, label string) (bool, error) {
+	key := m.find(uuid, id)
+	if key == nil {
+		return false, nil
+	}
+	key.Label = label
+	return true, nil
+}
+
+func (m *memoryRepo) RemoveAPIKey(_ context.Context, uuid, id string) (bool, error) {
+	for i, key := range m.keys {
+		if key.ID == id && key.UUID == uuid {
+			m.keys = append(m.keys[:i], m.keys[i+1:]...)
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func newService(cfg config.APIKeyConfig) (*APIKeyServiceImpl, *time.Time) {
+	now := time.Unix(1700000000, 0)
+	repo := &memoryRepo{now: func() time.Time { return now }, hashes: make(map[string]string)}
+
+	s := NewService(cfg, repo, zap.NewNop()).(*APIKeyServiceImpl)
+	s.now = repo.now
+	return s, &now
+}
+
+func TestAPIKeys(t *testing.T) {
+	ctx := context.Background()
+	s, now := newService(config.APIKeyConfig{})
+
+	secret, key, err := s.Create(ctx, "uuid", "ci", []string{ScopeSessionsRead, ScopeGUIDRead, ScopeGUIDRead}, now.Add(time.Hour))
+	require.NoError(t, err)
+	require.True(t, IsKey(secret))
+	require.Equal(t, secret[:len(key.Prefix)], key.Prefix)
+	require.Equal(t, []string{ScopeGUIDRead, ScopeSessionsRead}, key.Scopes)
+
+	uuid, authenticated, err := s.Authenticate(ctx, secret)
+	require.NoError(t, err)
+	require.Equal(t, "uuid", uuid)
+	require.Equal(t, key.ID, authenticated.ID)
+	require.Equal(t, key.Scopes, authenticated.Scopes)
+
+	_, _, err = s.Authenticate(ctx, secret+"x")
+	require.ErrorIs(t, err, ErrInvalidKey)
+
+	// labels are changed only by the owner
+	require.NoError(t, s.Label(ctx, "uuid", key.ID, "deploy"))
+	require.ErrorIs(t, s.Label(ctx, "other", key.ID, "stolen"), ErrNotFound)
+	require.ErrorIs(t, s.Label(ctx, "uuid", key.ID, " "), ErrInvalidLabel)
+
+	keys, err := s.List(ctx, "uuid")
+	require.NoError(t, err)
+	require.Len(t, keys, 1)
+	require.Equal(t, "deploy", keys[0].Label)
+	require.Equal(t, *now, keys[0].LastUsedAt)
+
+	// expired keys don't work
+	*now = now.Add(time.Hour)
+	_, _, err = s.Authenticate(ctx, secret)
+	require.ErrorIs(t, err, ErrInvalidKey)
+
+	// revoked keys don't work
+	secret, key, err = s.Create(ctx, "uuid", "ci", []string{ScopeGUIDRead}, time.Time{})
+	require.NoError(t, err)
+	require.ErrorIs(t, s.Revoke(ctx, "other", key.ID), ErrNotFound)
+	require.NoError(t, s.Revoke(ctx, "uuid", key.ID))
+	_, _, err = s.Authenticate(ctx, secret)
+	require.ErrorIs(t, err, ErrInvalidKey)
+	require.ErrorIs(t, s.Revoke(ctx, "uuid", key.ID), ErrNotFound)
+}
+
+func TestAPIKeyLimits(t *testing.T) {
+	ctx := context.Background()
+	s, now := newService(config.APIKeyConfig{MaxKeys: 1, MaxLifetime: 24 * time.Hour})
+
+	_, _, err := s.Create(ctx, "uuid", "ci", nil, now.Add(time.Hour))
+	require.ErrorIs(t, err, ErrInvalidScope)
+	_, _, err = s.Create(ctx, "uuid", "ci", []string{"admin"}, now.Add(time.Hour))
+	require.ErrorIs(t, err, ErrInvalidScope)
+	_, _, err = s.Create(ctx, "uuid", "", []string{ScopeGUIDRead}, now.Add(time.Hour))
+	require.ErrorIs(t, err, ErrInvalidLabel)
+
+	// lifetime is limited
+	_, _, err = s.Create(ctx, "uuid", "ci", []string{ScopeGUIDRead}, time.Time{})
+	require.ErrorIs(t, err, ErrExpiry)
+	_, _, err = s.Create(ctx, "uuid", "ci", []string{ScopeGUIDRead}, now.Add(25*time.Hour))
+	require.ErrorIs(t, err, ErrExpiry)
+	_, _, err = s.Create(ctx, "uuid", "ci", []string{ScopeGUIDRead}, now.Add(-time.Second))
+	require.ErrorIs(t, err, ErrExpiry)
+
+	_, _, err = s.Create(ctx, "uuid", "ci", []string{ScopeGUIDRead}, now.Add(time.Hour))
+	require.NoError(t, err)
+	_, _, err = s.Create(ctx, "uuid", "ci", []string{ScopeGUIDRead}, now.Add(time.Hour))
+	require.ErrorIs(t, err, ErrTooManyKeys)
+	_, _, err = s.Create(ctx, "other", "ci", []string{ScopeGUIDRead}, now.Add(time.Hour))
+	require.NoError(t, err)
+}
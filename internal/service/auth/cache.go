@@ -0,0 +1,107 @@
+package auth
+
+import "sync"
+
+// accessCache keeps fingerprints of the latest access tokens of sessions, so HasAccess doesn't go to database.
+// It's only filled while session events of all instances are received, every event drops the session
+// and lost subscription drops everything, so revocation on another instance is seen right away
+type accessCache struct {
+	mu      sync.RWMutex
+	size    int
+	live    bool
+	entries map[string]string
+	// changes on every invalidation, so fingerprint read from database before it isn't cached
+	generation uint64
+}
+
+// newAccessCache returns nil if size isn't positive, nil cache keeps nothing
+func newAccessCache(size int) *accessCache {
+	if size <= 0 {
+		return nil
+	}
+	return &accessCache{
+		size:    size,
+		entries: make(map[string]string),
+	}
+}
+
+func (c *accessCache) has(sessionID, fingerprint string) bool {
+	if c == nil {
+		return false
+	}
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	stored, ok := c.entries[sessionID]
+	return ok && stored == fingerprint
+}
+
+// version should be taken before reading fingerprint from database and passed to put
+func (c *accessCache) version() uint64 {
+	if c == nil {
+		return 0
+	}
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.generation
+}
+
+func (c *accessCache) put(version uint64, sessionID, fingerprint string) {
+	if c == nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.live || version != c.generation {
+		return
+	}
+	if len(c.entries) >= c.size {
+		clear(c.entries)
+	}
+	c.entries[sessionID] = fingerprint
+}
+
+func (c *accessCache) SessionChanged(sessionID string) {
+	if c == nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.entries, sessionID)
+	c.generation++
+}
+
+// dropAll is used when sessions are changed locally, but their ids aren't known
+func (c *accessCache) dropAll() {
+	if c == nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	clear(c.entries)
+	c.generation++
+}
+
+func (c *accessCache) Resync() {
+	c.reset(true)
+}
+
+func (c *accessCache) Lost() {
+	c.reset(false)
+}
+
+func (c *accessCache) reset(live bool) {
+	if c == nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	clear(c.entries)
+	c.live = live
+	c.generation++
+}
@@ -0,0 +1,56 @@
+package auth
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestAccessCache(t *testing.T) {
+	c := newAccessCache(2)
+
+	// nothing is kept until events are received
+	c.put(c.version(), "a", "fa")
+	require.False(t, c.has("a", "fa"))
+
+	c.Resync()
+	c.put(c.version(), "a", "fa")
+	require.True(t, c.has("a", "fa"))
+	require.False(t, c.has("a", "fb"))
+
+	c.SessionChanged("a")
+	require.False(t, c.has("a", "fa"))
+
+	// fingerprint read before invalidation isn't cached
+	version := c.version()
+	c.SessionChanged("b")
+	c.put(version, "b", "fb")
+	require.False(t, c.has("b", "fb"))
+
+	c.put(c.version(), "a", "fa")
+	c.Lost()
+	require.False(t, c.has("a", "fa"))
+	c.put(c.version(), "a", "fa")
+	require.False(t, c.has("a", "fa"))
+}
+
+func TestAccessCacheSize(t *testing.T) {
+	c := newAccessCache(2)
+	c.Resync()
+
+	c.put(c.version(), "a", "fa")
+	c.put(c.version(), "b", "fb")
+	c.put(c.version(), "c", "fc")
+	require.True(t, c.has("c", "fc"))
+	require.LessOrEqual(t, len(c.entries), 2)
+}
+
+func TestNilAccessCache(t *testing.T) {
+	c := newAccessCache(0)
+	require.Nil(t, c)
+
+	c.Resync()
+	c.put(c.version(), "a", "fa")
+	c.SessionChanged("a")
+	require.False(t, c.has("a", "fa"))
+}
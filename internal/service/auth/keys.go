@@ -0,0 +1,311 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/rinnothing/simple-jwt/internal/repository/postgres"
+	"github.com/rinnothing/simple-jwt/utils/jwt"
+
+	"go.uber.org/zap"
+)
+
+const defaultKeyReloadInterval = time.Minute
+
+var (
+	ErrKeysConfigured = errors.New("access key is set in config")
+)
+
+// bootstrapKeys makes sure there is an active key version which matches configuration,
+// nothing is written if the stored one already does. Instances starting at once take turns,
+// so the first one creates keys and the others use them
+func (s *ServiceImpl) bootstrapKeys(ctx context.Context) error {
+	return s.repo.LockKeys(ctx, s.getOrCreateKeys)
+}
+
+func (s *ServiceImpl) getOrCreateKeys(ctx context.Context) error {
+	// keys stored in plain text or with previous key encryption key are wrapped with the current one first
+	_, err := s.repo.RewrapKeys(ctx)
+	if err != nil {
+		return err
+	}
+
+	versions, err := s.repo.ReviveKeys(ctx)
+	if err != nil {
+		return err
+	}
+
+	var active *postgres.KeyVersion
+	for i := range versions {
+		if versions[i].State == postgres.KeyActive {
+			active = &versions[i]
+		}
+	}
+	if active != nil && !s.configChanged(*active) {
+		return nil
+	}
+
+	next, err := s.newKeyVersion(s.cfg.AccessKey, active)
+	if err != nil {
+		return err
+	}
+
+	if active == nil {
+		next.State = postgres.KeyActive
+		_, err = s.repo.StoreKeys(ctx, next)
+		return err
+	}
+
+	// configuration has changed, so the new key is used right away, while the old one keeps verifying
+	s.l.Info("keys in config differ from stored ones, activating new keys", zap.String("algorithm", next.Algorithm))
+	_, err = s.repo.StoreKeys(ctx, next)
+	if err != nil {
+		return err
+	}
+	_, err = s.repo.PromoteKeys(ctx, s.keyOverlap())
+	return err
+}
+
+func (s *ServiceImpl) configChanged(active postgres.KeyVersion) bool {
+	return active.Algorithm != s.algorithm() ||
+		(s.cfg.AccessKey != "" && s.cfg.AccessKey != active.AccessKey) ||
+		(s.cfg.RefreshKey != "" && s.cfg.RefreshKey != active.RefreshKey) ||
+		(s.cfg.RefreshHashKey != "" && s.cfg.RefreshHashKey != active.RefreshHashKey)
+}
+
+// newKeyVersion makes pending version, refresh keys are kept from active version so refresh tokens survive rotation
+func (s *ServiceImpl) newKeyVersion(accessKey string, active *postgres.KeyVersion) (postgres.KeyVersion, error) {
+	var err error
+	if accessKey == "" {
+		accessKey, err = jwt.GenerateSigningKey(s.algorithm())
+		if err != nil {
+			return postgres.KeyVersion{}, fmt.Errorf("can't generate access key: %w", err)
+		}
+	}
+
+	next := postgres.KeyVersion{
+		Algorithm:      s.algorithm(),
+		AccessKey:      accessKey,
+		RefreshKey:     s.cfg.RefreshKey,
+		RefreshHashKey: s.cfg.RefreshHashKey,
+		State:          postgres.KeyVerifyOnly,
+		ActivatedAt:    time.Now(),
+	}
+	if next.RefreshKey == "" && active != nil {
+		next.RefreshKey = active.RefreshKey
+	}
+	if next.RefreshKey == "" {
+		next.RefreshKey = jwt.GenerateKey()
+	}
+	if next.RefreshHashKey == "" && active != nil {
+		next.RefreshHashKey = active.RefreshHashKey
+	}
+	if next.RefreshHashKey == "" {
+		next.RefreshHashKey = jwt.GenerateKey()
+	}
+
+	return next, nil
+}
+
+// loadKeys reads all usable versions from database and puts them into keyring
+func (s *ServiceImpl) loadKeys(ctx context.Context) error {
+	versions, err := s.repo.ReviveKeys(ctx)
+	if err != nil {
+		return err
+	}
+
+	var active jwt.Signer
+	var activeVersion postgres.KeyVersion
+	var verifiers []jwt.Verifier
+	hasPending := false
+	for _, version := range versions {
+		signer, err := jwt.NewSigner(version.Algorithm, version.AccessKey)
+		if err != nil {
+			s.l.Warn("skipping unusable keys", zap.Int("id", version.ID), zap.Error(err))
+			continue
+		}
+
+		if version.State == postgres.KeyActive {
+			active = signer
+			activeVersion = version
+		} else {
+			verifiers = append(verifiers, signer.Verifier())
+		}
+		hasPending = hasPending || version.Pending()
+	}
+	if active == nil {
+		return errors.New("no active keys found")
+	}
+	// stored access key only keeps verifying tokens signed before the remote signer was set up
+	if s.remote != nil {
+		verifiers = append(verifiers, active.Verifier())
+		active = s.remote
+	}
+
+	s.keysMu.Lock()
+	defer s.keysMu.Unlock()
+
+	if s.keys == nil {
+		s.keys = jwt.NewKeyring(active, verifiers...)
+	} else {
+		s.keys.Replace(active, verifiers...)
+	}
+	if activeVersion.ID != s.activeKeys.ID && s.activeKeys.ID != 0 {
+		s.l.Info("switched to new keys", zap.Int("id", activeVersion.ID), zap.String("kid", active.KeyID()))
+	}
+	// tool is made after the first load, then it follows refresh keys of the active version
+	if s.authTool != nil && activeVersion.ID != s.activeKeys.ID {
+		s.authTool.ReplaceRefreshKeys(activeVersion.RefreshKey, activeVersion.RefreshHashKey)
+	}
+	s.activeKeys = activeVersion
+	s.hasPending = hasPending
+
+	return nil
+}
+
+// RotateKeys publishes new key as verify-only, it becomes active after publish delay,
+// by that time every instance and every JWKS consumer already knows it and accepts tokens signed with it.
+// It holds the keys lock like scheduled rotation, so manual rotation doesn't race with instances
+func (s *ServiceImpl) RotateKeys(ctx context.Context) error {
+	return s.repo.LockKeys(ctx, func(ctx context.Context) error {
+		err := s.loadKeys(ctx)
+		if err != nil {
+			return err
+		}
+		return s.rotateKeys(ctx)
+	})
+}
+
+// rotateKeys publishes new key, the keys lock must be held
+func (s *ServiceImpl) rotateKeys(ctx context.Context) error {
+	if s.cfg.AccessKey != "" {
+		return fmt.Errorf("%w: rotated key would be replaced back on restart", ErrKeysConfigured)
+	}
+	if s.remote != nil {
+		return fmt.Errorf("%w: access key is kept by remote signer", ErrKeysConfigured)
+	}
+
+	s.keysMu.Lock()
+	active := s.activeKeys
+	s.keysMu.Unlock()
+
+	next, err := s.newKeyVersion("", &active)
+	if err != nil {
+		return err
+	}
+	next.ActivatedAt = time.Now().Add(s.publishDelay())
+
+	id, err := s.repo.StoreKeys(ctx, next)
+	if err != nil {
+		return fmt.Errorf("can't store new keys: %w", err)
+	}
+	s.l.Info("published new keys", zap.Int("id", id), zap.Time("activated_at", next.ActivatedAt))
+
+	return s.loadKeys(ctx)
+}
+
+// RunKeyRotation periodically promotes pending keys, reloads keyring and rotates keys on schedule,
+// it also clears refresh successors whose grace is over. It returns when ctx is done
+func (s *ServiceImpl) RunKeyRotation(ctx context.Context) {
+	ticker := time.NewTicker(s.keyReloadInterval())
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			err := s.rotateIfDue(ctx)
+			if err != nil && ctx.Err() == nil {
+				s.l.Error("can't rotate keys", zap.Error(err))
+			}
+			s.checkRemoteSigner(ctx)
+			s.clearSuccessors(ctx)
+		}
+	}
+}
+
+func (s *ServiceImpl) rotateIfDue(ctx context.Context) error {
+	_, err := s.repo.PromoteKeys(ctx, s.keyOverlap())
+	if err != nil {
+		return err
+	}
+
+	err = s.loadKeys(ctx)
+	if err != nil {
+		return err
+	}
+
+	if !s.rotationDue() {
+		return nil
+	}
+
+	// other instance may have rotated meanwhile, so it's checked again under the lock
+	return s.repo.LockKeys(ctx, func(ctx context.Context) error {
+		err := s.loadKeys(ctx)
+		if err != nil {
+			return err
+		}
+		if !s.rotationDue() {
+			return nil
+		}
+		return s.rotateKeys(ctx)
+	})
+}
+
+func (s *ServiceImpl) rotationDue() bool {
+	s.keysMu.Lock()
+	defer s.keysMu.Unlock()
+	return s.cfg.KeyRotationPeriod != 0 && s.cfg.AccessKey == "" && s.remote == nil && !s.hasPending &&
+		time.Since(s.activeKeys.ActivatedAt) >= s.cfg.KeyRotationPeriod
+}
+
+// checkRemoteSigner logs if remote signer is down, tokens can't be issued until it's back
+func (s *ServiceImpl) checkRemoteSigner(ctx context.Context) {
+	if s.remote == nil {
+		return
+	}
+
+	err := s.remote.Health(ctx)
+	if err != nil && ctx.Err() == nil {
+		s.l.Error("remote signer is unhealthy", zap.Error(err))
+	}
+}
+
+// clearSuccessors drops sealed pairs duplicate refreshes can't get anymore
+func (s *ServiceImpl) clearSuccessors(ctx context.Context) {
+	cleared, err := s.repo.ClearSuccessors(ctx, s.cfg.RefreshGracePeriod)
+	if err != nil && ctx.Err() == nil {
+		s.l.Error("can't clear refresh successors", zap.Error(err))
+		return
+	}
+	if cleared != 0 {
+		s.l.Debug("cleared refresh successors", zap.Int64("cleared", cleared))
+	}
+}
+
+// keyOverlap is how long demoted key keeps verifying, refresh checks access token signature,
+// so it's the longest token lifetime
+func (s *ServiceImpl) keyOverlap() time.Duration {
+	return max(s.AccessLifetime(), s.refreshLifetime()) + s.cfg.Leeway
+}
+
+func (s *ServiceImpl) keyReloadInterval() time.Duration {
+	if s.cfg.KeyReloadInterval != 0 {
+		return s.cfg.KeyReloadInterval
+	}
+	return defaultKeyReloadInterval
+}
+
+func (s *ServiceImpl) publishDelay() time.Duration {
+	return max(s.keyReloadInterval(), s.cfg.JWKSMaxAge)
+}
+
+func (s *ServiceImpl) algorithm() string {
+	if s.cfg.Algorithm == "" {
+		return jwt.HS512
+	}
+	return s.cfg.Algorithm
+}
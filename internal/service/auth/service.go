@@ -2,8 +2,13 @@ package auth
 
 import (
 	"context"
+	"encoding/base64"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/rinnothing/simple-jwt/internal/api/schema"
 	"github.com/rinnothing/simple-jwt/internal/config"
@@ -14,70 +19,243 @@ import (
 	"go.uber.org/zap"
 )
 
+// every token check failure wraps ErrInvalidTokens together with the reason,
+// which is either one of jwt validation errors or ErrRevoked
+var (
+	ErrInvalidTokens = errors.New("invalid tokens")
+	ErrRevoked       = errors.New("tokens were revoked or already used")
+	ErrReused        = errors.New("rotated refresh token was used again, session is revoked")
+)
+
+// ScopeClaim limits what access token may be used for, it's space separated list as in RFC 8693.
+// Tokens of users who logged in themselves have no scope and aren't limited
+const ScopeClaim = "scope"
+
 type AuthService interface {
-	IssueTokens(ctx context.Context, uuid string, userAgent string, ip string) (schema.TokenPair, error)
-	HasAccess(ctx context.Context, token schema.AccessToken) (bool, error)
+	IssueTokens(ctx context.Context, uuid string, authn jwt.Authentication, claims map[string]any, userAgent string, ip string) (schema.TokenPair, error)
+	IssueKeyToken(ctx context.Context, uuid, keyID string, claims map[string]any, userAgent, ip string) (schema.AccessToken, error)
+	IssueClientTokens(ctx context.Context, uuid, clientID string, claims map[string]any, refresh bool, userAgent, ip string) (schema.TokenPair, error)
+	SealClientRefresh(pair schema.TokenPair) (string, error)
+	OpenClientRefresh(refresh string) (schema.TokenPair, error)
+	HasAccess(ctx context.Context, token schema.AccessToken) error
 	RefreshTokens(ctx context.Context, pair schema.TokenPair, userAgent, ip string) (schema.TokenPair, error)
 	GetUUID(ctx context.Context, token schema.AccessToken) (schema.AccessToken, error)
 	Unauthorize(ctx context.Context, token schema.AccessToken) error
+	UnauthorizeAll(ctx context.Context, token schema.AccessToken) error
+
+	Scopes(ctx context.Context, token schema.AccessToken) ([]string, error)
+	Claims(ctx context.Context, token schema.AccessToken) (map[string]any, error)
+	AccessLifetime() time.Duration
+
+	ListSessions(ctx context.Context, token schema.AccessToken) ([]schema.Session, error)
+	ListUserSessions(ctx context.Context, uuid string) ([]schema.Session, error)
+	RevokeSession(ctx context.Context, token schema.AccessToken, sessionID string) error
+	RevokeOtherSessions(ctx context.Context, token schema.AccessToken) error
+	GetJWKS(ctx context.Context) (jwt.JWKS, error)
+
+	RotateKeys(ctx context.Context) error
+	RunKeyRotation(ctx context.Context)
+	RunSessionEvents(ctx context.Context)
 }
 
 type AuthRepo interface {
-	ReviveKeys(ctx context.Context) ([]string, error)
-	StoreKeys(ctx context.Context, keys []string) error
+	ReviveKeys(ctx context.Context) ([]postgres.KeyVersion, error)
+	StoreKeys(ctx context.Context, key postgres.KeyVersion) (int, error)
+	PromoteKeys(ctx context.Context, overlap time.Duration) (bool, error)
+	LockKeys(ctx context.Context, fn func(ctx context.Context) error) error
+	RewrapKeys(ctx context.Context) (int, error)
 
-	PutRefresh(ctx context.Context, uuid string, oldRefresh, newRefresh schema.RefreshToken, userAgent, IP string) (bool, error)
-	FindRefresh(ctx context.Context, uuid string, refresh schema.RefreshToken) (bool, error)
-	Remove(ctx context.Context, uuid string) error
+	CreateSession(ctx context.Context, session postgres.Session, refreshID string, refresh schema.RefreshToken) error
+	CreateAccessSession(ctx context.Context, session postgres.Session, lifetime time.Duration) error
+	PutRefresh(ctx context.Context, rotation postgres.Rotation, grace time.Duration) (bool, error)
+	ClearSuccessors(ctx context.Context, grace time.Duration) (int64, error)
+	FindAccess(ctx context.Context, sessionID, fingerprint string, refresh schema.RefreshToken) (bool, error)
+	ListSessions(ctx context.Context, uuid string) ([]postgres.Session, error)
+	RemoveSession(ctx context.Context, uuid, sessionID string) (bool, error)
+	RemoveOtherSessions(ctx context.Context, uuid, keepSessionID string) error
+	RemoveSessions(ctx context.Context, uuid string) error
+	ListenSessions(ctx context.Context, handler postgres.SessionHandler)
+	RefreshV2Since(ctx context.Context) (time.Time, error)
 }
 
 type ServiceImpl struct {
 	l *zap.Logger
 
+	cfg      *config.AuthConfig
 	repo     AuthRepo
 	authTool *jwt.Tool
 	webhook  webhook.WebhookService
+	cache    *accessCache
+	// signs access tokens instead of stored key if set
+	remote *jwt.RemoteSigner
+	// v1 refresh tokens aren't accepted after it
+	refreshV1Until time.Time
+
+	keysMu     sync.Mutex
+	keys       *jwt.Keyring
+	activeKeys postgres.KeyVersion
+	hasPending bool
 }
 
 func NewService(cfg *config.AuthConfig, repo AuthRepo, webhook webhook.WebhookService, l *zap.Logger) (AuthService, error) {
-	keys, err := repo.ReviveKeys(context.Background())
-	if err == nil && keys != nil {
-		if cfg.AccessKey == "" {
-			cfg.AccessKey = keys[0]
+	cfg, err := withDerivedKeys(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("can't derive keys from master secret: %w", err)
+	}
+
+	s := &ServiceImpl{
+		l:       l,
+		cfg:     cfg,
+		repo:    repo,
+		webhook: webhook,
+		cache:   newAccessCache(cfg.AccessCacheSize),
+	}
+
+	if cfg.SignerSocket != "" {
+		s.remote, err = jwt.NewRemoteSigner(context.Background(), cfg.SignerSocket, cfg.SignerTimeout)
+		if err != nil {
+			return nil, fmt.Errorf("can't connect to remote signer: %w", err)
 		}
-		if cfg.RefreshKey == "" {
-			cfg.RefreshKey = keys[1]
+		if s.remote.Algorithm() != s.algorithm() {
+			return nil, fmt.Errorf("remote signer uses %s, but algorithm is %s", s.remote.Algorithm(), s.algorithm())
 		}
-		if cfg.RefreshHashKey == "" {
-			cfg.RefreshHashKey = keys[2]
+	}
+
+	// v1 refresh tokens issued before v2 rollout expire by themselves after refresh lifetime,
+	// rollout time is kept in database, so restarts don't move the cutoff
+	s.refreshV1Until = cfg.RefreshV1Until
+	if s.refreshV1Until.IsZero() {
+		since, err := repo.RefreshV2Since(context.Background())
+		if err != nil {
+			return nil, err
 		}
-	} else {
-		if cfg.AccessKey == "" {
-			cfg.AccessKey = jwt.GenerateKey()
+		s.refreshV1Until = since.Add(s.refreshLifetime())
+	}
+
+	err = s.bootstrapKeys(context.Background())
+	if err != nil {
+		return nil, fmt.Errorf("can't bootstrap keys: %w", err)
+	}
+
+	err = s.loadKeys(context.Background())
+	if err != nil {
+		return nil, err
+	}
+
+	s.authTool, err = s.newTool()
+	if err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// withDerivedKeys returns copy of config with keys which aren't set derived from master secret
+func withDerivedKeys(cfg *config.AuthConfig) (*config.AuthConfig, error) {
+	if cfg.MasterSecret == "" {
+		return cfg, nil
+	}
+	derived := *cfg
+
+	var err error
+	if derived.AccessKey == "" && (derived.Algorithm == "" || derived.Algorithm == jwt.HS512 || derived.Algorithm == jwt.EdDSA) {
+		derived.AccessKey, err = jwt.DeriveSigningKey(derived.Algorithm, derived.MasterSecret)
+		if err != nil {
+			return nil, err
 		}
-		if cfg.RefreshKey == "" {
-			cfg.RefreshKey = jwt.GenerateKey()
+	}
+	if derived.RefreshKey == "" {
+		derived.RefreshKey, err = jwt.DeriveKey(derived.MasterSecret, jwt.PurposeRefresh, 64)
+		if err != nil {
+			return nil, err
 		}
-		if cfg.RefreshHashKey == "" {
-			cfg.RefreshHashKey = jwt.GenerateKey()
+	}
+	if derived.RefreshHashKey == "" {
+		derived.RefreshHashKey, err = jwt.DeriveKey(derived.MasterSecret, jwt.PurposeRefreshHash, 64)
+		if err != nil {
+			return nil, err
 		}
 	}
-	err = repo.StoreKeys(context.Background(), []string{cfg.AccessKey, cfg.RefreshKey, cfg.RefreshHashKey})
-	if err != nil {
-		return nil, fmt.Errorf("can't store keys in database: %w", err)
+
+	return &derived, nil
+}
+
+func (s *ServiceImpl) newTool() (*jwt.Tool, error) {
+	tool := jwt.NewJWTTool(s.keys, s.activeKeys.RefreshKey, s.activeKeys.RefreshHashKey)
+	tool.Issuer = s.cfg.Issuer
+	tool.Audience = s.cfg.Audience
+	tool.Leeway = s.cfg.Leeway
+	tool.AccessLifetime = s.AccessLifetime()
+	tool.RefreshLifetime = s.refreshLifetime()
+
+	tool.RefreshV1Until = s.refreshV1Until
+
+	switch s.cfg.TokenFormat {
+	case "", "jwt":
+	case jwt.PasetoLocal, jwt.PasetoPublic:
+		want := jwt.HS512
+		if s.cfg.TokenFormat == jwt.PasetoPublic {
+			want = jwt.EdDSA
+		}
+		if s.algorithm() != want || s.cfg.Encryption != "" {
+			return nil, fmt.Errorf("%s tokens need %s algorithm and no encryption", s.cfg.TokenFormat, want)
+		}
+		tool.Format = s.cfg.TokenFormat
+	default:
+		return nil, fmt.Errorf("unknown token format %q", s.cfg.TokenFormat)
 	}
 
-	return &ServiceImpl{
-		l:        l,
-		repo:     repo,
-		webhook:  webhook,
-		authTool: jwt.NewJWTTool(cfg.AccessKey, cfg.RefreshKey, cfg.RefreshHashKey),
-	}, nil
+	if s.cfg.Encryption != "" {
+		encrypter, err := s.newEncrypter()
+		if err != nil {
+			return nil, fmt.Errorf("can't create token encrypter: %w", err)
+		}
+		tool.Encrypter = encrypter
+		tool.EncryptOnly = s.cfg.EncryptOnly
+	}
+
+	return tool, nil
+}
+
+func (s *ServiceImpl) newEncrypter() (jwt.KeyEncrypter, error) {
+	if s.cfg.EncryptionKey == "" {
+		return nil, fmt.Errorf("encryption_key is required for %s", s.cfg.Encryption)
+	}
+
+	if s.cfg.EncryptOnly && s.cfg.Encryption != jwt.Dir {
+		return nil, fmt.Errorf("encrypt_only is only allowed with %s", jwt.Dir)
+	}
+
+	key := s.cfg.EncryptionKey
+	if s.cfg.Encryption == jwt.Dir {
+		decoded, err := base64.StdEncoding.DecodeString(key)
+		if err != nil {
+			return nil, fmt.Errorf("can't decode dir key: %w", err)
+		}
+		key = string(decoded)
+	}
+
+	return jwt.NewKeyEncrypter(s.cfg.Encryption, key)
+}
+
+// AccessLifetime is how long issued access tokens live
+func (s *ServiceImpl) AccessLifetime() time.Duration {
+	if s.cfg.AccessLifetime != 0 {
+		return s.cfg.AccessLifetime
+	}
+	return jwt.DefaultAccessLifetime
+}
+
+func (s *ServiceImpl) refreshLifetime() time.Duration {
+	if s.cfg.RefreshLifetime != 0 {
+		return s.cfg.RefreshLifetime
+	}
+	return jwt.DefaultRefreshLifetime
 }
 
 // returns UUID which token pretends to be, first you should check it with HasAccess
 func (s *ServiceImpl) GetUUID(ctx context.Context, token schema.AccessToken) (schema.AccessToken, error) {
-	payload, err := jwt.AccessToken(token).GetPayload()
+	payload, err := s.authTool.GetPayload(jwt.AccessToken(token))
 	if err != nil {
 		return "", err
 	}
@@ -85,31 +263,84 @@ func (s *ServiceImpl) GetUUID(ctx context.Context, token schema.AccessToken) (sc
 	return payload.UUID, nil
 }
 
-func (s *ServiceImpl) HasAccess(ctx context.Context, token schema.AccessToken) (bool, error) {
-	if !s.authTool.CheckAccess(jwt.AccessToken(token)) {
-		return false, nil
+// HasAccess returns nil if token is valid and not revoked, denied access errors wrap ErrInvalidTokens
+func (s *ServiceImpl) HasAccess(ctx context.Context, token schema.AccessToken) error {
+	err := s.authTool.CheckAccess(jwt.AccessToken(token))
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidTokens, err)
 	}
 
-	payload, err := jwt.AccessToken(token).GetPayload()
+	payload, err := s.authTool.GetPayload(jwt.AccessToken(token))
 	if err != nil {
-		return false, fmt.Errorf("can't get uuid from access token: %w", err)
+		return fmt.Errorf("%w: %w", ErrInvalidTokens, err)
 	}
 
+	// bcrypt is left for refresh, access is checked by keyed fingerprint
+	sessionID := sessionOf(payload)
+	fingerprint := s.authTool.Fingerprint(jwt.AccessToken(token))
+	if s.cache.has(sessionID, fingerprint) {
+		return nil
+	}
+
+	version := s.cache.version()
 	refresh := s.authTool.AccessToRefresh(jwt.AccessToken(token))
-	found, err := s.repo.FindRefresh(ctx, payload.UUID, schema.RefreshToken(refresh))
+	found, err := s.repo.FindAccess(ctx, sessionID, fingerprint, schema.RefreshToken(refresh))
+	if err != nil {
+		return fmt.Errorf("can't check if access token has expired: %w", err)
+	}
+	if !found {
+		return fmt.Errorf("%w: %w", ErrInvalidTokens, ErrRevoked)
+	}
+	s.cache.put(version, sessionID, fingerprint)
+
+	return nil
+}
+
+// Scopes returns scopes the token is limited to, first check the token with HasAccess
+func (s *ServiceImpl) Scopes(ctx context.Context, token schema.AccessToken) ([]string, error) {
+	payload, err := s.authTool.GetPayload(jwt.AccessToken(token))
 	if err != nil {
-		return false, fmt.Errorf("can't check if access token has expired: %w", err)
+		return nil, err
+	}
+
+	scope, ok := payload.Extra[ScopeClaim].(string)
+	if !ok {
+		return nil, nil
 	}
+	return strings.Fields(scope), nil
+}
 
-	return found, nil
+// Claims returns extra claims of the token, the token isn't checked, so check it with HasAccess or on refresh
+func (s *ServiceImpl) Claims(ctx context.Context, token schema.AccessToken) (map[string]any, error) {
+	payload, err := s.authTool.GetPayload(jwt.AccessToken(token))
+	if err != nil {
+		return nil, err
+	}
+	return payload.Extra, nil
 }
 
-func (s *ServiceImpl) IssueTokens(ctx context.Context, uuid string, userAgent, ip string) (schema.TokenPair, error) {
-	access, refresh := s.authTool.IssueTokens(uuid)
+// IssueTokens makes a new pair, claims and the way user was authenticated are embedded in access token and kept on refresh
+func (s *ServiceImpl) IssueTokens(ctx context.Context, uuid string, authn jwt.Authentication, claims map[string]any, userAgent, ip string) (schema.TokenPair, error) {
+	session := postgres.Session{
+		ID:        jwt.GenerateID(),
+		UUID:      uuid,
+		UserAgent: userAgent,
+		IP:        ip,
+	}
+	return s.issueTokens(ctx, session, authn, claims)
+}
 
-	_, err := s.repo.PutRefresh(ctx, uuid, "", schema.RefreshToken(refresh), userAgent, ip)
+func (s *ServiceImpl) issueTokens(ctx context.Context, session postgres.Session, authn jwt.Authentication, claims map[string]any) (schema.TokenPair, error) {
+	access, refresh, err := s.authTool.IssueAuthenticatedTokens(ctx, session.ID, session.UUID, authn, claims)
 	if err != nil {
-		return schema.TokenPair{}, fmt.Errorf("can't update refresh token in database: %w", err)
+		return schema.TokenPair{}, fmt.Errorf("can't issue tokens: %w", err)
+	}
+	session.AccessFingerprint = s.authTool.Fingerprint(access)
+
+	// server keeps v1 form of the refresh token, as it can be recomputed from access token in HasAccess
+	err = s.repo.CreateSession(ctx, session, s.refreshID(refresh), schema.RefreshToken(s.authTool.AccessToRefresh(access)))
+	if err != nil {
+		return schema.TokenPair{}, fmt.Errorf("can't create session in database: %w", err)
 	}
 
 	accessToken := schema.AccessToken(access)
@@ -120,25 +351,143 @@ func (s *ServiceImpl) IssueTokens(ctx context.Context, uuid string, userAgent, i
 	}, nil
 }
 
+// IssueKeyToken makes access token alone for api key, its session is bound to the key and removed when the key is revoked
+func (s *ServiceImpl) IssueKeyToken(ctx context.Context, uuid, keyID string, claims map[string]any, userAgent, ip string) (schema.AccessToken, error) {
+	session := postgres.Session{
+		ID:        jwt.GenerateID(),
+		UUID:      uuid,
+		UserAgent: userAgent,
+		IP:        ip,
+		APIKeyID:  keyID,
+	}
+	return s.issueAccessToken(ctx, session, claims)
+}
+
+// IssueClientTokens makes tokens for oauth client, its session is bound to the client and isn't listed to the user.
+// Clients which may not refresh get access token alone, session of it is removed once the token expires
+func (s *ServiceImpl) IssueClientTokens(ctx context.Context, uuid, clientID string, claims map[string]any, refresh bool, userAgent, ip string) (schema.TokenPair, error) {
+	session := postgres.Session{
+		ID:            jwt.GenerateID(),
+		UUID:          uuid,
+		UserAgent:     userAgent,
+		IP:            ip,
+		OAuthClientID: clientID,
+	}
+	if refresh {
+		return s.issueTokens(ctx, session, jwt.Authentication{Time: s.authTool.Now().Unix()}, claims)
+	}
+
+	access, err := s.issueAccessToken(ctx, session, claims)
+	if err != nil {
+		return schema.TokenPair{}, err
+	}
+	return schema.TokenPair{AccessToken: &access}, nil
+}
+
+func (s *ServiceImpl) issueAccessToken(ctx context.Context, session postgres.Session, claims map[string]any) (schema.AccessToken, error) {
+	access, _, err := s.authTool.IssueAuthenticatedTokens(ctx, session.ID, session.UUID, jwt.Authentication{Time: s.authTool.Now().Unix()}, claims)
+	if err != nil {
+		return "", fmt.Errorf("can't issue tokens: %w", err)
+	}
+	session.AccessFingerprint = s.authTool.Fingerprint(access)
+
+	err = s.repo.CreateAccessSession(ctx, session, s.AccessLifetime()+s.cfg.Leeway)
+	if err != nil {
+		return "", fmt.Errorf("can't create session in database: %w", err)
+	}
+
+	return schema.AccessToken(access), nil
+}
+
+// SealClientRefresh makes oauth refresh token of the pair. Rotation needs access token too, while refresh_token
+// grant carries only refresh one, so the pair is sealed into single token which client can't read
+func (s *ServiceImpl) SealClientRefresh(pair schema.TokenPair) (string, error) {
+	sealed, err := s.sealPair(pair)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(sealed), nil
+}
+
+// OpenClientRefresh returns pair of oauth refresh token made by SealClientRefresh, the pair isn't checked
+func (s *ServiceImpl) OpenClientRefresh(refresh string) (schema.TokenPair, error) {
+	sealed, err := base64.RawURLEncoding.DecodeString(refresh)
+	if err != nil {
+		return schema.TokenPair{}, fmt.Errorf("%w: refresh token isn't in base64: %w", ErrInvalidTokens, err)
+	}
+
+	pair, err := s.openPair(sealed)
+	if errors.Is(err, ErrInvalidTokens) {
+		return schema.TokenPair{}, err
+	}
+	if err != nil || pair.AccessToken == nil || pair.RefreshToken == nil {
+		return schema.TokenPair{}, fmt.Errorf("%w: refresh token isn't a token pair", ErrInvalidTokens)
+	}
+	return pair, nil
+}
+
+// RefreshTokens rotates the pair, concurrent rotations of one session are serialized by repository.
+// Duplicate of a rotation within refresh_grace_period gets the same new pair
 func (s *ServiceImpl) RefreshTokens(ctx context.Context, pair schema.TokenPair, userAgent string, ip string) (schema.TokenPair, error) {
-	payload, err := jwt.AccessToken(*pair.AccessToken).GetPayload()
+	err := s.authTool.CheckRefresh(jwt.AccessToken(*pair.AccessToken), jwt.RefreshToken(*pair.RefreshToken))
+	if err != nil {
+		return schema.TokenPair{}, fmt.Errorf("%w: %w", ErrInvalidTokens, err)
+	}
+
+	payload, err := s.authTool.GetPayload(jwt.AccessToken(*pair.AccessToken))
+	if err != nil {
+		return schema.TokenPair{}, fmt.Errorf("%w: %w", ErrInvalidTokens, err)
+	}
+
+	access, refresh, err := s.authTool.IssueAuthenticatedTokens(ctx, sessionOf(payload), payload.UUID, payload.Authentication(), payload.Extra)
 	if err != nil {
-		return schema.TokenPair{}, fmt.Errorf("can't get uuid from access token: %w", err)
+		return schema.TokenPair{}, fmt.Errorf("can't issue tokens: %w", err)
 	}
 
-	if !s.authTool.CheckRefresh(jwt.AccessToken(*pair.AccessToken), jwt.RefreshToken(*pair.RefreshToken)) {
-		return schema.TokenPair{}, fmt.Errorf("access and refresh tokens don't work together")
+	accessToken := schema.AccessToken(access)
+	refreshToken := schema.RefreshToken(refresh)
+	newPair := schema.TokenPair{
+		AccessToken:  &accessToken,
+		RefreshToken: &refreshToken,
+	}
+
+	// access token may be already expired, so instead of HasAccess repository checks that the pair is the current one
+	rotation := postgres.Rotation{
+		SessionID:      sessionOf(payload),
+		ParentID:       s.refreshID(jwt.RefreshToken(*pair.RefreshToken)),
+		RefreshID:      s.refreshID(refresh),
+		OldRefresh:     schema.RefreshToken(s.authTool.AccessToRefresh(jwt.AccessToken(*pair.AccessToken))),
+		NewRefresh:     schema.RefreshToken(s.authTool.AccessToRefresh(access)),
+		NewFingerprint: s.authTool.Fingerprint(access),
+		UserAgent:      userAgent,
+		IP:             ip,
+	}
+	if s.cfg.RefreshGracePeriod > 0 {
+		rotation.Successor, err = s.sealPair(newPair)
+		if err != nil {
+			return schema.TokenPair{}, err
+		}
 	}
 
-	access, refresh := s.authTool.IssueTokens(payload.UUID)
-	updated, err := s.repo.PutRefresh(ctx, payload.UUID, *pair.RefreshToken, schema.RefreshToken(refresh), userAgent, ip)
-	if errors.Is(err, postgres.ErrWrongUserAgent) {
-		err = s.Unauthorize(ctx, *pair.AccessToken)
+	updated, err := s.repo.PutRefresh(ctx, rotation, s.cfg.RefreshGracePeriod)
+	var rotated *postgres.AlreadyRotatedError
+	if errors.As(err, &rotated) {
+		return s.openPair(rotated.Successor)
+	} else if errors.Is(err, postgres.ErrRefreshReused) {
+		return schema.TokenPair{}, s.revokeFamily(ctx, payload.UUID, rotation.SessionID, ip)
+	} else if errors.Is(err, postgres.ErrSessionNotFound) || errors.Is(err, postgres.ErrStaleRefresh) {
+		return schema.TokenPair{}, fmt.Errorf("%w: %w", ErrInvalidTokens, ErrRevoked)
+	} else if errors.Is(err, postgres.ErrWrongUserAgent) {
+		unauthorizeErr := s.Unauthorize(ctx, *pair.AccessToken)
+		if unauthorizeErr != nil {
+			return schema.TokenPair{}, unauthorizeErr
+		}
 
 		return schema.TokenPair{}, err
 	} else if err != nil {
 		return schema.TokenPair{}, fmt.Errorf("can't update refresh token in database: %w", err)
 	}
+	s.cache.SessionChanged(rotation.SessionID)
 
 	if updated {
 		err = s.webhook.CallWebhook(ip)
@@ -147,24 +496,192 @@ func (s *ServiceImpl) RefreshTokens(ctx context.Context, pair schema.TokenPair,
 		}
 	}
 
-	accessToken := schema.AccessToken(access)
-	refreshToken := schema.RefreshToken(refresh)
-	return schema.TokenPair{
-		AccessToken:  &accessToken,
-		RefreshToken: &refreshToken,
-	}, nil
+	return newPair, nil
+}
+
+// sealPair encrypts issued pair, so successors kept in database and oauth refresh tokens can't be read.
+// Successor is cleared by any refresh after its grace period is over
+func (s *ServiceImpl) sealPair(pair schema.TokenPair) ([]byte, error) {
+	data, err := json.Marshal(pair)
+	if err != nil {
+		return nil, fmt.Errorf("can't marshal token pair: %w", err)
+	}
+
+	sealed, err := s.authTool.SealStored(data)
+	if err != nil {
+		return nil, fmt.Errorf("can't seal token pair: %w", err)
+	}
+	return sealed, nil
+}
+
+// openPair returns pair sealed by sealPair, pair sealed with refresh key which was rotated since is revoked
+func (s *ServiceImpl) openPair(sealed []byte) (schema.TokenPair, error) {
+	data, err := s.authTool.OpenStored(sealed)
+	if err != nil {
+		return schema.TokenPair{}, fmt.Errorf("%w: %w", ErrInvalidTokens, ErrRevoked)
+	}
+
+	var pair schema.TokenPair
+	err = json.Unmarshal(data, &pair)
+	if err != nil {
+		return schema.TokenPair{}, fmt.Errorf("can't unmarshal token pair: %w", err)
+	}
+	return pair, nil
+}
+
+// revokeFamily is called when refresh token which was rotated before is used again,
+// someone has a copy of it, so the whole family is revoked and security event is sent
+func (s *ServiceImpl) revokeFamily(ctx context.Context, uuid, sessionID, ip string) error {
+	s.l.Warn("refresh token reuse detected", zap.String("uuid", uuid), zap.String("session", sessionID), zap.String("ip", ip))
+
+	_, err := s.repo.RemoveSession(ctx, uuid, sessionID)
+	if err != nil {
+		return fmt.Errorf("can't revoke refresh token family: %w", err)
+	}
+	s.cache.SessionChanged(sessionID)
+
+	err = s.webhook.ReportTokenReuse(uuid, sessionID, ip)
+	if err != nil {
+		s.l.Error("can't report refresh token reuse", zap.Error(err))
+	}
+
+	return fmt.Errorf("%w: %w", ErrInvalidTokens, ErrReused)
+}
+
+// refreshID returns id of v2 refresh token, older tokens have none
+func (s *ServiceImpl) refreshID(refresh jwt.RefreshToken) string {
+	if refresh.Version() != jwt.RefreshV2 {
+		return ""
+	}
+
+	claims, err := s.authTool.OpenRefresh(refresh)
+	if err != nil {
+		return ""
+	}
+	return claims.ID
 }
 
+// Unauthorize ends the session token belongs to
 func (s *ServiceImpl) Unauthorize(ctx context.Context, token schema.AccessToken) error {
-	payload, err := jwt.AccessToken(token).GetPayload()
+	payload, err := s.authTool.GetPayload(jwt.AccessToken(token))
+	if err != nil {
+		return fmt.Errorf("can't get session from access token: %w", err)
+	}
+
+	_, err = s.repo.RemoveSession(ctx, payload.UUID, sessionOf(payload))
+	if err != nil {
+		return fmt.Errorf("failed to remove session from database: %w", err)
+	}
+	s.cache.SessionChanged(sessionOf(payload))
+
+	return nil
+}
+
+// UnauthorizeAll ends every session of the user token belongs to
+func (s *ServiceImpl) UnauthorizeAll(ctx context.Context, token schema.AccessToken) error {
+	payload, err := s.authTool.GetPayload(jwt.AccessToken(token))
 	if err != nil {
 		return fmt.Errorf("can't get uuid from access token: %w", err)
 	}
 
-	err = s.repo.Remove(ctx, payload.UUID)
+	err = s.repo.RemoveSessions(ctx, payload.UUID)
 	if err != nil {
-		return fmt.Errorf("failed to remove refresh token from database: %w", err)
+		return fmt.Errorf("failed to remove sessions from database: %w", err)
 	}
+	s.cache.dropAll()
 
 	return nil
 }
+
+// ListSessions returns sessions of the user token belongs to, first check the token with HasAccess
+func (s *ServiceImpl) ListSessions(ctx context.Context, token schema.AccessToken) ([]schema.Session, error) {
+	payload, err := s.authTool.GetPayload(jwt.AccessToken(token))
+	if err != nil {
+		return nil, fmt.Errorf("can't get uuid from access token: %w", err)
+	}
+
+	return s.listSessions(ctx, payload.UUID, sessionOf(payload))
+}
+
+// ListUserSessions returns sessions of the user, none of them is marked current
+func (s *ServiceImpl) ListUserSessions(ctx context.Context, uuid string) ([]schema.Session, error) {
+	return s.listSessions(ctx, uuid, "")
+}
+
+func (s *ServiceImpl) listSessions(ctx context.Context, uuid, current string) ([]schema.Session, error) {
+	sessions, err := s.repo.ListSessions(ctx, uuid)
+	if err != nil {
+		return nil, fmt.Errorf("can't list sessions: %w", err)
+	}
+
+	res := make([]schema.Session, 0, len(sessions))
+	for _, session := range sessions {
+		res = append(res, schema.Session{
+			Id:         session.ID,
+			UserAgent:  session.UserAgent,
+			Ip:         session.IP,
+			CreatedAt:  session.CreatedAt,
+			LastUsedAt: session.LastUsedAt,
+			Current:    session.ID == current,
+		})
+	}
+
+	return res, nil
+}
+
+// RevokeSession ends one of the sessions of the user token belongs to, returns postgres.ErrSessionNotFound
+// if user has no such session
+func (s *ServiceImpl) RevokeSession(ctx context.Context, token schema.AccessToken, sessionID string) error {
+	payload, err := s.authTool.GetPayload(jwt.AccessToken(token))
+	if err != nil {
+		return fmt.Errorf("can't get uuid from access token: %w", err)
+	}
+
+	found, err := s.repo.RemoveSession(ctx, payload.UUID, sessionID)
+	if err != nil {
+		return fmt.Errorf("failed to remove session from database: %w", err)
+	}
+	s.cache.SessionChanged(sessionID)
+	if !found {
+		return fmt.Errorf("%w: %s", postgres.ErrSessionNotFound, sessionID)
+	}
+
+	return nil
+}
+
+// RevokeOtherSessions ends every session of the user except the one token belongs to
+func (s *ServiceImpl) RevokeOtherSessions(ctx context.Context, token schema.AccessToken) error {
+	payload, err := s.authTool.GetPayload(jwt.AccessToken(token))
+	if err != nil {
+		return fmt.Errorf("can't get session from access token: %w", err)
+	}
+
+	err = s.repo.RemoveOtherSessions(ctx, payload.UUID, sessionOf(payload))
+	if err != nil {
+		return fmt.Errorf("failed to remove other sessions from database: %w", err)
+	}
+	s.cache.dropAll()
+
+	return nil
+}
+
+// RunSessionEvents keeps access cache consistent with sessions changed by all instances,
+// it returns when ctx is done
+func (s *ServiceImpl) RunSessionEvents(ctx context.Context) {
+	if s.cache == nil {
+		return
+	}
+	s.repo.ListenSessions(ctx, s.cache)
+}
+
+// tokens issued before sessions existed have no sid, their session was migrated under user's uuid
+func sessionOf(payload *jwt.Payload) string {
+	if payload.SessionID != "" {
+		return payload.SessionID
+	}
+	return payload.UUID
+}
+
+func (s *ServiceImpl) GetJWKS(ctx context.Context) (jwt.JWKS, error) {
+	return s.authTool.JWKS(), nil
+}
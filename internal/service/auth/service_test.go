@@ -0,0 +1,107 @@
+package auth
+
+import (
+	"context"
+	"encoding/base64"
+	"testing"
+
+	"github.com/rinnothing/simple-jwt/internal/api/schema"
+	"github.com/rinnothing/simple-jwt/internal/config"
+	"github.com/rinnothing/simple-jwt/internal/repository/postgres"
+	"github.com/rinnothing/simple-jwt/utils/jwt"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func TestWithDerivedKeys(t *testing.T) {
+	cfg := &config.AuthConfig{}
+	same, err := withDerivedKeys(cfg)
+	require.NoError(t, err)
+	require.Same(t, cfg, same)
+
+	cfg = &config.AuthConfig{MasterSecret: "master", RefreshKey: "explicit"}
+	derived, err := withDerivedKeys(cfg)
+	require.NoError(t, err)
+	require.Empty(t, cfg.AccessKey, "config itself isn't changed")
+	require.NotEmpty(t, derived.AccessKey)
+	require.NotEmpty(t, derived.RefreshHashKey)
+	require.Equal(t, "explicit", derived.RefreshKey)
+
+	again, err := withDerivedKeys(cfg)
+	require.NoError(t, err)
+	require.Equal(t, derived, again)
+
+	// rsa keys can't be derived, so they are generated and rotated as without master secret
+	derived, err = withDerivedKeys(&config.AuthConfig{MasterSecret: "master", Algorithm: jwt.RS256})
+	require.NoError(t, err)
+	require.Empty(t, derived.AccessKey)
+	require.NotEmpty(t, derived.RefreshKey)
+}
+
+func TestClientRefresh(t *testing.T) {
+	s := &ServiceImpl{authTool: jwt.NewJWTTool(nil, "refresh", "refresh hash")}
+	access, refresh := schema.AccessToken("header.payload.signature"), schema.RefreshToken("c2VjcmV0+/==")
+	pair := schema.TokenPair{AccessToken: &access, RefreshToken: &refresh}
+
+	sealed, err := s.SealClientRefresh(pair)
+	require.NoError(t, err)
+	raw, err := base64.RawURLEncoding.DecodeString(sealed)
+	require.NoError(t, err)
+	require.NotContains(t, string(raw), string(access), "client can't read access token out of refresh one")
+
+	opened, err := s.OpenClientRefresh(sealed)
+	require.NoError(t, err)
+	require.Equal(t, pair, opened)
+
+	_, err = s.OpenClientRefresh(string(refresh))
+	require.ErrorIs(t, err, ErrInvalidTokens)
+	_, err = s.OpenClientRefresh(base64.RawURLEncoding.EncodeToString([]byte(`{"access_token":"a","refresh_token":"r"}`)))
+	require.ErrorIs(t, err, ErrInvalidTokens)
+
+	// tokens sealed with refresh key which was rotated since are revoked
+	s.authTool = jwt.NewJWTTool(nil, "rotated", "refresh hash")
+	_, err = s.OpenClientRefresh(sealed)
+	require.ErrorIs(t, err, ErrInvalidTokens)
+}
+
+// keysRepo serves stored key versions, other methods of the repo aren't expected to be called
+type keysRepo struct {
+	AuthRepo
+	versions []postgres.KeyVersion
+}
+
+func (r *keysRepo) ReviveKeys(ctx context.Context) ([]postgres.KeyVersion, error) {
+	return r.versions, nil
+}
+
+func TestLoadKeysReplacesRefreshKeys(t *testing.T) {
+	repo := &keysRepo{versions: []postgres.KeyVersion{
+		{ID: 1, Algorithm: jwt.HS512, AccessKey: "access", RefreshKey: "refresh", RefreshHashKey: "refresh hash", State: postgres.KeyActive},
+	}}
+	s := &ServiceImpl{l: zap.NewNop(), cfg: &config.AuthConfig{}, repo: repo}
+	require.NoError(t, s.loadKeys(context.Background()))
+	tool, err := s.newTool()
+	require.NoError(t, err)
+	s.authTool = tool
+
+	access, refresh, err := tool.IssueTokens(context.Background(), "uuid", nil)
+	require.NoError(t, err)
+	fingerprint := tool.Fingerprint(access)
+
+	// the same version is loaded again, nothing changes
+	require.NoError(t, s.loadKeys(context.Background()))
+	require.Equal(t, fingerprint, tool.Fingerprint(access))
+	require.NoError(t, tool.CheckRefresh(access, refresh))
+
+	// other instance activated version with other refresh keys, tool follows it
+	repo.versions = []postgres.KeyVersion{
+		{ID: 1, Algorithm: jwt.HS512, AccessKey: "access", RefreshKey: "refresh", RefreshHashKey: "refresh hash", State: postgres.KeyVerifyOnly},
+		{ID: 2, Algorithm: jwt.HS512, AccessKey: "access 2", RefreshKey: "refresh 2", RefreshHashKey: "refresh hash 2", State: postgres.KeyActive},
+	}
+	require.NoError(t, s.loadKeys(context.Background()))
+	require.NotEqual(t, fingerprint, tool.Fingerprint(access))
+	require.Error(t, tool.CheckRefresh(access, refresh))
+
+	next := jwt.NewJWTTool(nil, "refresh 2", "refresh hash 2")
+	require.Equal(t, next.Fingerprint(access), tool.Fingerprint(access))
+}
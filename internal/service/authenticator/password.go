@@ -0,0 +1,86 @@
+package authenticator
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+)
+
+const (
+	saltSize = 16
+	hashSize = 32
+)
+
+var ErrBadHash = errors.New("unsupported password hash")
+
+// Argon2Params are argon2id cost parameters, memory is in KiB
+type Argon2Params struct {
+	Memory      uint32
+	Iterations  uint32
+	Parallelism uint8
+}
+
+// DefaultArgon2Params follow the second recommended option of RFC 9106
+var DefaultArgon2Params = Argon2Params{
+	Memory:      64 * 1024,
+	Iterations:  3,
+	Parallelism: 4,
+}
+
+// HashPassword makes argon2id hash in PHC string format, parameters and salt are kept in it
+func HashPassword(password string, params Argon2Params) string {
+	salt := make([]byte, saltSize)
+	rand.Read(salt)
+
+	hash := argon2.IDKey([]byte(password), salt, params.Iterations, params.Memory, params.Parallelism, hashSize)
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s", argon2.Version,
+		params.Memory, params.Iterations, params.Parallelism,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(hash))
+}
+
+// VerifyPassword checks password against hash made by HashPassword, it also returns parameters of the hash,
+// so caller can tell if it should be rehashed
+func VerifyPassword(password, encoded string) (bool, Argon2Params, error) {
+	params, salt, hash, err := parseHash(encoded)
+	if err != nil {
+		return false, Argon2Params{}, err
+	}
+
+	computed := argon2.IDKey([]byte(password), salt, params.Iterations, params.Memory, params.Parallelism, uint32(len(hash)))
+	return subtle.ConstantTimeCompare(hash, computed) == 1, params, nil
+}
+
+func parseHash(encoded string) (Argon2Params, []byte, []byte, error) {
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 6 || parts[0] != "" || parts[1] != "argon2id" {
+		return Argon2Params{}, nil, nil, fmt.Errorf("%w: not an argon2id hash", ErrBadHash)
+	}
+
+	var version int
+	_, err := fmt.Sscanf(parts[2], "v=%d", &version)
+	if err != nil || version != argon2.Version {
+		return Argon2Params{}, nil, nil, fmt.Errorf("%w: unknown version %s", ErrBadHash, parts[2])
+	}
+
+	var params Argon2Params
+	_, err = fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &params.Memory, &params.Iterations, &params.Parallelism)
+	if err != nil || params.Iterations == 0 || params.Parallelism == 0 {
+		return Argon2Params{}, nil, nil, fmt.Errorf("%w: bad parameters %s", ErrBadHash, parts[3])
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return Argon2Params{}, nil, nil, fmt.Errorf("%w: bad salt: %w", ErrBadHash, err)
+	}
+	hash, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil || len(hash) == 0 {
+		return Argon2Params{}, nil, nil, fmt.Errorf("%w: bad hash", ErrBadHash)
+	}
+
+	return params, salt, hash, nil
+}
@@ -0,0 +1,164 @@
+package authenticator
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/rinnothing/simple-jwt/internal/api/schema"
+	"github.com/rinnothing/simple-jwt/internal/config"
+	"github.com/rinnothing/simple-jwt/utils/jwt"
+	"github.com/rinnothing/simple-jwt/utils/limiter"
+
+	"go.uber.org/zap"
+)
+
+const (
+	TypeTrust    = "trust"
+	TypePassword = "password"
+)
+
+var (
+	ErrInvalidCredentials = errors.New("invalid credentials")
+	ErrUnknownType        = errors.New("unknown authenticator type")
+)
+
+// Credentials are what the caller gave to prove who they are
+type Credentials struct {
+	Password string
+}
+
+// Authenticator decides if caller may get tokens for guid, it fails with ErrInvalidCredentials if not.
+// On success it returns amr values (RFC 8176) of the way caller was authenticated
+type Authenticator interface {
+	Authenticate(ctx context.Context, guid schema.GUID, credentials Credentials) ([]string, error)
+}
+
+type CredentialsRepo interface {
+	GetPasswordHash(ctx context.Context, guid schema.GUID) (string, bool, error)
+	PutPasswordHash(ctx context.Context, guid schema.GUID, hash string) error
+	UpdatePasswordHash(ctx context.Context, guid schema.GUID, oldHash, newHash string) (bool, error)
+}
+
+// NewService makes authenticator of configured type, hasher may be nil if argon2 work shouldn't be limited
+func NewService(cfg config.AuthenticatorConfig, repo CredentialsRepo, hasher *limiter.Limiter, l *zap.Logger) (Authenticator, error) {
+	switch cfg.Type {
+	case TypeTrust:
+		return &TrustAuthenticator{}, nil
+	case "", TypePassword:
+		return NewPasswordAuthenticator(repo, ParamsFromConfig(cfg.Argon2), hasher, l), nil
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnknownType, cfg.Type)
+	}
+}
+
+// ParamsFromConfig fills parameters which aren't set with defaults
+func ParamsFromConfig(cfg config.Argon2Config) Argon2Params {
+	params := DefaultArgon2Params
+	if cfg.Memory != 0 {
+		params.Memory = cfg.Memory
+	}
+	if cfg.Iterations != 0 {
+		params.Iterations = cfg.Iterations
+	}
+	if cfg.Parallelism != 0 {
+		params.Parallelism = cfg.Parallelism
+	}
+	return params
+}
+
+// TrustAuthenticator lets anyone who knows guid in, it's for deployments where caller is already trusted
+type TrustAuthenticator struct{}
+
+func (t *TrustAuthenticator) Authenticate(context.Context, schema.GUID, Credentials) ([]string, error) {
+	return nil, nil
+}
+
+// PasswordAuthenticator checks password against argon2id hash kept in credentials table
+type PasswordAuthenticator struct {
+	l *zap.Logger
+
+	repo   CredentialsRepo
+	hasher *limiter.Limiter
+	params Argon2Params
+
+	// compared against when there is no such user, so unknown guids take as long as known ones
+	dummyHash string
+}
+
+func NewPasswordAuthenticator(repo CredentialsRepo, params Argon2Params, hasher *limiter.Limiter, l *zap.Logger) *PasswordAuthenticator {
+	return &PasswordAuthenticator{
+		l:         l,
+		repo:      repo,
+		hasher:    hasher,
+		params:    params,
+		dummyHash: HashPassword("", params),
+	}
+}
+
+func (p *PasswordAuthenticator) Authenticate(ctx context.Context, guid schema.GUID, credentials Credentials) ([]string, error) {
+	hash, found, err := p.repo.GetPasswordHash(ctx, guid)
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		hash = p.dummyHash
+	}
+
+	var ok bool
+	var params Argon2Params
+	err = p.hasher.Do(ctx, func() error {
+		var verifyErr error
+		ok, params, verifyErr = VerifyPassword(credentials.Password, hash)
+		return verifyErr
+	})
+	if err != nil {
+		return nil, fmt.Errorf("can't verify password: %w", err)
+	}
+	if !found || !ok || credentials.Password == "" {
+		return nil, ErrInvalidCredentials
+	}
+
+	if params != p.params {
+		p.rehash(ctx, guid, credentials.Password, hash)
+	}
+
+	return []string{jwt.AMRPassword}, nil
+}
+
+// rehash upgrades hash made with old parameters, user is already in, so failure is only logged
+func (p *PasswordAuthenticator) rehash(ctx context.Context, guid schema.GUID, password, oldHash string) {
+	var newHash string
+	err := p.hasher.Do(ctx, func() error {
+		newHash = HashPassword(password, p.params)
+		return nil
+	})
+	if err != nil {
+		p.l.Warn("can't rehash password", zap.Error(err))
+		return
+	}
+
+	// password could be changed meanwhile, it's kept then
+	_, err = p.repo.UpdatePasswordHash(ctx, guid, oldHash, newHash)
+	if err != nil {
+		p.l.Warn("can't store rehashed password", zap.Error(err))
+	}
+}
+
+// SetPassword stores hash of new password of guid, creating the user if needed
+func (p *PasswordAuthenticator) SetPassword(ctx context.Context, guid schema.GUID, password string) error {
+	if password == "" {
+		return fmt.Errorf("%w: empty password", ErrInvalidCredentials)
+	}
+
+	var hash string
+	err := p.hasher.Do(ctx, func() error {
+		hash = HashPassword(password, p.params)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("can't hash password: %w", err)
+	}
+
+	return p.repo.PutPasswordHash(ctx, guid, hash)
+}
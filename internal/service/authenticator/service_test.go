@@ -0,0 +1,120 @@
+package authenticator
+
+import (
+	"context"
+	"testing"
+
+	"github.com/rinnothing/simple-jwt/internal/api/schema"
+	"github.com/rinnothing/simple-jwt/internal/config"
+	"github.com/rinnothing/simple-jwt/utils/jwt"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+// cheap parameters, so tests don't take long
+var testParams = Argon2Params{Memory: 1024, Iterations: 1, Parallelism: 1}
+
+type memoryRepo map[schema.GUID]string
+
+func (m memoryRepo) GetPasswordHash(_ context.Context, guid schema.GUID) (string, bool, error) {
+	hash, ok := m[guid]
+	return hash, ok, nil
+}
+
+func (m memoryRepo) PutPasswordHash(_ context.Context, guid schema.GUID, hash string) error {
+	m[guid] = hash
+	return nil
+}
+
+func (m memoryRepo) UpdatePasswordHash(_ context.Context, guid schema.GUID, oldHash, newHash string) (bool, error) {
+	if m[guid] != oldHash {
+		return false, nil
+	}
+	m[guid] = newHash
+	return true, nil
+}
+
+func TestHashPassword(t *testing.T) {
+	hash := HashPassword("secret", testParams)
+	require.Regexp(t, `^\$argon2id\$v=19\$m=1024,t=1,p=1\$[^$]+\$[^$]+$`, hash)
+	require.NotEqual(t, hash, HashPassword("secret", testParams))
+
+	ok, params, err := VerifyPassword("secret", hash)
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Equal(t, testParams, params)
+
+	ok, _, err = VerifyPassword("wrong", hash)
+	require.NoError(t, err)
+	require.False(t, ok)
+
+	for _, bad := range []string{"", "$2a$10$abc", "$argon2i$v=19$m=1024,t=1,p=1$c2FsdA$aGFzaA", "$argon2id$v=19$m=1024,t=0,p=1$c2FsdA$aGFzaA"} {
+		_, _, err = VerifyPassword("secret", bad)
+		require.ErrorIs(t, err, ErrBadHash, bad)
+	}
+}
+
+func TestPasswordAuthenticator(t *testing.T) {
+	ctx := context.Background()
+	repo := memoryRepo{}
+	a := NewPasswordAuthenticator(repo, testParams, nil, zap.NewNop())
+
+	_, err := a.Authenticate(ctx, "unknown", Credentials{Password: ""})
+	require.ErrorIs(t, err, ErrInvalidCredentials)
+	require.ErrorIs(t, a.SetPassword(ctx, "user", ""), ErrInvalidCredentials)
+
+	require.NoError(t, a.SetPassword(ctx, "user", "secret"))
+	methods, err := a.Authenticate(ctx, "user", Credentials{Password: "secret"})
+	require.NoError(t, err)
+	require.Equal(t, []string{jwt.AMRPassword}, methods)
+
+	_, err = a.Authenticate(ctx, "user", Credentials{Password: "wrong"})
+	require.ErrorIs(t, err, ErrInvalidCredentials)
+	_, err = a.Authenticate(ctx, "other", Credentials{Password: "secret"})
+	require.ErrorIs(t, err, ErrInvalidCredentials)
+}
+
+func TestRehashOnLogin(t *testing.T) {
+	ctx := context.Background()
+	repo := memoryRepo{}
+	old := NewPasswordAuthenticator(repo, testParams, nil, zap.NewNop())
+	require.NoError(t, old.SetPassword(ctx, "user", "secret"))
+	oldHash := repo["user"]
+
+	stronger := testParams
+	stronger.Iterations = 2
+	a := NewPasswordAuthenticator(repo, stronger, nil, zap.NewNop())
+
+	// failed login doesn't upgrade anything
+	_, err := a.Authenticate(ctx, "user", Credentials{Password: "wrong"})
+	require.ErrorIs(t, err, ErrInvalidCredentials)
+	require.Equal(t, oldHash, repo["user"])
+
+	_, err = a.Authenticate(ctx, "user", Credentials{Password: "secret"})
+	require.NoError(t, err)
+	_, params, err := VerifyPassword("secret", repo["user"])
+	require.NoError(t, err)
+	require.Equal(t, stronger, params)
+
+	// up to date hash is kept
+	newHash := repo["user"]
+	_, err = a.Authenticate(ctx, "user", Credentials{Password: "secret"})
+	require.NoError(t, err)
+	require.Equal(t, newHash, repo["user"])
+}
+
+func TestNewService(t *testing.T) {
+	a, err := NewService(config.AuthenticatorConfig{Type: TypeTrust}, nil, nil, zap.NewNop())
+	require.NoError(t, err)
+	methods, err := a.Authenticate(context.Background(), "anyone", Credentials{})
+	require.NoError(t, err)
+	require.Empty(t, methods)
+
+	a, err = NewService(config.AuthenticatorConfig{Argon2: config.Argon2Config{Memory: 1024}}, memoryRepo{}, nil, zap.NewNop())
+	require.NoError(t, err)
+	require.IsType(t, &PasswordAuthenticator{}, a)
+	require.Equal(t, uint32(1024), a.(*PasswordAuthenticator).params.Memory)
+
+	_, err = NewService(config.AuthenticatorConfig{Type: "ldap"}, nil, nil, zap.NewNop())
+	require.ErrorIs(t, err, ErrUnknownType)
+}
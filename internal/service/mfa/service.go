@@ -0,0 +1,320 @@
+package mfa
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base32"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/rinnothing/simple-jwt/internal/config"
+	"github.com/rinnothing/simple-jwt/internal/repository/postgres"
+	"github.com/rinnothing/simple-jwt/utils/digest"
+	"github.com/rinnothing/simple-jwt/utils/jwt"
+	"github.com/rinnothing/simple-jwt/utils/totp"
+
+	"go.uber.org/zap"
+)
+
+const (
+	defaultIssuer            = "simple-jwt"
+	defaultChallengeLifetime = 5 * time.Minute
+	defaultMaxAttempts       = 5
+	defaultLockout           = 5 * time.Minute
+	defaultRecoveryCodes     = 10
+
+	challengeSize = 32
+	// 10 base32 characters, 50 bits
+	recoveryCodeSize = 10
+)
+
+var (
+	ErrInvalidCode      = errors.New("invalid mfa code")
+	ErrInvalidChallenge = errors.New("mfa challenge is unknown, expired or already used")
+	ErrAlreadyEnabled   = errors.New("mfa is already enabled")
+	ErrNotEnrolled      = errors.New("mfa enrolment wasn't started")
+	ErrNotEnabled       = errors.New("mfa isn't enabled")
+)
+
+// LockedError is returned while the user is locked out after too many wrong codes, it matches ErrInvalidCode
+type LockedError struct {
+	Until time.Time
+}
+
+func (e *LockedError) Error() string {
+	return fmt.Sprintf("%s, too many attempts, locked until %s", ErrInvalidCode, e.Until.Format(time.RFC3339))
+}
+
+func (e *LockedError) Unwrap() error {
+	return ErrInvalidCode
+}
+
+// Code is the second factor, either totp code or one of recovery codes
+type Code struct {
+	TOTP     string
+	Recovery string
+}
+
+// Enrollment is what user puts into authenticator app
+type Enrollment struct {
+	Secret string
+	URI    string
+}
+
+type MFAService interface {
+	Enabled(ctx context.Context, uuid string) (bool, error)
+	Challenge(ctx context.Context, uuid string, authn jwt.Authentication) (string, time.Duration, error)
+	Verify(ctx context.Context, challenge string, code Code) (string, jwt.Authentication, error)
+
+	Enroll(ctx context.Context, uuid, account string) (Enrollment, error)
+	Confirm(ctx context.Context, uuid, code string) ([]string, error)
+	Disable(ctx context.Context, uuid string, code Code) error
+}
+
+type MFARepo interface {
+	PutTOTP(ctx context.Context, uuid string, secret []byte) error
+	GetTOTP(ctx context.Context, uuid string) (postgres.TOTP, bool, error)
+	MFAEnabled(ctx context.Context, uuid string) (bool, error)
+	EnableTOTP(ctx context.Context, uuid string, step int64, recoveryHashes [][]byte) error
+	UseTOTPStep(ctx context.Context, uuid string, step int64) (bool, error)
+	UseRecoveryCode(ctx context.Context, uuid string, codeHash []byte) (bool, error)
+	TakeMFAAttempt(ctx context.Context, uuid string, maxAttempts int, lockout time.Duration) (bool, time.Time, error)
+	RemoveTOTP(ctx context.Context, uuid string) error
+
+	CreateChallenge(ctx context.Context, challenge postgres.Challenge) error
+	GetChallenge(ctx context.Context, idHash []byte) (postgres.Challenge, bool, error)
+	RemoveChallenge(ctx context.Context, idHash []byte) (bool, error)
+}
+
+type MFAServiceImpl struct {
+	l *zap.Logger
+
+	cfg  config.MFAConfig
+	repo MFARepo
+	// clock of totp codes, replaced in tests
+	now func() time.Time
+}
+
+func NewService(cfg config.MFAConfig, repo MFARepo, l *zap.Logger) MFAService {
+	if cfg.Issuer == "" {
+		cfg.Issuer = defaultIssuer
+	}
+	if cfg.ChallengeLifetime <= 0 {
+		cfg.ChallengeLifetime = defaultChallengeLifetime
+	}
+	if cfg.MaxAttempts <= 0 {
+		cfg.MaxAttempts = defaultMaxAttempts
+	}
+	if cfg.Lockout <= 0 {
+		cfg.Lockout = defaultLockout
+	}
+	if cfg.RecoveryCodes <= 0 {
+		cfg.RecoveryCodes = defaultRecoveryCodes
+	}
+
+	return &MFAServiceImpl{
+		l:    l,
+		cfg:  cfg,
+		repo: repo,
+		now:  time.Now,
+	}
+}
+
+func (s *MFAServiceImpl) Enabled(ctx context.Context, uuid string) (bool, error) {
+	return s.repo.MFAEnabled(ctx, uuid)
+}
+
+// Challenge starts the second step of login, returned token is exchanged together with a code for tokens
+func (s *MFAServiceImpl) Challenge(ctx context.Context, uuid string, authn jwt.Authentication) (string, time.Duration, error) {
+	id := make([]byte, challengeSize)
+	rand.Read(id)
+	token := base64.RawURLEncoding.EncodeToString(id)
+
+	err := s.repo.CreateChallenge(ctx, postgres.Challenge{
+		IDHash:      digest.Random(token),
+		UUID:        uuid,
+		AuthMethods: authn.Methods,
+		ExpiresAt:   s.now().Add(s.cfg.ChallengeLifetime),
+	})
+	if err != nil {
+		return "", 0, err
+	}
+
+	return token, s.cfg.ChallengeLifetime, nil
+}
+
+// Verify checks the code of the challenge and uses it up, it returns uuid of the user and how they were authenticated
+func (s *MFAServiceImpl) Verify(ctx context.Context, challenge string, code Code) (string, jwt.Authentication, error) {
+	idHash := digest.Random(challenge)
+	stored, found, err := s.repo.GetChallenge(ctx, idHash)
+	if err != nil {
+		return "", jwt.Authentication{}, err
+	}
+	if !found {
+		return "", jwt.Authentication{}, ErrInvalidChallenge
+	}
+
+	method, err := s.check(ctx, stored.UUID, code)
+	if err != nil {
+		return "", jwt.Authentication{}, err
+	}
+
+	// the same challenge could be verified concurrently with another code
+	removed, err := s.repo.RemoveChallenge(ctx, idHash)
+	if err != nil {
+		return "", jwt.Authentication{}, err
+	}
+	if !removed {
+		return "", jwt.Authentication{}, ErrInvalidChallenge
+	}
+
+	methods := slices.Clone(stored.AuthMethods)
+	if len(methods) > 0 {
+		methods = append(methods, jwt.AMRMFA)
+	}
+	methods = append(methods, method)
+	return stored.UUID, jwt.Authentication{Methods: methods, Time: s.now().Unix()}, nil
+}
+
+// Enroll starts totp enrolment, it isn't in effect until confirmed with a code
+func (s *MFAServiceImpl) Enroll(ctx context.Context, uuid, account string) (Enrollment, error) {
+	secret := totp.GenerateSecret()
+
+	err := s.repo.PutTOTP(ctx, uuid, secret)
+	if errors.Is(err, postgres.ErrMFAEnabled) {
+		return Enrollment{}, ErrAlreadyEnabled
+	}
+	if err != nil {
+		return Enrollment{}, err
+	}
+
+	return Enrollment{
+		Secret: totp.EncodeSecret(secret),
+		URI:    totp.URI(s.cfg.Issuer, account, secret, totp.Options{}),
+	}, nil
+}
+
+// Confirm enables mfa once the user shows they can make codes, recovery codes are returned only here
+func (s *MFAServiceImpl) Confirm(ctx context.Context, uuid, code string) ([]string, error) {
+	enrolment, found, err := s.repo.GetTOTP(ctx, uuid)
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		return nil, ErrNotEnrolled
+	}
+	if enrolment.Enabled {
+		return nil, ErrAlreadyEnabled
+	}
+
+	step, ok := totp.Validate(enrolment.Secret, code, s.now(), totp.Options{})
+	if !ok {
+		return nil, ErrInvalidCode
+	}
+
+	codes := make([]string, s.cfg.RecoveryCodes)
+	hashes := make([][]byte, s.cfg.RecoveryCodes)
+	for i := range codes {
+		codes[i] = generateRecoveryCode()
+		hashes[i] = digest.Random(normalizeRecoveryCode(codes[i]))
+	}
+
+	err = s.repo.EnableTOTP(ctx, uuid, step, hashes)
+	if errors.Is(err, postgres.ErrMFAEnabled) {
+		return nil, ErrAlreadyEnabled
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return codes, nil
+}
+
+// Disable turns mfa off, it takes a code, so stolen access token alone isn't enough
+func (s *MFAServiceImpl) Disable(ctx context.Context, uuid string, code Code) error {
+	enabled, err := s.repo.MFAEnabled(ctx, uuid)
+	if err != nil {
+		return err
+	}
+	if !enabled {
+		return ErrNotEnabled
+	}
+
+	_, err = s.check(ctx, uuid, code)
+	if err != nil {
+		return err
+	}
+
+	return s.repo.RemoveTOTP(ctx, uuid)
+}
+
+// check verifies the code and uses it up, every attempt counts towards lockout until the right code.
+// It returns amr value of the code
+func (s *MFAServiceImpl) check(ctx context.Context, uuid string, code Code) (string, error) {
+	enrolment, found, err := s.repo.GetTOTP(ctx, uuid)
+	if err != nil {
+		return "", err
+	}
+	if !found || !enrolment.Enabled {
+		return "", ErrNotEnabled
+	}
+
+	// attempt is counted before the code is checked, so parallel guesses can't get past max_attempts
+	allowed, lockedUntil, err := s.repo.TakeMFAAttempt(ctx, uuid, s.cfg.MaxAttempts, s.cfg.Lockout)
+	if err != nil {
+		return "", err
+	}
+	if !allowed && lockedUntil.IsZero() {
+		return "", ErrNotEnabled
+	}
+	if !allowed {
+		return "", &LockedError{Until: lockedUntil}
+	}
+
+	ok := false
+	if code.TOTP != "" {
+		var step int64
+		step, ok = totp.Validate(enrolment.Secret, code.TOTP, s.now(), totp.Options{})
+		if ok && step > enrolment.LastStep {
+			ok, err = s.repo.UseTOTPStep(ctx, uuid, step)
+		} else {
+			ok = false
+		}
+	} else if code.Recovery != "" {
+		ok, err = s.repo.UseRecoveryCode(ctx, uuid, digest.Random(normalizeRecoveryCode(code.Recovery)))
+	}
+	if err != nil {
+		return "", err
+	}
+
+	if !ok {
+		return "", ErrInvalidCode
+	}
+
+	// recovery code is a one-time password too
+	return jwt.AMROTP, nil
+}
+
+var recoveryEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// generateRecoveryCode makes code like abcde-fghij
+func generateRecoveryCode() string {
+	raw := make([]byte, recoveryCodeSize*5/8)
+	rand.Read(raw)
+	code := strings.ToLower(recoveryEncoding.EncodeToString(raw))
+	return code[:recoveryCodeSize/2] + "-" + code[recoveryCodeSize/2:]
+}
+
+// normalizeRecoveryCode lets users type code in any case and with any separators
+func normalizeRecoveryCode(code string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '-' || r == ' ' {
+			return -1
+		}
+		return r
+	}, strings.ToLower(code))
+}
@@ -0,0 +1,266 @@
+package mfa
+
+import (
+	"context"
+	"encoding/base32"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/rinnothing/simple-jwt/internal/config"
+	"github.com/rinnothing/simple-jwt/internal/repository/postgres"
+	"github.com/rinnothing/simple-jwt/utils/jwt"
+	"github.com/rinnothing/simple-jwt/utils/totp"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+// memoryRepo keeps a single user, it's enough to follow the flows
+type memoryRepo struct {
+	now func() time.Time
+
+	totp       *postgres.TOTP
+	failed     int
+	recovery   map[string]bool
+	challenges map[string]postgres.Challenge
+}
+
+func (m *memoryRepo) PutTOTP(_ context.Context, _ string, secret []byte) error {
+	if m.totp != nil && m.totp.Enabled {
+		return postgres.ErrMFAEnabled
+	}
+	m.totp = &postgres.TOTP{Secret: secret}
+	return nil
+}
+
+func (m *memoryRepo) GetTOTP(context.Context, string) (postgres.TOTP, bool, error) {
+	if m.totp == nil {
+		return postgres.TOTP{}, false, nil
+	}
+	return *m.totp, true, nil
+}
+
+func (m *memoryRepo) MFAEnabled(context.Context, string) (bool, error) {
+	return m.totp != nil && m.totp.Enabled, nil
+}
+
+func (m *memoryRepo) EnableTOTP(_ context.Context, _ string, step int64, recoveryHashes [][]byte) error {
+	if m.totp.Enabled {
+		return postgres.ErrMFAEnabled
+	}
+	m.totp.Enabled, m.totp.LastStep = true, step
+	m.recovery = make(map[string]bool)
+	for _, hash := range recoveryHashes {
+		m.recovery[string(hash)] = false
+	}
+	return nil
+}
+
+func (m *memoryRepo) UseTOTPStep(_ context.Context, _ string, step int64) (bool, error) {
+	if step <= m.totp.LastStep {
+		return false, nil
+	}
+	m.totp.LastStep, m.failed, m.totp.LockedUntil = step, 0, time.Time{}
+	return true, nil
+}
+
+func (m *memoryRepo) UseRecoveryCode(_ context.Context, _ string, codeHash []byte) (bool, error) {
+	used, ok := m.recovery[string(codeHash)]
+	if !ok || used {
+		return false, nil
+	}
+	m.recovery[string(codeHash)], m.failed, m.totp.LockedUntil = true, 0, time.Time{}
+	return true, nil
+}
+
+func (m *memoryRepo) TakeMFAAttempt(_ context.Context, _ string, maxAttempts int, lockout time.Duration) (bool, time.Time, error) {
+	if m.now().Before(m.totp.LockedUntil) {
+		return false, m.totp.LockedUntil, nil
+	}
+	m.failed++
+	m.totp.LockedUntil = time.Time{}
+	if m.failed >= maxAttempts {
+		m.failed = 0
+		m.totp.LockedUntil = m.now().Add(lockout)
+	}
+	return true, time.Time{}, nil
+}
+
+func (m *memoryRepo) RemoveTOTP(context.Context, string) error {
+	m.totp, m.recovery, m.challenges = nil, nil, nil
+	return nil
+}
+
+func (m *memoryRepo) CreateChallenge(_ context.Context, challenge postgres.Challenge) error {
+	if m.challenges == nil {
+		m.challenges = make(map[string]postgres.Challenge)
+	}
+	m.challenges[string(challenge.IDHash)] = challenge
+	return nil
+}
+
+func (m *memoryRepo) GetChallenge(_ context.Context, idHash []byte) (postgres.Challenge, bool, error) {
+	challenge, ok := m.challenges[string(idHash)]
+	if !ok || !m.now().Before(challenge.ExpiresAt) {
+		return postgres.Challenge{}, false, nil
+	}
+	return challenge, true, nil
+}
+
+func (m *memoryRepo) RemoveChallenge(_ context.Context, idHash []byte) (bool, error) {
+	_, ok := m.challenges[string(idHash)]
+	delete(m.challenges, string(idHash))
+	return ok, nil
+}
+
+func newService(t *testing.T) (*MFAServiceImpl, *memoryRepo, *time.Time) {
+	now := time.Unix(1700000000, 0)
+	repo := &memoryRepo{now: func() time.Time { return now }}
+
+	s := NewService(config.MFAConfig{MaxAttempts: 3}, repo, zap.NewNop()).(*MFAServiceImpl)
+	s.now = repo.now
+	return s, repo, &now
+}
+
+// enable goes through enrolment and returns the secret together with recovery codes
+func enable(t *testing.T, s *MFAServiceImpl, now time.Time) ([]byte, []string) {
+	ctx := context.Background()
+
+	enrollment, err := s.Enroll(ctx, "uuid", "guid")
+	require.NoError(t, err)
+	require.Contains(t, enrollment.URI, "otpauth://totp/simple-jwt:guid?")
+	secret, err := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(enrollment.Secret)
+	require.NoError(t, err)
+
+	// not in effect before confirmation
+	enabled, err := s.Enabled(ctx, "uuid")
+	require.NoError(t, err)
+	require.False(t, enabled)
+
+	_, err = s.Confirm(ctx, "uuid", "000000")
+	require.ErrorIs(t, err, ErrInvalidCode)
+
+	codes, err := s.Confirm(ctx, "uuid", totp.Code(secret, now, totp.Options{}))
+	require.NoError(t, err)
+	require.Len(t, codes, defaultRecoveryCodes)
+	require.Regexp(t, `^[a-z2-7]{5}-[a-z2-7]{5}$`, codes[0])
+
+	enabled, err = s.Enabled(ctx, "uuid")
+	require.NoError(t, err)
+	require.True(t, enabled)
+
+	_, err = s.Enroll(ctx, "uuid", "guid")
+	require.ErrorIs(t, err, ErrAlreadyEnabled)
+
+	return secret, codes
+}
+
+func TestVerify(t *testing.T) {
+	ctx := context.Background()
+	s, _, now := newService(t)
+	secret, codes := enable(t, s, *now)
+
+	first := jwt.Authentication{Methods: []string{jwt.AMRPassword}, Time: now.Unix()}
+
+	// code used for confirmation can't be used again
+	*now = now.Add(totp.DefaultPeriod)
+	challenge, lifetime, err := s.Challenge(ctx, "uuid", first)
+	require.NoError(t, err)
+	require.Equal(t, defaultChallengeLifetime, lifetime)
+	_, _, err = s.Verify(ctx, challenge, Code{TOTP: totp.Code(secret, now.Add(-totp.DefaultPeriod), totp.Options{})})
+	require.ErrorIs(t, err, ErrInvalidCode)
+
+	*now = now.Add(time.Second)
+	uuid, authn, err := s.Verify(ctx, challenge, Code{TOTP: totp.Code(secret, *now, totp.Options{})})
+	require.NoError(t, err)
+	require.Equal(t, "uuid", uuid)
+	require.Equal(t, []string{jwt.AMRPassword, jwt.AMRMFA, jwt.AMROTP}, authn.Methods)
+	require.Equal(t, now.Unix(), authn.Time)
+
+	// challenge is used up
+	_, _, err = s.Verify(ctx, challenge, Code{Recovery: codes[0]})
+	require.ErrorIs(t, err, ErrInvalidChallenge)
+
+	// recovery codes work once, in any case
+	challenge, _, err = s.Challenge(ctx, "uuid", first)
+	require.NoError(t, err)
+	_, _, err = s.Verify(ctx, challenge, Code{Recovery: " " + codes[0][:5] + codes[0][6:]})
+	require.NoError(t, err)
+
+	challenge, _, err = s.Challenge(ctx, "uuid", first)
+	require.NoError(t, err)
+	_, _, err = s.Verify(ctx, challenge, Code{Recovery: codes[0]})
+	require.ErrorIs(t, err, ErrInvalidCode)
+
+	// challenge expires
+	*now = now.Add(defaultChallengeLifetime)
+	_, _, err = s.Verify(ctx, challenge, Code{Recovery: codes[1]})
+	require.ErrorIs(t, err, ErrInvalidChallenge)
+
+	// second factor alone isn't called mfa
+	challenge, _, err = s.Challenge(ctx, "uuid", jwt.Authentication{})
+	require.NoError(t, err)
+	_, authn, err = s.Verify(ctx, challenge, Code{Recovery: codes[1]})
+	require.NoError(t, err)
+	require.Equal(t, []string{jwt.AMROTP}, authn.Methods)
+}
+
+func TestLockout(t *testing.T) {
+	ctx := context.Background()
+	s, _, now := newService(t)
+	secret, codes := enable(t, s, *now)
+	*now = now.Add(totp.DefaultPeriod)
+
+	challenge, _, err := s.Challenge(ctx, "uuid", jwt.Authentication{})
+	require.NoError(t, err)
+
+	for range 3 {
+		_, _, err = s.Verify(ctx, challenge, Code{TOTP: "000000"})
+		require.ErrorIs(t, err, ErrInvalidCode)
+	}
+
+	// even right code is refused while locked out
+	_, _, err = s.Verify(ctx, challenge, Code{TOTP: totp.Code(secret, *now, totp.Options{})})
+	var locked *LockedError
+	require.ErrorAs(t, err, &locked)
+	require.Equal(t, now.Add(defaultLockout), locked.Until)
+	require.ErrorIs(t, s.Disable(ctx, "uuid", Code{Recovery: codes[0]}), ErrInvalidCode)
+
+	*now = locked.Until
+	challenge, _, err = s.Challenge(ctx, "uuid", jwt.Authentication{})
+	require.NoError(t, err)
+	_, _, err = s.Verify(ctx, challenge, Code{TOTP: totp.Code(secret, *now, totp.Options{})})
+	require.NoError(t, err)
+
+	// the last allowed attempt with the right code isn't locked out
+	*now = now.Add(totp.DefaultPeriod)
+	for range 2 {
+		challenge, _, err = s.Challenge(ctx, "uuid", jwt.Authentication{})
+		require.NoError(t, err)
+		_, _, err = s.Verify(ctx, challenge, Code{TOTP: "000000"})
+		require.ErrorIs(t, err, ErrInvalidCode)
+	}
+	challenge, _, err = s.Challenge(ctx, "uuid", jwt.Authentication{})
+	require.NoError(t, err)
+	_, _, err = s.Verify(ctx, challenge, Code{TOTP: totp.Code(secret, *now, totp.Options{})})
+	require.NoError(t, err)
+	challenge, _, err = s.Challenge(ctx, "uuid", jwt.Authentication{})
+	require.NoError(t, err)
+	_, _, err = s.Verify(ctx, challenge, Code{Recovery: codes[1]})
+	require.NoError(t, err)
+}
+
+func TestDisable(t *testing.T) {
+	ctx := context.Background()
+	s, repo, now := newService(t)
+	_, codes := enable(t, s, *now)
+
+	require.ErrorIs(t, s.Disable(ctx, "uuid", Code{Recovery: "wrong"}), ErrInvalidCode)
+	require.NoError(t, s.Disable(ctx, "uuid", Code{Recovery: codes[0]}))
+	require.Nil(t, repo.totp)
+	require.ErrorIs(t, s.Disable(ctx, "uuid", Code{Recovery: codes[1]}), ErrNotEnabled)
+
+	// can be enrolled again
+	_, codesAgain := enable(t, s, *now)
+	require.False(t, slices.Contains(codesAgain, codes[1]))
+}
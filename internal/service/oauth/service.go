@@ -0,0 +1,147 @@
+package oauth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/rinnothing/simple-jwt/internal/repository/postgres"
+	"github.com/rinnothing/simple-jwt/utils/digest"
+
+	"go.uber.org/zap"
+)
+
+const (
+	GrantClientCredentials = "client_credentials"
+	GrantRefreshToken      = "refresh_token"
+
+	// ClientIDClaim tells which client tokens were issued to, as in RFC 9068
+	ClientIDClaim = "client_id"
+
+	maxClientIDLength = 100
+	secretSize        = 32
+)
+
+// errors are named after error codes of RFC 6749 section 5.2
+var (
+	ErrInvalidClient = errors.New("client is unknown or secret is wrong")
+	ErrInvalidGrant  = errors.New("refresh token is invalid, expired, revoked or issued to another client")
+	ErrInvalidScope  = errors.New("scope is invalid or exceeds scope granted to the client")
+	ErrUnauthorized  = errors.New("client isn't allowed to use the grant")
+	ErrInvalidID     = errors.New("client id must be from 1 to 100 visible ascii characters")
+)
+
+// Client is registered confidential client, it acts on behalf of user UUID
+type Client struct {
+	ID      string
+	UUID    string
+	Scopes  []string
+	Refresh bool
+}
+
+type OAuthService interface {
+	Register(ctx context.Context, id, uuid string, scopes []string, refresh bool) (string, error)
+	Authenticate(ctx context.Context, id, secret string) (Client, error)
+	Grant(client Client, scope string) ([]string, error)
+}
+
+type OAuthRepo interface {
+	PutOAuthClient(ctx context.Context, client postgres.OAuthClient, secretHash []byte) error
+	GetOAuthClient(ctx context.Context, id string) (postgres.OAuthClient, []byte, bool, error)
+}
+
+type OAuthServiceImpl struct {
+	l *zap.Logger
+
+	repo OAuthRepo
+}
+
+func NewService(repo OAuthRepo, l *zap.Logger) OAuthService {
+	return &OAuthServiceImpl{
+		l:    l,
+		repo: repo,
+	}
+}
+
+// Register makes the client or replaces its secret, the secret is returned only here.
+// Client needs at least one scope, otherwise its tokens wouldn't be limited at all
+func (s *OAuthServiceImpl) Register(ctx context.Context, id, uuid string, scopes []string, refresh bool) (string, error) {
+	if len(id) == 0 || len(id) > maxClientIDLength || strings.IndexFunc(id, func(r rune) bool { return r <= ' ' || r > '~' }) != -1 {
+		return "", ErrInvalidID
+	}
+	if len(scopes) == 0 {
+		return "", fmt.Errorf("%w: at least one scope is required", ErrInvalidScope)
+	}
+	for _, scope := range scopes {
+		if !validScope(scope) {
+			return "", fmt.Errorf("%w: %q", ErrInvalidScope, scope)
+		}
+	}
+
+	raw := make([]byte, secretSize)
+	rand.Read(raw)
+	secret := base64.RawURLEncoding.EncodeToString(raw)
+
+	err := s.repo.PutOAuthClient(ctx, postgres.OAuthClient{
+		ID:      id,
+		UUID:    uuid,
+		Scopes:  slices.Compact(slices.Sorted(slices.Values(scopes))),
+		Refresh: refresh,
+	}, digest.Random(secret))
+	if err != nil {
+		return "", err
+	}
+
+	return secret, nil
+}
+
+// Authenticate checks client credentials, unknown client and wrong secret aren't told apart
+func (s *OAuthServiceImpl) Authenticate(ctx context.Context, id, secret string) (Client, error) {
+	stored, secretHash, found, err := s.repo.GetOAuthClient(ctx, id)
+	if err != nil {
+		return Client{}, err
+	}
+	if !found || subtle.ConstantTimeCompare(secretHash, digest.Random(secret)) != 1 {
+		return Client{}, ErrInvalidClient
+	}
+
+	return Client{
+		ID:      stored.ID,
+		UUID:    stored.UUID,
+		Scopes:  stored.Scopes,
+		Refresh: stored.Refresh,
+	}, nil
+}
+
+// Grant returns scopes of the token from scope parameter of the request, all scopes of the client if it's empty
+func (s *OAuthServiceImpl) Grant(client Client, scope string) ([]string, error) {
+	requested := strings.Fields(scope)
+	if len(requested) == 0 {
+		return client.Scopes, nil
+	}
+
+	for _, scope := range requested {
+		if !slices.Contains(client.Scopes, scope) {
+			return nil, fmt.Errorf("%w: %q", ErrInvalidScope, scope)
+		}
+	}
+	return slices.Compact(slices.Sorted(slices.Values(requested))), nil
+}
+
+// validScope checks scope-token syntax of RFC 6749 section 3.3
+func validScope(scope string) bool {
+	if scope == "" {
+		return false
+	}
+	for _, r := range scope {
+		if r < '!' || r > '~' || r == '"' || r == '\\' {
+			return false
+		}
+	}
+	return true
+}
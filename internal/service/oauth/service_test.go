@@ -0,0 +1,82 @@
+package oauth
+
+import (
+	"context"
+	"testing"
+
+	"github.com/rinnothing/simple-jwt/internal/repository/postgres"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+type memoryRepo struct {
+	clients map[string]postgres.OAuthClient
+	hashes  map[string][]byte
+}
+
+func (m *memoryRepo) PutOAuthClient(_ context.Context, client postgres.OAuthClient, secretHash []byte) error {
+	m.clients[client.ID] = client
+	m.hashes[client.ID] = secretHash
+	return nil
+}
+
+func (m *memoryRepo) GetOAuthClient(_ context.Context, id string) (postgres.OAuthClient, []byte, bool, error) {
+	client, ok := m.clients[id]
+	return client, m.hashes[id], ok, nil
+}
+
+func newService() OAuthService {
+	repo := &memoryRepo{clients: make(map[string]postgres.OAuthClient), hashes: make(map[string][]byte)}
+	return NewService(repo, zap.NewNop())
+}
+
+func TestClients(t *testing.T) {
+	ctx := context.Background()
+	s := newService()
+
+	secret, err := s.Register(ctx, "billing", "uuid", []string{"invoices:write", "guid:read", "guid:read"}, true)
+	require.NoError(t, err)
+
+	client, err := s.Authenticate(ctx, "billing", secret)
+	require.NoError(t, err)
+	require.Equal(t, Client{ID: "billing", UUID: "uuid", Scopes: []string{"guid:read", "invoices:write"}, Refresh: true}, client)
+
+	_, err = s.Authenticate(ctx, "billing", secret+"x")
+	require.ErrorIs(t, err, ErrInvalidClient)
+	_, err = s.Authenticate(ctx, "reports", secret)
+	require.ErrorIs(t, err, ErrInvalidClient)
+
+	// registering again replaces the secret
+	newSecret, err := s.Register(ctx, "billing", "uuid", []string{"guid:read"}, false)
+	require.NoError(t, err)
+	_, err = s.Authenticate(ctx, "billing", secret)
+	require.ErrorIs(t, err, ErrInvalidClient)
+	client, err = s.Authenticate(ctx, "billing", newSecret)
+	require.NoError(t, err)
+	require.False(t, client.Refresh)
+
+	_, err = s.Register(ctx, "", "uuid", []string{"guid:read"}, false)
+	require.ErrorIs(t, err, ErrInvalidID)
+	_, err = s.Register(ctx, "with space", "uuid", []string{"guid:read"}, false)
+	require.ErrorIs(t, err, ErrInvalidID)
+	_, err = s.Register(ctx, "reports", "uuid", nil, false)
+	require.ErrorIs(t, err, ErrInvalidScope)
+	_, err = s.Register(ctx, "reports", "uuid", []string{`say"hi"`}, false)
+	require.ErrorIs(t, err, ErrInvalidScope)
+}
+
+func TestGrant(t *testing.T) {
+	s := newService()
+	client := Client{ID: "billing", UUID: "uuid", Scopes: []string{"guid:read", "invoices:write"}}
+
+	scopes, err := s.Grant(client, "")
+	require.NoError(t, err)
+	require.Equal(t, client.Scopes, scopes)
+
+	scopes, err = s.Grant(client, "invoices:write  invoices:write")
+	require.NoError(t, err)
+	require.Equal(t, []string{"invoices:write"}, scopes)
+
+	_, err = s.Grant(client, "guid:read sessions:read")
+	require.ErrorIs(t, err, ErrInvalidScope)
+}
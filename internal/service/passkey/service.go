@@ -0,0 +1,265 @@
+package passkey
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/rinnothing/simple-jwt/internal/api/schema"
+	"github.com/rinnothing/simple-jwt/internal/config"
+	"github.com/rinnothing/simple-jwt/internal/repository/postgres"
+	"github.com/rinnothing/simple-jwt/utils/digest"
+	"github.com/rinnothing/simple-jwt/utils/jwt"
+	"github.com/rinnothing/simple-jwt/utils/webauthn"
+
+	"go.uber.org/zap"
+)
+
+const (
+	defaultRPName  = "simple-jwt"
+	defaultTimeout = 5 * time.Minute
+)
+
+var (
+	ErrDisabled          = errors.New("webauthn isn't configured")
+	ErrInvalidChallenge  = errors.New("webauthn challenge is unknown, expired or already used")
+	ErrInvalidCredential = errors.New("webauthn credential was rejected")
+	ErrUnknownCredential = errors.New("webauthn credential isn't registered")
+	ErrCredentialExists  = errors.New("webauthn credential is already registered")
+	ErrCloned            = errors.New("sign count didn't grow, authenticator may be cloned")
+)
+
+type PasskeyService interface {
+	BeginRegistration(ctx context.Context, uuid string, guid schema.GUID) (webauthn.CreationOptions, error)
+	FinishRegistration(ctx context.Context, uuid string, credential webauthn.Credential) error
+
+	BeginLogin(ctx context.Context, guid schema.GUID) (webauthn.RequestOptions, error)
+	FinishLogin(ctx context.Context, credential webauthn.Credential) (string, jwt.Authentication, error)
+}
+
+type PasskeyRepo interface {
+	GetUUID(ctx context.Context, guid schema.GUID) (string, bool, error)
+
+	CreateWebAuthnChallenge(ctx context.Context, challenge postgres.WebAuthnChallenge) error
+	TakeWebAuthnChallenge(ctx context.Context, challengeHash []byte, ceremony string) (postgres.WebAuthnChallenge, bool, error)
+	PutWebAuthnCredential(ctx context.Context, credential postgres.WebAuthnCredential) error
+	ListWebAuthnCredentials(ctx context.Context, uuid string) ([][]byte, error)
+	GetWebAuthnCredential(ctx context.Context, id []byte) (postgres.WebAuthnCredential, bool, error)
+	UseWebAuthnCredential(ctx context.Context, id []byte, signCount uint32) (bool, error)
+}
+
+type PasskeyServiceImpl struct {
+	l *zap.Logger
+
+	rp   *webauthn.RelyingParty
+	repo PasskeyRepo
+	now  func() time.Time
+}
+
+func NewService(cfg config.WebAuthnConfig, repo PasskeyRepo, l *zap.Logger) PasskeyService {
+	if cfg.RPName == "" {
+		cfg.RPName = defaultRPName
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = defaultTimeout
+	}
+
+	return &PasskeyServiceImpl{
+		l: l,
+		rp: &webauthn.RelyingParty{
+			ID:               cfg.RPID,
+			Name:             cfg.RPName,
+			Origins:          cfg.Origins,
+			UserVerification: cfg.UserVerification,
+			Attestation:      cfg.Attestation,
+			Timeout:          cfg.Timeout,
+		},
+		repo: repo,
+		now:  time.Now,
+	}
+}
+
+// BeginRegistration starts adding passkey to the user, options are passed to navigator.credentials.create()
+func (s *PasskeyServiceImpl) BeginRegistration(ctx context.Context, uuid string, guid schema.GUID) (webauthn.CreationOptions, error) {
+	if s.rp.ID == "" {
+		return webauthn.CreationOptions{}, ErrDisabled
+	}
+
+	registered, err := s.repo.ListWebAuthnCredentials(ctx, uuid)
+	if err != nil {
+		return webauthn.CreationOptions{}, err
+	}
+
+	challenge, err := s.challenge(ctx, uuid, webauthn.CeremonyCreate)
+	if err != nil {
+		return webauthn.CreationOptions{}, err
+	}
+
+	user := webauthn.UserEntity{ID: userHandle(uuid), Name: guid, DisplayName: guid}
+	return s.rp.CreationOptions(challenge, user, registered), nil
+}
+
+// FinishRegistration verifies the new credential and stores it, challenge must have been made for the same user
+func (s *PasskeyServiceImpl) FinishRegistration(ctx context.Context, uuid string, credential webauthn.Credential) error {
+	if s.rp.ID == "" {
+		return ErrDisabled
+	}
+
+	stored, err := s.takeChallenge(ctx, credential, webauthn.CeremonyCreate)
+	if err != nil {
+		return err
+	}
+	if stored.UUID != uuid {
+		return ErrInvalidChallenge
+	}
+
+	registration, err := s.rp.VerifyRegistration(stored.challenge, credential)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidCredential, err)
+	}
+
+	err = s.repo.PutWebAuthnCredential(ctx, postgres.WebAuthnCredential{
+		ID:        registration.CredentialID,
+		UUID:      uuid,
+		PublicKey: registration.PublicKey,
+		SignCount: registration.SignCount,
+		AAGUID:    registration.AAGUID,
+		Format:    registration.Format,
+	})
+	if errors.Is(err, postgres.ErrCredentialExists) {
+		return ErrCredentialExists
+	}
+	return err
+}
+
+// BeginLogin starts login, options are passed to navigator.credentials.get().
+// Without guid, or for users without passkeys, any discoverable credential may be used
+func (s *PasskeyServiceImpl) BeginLogin(ctx context.Context, guid schema.GUID) (webauthn.RequestOptions, error) {
+	if s.rp.ID == "" {
+		return webauthn.RequestOptions{}, ErrDisabled
+	}
+
+	var uuid string
+	var allowed [][]byte
+	if guid != "" {
+		found := false
+		var err error
+		uuid, found, err = s.repo.GetUUID(ctx, guid)
+		if err != nil {
+			return webauthn.RequestOptions{}, err
+		}
+		if found {
+			allowed, err = s.repo.ListWebAuthnCredentials(ctx, uuid)
+			if err != nil {
+				return webauthn.RequestOptions{}, err
+			}
+		}
+		if len(allowed) == 0 {
+			uuid = ""
+		}
+	}
+
+	challenge, err := s.challenge(ctx, uuid, webauthn.CeremonyGet)
+	if err != nil {
+		return webauthn.RequestOptions{}, err
+	}
+
+	return s.rp.RequestOptions(challenge, allowed), nil
+}
+
+// FinishLogin verifies assertion, it returns uuid of the credential owner and how they were authenticated.
+// Verified user counts as mfa, the authenticator checked pin or biometrics in addition to holding the key
+func (s *PasskeyServiceImpl) FinishLogin(ctx context.Context, credential webauthn.Credential) (string, jwt.Authentication, error) {
+	if s.rp.ID == "" {
+		return "", jwt.Authentication{}, ErrDisabled
+	}
+
+	stored, err := s.takeChallenge(ctx, credential, webauthn.CeremonyGet)
+	if err != nil {
+		return "", jwt.Authentication{}, err
+	}
+
+	registered, found, err := s.repo.GetWebAuthnCredential(ctx, credential.RawID)
+	if err != nil {
+		return "", jwt.Authentication{}, err
+	}
+	if !found {
+		return "", jwt.Authentication{}, ErrUnknownCredential
+	}
+	// challenge of a user is answered only by their credentials
+	if stored.UUID != "" && stored.UUID != registered.UUID {
+		return "", jwt.Authentication{}, ErrUnknownCredential
+	}
+
+	assertion, err := s.rp.VerifyAssertion(stored.challenge, credential, registered.PublicKey)
+	if err != nil {
+		return "", jwt.Authentication{}, fmt.Errorf("%w: %w", ErrInvalidCredential, err)
+	}
+	if len(assertion.UserHandle) != 0 && subtle.ConstantTimeCompare(assertion.UserHandle, userHandle(registered.UUID)) != 1 {
+		return "", jwt.Authentication{}, fmt.Errorf("%w: user handle differs from the credential owner", ErrInvalidCredential)
+	}
+
+	used, err := s.repo.UseWebAuthnCredential(ctx, registered.ID, assertion.SignCount)
+	if err != nil {
+		return "", jwt.Authentication{}, err
+	}
+	if !used {
+		s.l.Warn("webauthn sign count didn't grow", zap.String("uuid", registered.UUID),
+			zap.Uint32("stored", registered.SignCount), zap.Uint32("got", assertion.SignCount))
+		return "", jwt.Authentication{}, ErrCloned
+	}
+
+	methods := []string{jwt.AMRHardwareKey}
+	if assertion.UserVerified {
+		methods = append(methods, jwt.AMRMFA)
+	}
+	return registered.UUID, jwt.Authentication{Methods: methods, Time: s.now().Unix()}, nil
+}
+
+func (s *PasskeyServiceImpl) challenge(ctx context.Context, uuid, ceremony string) ([]byte, error) {
+	challenge := make([]byte, webauthn.ChallengeSize)
+	rand.Read(challenge)
+
+	err := s.repo.CreateWebAuthnChallenge(ctx, postgres.WebAuthnChallenge{
+		ChallengeHash: digest.Random(challenge),
+		UUID:          uuid,
+		Ceremony:      ceremony,
+		ExpiresAt:     s.now().Add(s.rp.Timeout),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return challenge, nil
+}
+
+type takenChallenge struct {
+	postgres.WebAuthnChallenge
+	challenge []byte
+}
+
+// takeChallenge uses up the challenge the credential answers, so it can't be answered twice
+func (s *PasskeyServiceImpl) takeChallenge(ctx context.Context, credential webauthn.Credential, ceremony string) (takenChallenge, error) {
+	challenge, err := webauthn.ChallengeOf(credential)
+	if err != nil {
+		return takenChallenge{}, fmt.Errorf("%w: %w", ErrInvalidCredential, err)
+	}
+
+	stored, found, err := s.repo.TakeWebAuthnChallenge(ctx, digest.Random(challenge), ceremony)
+	if err != nil {
+		return takenChallenge{}, err
+	}
+	if !found {
+		return takenChallenge{}, ErrInvalidChallenge
+	}
+
+	return takenChallenge{WebAuthnChallenge: stored, challenge: challenge}, nil
+}
+
+// userHandle is what authenticator keeps for the user, uuid is random, so it tells nothing about the user
+func userHandle(uuid string) []byte {
+	return []byte(uuid)
+}
@@ -0,0 +1,215 @@
+package passkey
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/rinnothing/simple-jwt/internal/config"
+	"github.com/rinnothing/simple-jwt/internal/repository/postgres"
+	"github.com/rinnothing/simple-jwt/utils/jwt"
+	"github.com/rinnothing/simple-jwt/utils/webauthn"
+	"github.com/rinnothing/simple-jwt/utils/webauthn/webauthntest"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+const origin = "https://login.example.com"
+
+type memoryRepo struct {
+	now func() time.Time
+
+	users       map[string]string
+	challenges  map[string]postgres.WebAuthnChallenge
+	credentials map[string]postgres.WebAuthnCredential
+}
+
+func (m *memoryRepo) GetUUID(_ context.Context, guid string) (string, bool, error) {
+	uuid, ok := m.users[guid]
+	return uuid, ok, nil
+}
+
+func (m *memoryRepo) CreateWebAuthnChallenge(_ context.Context, challenge postgres.WebAuthnChallenge) error {
+	m.challenges[string(challenge.ChallengeHash)] = challenge
+	return nil
+}
+
+func (m *memoryRepo) TakeWebAuthnChallenge(_ context.Context, challengeHash []byte, ceremony string) (postgres.WebAuthnChallenge, bool, error) {
+	challenge, ok := m.challenges[string(challengeHash)]
+	if !ok || challenge.Ceremony != ceremony || !m.now().Before(challenge.ExpiresAt) {
+		return postgres.WebAuthnChallenge{}, false, nil
+	}
+	delete(m.challenges, string(challengeHash))
+	return challenge, true, nil
+}
+
+func (m *memoryRepo) PutWebAuthnCredential(_ context.Context, credential postgres.WebAuthnCredential) error {
+	if _, ok := m.credentials[string(credential.ID)]; ok {
+		return postgres.ErrCredentialExists
+	}
+	m.credentials[string(credential.ID)] = credential
+	return nil
+}
+
+func (m *memoryRepo) ListWebAuthnCredentials(_ context.Context, uuid string) ([][]byte, error) {
+	var ids [][]byte
+	for _, credential := range m.credentials {
+		if credential.UUID == uuid {
+			ids = append(ids, credential.ID)
+		}
+	}
+	return ids, nil
+}
+
+func (m *memoryRepo) GetWebAuthnCredential(_ context.Context, id []byte) (postgres.WebAuthnCredential, bool, error) {
+	credential, ok := m.credentials[string(id)]
+	return credential, ok, nil
+}
+
+func (m *memoryRepo) UseWebAuthnCredential(_ context.Context, id []byte, signCount uint32) (bool, error) {
+	credential := m.credentials[string(id)]
+	if signCount <= credential.SignCount && (signCount != 0 || credential.SignCount != 0) {
+		return false, nil
+	}
+	credential.SignCount = signCount
+	m.credentials[string(id)] = credential
+	return true, nil
+}
+
+func newService(t *testing.T, userVerification string) (*PasskeyServiceImpl, *time.Time) {
+	now := time.Unix(1700000000, 0)
+	repo := &memoryRepo{
+		now:         func() time.Time { return now },
+		users:       map[string]string{"guid": "uuid", "other": "other-uuid"},
+		challenges:  make(map[string]postgres.WebAuthnChallenge),
+		credentials: make(map[string]postgres.WebAuthnCredential),
+	}
+
+	s := NewService(config.WebAuthnConfig{
+		RPID:             "example.com",
+		Origins:          []string{origin},
+		UserVerification: userVerification,
+	}, repo, zap.NewNop()).(*PasskeyServiceImpl)
+	s.now = repo.now
+	return s, &now
+}
+
+func register(t *testing.T, s *PasskeyServiceImpl, a *webauthntest.Authenticator, uuid, guid string) webauthn.Credential {
+	ctx := context.Background()
+
+	options, err := s.BeginRegistration(ctx, uuid, guid)
+	require.NoError(t, err)
+	credential, err := a.Create(options)
+	require.NoError(t, err)
+	require.NoError(t, s.FinishRegistration(ctx, uuid, credential))
+	return credential
+}
+
+func login(t *testing.T, s *PasskeyServiceImpl, a *webauthntest.Authenticator, guid string) webauthn.Credential {
+	options, err := s.BeginLogin(context.Background(), guid)
+	require.NoError(t, err)
+	credential, err := a.Get(options)
+	require.NoError(t, err)
+	return credential
+}
+
+func TestPasskeyLogin(t *testing.T) {
+	ctx := context.Background()
+	s, now := newService(t, webauthn.UserVerificationPreferred)
+	a := webauthntest.New(origin)
+
+	registered := register(t, s, a, "uuid", "guid")
+
+	// the same authenticator can't register the credential twice
+	options, err := s.BeginRegistration(ctx, "uuid", "guid")
+	require.NoError(t, err)
+	require.Len(t, options.ExcludeCredentials, 1)
+	require.Equal(t, registered.RawID, options.ExcludeCredentials[0].ID)
+
+	// by guid and with discoverable credential
+	for _, guid := range []string{"guid", ""} {
+		uuid, authn, err := s.FinishLogin(ctx, login(t, s, a, guid))
+		require.NoError(t, err)
+		require.Equal(t, "uuid", uuid)
+		require.Equal(t, []string{jwt.AMRHardwareKey, jwt.AMRMFA}, authn.Methods)
+		require.Equal(t, now.Unix(), authn.Time)
+	}
+
+	// not verified user has only one factor
+	a.UserVerified = false
+	_, authn, err := s.FinishLogin(ctx, login(t, s, a, "guid"))
+	require.NoError(t, err)
+	require.Equal(t, []string{jwt.AMRHardwareKey}, authn.Methods)
+}
+
+func TestPasskeyLoginRejected(t *testing.T) {
+	ctx := context.Background()
+	s, now := newService(t, webauthn.UserVerificationRequired)
+	a := webauthntest.New(origin)
+	registered := register(t, s, a, "uuid", "guid")
+
+	// challenge is used up
+	credential := login(t, s, a, "guid")
+	_, _, err := s.FinishLogin(ctx, credential)
+	require.NoError(t, err)
+	_, _, err = s.FinishLogin(ctx, credential)
+	require.ErrorIs(t, err, ErrInvalidChallenge)
+
+	// challenge expires
+	credential = login(t, s, a, "guid")
+	*now = now.Add(defaultTimeout)
+	_, _, err = s.FinishLogin(ctx, credential)
+	require.ErrorIs(t, err, ErrInvalidChallenge)
+
+	// registration challenge can't be used for login
+	options, err := s.BeginRegistration(ctx, "uuid", "guid")
+	require.NoError(t, err)
+	credential, err = a.Get(webauthn.RequestOptions{Challenge: options.Challenge, RPID: options.RP.ID})
+	require.NoError(t, err)
+	_, _, err = s.FinishLogin(ctx, credential)
+	require.ErrorIs(t, err, ErrInvalidChallenge)
+
+	// challenge of another user
+	other := webauthntest.New(origin)
+	register(t, s, other, "other-uuid", "other")
+	options2, err := s.BeginLogin(ctx, "guid")
+	require.NoError(t, err)
+	credential, err = other.Get(webauthn.RequestOptions{Challenge: options2.Challenge, RPID: options2.RPID})
+	require.NoError(t, err)
+	_, _, err = s.FinishLogin(ctx, credential)
+	require.ErrorIs(t, err, ErrUnknownCredential)
+
+	// unverified user when verification is required
+	a.UserVerified = false
+	_, _, err = s.FinishLogin(ctx, login(t, s, a, "guid"))
+	require.ErrorIs(t, err, webauthn.ErrUserVerification)
+	require.ErrorIs(t, err, ErrInvalidCredential)
+	a.UserVerified = true
+
+	// cloned authenticator goes back in sign count
+	a.SetCounter(registered.RawID, 0)
+	_, _, err = s.FinishLogin(ctx, login(t, s, a, "guid"))
+	require.ErrorIs(t, err, ErrCloned)
+}
+
+func TestPasskeyRegistrationRejected(t *testing.T) {
+	ctx := context.Background()
+	s, _ := newService(t, webauthn.UserVerificationPreferred)
+	a := webauthntest.New(origin)
+
+	// challenge of another user
+	options, err := s.BeginRegistration(ctx, "uuid", "guid")
+	require.NoError(t, err)
+	credential, err := a.Create(options)
+	require.NoError(t, err)
+	require.ErrorIs(t, s.FinishRegistration(ctx, "other-uuid", credential), ErrInvalidChallenge)
+
+	// unknown credential can't login
+	_, _, err = s.FinishLogin(ctx, login(t, s, a, ""))
+	require.ErrorIs(t, err, ErrUnknownCredential)
+
+	// passkeys are off without rp id
+	disabled := NewService(config.WebAuthnConfig{}, s.repo, zap.NewNop())
+	_, err = disabled.BeginLogin(ctx, "guid")
+	require.ErrorIs(t, err, ErrDisabled)
+}
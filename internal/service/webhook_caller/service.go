@@ -12,6 +12,7 @@ import (
 
 type WebhookService interface {
 	CallWebhook(ip string) error
+	ReportTokenReuse(uuid, sessionID, ip string) error
 }
 
 type WebhookServiceImpl struct {
@@ -27,14 +28,30 @@ func NewService(cfg config.WebhookConfig, l *zap.Logger) WebhookService {
 	}
 }
 
+// security events have Event set, so receivers can tell them from plain notifications
 type PostRequest struct {
+	Event   string `json:"event,omitempty"`
 	Message string `json:"message"`
 }
 
+const EventRefreshTokenReuse = "refresh_token_reuse"
+
 func (w *WebhookServiceImpl) CallWebhook(ip string) error {
+	return w.post(PostRequest{Message: fmt.Sprintf("try to auth from unknow ip found: %s", ip)})
+}
+
+// ReportTokenReuse tells that rotated refresh token was presented again, so the session was revoked
+func (w *WebhookServiceImpl) ReportTokenReuse(uuid, sessionID, ip string) error {
+	return w.post(PostRequest{
+		Event:   EventRefreshTokenReuse,
+		Message: fmt.Sprintf("refresh token reuse detected for user %s from ip %s, session %s was revoked", uuid, ip, sessionID),
+	})
+}
+
+func (w *WebhookServiceImpl) post(body PostRequest) error {
 	request := w.client.R()
 
-	requestBytes, err := json.Marshal(PostRequest{Message: fmt.Sprintf("try to auth from unknow ip found: %s", ip)})
+	requestBytes, err := json.Marshal(body)
 	if err != nil {
 		return fmt.Errorf("failed to marshal request: %w", err)
 	}
@@ -0,0 +1,31 @@
+-- +goose Up
+ALTER TABLE keys
+    ADD COLUMN id SERIAL PRIMARY KEY,
+    ADD COLUMN algorithm TEXT NOT NULL DEFAULT 'HS512',
+    ADD COLUMN state TEXT NOT NULL DEFAULT 'verify-only' CHECK (state IN ('active', 'verify-only', 'retired')),
+    ADD COLUMN activated_at TIMESTAMPTZ,
+    ADD COLUMN retired_at TIMESTAMPTZ;
+
+-- before keyring only the newest row was used
+UPDATE keys
+SET state = 'retired', activated_at = created_at, retired_at = now();
+
+UPDATE keys
+SET state = 'active', retired_at = NULL
+WHERE id = (SELECT id FROM keys ORDER BY created_at DESC LIMIT 1);
+
+ALTER TABLE keys
+    ALTER COLUMN activated_at SET DEFAULT now(),
+    ALTER COLUMN activated_at SET NOT NULL;
+
+CREATE UNIQUE INDEX index_keys_single_active ON keys(state) WHERE state = 'active';
+
+-- +goose Down
+DROP INDEX index_keys_single_active;
+
+ALTER TABLE keys
+    DROP COLUMN retired_at,
+    DROP COLUMN activated_at,
+    DROP COLUMN state,
+    DROP COLUMN algorithm,
+    DROP COLUMN id;
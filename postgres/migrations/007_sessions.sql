@@ -0,0 +1,48 @@
+-- +goose Up
+-- one storage row per guid, sessions of the duplicates are dropped, so those users have to authorize again
+DELETE FROM storage a
+USING storage b
+WHERE a.guid = b.guid AND a.id > b.id;
+
+CREATE UNIQUE INDEX index_storage_guid ON storage(guid);
+
+CREATE TABLE sessions
+(
+    id TEXT PRIMARY KEY,
+    user_id UUID NOT NULL REFERENCES storage(id) ON DELETE CASCADE,
+    refresh_hash VARCHAR(60) NOT NULL,
+    user_agent TEXT NOT NULL,
+    ip TEXT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    last_used_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX index_sessions_user ON sessions(user_id);
+
+-- tokens issued before have no session id, their session is found by user id
+INSERT INTO sessions (id, user_id, refresh_hash, user_agent, ip)
+SELECT id::TEXT, id, refresh_hash, user_agent, ip
+FROM auth;
+
+DROP TABLE auth;
+
+-- +goose Down
+CREATE TABLE auth
+(
+    id UUID PRIMARY KEY REFERENCES storage(id) ON DELETE CASCADE,
+    refresh_hash VARCHAR(60) NOT NULL,
+    user_agent TEXT NOT NULL,
+    ip TEXT NOT NULL
+);
+
+CREATE INDEX index_auth_table ON auth(id);
+
+-- only the most recently used session survives
+INSERT INTO auth (id, refresh_hash, user_agent, ip)
+SELECT DISTINCT ON (user_id) user_id, refresh_hash, user_agent, ip
+FROM sessions
+ORDER BY user_id, last_used_at DESC;
+
+DROP TABLE sessions;
+
+DROP INDEX index_storage_guid;
@@ -0,0 +1,16 @@
+-- +goose Up
+-- every refresh token of a session, linked to the one it was rotated from, the session is the family root.
+-- only ids from inside v2 refresh tokens are stored, tokens themselves are still kept only as bcrypt hash
+CREATE TABLE refresh_tokens
+(
+    id TEXT PRIMARY KEY,
+    session_id TEXT NOT NULL REFERENCES sessions(id) ON DELETE CASCADE,
+    parent_id TEXT REFERENCES refresh_tokens(id) ON DELETE SET NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    rotated_at TIMESTAMPTZ
+);
+
+CREATE INDEX index_refresh_tokens_session ON refresh_tokens(session_id);
+
+-- +goose Down
+DROP TABLE refresh_tokens;
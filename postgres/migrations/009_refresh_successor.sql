@@ -0,0 +1,6 @@
+-- +goose Up
+-- sealed pair issued by rotation of the token, returned to duplicate refresh requests within grace period
+ALTER TABLE refresh_tokens ADD COLUMN successor BYTEA;
+
+-- +goose Down
+ALTER TABLE refresh_tokens DROP COLUMN successor;
@@ -0,0 +1,7 @@
+-- +goose Up
+-- keyed hash of the latest access token of the session, checked on every request instead of bcrypt.
+-- sessions of older tokens have none until refresh and fall back to refresh_hash
+ALTER TABLE sessions ADD COLUMN access_fingerprint TEXT;
+
+-- +goose Down
+ALTER TABLE sessions DROP COLUMN access_fingerprint;
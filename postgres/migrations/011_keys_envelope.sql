@@ -0,0 +1,12 @@
+-- +goose Up
+-- key columns hold keys sealed by data key, which is wrapped by key encryption key with kek_id.
+-- rows without kek_id are still in plain text, server wraps them on start
+ALTER TABLE keys
+    ADD COLUMN kek_id TEXT,
+    ADD COLUMN wrapped_dek BYTEA;
+
+-- +goose Down
+-- wrapped rows can't be read after it, so it's only safe before the server has wrapped anything
+ALTER TABLE keys
+    DROP COLUMN wrapped_dek,
+    DROP COLUMN kek_id;
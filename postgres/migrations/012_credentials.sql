@@ -0,0 +1,11 @@
+-- +goose Up
+-- password of a user as argon2id hash in PHC string format, parameters are kept inside the hash
+CREATE TABLE credentials
+(
+    user_id UUID PRIMARY KEY REFERENCES storage(id) ON DELETE CASCADE,
+    password_hash TEXT NOT NULL,
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+-- +goose Down
+DROP TABLE credentials;
@@ -0,0 +1,40 @@
+-- +goose Up
+-- totp secret is sealed by data key, which is wrapped by key encryption key with kek_id, like keys are.
+-- enrolment isn't in effect until it's confirmed with a code, last_step keeps used codes from being used again
+CREATE TABLE mfa_totp
+(
+    user_id UUID PRIMARY KEY REFERENCES storage(id) ON DELETE CASCADE,
+    secret BYTEA NOT NULL,
+    kek_id TEXT NOT NULL,
+    wrapped_dek BYTEA NOT NULL,
+    enabled_at TIMESTAMPTZ,
+    last_step BIGINT NOT NULL DEFAULT 0,
+    failed_attempts INT NOT NULL DEFAULT 0,
+    locked_until TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+-- only hashes of recovery codes are kept
+CREATE TABLE mfa_recovery_codes
+(
+    user_id UUID NOT NULL REFERENCES storage(id) ON DELETE CASCADE,
+    code_hash BYTEA NOT NULL,
+    used_at TIMESTAMPTZ,
+    PRIMARY KEY (user_id, code_hash)
+);
+
+-- first step of login of users with mfa, only sha256 of the challenge token is kept
+CREATE TABLE mfa_challenges
+(
+    id_hash BYTEA PRIMARY KEY,
+    user_id UUID NOT NULL REFERENCES storage(id) ON DELETE CASCADE,
+    auth_methods TEXT[] NOT NULL,
+    expires_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX index_mfa_challenges_expires ON mfa_challenges(expires_at);
+
+-- +goose Down
+DROP TABLE mfa_challenges;
+DROP TABLE mfa_recovery_codes;
+DROP TABLE mfa_totp;
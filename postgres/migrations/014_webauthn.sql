@@ -0,0 +1,30 @@
+-- +goose Up
+-- passkeys of users, public_key is COSE_Key. sign_count only grows, authenticators which don't count keep it zero
+CREATE TABLE webauthn_credentials
+(
+    id BYTEA PRIMARY KEY,
+    user_id UUID NOT NULL REFERENCES storage(id) ON DELETE CASCADE,
+    public_key BYTEA NOT NULL,
+    sign_count BIGINT NOT NULL DEFAULT 0,
+    aaguid BYTEA NOT NULL,
+    attestation_format TEXT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    last_used_at TIMESTAMPTZ
+);
+
+CREATE INDEX index_webauthn_credentials_user ON webauthn_credentials(user_id);
+
+-- pending ceremonies, only sha256 of the challenge is kept. user_id is empty for login with discoverable credential
+CREATE TABLE webauthn_challenges
+(
+    challenge_hash BYTEA PRIMARY KEY,
+    user_id UUID REFERENCES storage(id) ON DELETE CASCADE,
+    ceremony TEXT NOT NULL,
+    expires_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX index_webauthn_challenges_expires ON webauthn_challenges(expires_at);
+
+-- +goose Down
+DROP TABLE webauthn_challenges;
+DROP TABLE webauthn_credentials;
@@ -0,0 +1,20 @@
+-- +goose Up
+-- only hashes of keys are kept, prefix is shown to tell keys apart.
+-- keys without expires_at never expire, revoked keys are deleted
+CREATE TABLE api_keys
+(
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    user_id UUID NOT NULL REFERENCES storage(id) ON DELETE CASCADE,
+    key_hash BYTEA NOT NULL UNIQUE,
+    prefix TEXT NOT NULL,
+    label TEXT NOT NULL,
+    scopes TEXT[] NOT NULL,
+    expires_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    last_used_at TIMESTAMPTZ
+);
+
+CREATE INDEX index_api_keys_user ON api_keys(user_id);
+
+-- +goose Down
+DROP TABLE api_keys;
@@ -0,0 +1,14 @@
+-- +goose Up
+-- confidential clients of the oauth token endpoint, they act on behalf of user_id, only hashes of secrets are kept
+CREATE TABLE oauth_clients
+(
+    client_id TEXT PRIMARY KEY,
+    user_id UUID NOT NULL REFERENCES storage(id) ON DELETE CASCADE,
+    secret_hash BYTEA NOT NULL,
+    scopes TEXT[] NOT NULL,
+    refresh BOOLEAN NOT NULL DEFAULT false,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+-- +goose Down
+DROP TABLE oauth_clients;
@@ -0,0 +1,13 @@
+-- +goose Up
+-- when the server started to issue v2 refresh tokens, v1 ones are accepted for refresh lifetime after it.
+-- single row, it's written once by the migration and never changed
+CREATE TABLE refresh_rollout
+(
+    id BOOLEAN PRIMARY KEY DEFAULT true CHECK (id),
+    v2_since TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+INSERT INTO refresh_rollout DEFAULT VALUES;
+
+-- +goose Down
+DROP TABLE refresh_rollout;
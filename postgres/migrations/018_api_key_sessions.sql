@@ -0,0 +1,11 @@
+-- +goose Up
+-- sessions of access tokens exchanged for api key, they have no refresh token, aren't listed to the user
+-- and are removed together with the key
+ALTER TABLE sessions ADD COLUMN api_key_id UUID REFERENCES api_keys(id) ON DELETE CASCADE;
+
+CREATE INDEX index_sessions_api_key ON sessions(api_key_id);
+
+-- +goose Down
+DROP INDEX index_sessions_api_key;
+
+ALTER TABLE sessions DROP COLUMN api_key_id;
@@ -0,0 +1,11 @@
+-- +goose Up
+-- sessions of access tokens oauth clients get with client_credentials, like sessions of api keys
+-- they have no refresh token, aren't listed to the user and are removed together with the client
+ALTER TABLE sessions ADD COLUMN oauth_client_id TEXT REFERENCES oauth_clients(client_id) ON DELETE CASCADE;
+
+CREATE INDEX index_sessions_oauth_client ON sessions(oauth_client_id);
+
+-- +goose Down
+DROP INDEX index_sessions_oauth_client;
+
+ALTER TABLE sessions DROP COLUMN oauth_client_id;
@@ -0,0 +1,6 @@
+-- +goose Up
+-- successors are cleared once grace period is over, index keeps finding them cheap
+CREATE INDEX index_refresh_tokens_successor ON refresh_tokens(rotated_at) WHERE successor IS NOT NULL;
+
+-- +goose Down
+DROP INDEX index_refresh_tokens_successor;
@@ -0,0 +1,12 @@
+// Package digest hashes random values the server hands out, such as api keys, client secrets,
+// recovery codes and challenges, so only the hash is stored and the value is found by it
+package digest
+
+import "crypto/sha256"
+
+// Random returns sha256 of the value. The values are random, so they can't be guessed from the hash,
+// and salt with slow hashing would only slow down every request
+func Random[T string | []byte](value T) []byte {
+	sum := sha256.Sum256([]byte(value))
+	return sum[:]
+}
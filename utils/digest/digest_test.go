@@ -0,0 +1,15 @@
+package digest
+
+import (
+	"encoding/hex"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRandom(t *testing.T) {
+	// sha256 of "abc" from FIPS 180-2
+	want := "ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad"
+	require.Equal(t, want, hex.EncodeToString(Random("abc")))
+	require.Equal(t, Random("abc"), Random([]byte("abc")))
+}
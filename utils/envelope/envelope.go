@@ -0,0 +1,182 @@
+package envelope
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+const KeySize = 32
+
+var (
+	ErrNoKEK      = errors.New("no key encryption key")
+	ErrUnknownKEK = errors.New("unknown key encryption key")
+	ErrDecryption = errors.New("can't decrypt")
+)
+
+// KEK is a key encryption key, it only wraps data keys, which encrypt the data itself
+type KEK struct {
+	// derived from the key, so it can't be mixed up with another one
+	ID string
+
+	aead cipher.AEAD
+}
+
+func NewKEK(key []byte) (*KEK, error) {
+	if len(key) != KeySize {
+		return nil, fmt.Errorf("key encryption key must be %d bytes, got %d", KeySize, len(key))
+	}
+
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+
+	sum := sha256.Sum256(key)
+	return &KEK{
+		ID:   hex.EncodeToString(sum[:8]),
+		aead: aead,
+	}, nil
+}
+
+// ParseKEKs reads base64 encoded keys separated by spaces, commas or new lines
+func ParseKEKs(text string) ([]*KEK, error) {
+	fields := strings.FieldsFunc(text, func(r rune) bool {
+		return r == ',' || r == ' ' || r == '\n' || r == '\r' || r == '\t'
+	})
+
+	keks := make([]*KEK, 0, len(fields))
+	for i, field := range fields {
+		key, err := base64.StdEncoding.DecodeString(field)
+		if err != nil {
+			return nil, fmt.Errorf("can't decode key encryption key #%d: %w", i+1, err)
+		}
+
+		kek, err := NewKEK(key)
+		if err != nil {
+			return nil, fmt.Errorf("bad key encryption key #%d: %w", i+1, err)
+		}
+		keks = append(keks, kek)
+	}
+
+	return keks, nil
+}
+
+// Wrapper wraps data keys with the current KEK and unwraps them with any known one
+type Wrapper struct {
+	current *KEK
+	keks    map[string]*KEK
+}
+
+// NewWrapper makes wrapper, the first KEK is the current one, the others are kept to unwrap older data keys
+func NewWrapper(keks ...*KEK) (*Wrapper, error) {
+	if len(keks) == 0 {
+		return nil, ErrNoKEK
+	}
+
+	w := &Wrapper{
+		current: keks[0],
+		keks:    make(map[string]*KEK, len(keks)),
+	}
+	for _, kek := range keks {
+		w.keks[kek.ID] = kek
+	}
+	return w, nil
+}
+
+// CurrentID is id of the KEK new data keys are wrapped with
+func (w *Wrapper) CurrentID() string {
+	return w.current.ID
+}
+
+// NewDEK generates data key, it's returned together with its wrapped form and id of KEK which wrapped it
+func (w *Wrapper) NewDEK() ([]byte, []byte, string, error) {
+	dek := make([]byte, KeySize)
+	rand.Read(dek)
+
+	wrapped, err := seal(w.current.aead, dek, []byte(w.current.ID))
+	if err != nil {
+		return nil, nil, "", err
+	}
+	return dek, wrapped, w.current.ID, nil
+}
+
+// UnwrapDEK opens data key wrapped by KEK with the id
+func (w *Wrapper) UnwrapDEK(kekID string, wrapped []byte) ([]byte, error) {
+	kek, ok := w.keks[kekID]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownKEK, kekID)
+	}
+
+	return open(kek.aead, wrapped, []byte(kekID))
+}
+
+// Rewrap wraps data key with the current KEK, data encrypted by it stays as is
+func (w *Wrapper) Rewrap(kekID string, wrapped []byte) ([]byte, string, error) {
+	dek, err := w.UnwrapDEK(kekID, wrapped)
+	if err != nil {
+		return nil, "", err
+	}
+
+	rewrapped, err := seal(w.current.aead, dek, []byte(w.current.ID))
+	if err != nil {
+		return nil, "", err
+	}
+	return rewrapped, w.current.ID, nil
+}
+
+// Seal encrypts data with data key, aad should tell what the data is, so it can't be swapped with another one
+func Seal(dek, plaintext, aad []byte) ([]byte, error) {
+	aead, err := newAEAD(dek)
+	if err != nil {
+		return nil, err
+	}
+	return seal(aead, plaintext, aad)
+}
+
+// Open decrypts data sealed with Seal
+func Open(dek, sealed, aad []byte) ([]byte, error) {
+	aead, err := newAEAD(dek)
+	if err != nil {
+		return nil, err
+	}
+	return open(aead, sealed, aad)
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("can't create cipher: %w", err)
+	}
+
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("can't create gcm: %w", err)
+	}
+	return aead, nil
+}
+
+// seal returns nonce followed by ciphertext
+func seal(aead cipher.AEAD, plaintext, aad []byte) ([]byte, error) {
+	out := make([]byte, aead.NonceSize(), aead.NonceSize()+len(plaintext)+aead.Overhead())
+	rand.Read(out)
+	return aead.Seal(out, out, plaintext, aad), nil
+}
+
+func open(aead cipher.AEAD, sealed, aad []byte) ([]byte, error) {
+	if len(sealed) < aead.NonceSize()+aead.Overhead() {
+		return nil, fmt.Errorf("%w: sealed data is too short", ErrDecryption)
+	}
+
+	plaintext, err := aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], aad)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrDecryption, err)
+	}
+	return plaintext, nil
+}
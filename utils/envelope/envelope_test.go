@@ -0,0 +1,90 @@
+package envelope_test
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"testing"
+
+	"github.com/rinnothing/simple-jwt/utils/envelope"
+	"github.com/stretchr/testify/require"
+)
+
+func newKEK(t *testing.T) *envelope.KEK {
+	key := make([]byte, envelope.KeySize)
+	rand.Read(key)
+
+	kek, err := envelope.NewKEK(key)
+	require.NoError(t, err)
+	return kek
+}
+
+func TestEnvelope(t *testing.T) {
+	wrapper, err := envelope.NewWrapper(newKEK(t))
+	require.NoError(t, err)
+
+	dek, wrapped, kekID, err := wrapper.NewDEK()
+	require.NoError(t, err)
+	require.Equal(t, wrapper.CurrentID(), kekID)
+
+	sealed, err := envelope.Seal(dek, []byte("secret"), []byte("access_key"))
+	require.NoError(t, err)
+
+	unwrapped, err := wrapper.UnwrapDEK(kekID, wrapped)
+	require.NoError(t, err)
+	opened, err := envelope.Open(unwrapped, sealed, []byte("access_key"))
+	require.NoError(t, err)
+	require.Equal(t, []byte("secret"), opened)
+
+	// data sealed for another purpose isn't accepted
+	_, err = envelope.Open(unwrapped, sealed, []byte("refresh_key"))
+	require.ErrorIs(t, err, envelope.ErrDecryption)
+
+	sealed[len(sealed)-1] ^= 1
+	_, err = envelope.Open(unwrapped, sealed, []byte("access_key"))
+	require.ErrorIs(t, err, envelope.ErrDecryption)
+}
+
+func TestRewrap(t *testing.T) {
+	oldKEK, newKEK := newKEK(t), newKEK(t)
+	oldWrapper, err := envelope.NewWrapper(oldKEK)
+	require.NoError(t, err)
+	dek, wrapped, kekID, err := oldWrapper.NewDEK()
+	require.NoError(t, err)
+
+	// new wrapper doesn't know the old kek until it's given as previous one
+	wrapper, err := envelope.NewWrapper(newKEK)
+	require.NoError(t, err)
+	_, err = wrapper.UnwrapDEK(kekID, wrapped)
+	require.ErrorIs(t, err, envelope.ErrUnknownKEK)
+
+	wrapper, err = envelope.NewWrapper(newKEK, oldKEK)
+	require.NoError(t, err)
+	rewrapped, newID, err := wrapper.Rewrap(kekID, wrapped)
+	require.NoError(t, err)
+	require.Equal(t, newKEK.ID, newID)
+
+	unwrapped, err := wrapper.UnwrapDEK(newID, rewrapped)
+	require.NoError(t, err)
+	require.Equal(t, dek, unwrapped)
+
+	// wrapped key is bound to kek id
+	_, err = wrapper.UnwrapDEK(kekID, rewrapped)
+	require.ErrorIs(t, err, envelope.ErrDecryption)
+}
+
+func TestParseKEKs(t *testing.T) {
+	first, second := make([]byte, envelope.KeySize), make([]byte, envelope.KeySize)
+	rand.Read(first)
+	rand.Read(second)
+
+	keks, err := envelope.ParseKEKs(base64.StdEncoding.EncodeToString(first) + ",\n" + base64.StdEncoding.EncodeToString(second) + "\n")
+	require.NoError(t, err)
+	require.Len(t, keks, 2)
+	require.NotEqual(t, keks[0].ID, keks[1].ID)
+
+	_, err = envelope.ParseKEKs(base64.StdEncoding.EncodeToString(first[:16]))
+	require.Error(t, err)
+
+	_, err = envelope.NewWrapper()
+	require.ErrorIs(t, err, envelope.ErrNoKEK)
+}
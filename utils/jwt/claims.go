@@ -0,0 +1,106 @@
+package jwt
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+// payloadClaims are json names of Payload fields, extra claims can't use them
+var payloadClaims = sync.OnceValue(func() map[string]struct{} {
+	claims := make(map[string]struct{})
+
+	payloadType := reflect.TypeFor[Payload]()
+	for i := range payloadType.NumField() {
+		name, _, _ := strings.Cut(payloadType.Field(i).Tag.Get("json"), ",")
+		if name != "" && name != "-" {
+			claims[name] = struct{}{}
+		}
+	}
+	return claims
+})
+
+// payloadFields is Payload without methods, so json doesn't call them recursively
+type payloadFields Payload
+
+func (p Payload) MarshalJSON() ([]byte, error) {
+	data, err := json.Marshal(payloadFields(p))
+	if err != nil || len(p.Extra) == 0 {
+		return data, err
+	}
+
+	var merged map[string]any
+	err = json.Unmarshal(data, &merged)
+	if err != nil {
+		return nil, err
+	}
+
+	for name, value := range p.Extra {
+		if _, reserved := payloadClaims()[name]; reserved {
+			continue
+		}
+		merged[name] = value
+	}
+
+	return json.Marshal(merged)
+}
+
+func (p *Payload) UnmarshalJSON(data []byte) error {
+	err := json.Unmarshal(data, (*payloadFields)(p))
+	if err != nil {
+		return err
+	}
+
+	var all map[string]any
+	err = json.Unmarshal(data, &all)
+	if err != nil {
+		return err
+	}
+
+	p.Extra = nil
+	for name, value := range all {
+		if _, reserved := payloadClaims()[name]; reserved {
+			continue
+		}
+		if p.Extra == nil {
+			p.Extra = make(map[string]any)
+		}
+		p.Extra[name] = value
+	}
+
+	return nil
+}
+
+// GetClaims decodes payload into application defined type, don't embed Payload in it,
+// as its UnmarshalJSON would hide the other fields. Like GetPayload it doesn't check the token, do it first
+func GetClaims[T any](a AccessToken) (T, error) {
+	decoded, err := a.PayloadJSON()
+	if err != nil {
+		var claims T
+		return claims, err
+	}
+	return decodeClaims[T](decoded)
+}
+
+// GetToolClaims is GetClaims which also understands tokens encrypted by the tool
+func GetToolClaims[T any](t *Tool, a AccessToken) (T, error) {
+	decoded, err := t.PayloadJSON(a)
+	if err != nil {
+		var claims T
+		return claims, err
+	}
+	return decodeClaims[T](decoded)
+}
+
+func decodeClaims[T any](decoded []byte) (T, error) {
+	var claims T
+
+	err := json.Unmarshal(decoded, &claims)
+	if err != nil {
+		return claims, fmt.Errorf("%w: failed to unmarshal claims json: %w", ErrMalformed, err)
+	}
+
+	return claims, nil
+}
@@ -0,0 +1,51 @@
+package jwt_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/rinnothing/simple-jwt/utils/jwt"
+	"github.com/stretchr/testify/require"
+)
+
+type appClaims struct {
+	UUID        string   `json:"uuid"`
+	Tenant      string   `json:"tenant"`
+	Roles       []string `json:"roles"`
+	DisplayName string   `json:"name"`
+}
+
+func TestCustomClaims(t *testing.T) {
+	tool := newTool(t)
+	tool.Now = func() time.Time { return issueTime }
+
+	access, _, err := tool.IssueTokens(t.Context(), "12345", map[string]any{
+		"tenant": "acme",
+		"roles":  []string{"admin", "user"},
+		"name":   "Jane Doe",
+		// registered claims can't be overridden
+		"exp":  1,
+		"uuid": "67890",
+	})
+	require.NoError(t, err)
+	require.NoError(t, tool.CheckAccess(access))
+
+	payload, err := access.GetPayload()
+	require.NoError(t, err)
+	require.Equal(t, "12345", payload.UUID)
+	require.Equal(t, "acme", payload.Extra["tenant"])
+	require.Equal(t, []any{"admin", "user"}, payload.Extra["roles"])
+	require.NotContains(t, payload.Extra, "exp")
+
+	claims, err := jwt.GetClaims[appClaims](access)
+	require.NoError(t, err)
+	require.Equal(t, appClaims{UUID: "12345", Tenant: "acme", Roles: []string{"admin", "user"}, DisplayName: "Jane Doe"}, claims)
+
+	// unknown claims survive decoding and encoding again
+	signer := accessSigner(t)
+	again, err := jwt.PreAccessToken{Payload: *payload}.Encode(t.Context(), signer)
+	require.NoError(t, err)
+	claims, err = jwt.GetClaims[appClaims](again)
+	require.NoError(t, err)
+	require.Equal(t, "acme", claims.Tenant)
+}
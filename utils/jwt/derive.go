@@ -0,0 +1,53 @@
+package jwt
+
+import (
+	"crypto/ed25519"
+	"crypto/sha512"
+	"crypto/x509"
+	"fmt"
+	"io"
+
+	"golang.org/x/crypto/hkdf"
+)
+
+// purposes of keys derived from master secret, changing them changes every derived key
+const (
+	PurposeAccess      = "simple-jwt access key"
+	PurposeRefresh     = "simple-jwt refresh key"
+	PurposeRefreshHash = "simple-jwt refresh hash key"
+)
+
+// DeriveKey derives key for the purpose from master secret with HKDF-SHA512
+func DeriveKey(masterSecret, purpose string, size int) (string, error) {
+	if masterSecret == "" {
+		return "", fmt.Errorf("master secret is empty")
+	}
+
+	key := make([]byte, size)
+	_, err := io.ReadFull(hkdf.New(sha512.New, []byte(masterSecret), nil, []byte(purpose)), key)
+	if err != nil {
+		return "", fmt.Errorf("can't derive %s: %w", purpose, err)
+	}
+	return string(key), nil
+}
+
+// DeriveSigningKey derives access key in the form NewSigner accepts, only HS512 and EdDSA keys can be derived
+func DeriveSigningKey(alg, masterSecret string) (string, error) {
+	switch alg {
+	case "", HS512:
+		return DeriveKey(masterSecret, PurposeAccess, 64)
+	case EdDSA:
+		seed, err := DeriveKey(masterSecret, PurposeAccess, ed25519.SeedSize)
+		if err != nil {
+			return "", err
+		}
+
+		der, err := x509.MarshalPKCS8PrivateKey(ed25519.NewKeyFromSeed([]byte(seed)))
+		if err != nil {
+			return "", fmt.Errorf("can't marshal key: %w", err)
+		}
+		return string(der), nil
+	default:
+		return "", fmt.Errorf("%w: %s keys can't be derived", ErrUnknownAlgorithm, alg)
+	}
+}
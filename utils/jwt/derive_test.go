@@ -0,0 +1,47 @@
+package jwt_test
+
+import (
+	"testing"
+
+	"github.com/rinnothing/simple-jwt/utils/jwt"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDeriveKey(t *testing.T) {
+	access, err := jwt.DeriveKey("master", jwt.PurposeAccess, 64)
+	require.NoError(t, err)
+	require.Len(t, access, 64)
+
+	again, err := jwt.DeriveKey("master", jwt.PurposeAccess, 64)
+	require.NoError(t, err)
+	require.Equal(t, access, again)
+
+	refresh, err := jwt.DeriveKey("master", jwt.PurposeRefresh, 64)
+	require.NoError(t, err)
+	require.NotEqual(t, access, refresh)
+
+	other, err := jwt.DeriveKey("another master", jwt.PurposeAccess, 64)
+	require.NoError(t, err)
+	require.NotEqual(t, access, other)
+
+	_, err = jwt.DeriveKey("", jwt.PurposeAccess, 64)
+	require.Error(t, err)
+}
+
+func TestDeriveSigningKey(t *testing.T) {
+	for _, alg := range []string{jwt.HS512, jwt.EdDSA} {
+		key, err := jwt.DeriveSigningKey(alg, "master")
+		require.NoError(t, err)
+
+		again, err := jwt.DeriveSigningKey(alg, "master")
+		require.NoError(t, err)
+		require.Equal(t, key, again)
+
+		signer, err := jwt.NewSigner(alg, key)
+		require.NoError(t, err)
+		require.Equal(t, alg, signer.Algorithm())
+	}
+
+	_, err := jwt.DeriveSigningKey(jwt.RS256, "master")
+	require.ErrorIs(t, err, jwt.ErrUnknownAlgorithm)
+}
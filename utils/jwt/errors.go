@@ -0,0 +1,16 @@
+package jwt
+
+import "errors"
+
+// errors returned by token validation, check them with errors.Is
+var (
+	ErrMalformed    = errors.New("malformed token")
+	ErrSignature    = errors.New("invalid signature")
+	ErrUnknownKey   = errors.New("token is signed with unknown key")
+	ErrExpired      = errors.New("token is expired")
+	ErrNotYetValid  = errors.New("token is not valid yet")
+	ErrIssuer       = errors.New("token has wrong issuer")
+	ErrAudience     = errors.New("token has wrong audience")
+	ErrPairMismatch = errors.New("access and refresh tokens don't match")
+	ErrDecryption   = errors.New("can't decrypt token")
+)
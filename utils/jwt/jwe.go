@@ -0,0 +1,269 @@
+package jwt
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"hash"
+	"strings"
+)
+
+// key management algorithms, content is always encrypted with A256GCM
+const (
+	Dir        = "dir"
+	RSAOAEP    = "RSA-OAEP"
+	RSAOAEP256 = "RSA-OAEP-256"
+
+	A256GCM = "A256GCM"
+)
+
+const (
+	cekSize   = 32
+	gcmIVSize = 12
+)
+
+type JWEHeader struct {
+	Algorithm   string `json:"alg"`
+	Encryption  string `json:"enc"`
+	Type        string `json:"typ,omitempty"`
+	ContentType string `json:"cty,omitempty"`
+	KeyID       string `json:"kid,omitempty"`
+}
+
+// KeyEncrypter gives content encryption key for JWE, either the shared key itself or a random one wrapped with RSA
+type KeyEncrypter interface {
+	Algorithm() string
+	KeyID() string
+	WrapKey() (cek []byte, encryptedKey []byte, err error)
+	UnwrapKey(encryptedKey []byte) ([]byte, error)
+}
+
+// NewKeyEncrypter creates key encrypter, for dir key is 32 raw bytes, for RSA-OAEP it's PKCS #8 private key in DER or PEM
+func NewKeyEncrypter(alg string, key string) (KeyEncrypter, error) {
+	switch alg {
+	case Dir:
+		if len(key) != cekSize {
+			return nil, fmt.Errorf("%w: dir key must be %d bytes, has %d", ErrWrongKeyType, cekSize, len(key))
+		}
+		return &dirKey{key: []byte(key), kid: hmacKeyID([]byte(key))}, nil
+	case RSAOAEP, RSAOAEP256:
+		der := []byte(key)
+		if block, _ := pem.Decode(der); block != nil {
+			der = block.Bytes
+		}
+
+		private, err := x509.ParsePKCS8PrivateKey(der)
+		if err != nil {
+			return nil, fmt.Errorf("can't parse private key: %w", err)
+		}
+		rsaKey, ok := private.(*rsa.PrivateKey)
+		if !ok {
+			return nil, fmt.Errorf("%w: %s wants rsa key", ErrWrongKeyType, alg)
+		}
+		if rsaKey.N.BitLen() < minRSABits {
+			return nil, fmt.Errorf("%w: rsa key must be at least %d bits", ErrWrongKeyType, minRSABits)
+		}
+		return &rsaOAEPKey{alg: alg, key: rsaKey, kid: rsaJWK(alg, &rsaKey.PublicKey).KeyID}, nil
+	}
+
+	return nil, fmt.Errorf("%w: %s", ErrUnknownAlgorithm, alg)
+}
+
+// EncryptJWE makes compact JWE, cty is "JWT" for nested tokens and empty if plaintext is the payload itself
+func EncryptJWE(encrypter KeyEncrypter, plaintext []byte, contentType string) (string, error) {
+	header := JWEHeader{
+		Algorithm:   encrypter.Algorithm(),
+		Encryption:  A256GCM,
+		Type:        "JWT",
+		ContentType: contentType,
+		KeyID:       encrypter.KeyID(),
+	}
+	headerJSON, err := json.Marshal(header)
+	if err != nil {
+		return "", fmt.Errorf("can't marshal header: %w", err)
+	}
+	encodedHeader := base64.RawURLEncoding.EncodeToString(headerJSON)
+
+	cek, encryptedKey, err := encrypter.WrapKey()
+	if err != nil {
+		return "", fmt.Errorf("can't wrap key: %w", err)
+	}
+
+	gcm, err := newGCM(cek)
+	if err != nil {
+		return "", err
+	}
+
+	iv := make([]byte, gcmIVSize)
+	rand.Read(iv)
+
+	// header is authenticated as additional data
+	sealed := gcm.Seal(nil, iv, plaintext, []byte(encodedHeader))
+	ciphertext, tag := sealed[:len(sealed)-gcm.Overhead()], sealed[len(sealed)-gcm.Overhead():]
+
+	return strings.Join([]string{
+		encodedHeader,
+		base64.RawURLEncoding.EncodeToString(encryptedKey),
+		base64.RawURLEncoding.EncodeToString(iv),
+		base64.RawURLEncoding.EncodeToString(ciphertext),
+		base64.RawURLEncoding.EncodeToString(tag),
+	}, "."), nil
+}
+
+// DecryptJWE opens compact JWE, algorithms in header must be the encrypter's ones
+func DecryptJWE(encrypter KeyEncrypter, token string) (*JWEHeader, []byte, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 5 {
+		return nil, nil, fmt.Errorf("%w: want 5 parts, has %d", ErrMalformed, len(parts))
+	}
+
+	headerJSON, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: header isn't in base64url: %w", ErrMalformed, err)
+	}
+	var header JWEHeader
+	err = json.Unmarshal(headerJSON, &header)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: failed to unmarshal header json: %w", ErrMalformed, err)
+	}
+	if header.Algorithm != encrypter.Algorithm() || header.Encryption != A256GCM {
+		return nil, nil, fmt.Errorf("%w: algorithms %q and %q aren't allowed", ErrDecryption, header.Algorithm, header.Encryption)
+	}
+	if header.KeyID != "" && header.KeyID != encrypter.KeyID() {
+		return nil, nil, fmt.Errorf("%w: kid %q", ErrUnknownKey, header.KeyID)
+	}
+
+	decoded := make([][]byte, 4)
+	for i, part := range parts[1:] {
+		decoded[i], err = base64.RawURLEncoding.DecodeString(part)
+		if err != nil {
+			return nil, nil, fmt.Errorf("%w: part %d isn't in base64url: %w", ErrMalformed, i+1, err)
+		}
+	}
+	encryptedKey, iv, ciphertext, tag := decoded[0], decoded[1], decoded[2], decoded[3]
+	if len(iv) != gcmIVSize {
+		return nil, nil, fmt.Errorf("%w: wrong iv size", ErrMalformed)
+	}
+
+	cek, err := encrypter.UnwrapKey(encryptedKey)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: %w", ErrDecryption, err)
+	}
+
+	gcm, err := newGCM(cek)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: %w", ErrDecryption, err)
+	}
+
+	plaintext, err := gcm.Open(nil, iv, append(ciphertext, tag...), []byte(parts[0]))
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: %w", ErrDecryption, err)
+	}
+
+	return &header, plaintext, nil
+}
+
+func newGCM(cek []byte) (cipher.AEAD, error) {
+	if len(cek) != cekSize {
+		return nil, fmt.Errorf("content key must be %d bytes, has %d", cekSize, len(cek))
+	}
+
+	block, err := aes.NewCipher(cek)
+	if err != nil {
+		return nil, fmt.Errorf("can't create cipher: %w", err)
+	}
+	return cipher.NewGCM(block)
+}
+
+func GenerateEncryptionKey(alg string) (string, error) {
+	switch alg {
+	case Dir:
+		key := make([]byte, cekSize)
+		rand.Read(key)
+		return string(key), nil
+	case RSAOAEP, RSAOAEP256:
+		private, err := rsa.GenerateKey(rand.Reader, minRSABits)
+		if err != nil {
+			return "", fmt.Errorf("can't generate key: %w", err)
+		}
+		der, err := x509.MarshalPKCS8PrivateKey(private)
+		if err != nil {
+			return "", fmt.Errorf("can't marshal key: %w", err)
+		}
+		return string(der), nil
+	}
+
+	return "", fmt.Errorf("%w: %s", ErrUnknownAlgorithm, alg)
+}
+
+type dirKey struct {
+	key []byte
+	kid string
+}
+
+func (d *dirKey) Algorithm() string {
+	return Dir
+}
+
+func (d *dirKey) KeyID() string {
+	return d.kid
+}
+
+func (d *dirKey) WrapKey() ([]byte, []byte, error) {
+	return d.key, nil, nil
+}
+
+func (d *dirKey) UnwrapKey(encryptedKey []byte) ([]byte, error) {
+	if len(encryptedKey) != 0 {
+		return nil, fmt.Errorf("dir doesn't use encrypted key")
+	}
+	return d.key, nil
+}
+
+type rsaOAEPKey struct {
+	alg string
+	key *rsa.PrivateKey
+	kid string
+}
+
+func (r *rsaOAEPKey) Algorithm() string {
+	return r.alg
+}
+
+func (r *rsaOAEPKey) KeyID() string {
+	return r.kid
+}
+
+func (r *rsaOAEPKey) hash() hash.Hash {
+	if r.alg == RSAOAEP {
+		return sha1.New()
+	}
+	return sha256.New()
+}
+
+func (r *rsaOAEPKey) WrapKey() ([]byte, []byte, error) {
+	cek := make([]byte, cekSize)
+	rand.Read(cek)
+
+	encryptedKey, err := rsa.EncryptOAEP(r.hash(), rand.Reader, &r.key.PublicKey, cek, nil)
+	if err != nil {
+		return nil, nil, fmt.Errorf("can't encrypt key: %w", err)
+	}
+	return cek, encryptedKey, nil
+}
+
+func (r *rsaOAEPKey) UnwrapKey(encryptedKey []byte) ([]byte, error) {
+	cek, err := rsa.DecryptOAEP(r.hash(), nil, r.key, encryptedKey, nil)
+	if err != nil {
+		return nil, fmt.Errorf("can't decrypt key: %w", err)
+	}
+	return cek, nil
+}
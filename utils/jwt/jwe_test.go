@@ -0,0 +1,100 @@
+package jwt_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/rinnothing/simple-jwt/utils/jwt"
+	"github.com/stretchr/testify/require"
+)
+
+func newEncrypter(t *testing.T, alg string) jwt.KeyEncrypter {
+	key, err := jwt.GenerateEncryptionKey(alg)
+	require.NoError(t, err)
+	encrypter, err := jwt.NewKeyEncrypter(alg, key)
+	require.NoError(t, err)
+	return encrypter
+}
+
+func TestEncryptedTokens(t *testing.T) {
+	cases := []struct {
+		alg         string
+		encryptOnly bool
+	}{
+		{jwt.Dir, false},
+		{jwt.Dir, true},
+		{jwt.RSAOAEP, false},
+		{jwt.RSAOAEP256, false},
+	}
+
+	for _, c := range cases {
+		name := c.alg
+		if c.encryptOnly {
+			name += "/encrypt-only"
+		}
+		t.Run(name, func(t *testing.T) {
+			tool := newTool(t)
+			tool.Encrypter = newEncrypter(t, c.alg)
+			tool.EncryptOnly = c.encryptOnly
+
+			access, refresh, err := tool.IssueTokens(t.Context(), "12345", map[string]any{"tenant": "acme"})
+			require.NoError(t, err)
+			require.Len(t, strings.Split(string(access), "."), 5)
+
+			// nobody without the key can read it
+			_, err = access.GetPayload()
+			require.ErrorIs(t, err, jwt.ErrMalformed)
+
+			require.NoError(t, tool.CheckAccess(access))
+			require.NoError(t, tool.CheckRefresh(access, refresh))
+
+			payload, err := tool.GetPayload(access)
+			require.NoError(t, err)
+			require.Equal(t, "12345", payload.UUID)
+			require.Equal(t, "acme", payload.Extra["tenant"])
+
+			claims, err := jwt.GetToolClaims[appClaims](tool, access)
+			require.NoError(t, err)
+			require.Equal(t, "acme", claims.Tenant)
+
+			parts := strings.Split(string(access), ".")
+			parts[3] = brakeBase64URL(parts[3])
+			require.ErrorIs(t, tool.CheckAccess(jwt.AccessToken(strings.Join(parts, "."))), jwt.ErrDecryption)
+
+			other := newTool(t)
+			other.Encrypter = newEncrypter(t, c.alg)
+			require.Error(t, other.CheckAccess(access))
+		})
+	}
+}
+
+func TestUnsignedOnlyWithDir(t *testing.T) {
+	tool := newTool(t)
+	tool.Encrypter = newEncrypter(t, jwt.RSAOAEP256)
+	tool.EncryptOnly = true
+
+	_, _, err := tool.IssueTokens(t.Context(), "12345", nil)
+	require.Error(t, err)
+
+	// forged token encrypted with the public key, but not signed
+	payload := []byte(`{"sub":"12345","exp":9999999999,"uuid":"12345"}`)
+	forged, err := jwt.EncryptJWE(tool.Encrypter, payload, "")
+	require.NoError(t, err)
+	require.ErrorIs(t, tool.CheckAccess(jwt.AccessToken(forged)), jwt.ErrSignature)
+}
+
+func TestEncryptionSwitch(t *testing.T) {
+	tool := newTool(t)
+
+	plain, _, err := tool.IssueTokens(t.Context(), "12345", nil)
+	require.NoError(t, err)
+
+	encrypted := newTool(t)
+	encrypted.Encrypter = newEncrypter(t, jwt.Dir)
+	access, _, err := encrypted.IssueTokens(t.Context(), "12345", nil)
+	require.NoError(t, err)
+
+	// tokens issued before encryption was enabled are still signed by us
+	require.NoError(t, encrypted.CheckAccess(plain))
+	require.ErrorIs(t, tool.CheckAccess(access), jwt.ErrMalformed)
+}
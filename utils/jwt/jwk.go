@@ -0,0 +1,182 @@
+package jwt
+
+import (
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+)
+
+// JWK is a public key in RFC 7517 format, only fields needed by our algorithms are present
+type JWK struct {
+	KeyType   string `json:"kty"`
+	Use       string `json:"use,omitempty"`
+	Algorithm string `json:"alg,omitempty"`
+	KeyID     string `json:"kid,omitempty"`
+
+	// rsa
+	N string `json:"n,omitempty"`
+	E string `json:"e,omitempty"`
+
+	// ec and okp
+	Curve string `json:"crv,omitempty"`
+	X     string `json:"x,omitempty"`
+	Y     string `json:"y,omitempty"`
+}
+
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// PublicVerifier is a Verifier which key can be published, hmac keys never implement it
+type PublicVerifier interface {
+	Verifier
+	JWK() JWK
+}
+
+// Thumbprint computes RFC 7638 thumbprint of the key, it's used as kid
+func (j JWK) Thumbprint() string {
+	var members any
+	switch j.KeyType {
+	case "RSA":
+		members = struct {
+			E   string `json:"e"`
+			Kty string `json:"kty"`
+			N   string `json:"n"`
+		}{j.E, j.KeyType, j.N}
+	case "EC":
+		members = struct {
+			Crv string `json:"crv"`
+			Kty string `json:"kty"`
+			X   string `json:"x"`
+			Y   string `json:"y"`
+		}{j.Curve, j.KeyType, j.X, j.Y}
+	case "OKP":
+		members = struct {
+			Crv string `json:"crv"`
+			Kty string `json:"kty"`
+			X   string `json:"x"`
+		}{j.Curve, j.KeyType, j.X}
+	default:
+		return ""
+	}
+
+	// struct fields are already in lexicographic order, as the RFC wants
+	data, err := json.Marshal(members)
+	if err != nil {
+		return ""
+	}
+
+	sum := sha256.Sum256(data)
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// hmac key id is the thumbprint of "oct" JWK, it's a hash of the secret so it leaks nothing useful
+func hmacKeyID(key []byte) string {
+	data, err := json.Marshal(struct {
+		K   string `json:"k"`
+		Kty string `json:"kty"`
+	}{base64.RawURLEncoding.EncodeToString(key), "oct"})
+	if err != nil {
+		return ""
+	}
+
+	sum := sha256.Sum256(data)
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+func rsaJWK(alg string, key *rsa.PublicKey) JWK {
+	jwk := JWK{
+		KeyType:   "RSA",
+		Use:       "sig",
+		Algorithm: alg,
+		N:         base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+		E:         base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+	}
+	jwk.KeyID = jwk.Thumbprint()
+	return jwk
+}
+
+func ecdsaJWK(key *ecdsa.PublicKey) JWK {
+	size := (key.Curve.Params().BitSize + 7) / 8
+	jwk := JWK{
+		KeyType:   "EC",
+		Use:       "sig",
+		Algorithm: ES256,
+		Curve:     key.Curve.Params().Name,
+		X:         base64.RawURLEncoding.EncodeToString(key.X.FillBytes(make([]byte, size))),
+		Y:         base64.RawURLEncoding.EncodeToString(key.Y.FillBytes(make([]byte, size))),
+	}
+	jwk.KeyID = jwk.Thumbprint()
+	return jwk
+}
+
+func ed25519JWK(key ed25519.PublicKey) JWK {
+	jwk := JWK{
+		KeyType:   "OKP",
+		Use:       "sig",
+		Algorithm: EdDSA,
+		Curve:     "Ed25519",
+		X:         base64.RawURLEncoding.EncodeToString(key),
+	}
+	jwk.KeyID = jwk.Thumbprint()
+	return jwk
+}
+
+// Verifier restores public key from JWK, so tokens can be checked by anyone who fetched JWKS
+func (j JWK) Verifier() (Verifier, error) {
+	decode := base64.RawURLEncoding.DecodeString
+
+	switch j.KeyType {
+	case "RSA":
+		n, err := decode(j.N)
+		if err != nil {
+			return nil, fmt.Errorf("can't decode n: %w", err)
+		}
+		e, err := decode(j.E)
+		if err != nil {
+			return nil, fmt.Errorf("can't decode e: %w", err)
+		}
+		public := &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+		return newPublicVerifier(j.Algorithm, public)
+	case "EC":
+		if j.Curve != elliptic.P256().Params().Name {
+			return nil, fmt.Errorf("%w: unsupported curve %s", ErrWrongKeyType, j.Curve)
+		}
+		x, err := decode(j.X)
+		if err != nil {
+			return nil, fmt.Errorf("can't decode x: %w", err)
+		}
+		y, err := decode(j.Y)
+		if err != nil {
+			return nil, fmt.Errorf("can't decode y: %w", err)
+		}
+		// ecdh checks that the point is really on the curve
+		point := append([]byte{4}, append(x, y...)...)
+		if _, err := ecdh.P256().NewPublicKey(point); err != nil {
+			return nil, fmt.Errorf("can't parse ec point: %w", err)
+		}
+		public := &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		return newPublicVerifier(j.Algorithm, public)
+	case "OKP":
+		if j.Curve != "Ed25519" {
+			return nil, fmt.Errorf("%w: unsupported curve %s", ErrWrongKeyType, j.Curve)
+		}
+		x, err := decode(j.X)
+		if err != nil {
+			return nil, fmt.Errorf("can't decode x: %w", err)
+		}
+		if len(x) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("%w: wrong ed25519 key size", ErrWrongKeyType)
+		}
+		return newPublicVerifier(j.Algorithm, ed25519.PublicKey(x))
+	}
+
+	return nil, fmt.Errorf("%w: unsupported key type %s", ErrWrongKeyType, j.KeyType)
+}
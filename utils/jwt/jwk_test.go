@@ -0,0 +1,49 @@
+package jwt_test
+
+import (
+	"testing"
+
+	"github.com/rinnothing/simple-jwt/utils/jwt"
+	"github.com/stretchr/testify/require"
+)
+
+func TestThumbprint(t *testing.T) {
+	// example from RFC 7638 section 3.1
+	jwk := jwt.JWK{
+		KeyType: "RSA",
+		N: "0vx7agoebGcQSuuPiLJXZptN9nndrQmbXEps2aiAFbWhM78LhWx4cbbfAAtVT86zwu1RK7aPFFxuhDR1L6tSoc_BJECPebWKRXjBZCiFV4n3oknjhMs" +
+			"tn64tZ_2W-5JsGY4Hc5n9yBXArwl93lqt7_RN5w6Cf0h4QyQ5v-65YGjQR0_FDW2QvzqY368QQMicAtaSqzs8KJZgnYb9c7d0zgdAZHzu6qMQvRL5hajrn1n91" +
+			"CbOpbISD08qNLyrdkt-bFTWhAI4vMQFh6WeZu0fM4lFd2NcRwr3XPksINHaQ-G_xBniIqbw0Ls1jF44-csFCur-kEgU8awapJzKnqDKgw",
+		E: "AQAB",
+	}
+	require.Equal(t, "NzbLsXh8uDCcd-6MNwXF4W_7noWXFZAfHkxZsRGC9Xs", jwk.Thumbprint())
+}
+
+func TestJWKS(t *testing.T) {
+	tool := newTool(t)
+	require.Empty(t, tool.JWKS().Keys)
+
+	for _, alg := range []string{jwt.RS256, jwt.PS256, jwt.ES256, jwt.EdDSA} {
+		t.Run(alg, func(t *testing.T) {
+			key, err := jwt.GenerateSigningKey(alg)
+			require.NoError(t, err)
+			signer, err := jwt.NewSigner(alg, key)
+			require.NoError(t, err)
+
+			tool := jwt.NewJWTTool(jwt.NewKeyring(signer), string(refreshKey), string(refreshHashKey))
+			access, _, err := tool.IssueTokens(t.Context(), "12345", nil)
+			require.NoError(t, err)
+
+			jwks := tool.JWKS()
+			require.Len(t, jwks.Keys, 1)
+
+			header, err := access.GetHeader()
+			require.NoError(t, err)
+			require.Equal(t, jwks.Keys[0].KeyID, header.KeyID)
+
+			verifier, err := jwks.Keys[0].Verifier()
+			require.NoError(t, err)
+			require.NoError(t, access.ValidateSignature(verifier))
+		})
+	}
+}
@@ -0,0 +1,71 @@
+package jwt
+
+import (
+	"slices"
+	"strings"
+	"sync"
+)
+
+// Keyring keeps the key new tokens are signed with together with older keys which are still allowed to verify,
+// it's safe to replace keys while tokens are issued and checked
+type Keyring struct {
+	mu sync.RWMutex
+
+	active    Signer
+	verifiers map[string]Verifier
+}
+
+func NewKeyring(active Signer, verifyOnly ...Verifier) *Keyring {
+	k := &Keyring{}
+	k.Replace(active, verifyOnly...)
+	return k
+}
+
+// Replace atomically swaps all keys, active key is always allowed to verify
+func (k *Keyring) Replace(active Signer, verifyOnly ...Verifier) {
+	verifiers := make(map[string]Verifier, len(verifyOnly)+1)
+	for _, v := range verifyOnly {
+		verifiers[v.KeyID()] = v
+	}
+	verifiers[active.KeyID()] = active.Verifier()
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	k.active = active
+	k.verifiers = verifiers
+}
+
+func (k *Keyring) Signer() Signer {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+
+	return k.active
+}
+
+// Verifier finds key by kid, tokens without kid are checked with the active key
+func (k *Keyring) Verifier(kid string) (Verifier, bool) {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+
+	if kid == "" {
+		return k.active.Verifier(), true
+	}
+	v, ok := k.verifiers[kid]
+	return v, ok
+}
+
+// Verifiers returns all keys ordered by kid
+func (k *Keyring) Verifiers() []Verifier {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+
+	verifiers := make([]Verifier, 0, len(k.verifiers))
+	for _, v := range k.verifiers {
+		verifiers = append(verifiers, v)
+	}
+	slices.SortFunc(verifiers, func(a, b Verifier) int {
+		return strings.Compare(a.KeyID(), b.KeyID())
+	})
+	return verifiers
+}
@@ -0,0 +1,49 @@
+package jwt_test
+
+import (
+	"testing"
+
+	"github.com/rinnothing/simple-jwt/utils/jwt"
+	"github.com/stretchr/testify/require"
+)
+
+func TestKeyringRotation(t *testing.T) {
+	newSigner := func() jwt.Signer {
+		key, err := jwt.GenerateSigningKey(jwt.ES256)
+		require.NoError(t, err)
+		signer, err := jwt.NewSigner(jwt.ES256, key)
+		require.NoError(t, err)
+		return signer
+	}
+
+	oldSigner, nextSigner := newSigner(), newSigner()
+
+	keys := jwt.NewKeyring(oldSigner)
+	tool := jwt.NewJWTTool(keys, string(refreshKey), string(refreshHashKey))
+
+	oldAccess, oldRefresh, err := tool.IssueTokens(t.Context(), "12345", nil)
+	require.NoError(t, err)
+
+	// next key is published before it's used
+	keys.Replace(oldSigner, nextSigner.Verifier())
+	require.Len(t, tool.JWKS().Keys, 2)
+
+	keys.Replace(nextSigner, oldSigner.Verifier())
+
+	newAccess, _, err := tool.IssueTokens(t.Context(), "12345", nil)
+	require.NoError(t, err)
+	header, err := newAccess.GetHeader()
+	require.NoError(t, err)
+	require.Equal(t, nextSigner.KeyID(), header.KeyID)
+
+	require.NoError(t, tool.CheckAccess(oldAccess))
+	require.NoError(t, tool.CheckRefresh(oldAccess, oldRefresh))
+	require.NoError(t, tool.CheckAccess(newAccess))
+
+	// old key retired
+	keys.Replace(nextSigner)
+	require.Len(t, tool.JWKS().Keys, 1)
+	require.ErrorIs(t, tool.CheckAccess(oldAccess), jwt.ErrUnknownKey)
+	require.ErrorIs(t, tool.CheckRefresh(oldAccess, oldRefresh), jwt.ErrUnknownKey)
+	require.NoError(t, tool.CheckAccess(newAccess))
+}
@@ -0,0 +1,289 @@
+package jwt
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha512"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/blake2b"
+	"golang.org/x/crypto/chacha20"
+)
+
+// PASETO v4 purposes, local tokens are encrypted with a key derived from HS512 secret,
+// public ones are signed with EdDSA key
+const (
+	PasetoLocal  = "v4.local"
+	PasetoPublic = "v4.public"
+)
+
+const (
+	pasetoNonceSize = 32
+	pasetoMACSize   = 32
+)
+
+// PASETO wants time claims as RFC 3339 strings
+var pasetoTimeClaims = []string{"exp", "nbf", "iat"}
+
+// key id goes to the footer, it's authenticated but not encrypted
+type pasetoFooter struct {
+	KeyID string `json:"kid"`
+}
+
+// pasetoLocalKeyer is implemented by keys which can give symmetric key for v4.local
+type pasetoLocalKeyer interface {
+	pasetoLocalKey() []byte
+}
+
+// v4.local key is derived from hmac secret, so the same key is never used by two algorithms
+func (h *hmacKey) pasetoLocalKey() []byte {
+	mac := hmac.New(sha512.New, h.key)
+	mac.Write([]byte("simple-jwt paseto v4.local key"))
+	return mac.Sum(nil)[:32]
+}
+
+// EncodePaseto makes PASETO token out of payload, header isn't used as the purpose fixes algorithms
+func (p PreAccessToken) EncodePaseto(ctx context.Context, purpose string, signer Signer) (AccessToken, error) {
+	message, err := pasetoPayload(p.Payload)
+	if err != nil {
+		return "", err
+	}
+
+	footer, err := json.Marshal(pasetoFooter{KeyID: signer.KeyID()})
+	if err != nil {
+		return "", fmt.Errorf("can't marshal footer: %w", err)
+	}
+
+	var body []byte
+	switch purpose {
+	case PasetoLocal:
+		keyer, ok := signer.(pasetoLocalKeyer)
+		if !ok {
+			return "", fmt.Errorf("%w: %s wants %s key", ErrWrongKeyType, purpose, HS512)
+		}
+		body = pasetoEncrypt(keyer.pasetoLocalKey(), message, footer)
+	case PasetoPublic:
+		if signer.Algorithm() != EdDSA {
+			return "", fmt.Errorf("%w: %s wants %s key", ErrWrongKeyType, purpose, EdDSA)
+		}
+		signature, err := signer.Sign(ctx, pae([]byte(PasetoPublic+"."), message, footer, nil))
+		if err != nil {
+			return "", fmt.Errorf("can't sign token: %w", err)
+		}
+		body = append(message, signature...)
+	default:
+		return "", fmt.Errorf("%w: %s", ErrUnknownAlgorithm, purpose)
+	}
+
+	return AccessToken(purpose + "." + base64.RawURLEncoding.EncodeToString(body) + "." +
+		base64.RawURLEncoding.EncodeToString(footer)), nil
+}
+
+func (a AccessToken) IsPaseto() bool {
+	return strings.HasPrefix(string(a), PasetoLocal+".") || strings.HasPrefix(string(a), PasetoPublic+".")
+}
+
+// PasetoKeyID reads kid from the footer, it isn't checked until the token is opened
+func (a AccessToken) PasetoKeyID() (string, error) {
+	_, _, footer, err := a.pasetoParts()
+	if err != nil {
+		return "", err
+	}
+
+	var parsed pasetoFooter
+	err = json.Unmarshal(footer, &parsed)
+	if err != nil {
+		return "", fmt.Errorf("%w: failed to unmarshal footer json: %w", ErrMalformed, err)
+	}
+	return parsed.KeyID, nil
+}
+
+// OpenPaseto checks the token with verifier and returns its payload json with time claims as unix seconds
+func (a AccessToken) OpenPaseto(verifier Verifier) ([]byte, error) {
+	purpose, body, footer, err := a.pasetoParts()
+	if err != nil {
+		return nil, err
+	}
+
+	var message []byte
+	switch purpose {
+	case PasetoLocal:
+		keyer, ok := verifier.(pasetoLocalKeyer)
+		if !ok {
+			return nil, fmt.Errorf("%w: %s isn't allowed with %s key", ErrSignature, purpose, verifier.Algorithm())
+		}
+		message, err = pasetoDecrypt(keyer.pasetoLocalKey(), body, footer)
+		if err != nil {
+			return nil, err
+		}
+	case PasetoPublic:
+		if verifier.Algorithm() != EdDSA {
+			return nil, fmt.Errorf("%w: %s isn't allowed with %s key", ErrSignature, purpose, verifier.Algorithm())
+		}
+		if len(body) < 64 {
+			return nil, fmt.Errorf("%w: token is too short", ErrMalformed)
+		}
+		signature := body[len(body)-64:]
+		message = body[:len(body)-64]
+		if !verifier.Verify(pae([]byte(PasetoPublic+"."), message, footer, nil), signature) {
+			return nil, ErrSignature
+		}
+	}
+
+	return fromPasetoPayload(message)
+}
+
+func (a AccessToken) pasetoParts() (string, []byte, []byte, error) {
+	parts := strings.Split(string(a), ".")
+	if len(parts) != 4 || !a.IsPaseto() {
+		return "", nil, nil, fmt.Errorf("%w: not a paseto v4 token with footer", ErrMalformed)
+	}
+
+	body, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return "", nil, nil, fmt.Errorf("%w: body isn't in base64url: %w", ErrMalformed, err)
+	}
+	footer, err := base64.RawURLEncoding.DecodeString(parts[3])
+	if err != nil {
+		return "", nil, nil, fmt.Errorf("%w: footer isn't in base64url: %w", ErrMalformed, err)
+	}
+
+	return parts[0] + "." + parts[1], body, footer, nil
+}
+
+// pasetoEncrypt is v4.local encryption, implicit assertion is always empty
+func pasetoEncrypt(key, message, footer []byte) []byte {
+	nonce := make([]byte, pasetoNonceSize)
+	rand.Read(nonce)
+
+	encKey, counterNonce, authKey := pasetoSplitKey(key, nonce)
+
+	cipher, err := chacha20.NewUnauthenticatedCipher(encKey, counterNonce)
+	if err != nil {
+		// sizes are fixed, so it can't happen
+		panic(err)
+	}
+	ciphertext := make([]byte, len(message))
+	cipher.XORKeyStream(ciphertext, message)
+
+	tag := pasetoMAC(authKey, nonce, ciphertext, footer)
+
+	body := append(nonce, ciphertext...)
+	return append(body, tag...)
+}
+
+func pasetoDecrypt(key, body, footer []byte) ([]byte, error) {
+	if len(body) < pasetoNonceSize+pasetoMACSize {
+		return nil, fmt.Errorf("%w: token is too short", ErrMalformed)
+	}
+	nonce := body[:pasetoNonceSize]
+	ciphertext := body[pasetoNonceSize : len(body)-pasetoMACSize]
+	tag := body[len(body)-pasetoMACSize:]
+
+	encKey, counterNonce, authKey := pasetoSplitKey(key, nonce)
+
+	if subtle.ConstantTimeCompare(tag, pasetoMAC(authKey, nonce, ciphertext, footer)) != 1 {
+		return nil, ErrDecryption
+	}
+
+	cipher, err := chacha20.NewUnauthenticatedCipher(encKey, counterNonce)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrDecryption, err)
+	}
+	message := make([]byte, len(ciphertext))
+	cipher.XORKeyStream(message, ciphertext)
+
+	return message, nil
+}
+
+func pasetoSplitKey(key, nonce []byte) ([]byte, []byte, []byte) {
+	tmp := keyedBlake2b(key, 56, []byte("paseto-encryption-key"), nonce)
+	authKey := keyedBlake2b(key, 32, []byte("paseto-auth-key-for-aead"), nonce)
+	return tmp[:32], tmp[32:], authKey
+}
+
+func pasetoMAC(authKey, nonce, ciphertext, footer []byte) []byte {
+	return keyedBlake2b(authKey, pasetoMACSize, pae([]byte(PasetoLocal+"."), nonce, ciphertext, footer, nil))
+}
+
+func keyedBlake2b(key []byte, size int, data ...[]byte) []byte {
+	h, err := blake2b.New(size, key)
+	if err != nil {
+		// sizes are fixed, so it can't happen
+		panic(err)
+	}
+	for _, d := range data {
+		h.Write(d)
+	}
+	return h.Sum(nil)
+}
+
+// pae is pre-authentication encoding from PASETO spec
+func pae(pieces ...[]byte) []byte {
+	out := binary.LittleEndian.AppendUint64(nil, uint64(len(pieces)))
+	for _, piece := range pieces {
+		out = binary.LittleEndian.AppendUint64(out, uint64(len(piece)))
+		out = append(out, piece...)
+	}
+	return out
+}
+
+func pasetoPayload(payload Payload) ([]byte, error) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return nil, fmt.Errorf("can't marshal payload: %w", err)
+	}
+	return convertTimeClaims(data, func(raw json.RawMessage) (any, error) {
+		var seconds int64
+		err := json.Unmarshal(raw, &seconds)
+		return time.Unix(seconds, 0).UTC().Format(time.RFC3339), err
+	})
+}
+
+func fromPasetoPayload(message []byte) ([]byte, error) {
+	data, err := convertTimeClaims(message, func(raw json.RawMessage) (any, error) {
+		var formatted string
+		err := json.Unmarshal(raw, &formatted)
+		if err != nil {
+			return nil, err
+		}
+		parsed, err := time.Parse(time.RFC3339, formatted)
+		return parsed.Unix(), err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrMalformed, err)
+	}
+	return data, nil
+}
+
+func convertTimeClaims(data []byte, convert func(json.RawMessage) (any, error)) ([]byte, error) {
+	var claims map[string]json.RawMessage
+	err := json.Unmarshal(data, &claims)
+	if err != nil {
+		return nil, fmt.Errorf("can't unmarshal claims: %w", err)
+	}
+
+	for _, name := range pasetoTimeClaims {
+		raw, ok := claims[name]
+		if !ok {
+			continue
+		}
+		converted, err := convert(raw)
+		if err != nil {
+			return nil, fmt.Errorf("can't convert %s: %w", name, err)
+		}
+		claims[name], err = json.Marshal(converted)
+		if err != nil {
+			return nil, fmt.Errorf("can't convert %s: %w", name, err)
+		}
+	}
+
+	return json.Marshal(claims)
+}
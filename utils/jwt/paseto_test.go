@@ -0,0 +1,91 @@
+package jwt_test
+
+import (
+	"crypto/ed25519"
+	"crypto/x509"
+	"encoding/hex"
+	"strings"
+	"testing"
+
+	"github.com/rinnothing/simple-jwt/utils/jwt"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPasetoVector(t *testing.T) {
+	// 4-S-2 from PASETO test vectors
+	seed, err := hex.DecodeString("b4cbfb43df4ce210727d953e4a713307fa19bb7d9f85041438d9e11b942a3774")
+	require.NoError(t, err)
+	der, err := x509.MarshalPKCS8PrivateKey(ed25519.NewKeyFromSeed(seed))
+	require.NoError(t, err)
+	signer, err := jwt.NewSigner(jwt.EdDSA, string(der))
+	require.NoError(t, err)
+
+	token := jwt.AccessToken("v4.public.eyJkYXRhIjoidGhpcyBpcyBhIHNpZ25lZCBtZXNzYWdlIiwiZXhwIjoiMjAyMi0wMS0wMVQwMDowMDowMCswMDowMCJ9" +
+		"v3Jt8mx_TdM2ceTGoqwrh4yDFn0XsHvvV_D0DtwQxVrJEBMl0F2caAdgnpKlt4p7xBnx1HcO-SPo8FPp214HDw" +
+		".eyJraWQiOiJ6VmhNaVBCUDlmUmYyc25FY1Q3Z0ZUaW9lQTlDT2NOeTlEZmdMMVc2MGhhTiJ9")
+
+	kid, err := token.PasetoKeyID()
+	require.NoError(t, err)
+	require.Equal(t, "zVhMiPBP9fRf2snEcT7gFTioeA9COcNy9DfgL1W60haN", kid)
+
+	payload, err := token.OpenPaseto(signer.Verifier())
+	require.NoError(t, err)
+	require.JSONEq(t, `{"data":"this is a signed message","exp":1640995200}`, string(payload))
+}
+
+func TestPasetoTokens(t *testing.T) {
+	for _, c := range []struct {
+		format string
+		alg    string
+	}{
+		{jwt.PasetoLocal, jwt.HS512},
+		{jwt.PasetoPublic, jwt.EdDSA},
+	} {
+		t.Run(c.format, func(t *testing.T) {
+			key, err := jwt.GenerateSigningKey(c.alg)
+			require.NoError(t, err)
+			signer, err := jwt.NewSigner(c.alg, key)
+			require.NoError(t, err)
+
+			tool := jwt.NewJWTTool(jwt.NewKeyring(signer), string(refreshKey), string(refreshHashKey))
+			tool.Format = c.format
+
+			access, refresh, err := tool.IssueTokens(t.Context(), "12345", map[string]any{"tenant": "acme"})
+			require.NoError(t, err)
+			require.True(t, strings.HasPrefix(string(access), c.format+"."))
+
+			require.NoError(t, tool.CheckAccess(access))
+			require.NoError(t, tool.CheckRefresh(access, refresh))
+
+			payload, err := tool.GetPayload(access)
+			require.NoError(t, err)
+			require.Equal(t, "12345", payload.UUID)
+			require.Equal(t, "acme", payload.Extra["tenant"])
+
+			claims, err := jwt.GetToolClaims[appClaims](tool, access)
+			require.NoError(t, err)
+			require.Equal(t, "acme", claims.Tenant)
+
+			parts := strings.Split(string(access), ".")
+			parts[2] = brakeBase64URL(parts[2])
+			require.Error(t, tool.CheckAccess(jwt.AccessToken(strings.Join(parts, "."))))
+
+			// purpose can't be swapped
+			swapped := jwt.PasetoPublic
+			if c.format == jwt.PasetoPublic {
+				swapped = jwt.PasetoLocal
+			}
+			parts = strings.Split(string(access), ".")
+			parts[0], parts[1] = strings.Split(swapped, ".")[0], strings.Split(swapped, ".")[1]
+			require.Error(t, tool.CheckAccess(jwt.AccessToken(strings.Join(parts, "."))))
+		})
+	}
+}
+
+func TestPasetoWrongKey(t *testing.T) {
+	tool := newTool(t)
+	tool.Format = jwt.PasetoPublic
+
+	_, _, err := tool.IssueTokens(t.Context(), "12345", nil)
+	require.ErrorIs(t, err, jwt.ErrWrongKeyType)
+}
@@ -0,0 +1,161 @@
+package jwt
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+
+	"golang.org/x/crypto/chacha20poly1305"
+)
+
+const (
+	RefreshV1 = 1
+	RefreshV2 = 2
+)
+
+// RefreshClaims is the content of v2 refresh token, client can't read or change it
+type RefreshClaims struct {
+	Version   int    `json:"v"`
+	ID        string `json:"jti"`
+	SessionID string `json:"sid"`
+	IssuedAt  int64  `json:"iat"`
+	ExpiresAt int64  `json:"exp"`
+	// binds refresh token to the access token issued with it
+	AccessHash string `json:"ath"`
+}
+
+// Seal makes v2 refresh token: version byte, nonce and sealed claims, all in standard base64.
+// Version byte is authenticated too, so it can't be swapped
+func (c RefreshClaims) Seal(refreshKey string) (RefreshToken, error) {
+	c.Version = RefreshV2
+	plaintext, err := json.Marshal(c)
+	if err != nil {
+		return "", fmt.Errorf("can't marshal refresh claims: %w", err)
+	}
+
+	aead, err := chacha20poly1305.NewX(refreshSealKey(refreshKey))
+	if err != nil {
+		return "", fmt.Errorf("can't create cipher: %w", err)
+	}
+
+	out := make([]byte, 1+aead.NonceSize(), 1+aead.NonceSize()+len(plaintext)+aead.Overhead())
+	out[0] = RefreshV2
+	rand.Read(out[1:])
+	out = aead.Seal(out, out[1:], plaintext, out[:1])
+
+	return RefreshToken(base64.StdEncoding.EncodeToString(out)), nil
+}
+
+// Version tells refresh token format, v1 is base64 of ascii text, so it never starts with byte 2
+func (r RefreshToken) Version() int {
+	decoded, err := base64.StdEncoding.DecodeString(string(r))
+	if err == nil && len(decoded) > 0 && decoded[0] == RefreshV2 {
+		return RefreshV2
+	}
+	return RefreshV1
+}
+
+// Open checks and decrypts v2 refresh token, times aren't checked
+func (r RefreshToken) Open(refreshKey string) (*RefreshClaims, error) {
+	decoded, err := base64.StdEncoding.DecodeString(string(r))
+	if err != nil {
+		return nil, fmt.Errorf("%w: refresh token isn't in base64: %w", ErrMalformed, err)
+	}
+
+	aead, err := chacha20poly1305.NewX(refreshSealKey(refreshKey))
+	if err != nil {
+		return nil, fmt.Errorf("can't create cipher: %w", err)
+	}
+	if len(decoded) < 1+aead.NonceSize()+aead.Overhead() || decoded[0] != RefreshV2 {
+		return nil, fmt.Errorf("%w: not a v2 refresh token", ErrMalformed)
+	}
+
+	nonce, sealed := decoded[1:1+aead.NonceSize()], decoded[1+aead.NonceSize():]
+	plaintext, err := aead.Open(nil, nonce, sealed, decoded[:1])
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrPairMismatch, err)
+	}
+
+	var claims RefreshClaims
+	err = json.Unmarshal(plaintext, &claims)
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to unmarshal refresh claims: %w", ErrMalformed, err)
+	}
+	if claims.Version != RefreshV2 {
+		return nil, fmt.Errorf("%w: unknown refresh token version %d", ErrMalformed, claims.Version)
+	}
+
+	return &claims, nil
+}
+
+// ValidateAccess checks that refresh token was issued together with access one
+func (c RefreshClaims) ValidateAccess(access AccessToken) error {
+	if subtle.ConstantTimeCompare([]byte(c.AccessHash), []byte(accessHash(access))) != 1 {
+		return ErrPairMismatch
+	}
+	return nil
+}
+
+func accessHash(access AccessToken) string {
+	sum := sha256.Sum256([]byte(access))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// fingerprint is keyed hash of access token, unlike refresh token hash it's cheap to check on every request
+func fingerprint(key []byte, access AccessToken) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(access))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func fingerprintKey(refreshHashKey string) []byte {
+	mac := hmac.New(sha512.New, []byte(refreshHashKey))
+	mac.Write([]byte("simple-jwt access fingerprint key"))
+	return mac.Sum(nil)[:sha256.Size]
+}
+
+// refresh key is also used for v1 hmac, so a separate key is derived for sealing
+func refreshSealKey(refreshKey string) []byte {
+	mac := hmac.New(sha512.New, []byte(refreshKey))
+	mac.Write([]byte("simple-jwt refresh v2 key"))
+	return mac.Sum(nil)[:chacha20poly1305.KeySize]
+}
+
+// sealStored encrypts data server keeps for itself, nonce is prepended to the result
+func sealStored(refreshKey string, data []byte) ([]byte, error) {
+	aead, err := chacha20poly1305.NewX(storedSealKey(refreshKey))
+	if err != nil {
+		return nil, fmt.Errorf("can't create cipher: %w", err)
+	}
+
+	out := make([]byte, aead.NonceSize(), aead.NonceSize()+len(data)+aead.Overhead())
+	rand.Read(out)
+	return aead.Seal(out, out, data, nil), nil
+}
+
+func openStored(refreshKey string, sealed []byte) ([]byte, error) {
+	aead, err := chacha20poly1305.NewX(storedSealKey(refreshKey))
+	if err != nil {
+		return nil, fmt.Errorf("can't create cipher: %w", err)
+	}
+	if len(sealed) < aead.NonceSize()+aead.Overhead() {
+		return nil, fmt.Errorf("%w: sealed data is too short", ErrMalformed)
+	}
+
+	data, err := aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], nil)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrDecryption, err)
+	}
+	return data, nil
+}
+
+func storedSealKey(refreshKey string) []byte {
+	mac := hmac.New(sha512.New, []byte(refreshKey))
+	mac.Write([]byte("simple-jwt stored data key"))
+	return mac.Sum(nil)[:chacha20poly1305.KeySize]
+}
@@ -0,0 +1,106 @@
+package jwt_test
+
+import (
+	"encoding/base64"
+	"testing"
+	"time"
+
+	"github.com/rinnothing/simple-jwt/utils/jwt"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRefreshV2(t *testing.T) {
+	tool := newTool(t)
+	now := issueTime
+	tool.Now = func() time.Time { return now }
+
+	access, refresh, err := tool.IssueSessionTokens(t.Context(), "session", "12345", nil)
+	require.NoError(t, err)
+	require.Equal(t, jwt.RefreshV2, refresh.Version())
+
+	claims, err := tool.OpenRefresh(refresh)
+	require.NoError(t, err)
+	require.Equal(t, "session", claims.SessionID)
+	require.NotEmpty(t, claims.ID)
+	require.Equal(t, issueTime.Unix(), claims.IssuedAt)
+	require.Equal(t, issueTime.Add(jwt.DefaultRefreshLifetime).Unix(), claims.ExpiresAt)
+	require.NoError(t, tool.CheckRefresh(access, refresh))
+
+	// refresh token is bound to its access token
+	otherAccess, otherRefresh, err := tool.IssueSessionTokens(t.Context(), "session", "12345", nil)
+	require.NoError(t, err)
+	require.ErrorIs(t, tool.CheckRefresh(otherAccess, refresh), jwt.ErrPairMismatch)
+	require.ErrorIs(t, tool.CheckRefresh(access, otherRefresh), jwt.ErrPairMismatch)
+
+	// any change is detected, version byte included
+	decoded, err := base64.StdEncoding.DecodeString(string(refresh))
+	require.NoError(t, err)
+	for _, i := range []int{0, 1, len(decoded) / 2, len(decoded) - 1} {
+		changed := append([]byte{}, decoded...)
+		changed[i] ^= 1
+		require.Error(t, tool.CheckRefresh(access, jwt.RefreshToken(base64.StdEncoding.EncodeToString(changed))))
+	}
+
+	now = issueTime.Add(jwt.DefaultRefreshLifetime)
+	require.ErrorIs(t, tool.CheckRefresh(access, refresh), jwt.ErrExpired)
+}
+
+func TestRefreshV1Window(t *testing.T) {
+	tool := newTool(t)
+	tool.Now = func() time.Time { return issueTime }
+
+	access, _, err := tool.IssueTokens(t.Context(), "12345", nil)
+	require.NoError(t, err)
+	v1Refresh := tool.AccessToRefresh(access)
+	require.Equal(t, jwt.RefreshV1, v1Refresh.Version())
+
+	require.ErrorIs(t, tool.CheckRefresh(access, v1Refresh), jwt.ErrMalformed)
+
+	tool.RefreshV1Until = issueTime.Add(time.Hour)
+	require.NoError(t, tool.CheckRefresh(access, v1Refresh))
+
+	tool.Now = func() time.Time { return issueTime.Add(time.Hour) }
+	require.ErrorIs(t, tool.CheckRefresh(access, v1Refresh), jwt.ErrMalformed)
+}
+
+func TestSealStored(t *testing.T) {
+	tool := newTool(t)
+
+	sealed, err := tool.SealStored([]byte("pair"))
+	require.NoError(t, err)
+	require.NotContains(t, string(sealed), "pair")
+
+	data, err := tool.OpenStored(sealed)
+	require.NoError(t, err)
+	require.Equal(t, []byte("pair"), data)
+
+	sealed[len(sealed)-1] ^= 1
+	_, err = tool.OpenStored(sealed)
+	require.ErrorIs(t, err, jwt.ErrDecryption)
+
+	_, err = tool.OpenStored(sealed[:4])
+	require.ErrorIs(t, err, jwt.ErrMalformed)
+}
+
+func TestFingerprint(t *testing.T) {
+	tool := newTool(t)
+
+	access, _, err := tool.IssueTokens(t.Context(), "12345", nil)
+	require.NoError(t, err)
+	otherAccess, _, err := tool.IssueTokens(t.Context(), "12345", nil)
+	require.NoError(t, err)
+
+	require.Equal(t, tool.Fingerprint(access), tool.Fingerprint(access))
+	require.NotEqual(t, tool.Fingerprint(access), tool.Fingerprint(otherAccess))
+
+	otherTool := jwt.NewJWTTool(jwt.NewKeyring(accessSigner(t)), string(refreshKey), "another-hash-key")
+	require.NotEqual(t, tool.Fingerprint(access), otherTool.Fingerprint(access))
+}
+
+func BenchmarkFingerprint(b *testing.B) {
+	tool := newTool(b)
+
+	for b.Loop() {
+		tool.Fingerprint(rightToken)
+	}
+}
@@ -0,0 +1,193 @@
+package jwt
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"time"
+)
+
+// remote signer protocol, JSON over HTTP on a unix socket
+const (
+	RemoteKeyPath    = "/v1/key"
+	RemoteSignPath   = "/v1/sign"
+	RemoteHealthPath = "/v1/health"
+
+	DefaultRemoteTimeout = time.Second
+)
+
+var ErrRemoteSigner = errors.New("remote signer failed")
+
+type remoteSignRequest struct {
+	KeyID string `json:"kid"`
+	Data  []byte `json:"data"`
+}
+
+type remoteSignResponse struct {
+	Signature []byte `json:"signature"`
+}
+
+// RemoteSigner asks external process to sign, so private key never gets into our process.
+// Public key is fetched once, verification doesn't go to the signer
+type RemoteSigner struct {
+	client   *http.Client
+	timeout  time.Duration
+	verifier PublicVerifier
+}
+
+// NewRemoteSigner connects to the signer listening on socket and fetches its public key,
+// every request is limited by timeout, DefaultRemoteTimeout is used if it's zero
+func NewRemoteSigner(ctx context.Context, socket string, timeout time.Duration) (*RemoteSigner, error) {
+	if timeout == 0 {
+		timeout = DefaultRemoteTimeout
+	}
+
+	var dialer net.Dialer
+	r := &RemoteSigner{
+		client: &http.Client{
+			Transport: &http.Transport{
+				DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+					return dialer.DialContext(ctx, "unix", socket)
+				},
+			},
+		},
+		timeout: timeout,
+	}
+
+	var jwk JWK
+	err := r.do(ctx, http.MethodGet, RemoteKeyPath, nil, &jwk)
+	if err != nil {
+		return nil, fmt.Errorf("can't fetch public key: %w", err)
+	}
+
+	verifier, err := jwk.Verifier()
+	if err != nil {
+		return nil, fmt.Errorf("%w: bad public key: %w", ErrRemoteSigner, err)
+	}
+	public, ok := verifier.(PublicVerifier)
+	if !ok || public.KeyID() != jwk.KeyID {
+		return nil, fmt.Errorf("%w: kid %q doesn't match public key", ErrRemoteSigner, jwk.KeyID)
+	}
+	r.verifier = public
+
+	return r, nil
+}
+
+func (r *RemoteSigner) Algorithm() string {
+	return r.verifier.Algorithm()
+}
+
+func (r *RemoteSigner) KeyID() string {
+	return r.verifier.KeyID()
+}
+
+// Sign sends data to the signer, signature is checked with cached public key before it's used.
+// Request ends with ctx or after the timeout, whichever comes first
+func (r *RemoteSigner) Sign(ctx context.Context, data []byte) ([]byte, error) {
+	var resp remoteSignResponse
+	err := r.do(ctx, http.MethodPost, RemoteSignPath, remoteSignRequest{KeyID: r.KeyID(), Data: data}, &resp)
+	if err != nil {
+		return nil, err
+	}
+
+	if !r.verifier.Verify(data, resp.Signature) {
+		return nil, fmt.Errorf("%w: signature doesn't match public key", ErrRemoteSigner)
+	}
+	return resp.Signature, nil
+}
+
+func (r *RemoteSigner) Verifier() Verifier {
+	return r.verifier
+}
+
+// Health checks that the signer is up
+func (r *RemoteSigner) Health(ctx context.Context) error {
+	return r.do(ctx, http.MethodGet, RemoteHealthPath, nil, nil)
+}
+
+func (r *RemoteSigner) do(ctx context.Context, method, path string, body, res any) error {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	var reqBody io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return fmt.Errorf("can't marshal request: %w", err)
+		}
+		reqBody = bytes.NewReader(data)
+	}
+
+	// host is ignored, connection always goes to the socket
+	req, err := http.NewRequestWithContext(ctx, method, "http://signer"+path, reqBody)
+	if err != nil {
+		return fmt.Errorf("can't make request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrRemoteSigner, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("%w: %s: %s", ErrRemoteSigner, resp.Status, bytes.TrimSpace(msg))
+	}
+	if res == nil {
+		return nil
+	}
+
+	err = json.NewDecoder(resp.Body).Decode(res)
+	if err != nil {
+		return fmt.Errorf("%w: can't decode response: %w", ErrRemoteSigner, err)
+	}
+	return nil
+}
+
+// NewSignerHandler serves remote signer protocol with the signer, it's what a reference signer process runs.
+// Only signers with public keys can be served, as verification stays on the other side
+func NewSignerHandler(signer Signer) (http.Handler, error) {
+	public, ok := signer.Verifier().(PublicVerifier)
+	if !ok {
+		return nil, fmt.Errorf("%w: %s key can't be published", ErrWrongKeyType, signer.Algorithm())
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET "+RemoteHealthPath, func(w http.ResponseWriter, _ *http.Request) {
+		w.Write([]byte("ok\n"))
+	})
+	mux.HandleFunc("GET "+RemoteKeyPath, func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(public.JWK())
+	})
+	mux.HandleFunc("POST "+RemoteSignPath, func(w http.ResponseWriter, r *http.Request) {
+		var req remoteSignRequest
+		err := json.NewDecoder(io.LimitReader(r.Body, 1<<20)).Decode(&req)
+		if err != nil {
+			http.Error(w, "can't decode request", http.StatusBadRequest)
+			return
+		}
+		if req.KeyID != signer.KeyID() {
+			http.Error(w, "unknown kid", http.StatusNotFound)
+			return
+		}
+
+		signature, err := signer.Sign(r.Context(), req.Data)
+		if err != nil {
+			http.Error(w, "can't sign", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(remoteSignResponse{Signature: signature})
+	})
+
+	return mux, nil
+}
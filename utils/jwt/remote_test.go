@@ -0,0 +1,118 @@
+package jwt_test
+
+import (
+	"context"
+	"encoding/base64"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/rinnothing/simple-jwt/utils/jwt"
+	"github.com/stretchr/testify/require"
+)
+
+// serveSigner runs handler on a unix socket until test ends and returns socket path
+func serveSigner(t *testing.T, handler http.Handler) string {
+	// t.TempDir may be too long for a socket path
+	dir, err := os.MkdirTemp("", "signer")
+	require.NoError(t, err)
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	socket := filepath.Join(dir, "signer.sock")
+	listener, err := net.Listen("unix", socket)
+	require.NoError(t, err)
+
+	server := &http.Server{Handler: handler}
+	go server.Serve(listener)
+	t.Cleanup(func() { server.Close() })
+
+	return socket
+}
+
+func TestRemoteSigner(t *testing.T) {
+	for _, alg := range []string{jwt.ES256, jwt.EdDSA} {
+		t.Run(alg, func(t *testing.T) {
+			key, err := jwt.GenerateSigningKey(alg)
+			require.NoError(t, err)
+			local, err := jwt.NewSigner(alg, key)
+			require.NoError(t, err)
+
+			handler, err := jwt.NewSignerHandler(local)
+			require.NoError(t, err)
+			socket := serveSigner(t, handler)
+
+			remote, err := jwt.NewRemoteSigner(context.Background(), socket, 0)
+			require.NoError(t, err)
+			require.Equal(t, alg, remote.Algorithm())
+			require.Equal(t, local.KeyID(), remote.KeyID())
+			require.NoError(t, remote.Health(context.Background()))
+
+			tool := jwt.NewJWTTool(jwt.NewKeyring(remote), string(refreshKey), string(refreshHashKey))
+			access, refresh, err := tool.IssueTokens(t.Context(), "12345", nil)
+			require.NoError(t, err)
+			require.NoError(t, tool.CheckAccess(access))
+			require.NoError(t, tool.CheckRefresh(access, refresh))
+
+			// tokens are the same as if they were signed locally
+			localTool := jwt.NewJWTTool(jwt.NewKeyring(local), string(refreshKey), string(refreshHashKey))
+			require.NoError(t, localTool.CheckAccess(access))
+
+			// signing stops with the caller's context
+			ctx, cancel := context.WithCancel(t.Context())
+			cancel()
+			_, _, err = tool.IssueTokens(ctx, "12345", nil)
+			require.ErrorIs(t, err, context.Canceled)
+		})
+	}
+}
+
+func TestRemoteSignerFailures(t *testing.T) {
+	key, err := jwt.GenerateSigningKey(jwt.EdDSA)
+	require.NoError(t, err)
+	local, err := jwt.NewSigner(jwt.EdDSA, key)
+	require.NoError(t, err)
+	handler, err := jwt.NewSignerHandler(local)
+	require.NoError(t, err)
+
+	// signer which answers too late
+	slow := make(chan struct{})
+	defer close(slow)
+	mux := http.NewServeMux()
+	mux.Handle("GET "+jwt.RemoteKeyPath, handler)
+	mux.HandleFunc(jwt.RemoteHealthPath, func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-slow:
+		case <-r.Context().Done():
+		}
+	})
+	// signer which signs with another key
+	otherKey, err := jwt.GenerateSigningKey(jwt.EdDSA)
+	require.NoError(t, err)
+	other, err := jwt.NewSigner(jwt.EdDSA, otherKey)
+	require.NoError(t, err)
+	mux.HandleFunc("POST "+jwt.RemoteSignPath, func(w http.ResponseWriter, r *http.Request) {
+		signature, _ := other.Sign(t.Context(), []byte("data"))
+		w.Write([]byte(`{"signature":"` + base64.StdEncoding.EncodeToString(signature) + `"}`))
+	})
+
+	remote, err := jwt.NewRemoteSigner(context.Background(), serveSigner(t, mux), 50*time.Millisecond)
+	require.NoError(t, err)
+
+	start := time.Now()
+	require.ErrorIs(t, remote.Health(context.Background()), jwt.ErrRemoteSigner)
+	require.Less(t, time.Since(start), time.Second)
+
+	_, err = remote.Sign(t.Context(), []byte("data"))
+	require.ErrorIs(t, err, jwt.ErrRemoteSigner)
+
+	// nobody listens
+	_, err = jwt.NewRemoteSigner(context.Background(), filepath.Join(os.TempDir(), "no-such-signer.sock"), 0)
+	require.ErrorIs(t, err, jwt.ErrRemoteSigner)
+
+	// hmac key can't be served, it would have to be shared for verification
+	_, err = jwt.NewSignerHandler(accessSigner(t))
+	require.ErrorIs(t, err, jwt.ErrWrongKeyType)
+}
@@ -0,0 +1,359 @@
+package jwt
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+)
+
+const (
+	HS512 = "HS512"
+	RS256 = "RS256"
+	PS256 = "PS256"
+	ES256 = "ES256"
+	EdDSA = "EdDSA"
+)
+
+const minRSABits = 2048
+
+var (
+	ErrUnknownAlgorithm = errors.New("unknown signing algorithm")
+	ErrWrongKeyType     = errors.New("key doesn't suit the algorithm")
+)
+
+// Signer makes signatures for access tokens, Verifier returns the matching one.
+// Local keys sign at once, ctx matters to signers which wait on something outside
+type Signer interface {
+	Algorithm() string
+	KeyID() string
+	Sign(ctx context.Context, data []byte) ([]byte, error)
+	Verifier() Verifier
+}
+
+// Verifier checks signatures made by a single key with a single algorithm
+type Verifier interface {
+	Algorithm() string
+	KeyID() string
+	Verify(data, signature []byte) bool
+}
+
+// NewSigner creates signer from key material,
+// for HS512 it's the raw secret, for the others it's PKCS #8 private key in DER or PEM
+func NewSigner(alg string, key string) (Signer, error) {
+	if alg == "" {
+		alg = HS512
+	}
+
+	if alg == HS512 {
+		if len(key) == 0 {
+			return nil, fmt.Errorf("%w: empty hmac key", ErrWrongKeyType)
+		}
+		return &hmacKey{key: []byte(key), kid: hmacKeyID([]byte(key))}, nil
+	}
+
+	der := []byte(key)
+	if block, _ := pem.Decode(der); block != nil {
+		der = block.Bytes
+	}
+
+	private, err := x509.ParsePKCS8PrivateKey(der)
+	if err != nil {
+		return nil, fmt.Errorf("can't parse private key: %w", err)
+	}
+
+	switch alg {
+	case RS256, PS256:
+		rsaKey, ok := private.(*rsa.PrivateKey)
+		if !ok {
+			return nil, fmt.Errorf("%w: %s wants rsa key", ErrWrongKeyType, alg)
+		}
+		if rsaKey.N.BitLen() < minRSABits {
+			return nil, fmt.Errorf("%w: rsa key must be at least %d bits", ErrWrongKeyType, minRSABits)
+		}
+		return &rsaPrivateKey{key: rsaKey, public: newRSAPublicKey(alg, &rsaKey.PublicKey)}, nil
+	case ES256:
+		ecKey, ok := private.(*ecdsa.PrivateKey)
+		if !ok || ecKey.Curve != elliptic.P256() {
+			return nil, fmt.Errorf("%w: %s wants P-256 ecdsa key", ErrWrongKeyType, alg)
+		}
+		return &ecdsaPrivateKey{key: ecKey, public: newECDSAPublicKey(&ecKey.PublicKey)}, nil
+	case EdDSA:
+		edKey, ok := private.(ed25519.PrivateKey)
+		if !ok {
+			return nil, fmt.Errorf("%w: %s wants ed25519 key", ErrWrongKeyType, alg)
+		}
+		return &ed25519PrivateKey{key: edKey, public: newEd25519PublicKey(edKey.Public().(ed25519.PublicKey))}, nil
+	}
+
+	return nil, fmt.Errorf("%w: %s", ErrUnknownAlgorithm, alg)
+}
+
+// NewVerifier creates verifier for asymmetric algorithms from PKIX public key in DER or PEM
+func NewVerifier(alg string, publicKey string) (Verifier, error) {
+	der := []byte(publicKey)
+	if block, _ := pem.Decode(der); block != nil {
+		der = block.Bytes
+	}
+
+	public, err := x509.ParsePKIXPublicKey(der)
+	if err != nil {
+		return nil, fmt.Errorf("can't parse public key: %w", err)
+	}
+
+	return newPublicVerifier(alg, public)
+}
+
+func newPublicVerifier(alg string, public crypto.PublicKey) (Verifier, error) {
+	switch alg {
+	case RS256, PS256:
+		rsaKey, ok := public.(*rsa.PublicKey)
+		if !ok {
+			return nil, fmt.Errorf("%w: %s wants rsa key", ErrWrongKeyType, alg)
+		}
+		return newRSAPublicKey(alg, rsaKey), nil
+	case ES256:
+		ecKey, ok := public.(*ecdsa.PublicKey)
+		if !ok || ecKey.Curve != elliptic.P256() {
+			return nil, fmt.Errorf("%w: %s wants P-256 ecdsa key", ErrWrongKeyType, alg)
+		}
+		return newECDSAPublicKey(ecKey), nil
+	case EdDSA:
+		edKey, ok := public.(ed25519.PublicKey)
+		if !ok {
+			return nil, fmt.Errorf("%w: %s wants ed25519 key", ErrWrongKeyType, alg)
+		}
+		return newEd25519PublicKey(edKey), nil
+	}
+
+	return nil, fmt.Errorf("%w: %s", ErrUnknownAlgorithm, alg)
+}
+
+// GenerateSigningKey makes new key material suitable for NewSigner
+func GenerateSigningKey(alg string) (string, error) {
+	var private any
+	var err error
+
+	switch alg {
+	case "", HS512:
+		return GenerateKey(), nil
+	case RS256, PS256:
+		private, err = rsa.GenerateKey(rand.Reader, minRSABits)
+	case ES256:
+		private, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	case EdDSA:
+		_, private, err = ed25519.GenerateKey(rand.Reader)
+	default:
+		return "", fmt.Errorf("%w: %s", ErrUnknownAlgorithm, alg)
+	}
+	if err != nil {
+		return "", fmt.Errorf("can't generate key: %w", err)
+	}
+
+	der, err := x509.MarshalPKCS8PrivateKey(private)
+	if err != nil {
+		return "", fmt.Errorf("can't marshal key: %w", err)
+	}
+	return string(der), nil
+}
+
+type hmacKey struct {
+	key []byte
+	kid string
+}
+
+func (h *hmacKey) Algorithm() string {
+	return HS512
+}
+
+func (h *hmacKey) KeyID() string {
+	return h.kid
+}
+
+func (h *hmacKey) Sign(_ context.Context, data []byte) ([]byte, error) {
+	return doHmac(string(h.key), string(data)), nil
+}
+
+func (h *hmacKey) Verify(data, signature []byte) bool {
+	return hmac.Equal(doHmac(string(h.key), string(data)), signature)
+}
+
+func (h *hmacKey) Verifier() Verifier {
+	return h
+}
+
+type rsaPrivateKey struct {
+	key    *rsa.PrivateKey
+	public *rsaPublicKey
+}
+
+func (r *rsaPrivateKey) Algorithm() string {
+	return r.public.alg
+}
+
+func (r *rsaPrivateKey) KeyID() string {
+	return r.public.KeyID()
+}
+
+func (r *rsaPrivateKey) Sign(_ context.Context, data []byte) ([]byte, error) {
+	digest := sha256.Sum256(data)
+	if r.public.alg == PS256 {
+		return rsa.SignPSS(rand.Reader, r.key, crypto.SHA256, digest[:], &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash})
+	}
+	return rsa.SignPKCS1v15(rand.Reader, r.key, crypto.SHA256, digest[:])
+}
+
+func (r *rsaPrivateKey) Verifier() Verifier {
+	return r.public
+}
+
+type rsaPublicKey struct {
+	alg string
+	key *rsa.PublicKey
+	jwk JWK
+}
+
+func newRSAPublicKey(alg string, key *rsa.PublicKey) *rsaPublicKey {
+	return &rsaPublicKey{alg: alg, key: key, jwk: rsaJWK(alg, key)}
+}
+
+func (r *rsaPublicKey) Algorithm() string {
+	return r.alg
+}
+
+func (r *rsaPublicKey) KeyID() string {
+	return r.jwk.KeyID
+}
+
+func (r *rsaPublicKey) JWK() JWK {
+	return r.jwk
+}
+
+func (r *rsaPublicKey) Verify(data, signature []byte) bool {
+	digest := sha256.Sum256(data)
+	if r.alg == PS256 {
+		return rsa.VerifyPSS(r.key, crypto.SHA256, digest[:], signature, &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash}) == nil
+	}
+	return rsa.VerifyPKCS1v15(r.key, crypto.SHA256, digest[:], signature) == nil
+}
+
+// ecdsa signatures in JWS are r and s concatenated, not ASN.1
+const es256PartSize = 32
+
+type ecdsaPrivateKey struct {
+	key    *ecdsa.PrivateKey
+	public *ecdsaPublicKey
+}
+
+func (e *ecdsaPrivateKey) Algorithm() string {
+	return ES256
+}
+
+func (e *ecdsaPrivateKey) KeyID() string {
+	return e.public.KeyID()
+}
+
+func (e *ecdsaPrivateKey) Sign(_ context.Context, data []byte) ([]byte, error) {
+	digest := sha256.Sum256(data)
+	r, s, err := ecdsa.Sign(rand.Reader, e.key, digest[:])
+	if err != nil {
+		return nil, fmt.Errorf("can't sign with ecdsa: %w", err)
+	}
+
+	signature := make([]byte, 2*es256PartSize)
+	r.FillBytes(signature[:es256PartSize])
+	s.FillBytes(signature[es256PartSize:])
+	return signature, nil
+}
+
+func (e *ecdsaPrivateKey) Verifier() Verifier {
+	return e.public
+}
+
+type ecdsaPublicKey struct {
+	key *ecdsa.PublicKey
+	jwk JWK
+}
+
+func newECDSAPublicKey(key *ecdsa.PublicKey) *ecdsaPublicKey {
+	return &ecdsaPublicKey{key: key, jwk: ecdsaJWK(key)}
+}
+
+func (e *ecdsaPublicKey) Algorithm() string {
+	return ES256
+}
+
+func (e *ecdsaPublicKey) KeyID() string {
+	return e.jwk.KeyID
+}
+
+func (e *ecdsaPublicKey) JWK() JWK {
+	return e.jwk
+}
+
+func (e *ecdsaPublicKey) Verify(data, signature []byte) bool {
+	if len(signature) != 2*es256PartSize {
+		return false
+	}
+
+	digest := sha256.Sum256(data)
+	r := new(big.Int).SetBytes(signature[:es256PartSize])
+	s := new(big.Int).SetBytes(signature[es256PartSize:])
+	return ecdsa.Verify(e.key, digest[:], r, s)
+}
+
+type ed25519PrivateKey struct {
+	key    ed25519.PrivateKey
+	public *ed25519PublicKey
+}
+
+func (e *ed25519PrivateKey) Algorithm() string {
+	return EdDSA
+}
+
+func (e *ed25519PrivateKey) KeyID() string {
+	return e.public.KeyID()
+}
+
+func (e *ed25519PrivateKey) Sign(_ context.Context, data []byte) ([]byte, error) {
+	return ed25519.Sign(e.key, data), nil
+}
+
+func (e *ed25519PrivateKey) Verifier() Verifier {
+	return e.public
+}
+
+type ed25519PublicKey struct {
+	key ed25519.PublicKey
+	jwk JWK
+}
+
+func newEd25519PublicKey(key ed25519.PublicKey) *ed25519PublicKey {
+	return &ed25519PublicKey{key: key, jwk: ed25519JWK(key)}
+}
+
+func (e *ed25519PublicKey) Algorithm() string {
+	return EdDSA
+}
+
+func (e *ed25519PublicKey) KeyID() string {
+	return e.jwk.KeyID
+}
+
+func (e *ed25519PublicKey) JWK() JWK {
+	return e.jwk
+}
+
+func (e *ed25519PublicKey) Verify(data, signature []byte) bool {
+	return ed25519.Verify(e.key, data, signature)
+}
@@ -0,0 +1,93 @@
+package jwt_test
+
+import (
+	"crypto"
+	"crypto/x509"
+	"encoding/base64"
+	"testing"
+
+	"github.com/rinnothing/simple-jwt/utils/jwt"
+	"github.com/stretchr/testify/require"
+)
+
+var algorithms = []string{jwt.HS512, jwt.RS256, jwt.PS256, jwt.ES256, jwt.EdDSA}
+
+func TestSigningAlgorithms(t *testing.T) {
+	for _, alg := range algorithms {
+		t.Run(alg, func(t *testing.T) {
+			key, err := jwt.GenerateSigningKey(alg)
+			require.NoError(t, err)
+
+			signer, err := jwt.NewSigner(alg, key)
+			require.NoError(t, err)
+			require.Equal(t, alg, signer.Algorithm())
+
+			tool := jwt.NewJWTTool(jwt.NewKeyring(signer), string(refreshKey), string(refreshHashKey))
+			access, refresh, err := tool.IssueTokens(t.Context(), "12345", nil)
+			require.NoError(t, err)
+
+			header, err := access.GetHeader()
+			require.NoError(t, err)
+			require.Equal(t, alg, header.Algorithm)
+
+			require.NoError(t, tool.CheckAccess(access))
+			require.NoError(t, tool.CheckRefresh(access, refresh))
+
+			broken := jwt.AccessToken(brakeOneChar(string(access)))
+			require.Error(t, tool.CheckAccess(broken))
+
+			// key of the same algorithm but a different one
+			otherKey, err := jwt.GenerateSigningKey(alg)
+			require.NoError(t, err)
+			other, err := jwt.NewSigner(alg, otherKey)
+			require.NoError(t, err)
+			require.ErrorIs(t, access.ValidateSignature(other.Verifier()), jwt.ErrUnknownKey)
+		})
+	}
+}
+
+func TestWrongKeyType(t *testing.T) {
+	key, err := jwt.GenerateSigningKey(jwt.ES256)
+	require.NoError(t, err)
+
+	_, err = jwt.NewSigner(jwt.RS256, key)
+	require.ErrorIs(t, err, jwt.ErrWrongKeyType)
+
+	_, err = jwt.NewSigner("HS256", key)
+	require.ErrorIs(t, err, jwt.ErrUnknownAlgorithm)
+}
+
+func TestAlgorithmConfusion(t *testing.T) {
+	key, err := jwt.GenerateSigningKey(jwt.RS256)
+	require.NoError(t, err)
+	signer, err := jwt.NewSigner(jwt.RS256, key)
+	require.NoError(t, err)
+
+	private, err := x509.ParsePKCS8PrivateKey([]byte(key))
+	require.NoError(t, err)
+	public, err := x509.MarshalPKIXPublicKey(private.(crypto.Signer).Public())
+	require.NoError(t, err)
+
+	verifier, err := jwt.NewVerifier(jwt.RS256, string(public))
+	require.NoError(t, err)
+
+	payload := jwt.Payload{UUID: "12345", ExpiresAt: issueTime.Unix() + 60}
+	exp := jwt.Expectations{Now: issueTime}
+
+	// public key used as hmac secret
+	hmacSigner, err := jwt.NewSigner(jwt.HS512, string(public))
+	require.NoError(t, err)
+	forged, err := jwt.PreAccessToken{Payload: payload}.Encode(t.Context(), hmacSigner)
+	require.NoError(t, err)
+	require.ErrorIs(t, forged.Validate(verifier, exp), jwt.ErrSignature)
+	require.ErrorIs(t, forged.Validate(signer.Verifier(), exp), jwt.ErrSignature)
+
+	// alg none
+	none := jwt.AccessToken(base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"none","typ":"JWT"}`)) + "." +
+		base64.RawURLEncoding.EncodeToString([]byte(`{"uuid":"12345","exp":1750000060}`)) + ".")
+	require.ErrorIs(t, none.Validate(verifier, exp), jwt.ErrSignature)
+
+	genuine, err := jwt.PreAccessToken{Payload: payload}.Encode(t.Context(), signer)
+	require.NoError(t, err)
+	require.NoError(t, genuine.Validate(verifier, exp))
+}
@@ -1,59 +1,413 @@
 package jwt
 
 import (
+	"context"
 	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultAccessLifetime  = 15 * time.Minute
+	DefaultRefreshLifetime = 30 * 24 * time.Hour
 )
 
 type Tool struct {
-	RandomString   string
-	accessKey      string
-	refreshKey     string
-	refreshHashKey string
+	// used as jti if set, otherwise jti is random
+	RandomString string
+
+	Issuer   string
+	Audience string
+
+	AccessLifetime  time.Duration
+	RefreshLifetime time.Duration
+	// allowed clock skew when checking time based claims
+	Leeway time.Duration
+
+	Now func() time.Time
+
+	// PasetoLocal or PasetoPublic makes tokens in PASETO v4 format instead of JWT, tokens of every format
+	// are accepted as long as they are made with our keys
+	Format string
+
+	// access tokens are wrapped into JWE if set, signed token is encrypted unless EncryptOnly is set
+	Encrypter KeyEncrypter
+	// payload is encrypted without signature, allowed only with dir, as anyone can encrypt with a public key
+	EncryptOnly bool
+
+	// v1 refresh tokens are accepted until then, only v2 ones are issued
+	RefreshV1Until time.Time
+
+	keys *Keyring
+
+	refreshMu sync.RWMutex
+	refresh   refreshKeys
+}
+
+// refreshKeys are keys of one key version which refresh tokens and fingerprints are made with
+type refreshKeys struct {
+	key         string
+	hashKey     string
+	fingerprint []byte
+}
+
+func NewJWTTool(keys *Keyring, refreshKey, refreshHashKey string) *Tool {
+	t := &Tool{
+		AccessLifetime:  DefaultAccessLifetime,
+		RefreshLifetime: DefaultRefreshLifetime,
+		Now:             time.Now,
+		keys:            keys,
+	}
+	t.ReplaceRefreshKeys(refreshKey, refreshHashKey)
+	return t
 }
 
-func NewJWTTool(accessKey, refreshKey, refreshHashKey string) *Tool {
-	return &Tool{
-		accessKey:      accessKey,
-		refreshKey:     refreshKey,
-		refreshHashKey: refreshHashKey,
+// ReplaceRefreshKeys atomically swaps refresh keys, like Keyring.Replace it's safe while tokens are issued and checked
+func (t *Tool) ReplaceRefreshKeys(refreshKey, refreshHashKey string) {
+	keys := refreshKeys{
+		key:         refreshKey,
+		hashKey:     refreshHashKey,
+		fingerprint: fingerprintKey(refreshHashKey),
 	}
+
+	t.refreshMu.Lock()
+	defer t.refreshMu.Unlock()
+
+	t.refresh = keys
+}
+
+func (t *Tool) refreshKeys() refreshKeys {
+	t.refreshMu.RLock()
+	defer t.refreshMu.RUnlock()
+
+	return t.refresh
+}
+
+// IssueTokens makes a pair of tokens for a new session, claims are added to access token payload unless they clash with registered ones
+func (t *Tool) IssueTokens(ctx context.Context, uuid string, claims map[string]any) (AccessToken, RefreshToken, error) {
+	return t.IssueSessionTokens(ctx, GenerateID(), uuid, claims)
+}
+
+// IssueSessionTokens makes a pair of tokens for existing session, session ID is put into both tokens
+func (t *Tool) IssueSessionTokens(ctx context.Context, sessionID, uuid string, claims map[string]any) (AccessToken, RefreshToken, error) {
+	return t.IssueAuthenticatedTokens(ctx, sessionID, uuid, Authentication{}, claims)
 }
 
-func (t *Tool) IssueTokens(uuid string) (AccessToken, RefreshToken) {
+// IssueAuthenticatedTokens is IssueSessionTokens which also records how the user was authenticated
+func (t *Tool) IssueAuthenticatedTokens(ctx context.Context, sessionID, uuid string, authn Authentication, claims map[string]any) (AccessToken, RefreshToken, error) {
+	now := t.Now()
+
 	preAccess := PreAccessToken{
 		Header: Header{
-			Algorithm: "HS512",
-			Type:      "JWT",
+			Type: "JWT",
 		},
 		Payload: Payload{
-			UUID:        uuid,
-			RandomValue: t.RandomString,
+			Issuer:    t.Issuer,
+			Subject:   uuid,
+			ExpiresAt: now.Add(t.AccessLifetime).Unix(),
+			NotBefore: now.Unix(),
+			IssuedAt:  now.Unix(),
+			ID:        t.RandomString,
+			UUID:      uuid,
+			SessionID: sessionID,
+			Extra:     claims,
+
+			AuthMethods: authn.Methods,
+			AuthTime:    authn.Time,
 		},
 	}
-	access := preAccess.Encode(t.accessKey)
+	if t.Audience != "" {
+		preAccess.Payload.Audience = Audience{t.Audience}
+	}
+	access, err := t.encode(ctx, preAccess)
+	if err != nil {
+		return "", "", err
+	}
 
-	preRefresh := PreRefreshToken{
-		Access: access,
+	refresh, err := RefreshClaims{
+		ID:         GenerateID(),
+		SessionID:  sessionID,
+		IssuedAt:   now.Unix(),
+		ExpiresAt:  now.Add(t.RefreshLifetime).Unix(),
+		AccessHash: accessHash(access),
+	}.Seal(t.refreshKeys().key)
+	if err != nil {
+		return "", "", err
 	}
-	refresh := preRefresh.Encode(t.refreshKey, t.refreshHashKey)
 
-	return access, refresh
+	return access, refresh, nil
 }
 
+// AccessToRefresh returns v1 refresh token of the access token, as it can be computed from access token alone,
+// it's what server stores to recognize the latest tokens of the session
 func (t *Tool) AccessToRefresh(access AccessToken) RefreshToken {
 	preRefresh := PreRefreshToken{
 		Access: access,
 	}
-	return preRefresh.Encode(t.refreshKey, t.refreshHashKey)
+	keys := t.refreshKeys()
+	return preRefresh.Encode(keys.key, keys.hashKey)
+}
+
+// Fingerprint returns keyed hash of access token, server stores it to recognize the latest access token of the session
+func (t *Tool) Fingerprint(access AccessToken) string {
+	return fingerprint(t.refreshKeys().fingerprint, access)
+}
+
+// OpenRefresh returns claims of v2 refresh token, it doesn't check the token is still valid
+func (t *Tool) OpenRefresh(refresh RefreshToken) (*RefreshClaims, error) {
+	return refresh.Open(t.refreshKeys().key)
+}
+
+// SealStored encrypts data which server keeps in database but clients must not read, like issued tokens
+func (t *Tool) SealStored(data []byte) ([]byte, error) {
+	return sealStored(t.refreshKeys().key, data)
+}
+
+// OpenStored decrypts data sealed by SealStored
+func (t *Tool) OpenStored(sealed []byte) ([]byte, error) {
+	return openStored(t.refreshKeys().key, sealed)
 }
 
-func (t *Tool) CheckAccess(access AccessToken) bool {
-	return access.Validate(t.accessKey)
+func (t *Tool) CheckAccess(access AccessToken) error {
+	signed, payload, err := t.open(access)
+	if err != nil {
+		return err
+	}
+	if signed == "" {
+		return payload.Validate(t.expectations())
+	}
+
+	verifier, err := t.verifierFor(signed)
+	if err != nil {
+		return err
+	}
+	return signed.Validate(verifier, t.expectations())
 }
 
 // remember: the refresh key could be already used, the method only checks for access and refresh tokens compatibility
-func (t *Tool) CheckRefresh(access AccessToken, refresh RefreshToken) bool {
-	return refresh.Validate(access, t.refreshKey, t.refreshHashKey)
+// access token itself may be expired, but refresh token must still be within its lifetime
+func (t *Tool) CheckRefresh(access AccessToken, refresh RefreshToken) error {
+	signed, payload, err := t.open(access)
+	if err != nil {
+		return err
+	}
+	if signed != "" {
+		verifier, err := t.verifierFor(signed)
+		if err != nil {
+			return err
+		}
+		err = signed.ValidateSignature(verifier)
+		if err != nil {
+			return err
+		}
+	}
+
+	if refresh.Version() == RefreshV2 {
+		claims, err := refresh.Open(t.refreshKeys().key)
+		if err != nil {
+			return err
+		}
+		if !t.Now().Add(-t.Leeway).Before(time.Unix(claims.ExpiresAt, 0)) {
+			return fmt.Errorf("%w: refresh token lifetime is over", ErrExpired)
+		}
+		return claims.ValidateAccess(access)
+	}
+
+	if !t.Now().Before(t.RefreshV1Until) {
+		return fmt.Errorf("%w: v1 refresh tokens aren't accepted anymore", ErrMalformed)
+	}
+
+	// v1 refresh token is issued together with access one, so it shares iat
+	expires := time.Unix(payload.IssuedAt, 0).Add(t.RefreshLifetime)
+	if !t.Now().Add(-t.Leeway).Before(expires) {
+		return fmt.Errorf("%w: refresh token lifetime is over", ErrExpired)
+	}
+
+	// refresh token is bound to the token client has, encrypted or not
+	keys := t.refreshKeys()
+	return refresh.Validate(access, keys.key, keys.hashKey)
+}
+
+// GetPayload works like AccessToken.GetPayload, but also decrypts tokens, the token isn't checked
+func (t *Tool) GetPayload(access AccessToken) (*Payload, error) {
+	_, payload, err := t.open(access)
+	return payload, err
+}
+
+// PayloadJSON works like AccessToken.PayloadJSON, but also decrypts tokens, the token isn't checked
+func (t *Tool) PayloadJSON(access AccessToken) ([]byte, error) {
+	if access.IsPaseto() {
+		return t.openPaseto(access)
+	}
+	if !isJWE(access) {
+		return access.PayloadJSON()
+	}
+
+	signed, decoded, err := t.decrypt(access)
+	if err != nil {
+		return nil, err
+	}
+	if signed != "" {
+		return signed.PayloadJSON()
+	}
+	return decoded, nil
+}
+
+func (t *Tool) encode(ctx context.Context, preAccess PreAccessToken) (AccessToken, error) {
+	if t.Format != "" {
+		if t.Encrypter != nil {
+			return "", fmt.Errorf("%w: paseto tokens can't be wrapped into JWE", ErrUnknownAlgorithm)
+		}
+		return preAccess.EncodePaseto(ctx, t.Format, t.keys.Signer())
+	}
+
+	if t.Encrypter == nil {
+		return preAccess.Encode(ctx, t.keys.Signer())
+	}
+
+	if t.EncryptOnly {
+		if t.Encrypter.Algorithm() != Dir {
+			return "", fmt.Errorf("%w: unsigned tokens can only be encrypted with dir", ErrUnknownAlgorithm)
+		}
+		payload, err := json.Marshal(preAccess.Payload)
+		if err != nil {
+			return "", fmt.Errorf("can't marshal payload: %w", err)
+		}
+		encrypted, err := EncryptJWE(t.Encrypter, payload, "")
+		if err != nil {
+			return "", err
+		}
+		return AccessToken(encrypted), nil
+	}
+
+	signed, err := preAccess.Encode(ctx, t.keys.Signer())
+	if err != nil {
+		return "", err
+	}
+	encrypted, err := EncryptJWE(t.Encrypter, []byte(signed), "JWT")
+	if err != nil {
+		return "", err
+	}
+	return AccessToken(encrypted), nil
+}
+
+// open returns signed token which must be checked and its payload,
+// signed token is empty if the payload was only encrypted or it was paseto, then opening itself proves it's ours
+func (t *Tool) open(access AccessToken) (AccessToken, *Payload, error) {
+	if access.IsPaseto() {
+		decoded, err := t.openPaseto(access)
+		if err != nil {
+			return "", nil, err
+		}
+
+		var payload Payload
+		err = json.Unmarshal(decoded, &payload)
+		if err != nil {
+			return "", nil, fmt.Errorf("%w: failed to unmarshal payload json: %w", ErrMalformed, err)
+		}
+		return "", &payload, nil
+	}
+
+	if !isJWE(access) {
+		payload, err := access.GetPayload()
+		return access, payload, err
+	}
+
+	signed, decoded, err := t.decrypt(access)
+	if err != nil {
+		return "", nil, err
+	}
+	if signed != "" {
+		payload, err := signed.GetPayload()
+		return signed, payload, err
+	}
+
+	var payload Payload
+	err = json.Unmarshal(decoded, &payload)
+	if err != nil {
+		return "", nil, fmt.Errorf("%w: failed to unmarshal payload json: %w", ErrMalformed, err)
+	}
+	return "", &payload, nil
+}
+
+// decrypt returns either nested signed token or plain payload
+func (t *Tool) decrypt(access AccessToken) (AccessToken, []byte, error) {
+	if t.Encrypter == nil {
+		return "", nil, fmt.Errorf("%w: encrypted tokens aren't accepted", ErrMalformed)
+	}
+
+	header, plaintext, err := DecryptJWE(t.Encrypter, string(access))
+	if err != nil {
+		return "", nil, err
+	}
+
+	if header.ContentType == "JWT" {
+		return AccessToken(plaintext), nil, nil
+	}
+	// with public key anyone could make such a token
+	if header.Algorithm != Dir {
+		return "", nil, fmt.Errorf("%w: encrypted token isn't signed", ErrSignature)
+	}
+	return "", plaintext, nil
+}
+
+// paseto tokens can't be read without checking them, so it's done right away
+func (t *Tool) openPaseto(access AccessToken) ([]byte, error) {
+	kid, err := access.PasetoKeyID()
+	if err != nil {
+		return nil, err
+	}
+
+	verifier, ok := t.keys.Verifier(kid)
+	if !ok {
+		return nil, fmt.Errorf("%w: kid %q", ErrUnknownKey, kid)
+	}
+	return access.OpenPaseto(verifier)
+}
+
+func isJWE(access AccessToken) bool {
+	return strings.Count(string(access), ".") == 4
+}
+
+// JWKS returns keys which can be used to verify access tokens outside, hmac ones are skipped
+func (t *Tool) JWKS() JWKS {
+	jwks := JWKS{Keys: []JWK{}}
+	for _, verifier := range t.keys.Verifiers() {
+		if public, ok := verifier.(PublicVerifier); ok {
+			jwks.Keys = append(jwks.Keys, public.JWK())
+		}
+	}
+	return jwks
+}
+
+// Keys returns keyring of the tool, replacing keys in it affects the tool immediately
+func (t *Tool) Keys() *Keyring {
+	return t.keys
+}
+
+func (t *Tool) verifierFor(access AccessToken) (Verifier, error) {
+	header, err := access.GetHeader()
+	if err != nil {
+		return nil, err
+	}
+
+	verifier, ok := t.keys.Verifier(header.KeyID)
+	if !ok {
+		return nil, fmt.Errorf("%w: kid %q", ErrUnknownKey, header.KeyID)
+	}
+	return verifier, nil
+}
+
+func (t *Tool) expectations() Expectations {
+	return Expectations{
+		Issuer:   t.Issuer,
+		Audience: t.Audience,
+		Now:      t.Now(),
+		Leeway:   t.Leeway,
+	}
 }
 
 func GenerateKey() string {
@@ -1,24 +1,118 @@
 package jwt
 
 import (
+	"context"
 	"crypto/hmac"
 	"crypto/rand"
 	"crypto/sha512"
+	"crypto/subtle"
 	"encoding/base64"
 	"encoding/json"
-	"errors"
 	"fmt"
+	"slices"
 	"strings"
+	"time"
 )
 
 type Header struct {
 	Algorithm string `json:"alg"`
 	Type      string `json:"typ"`
+	KeyID     string `json:"kid,omitempty"`
 }
 
+// Payload holds registered claims from RFC 7519 together with our own ones
 type Payload struct {
-	RandomValue string `json:"random_value"`
-	UUID        string `json:"uuid"`
+	Issuer    string   `json:"iss,omitempty"`
+	Subject   string   `json:"sub,omitempty"`
+	Audience  Audience `json:"aud,omitempty"`
+	ExpiresAt int64    `json:"exp,omitempty"`
+	NotBefore int64    `json:"nbf,omitempty"`
+	IssuedAt  int64    `json:"iat,omitempty"`
+	ID        string   `json:"jti,omitempty"`
+
+	UUID string `json:"uuid"`
+	// session the token belongs to, tokens issued before sessions existed don't have it
+	SessionID string `json:"sid,omitempty"`
+	// how and when user proved who they are (RFC 8176 and OpenID Connect), they're kept over refreshes
+	AuthMethods []string `json:"amr,omitempty"`
+	AuthTime    int64    `json:"auth_time,omitempty"`
+
+	// application defined claims, they can't override the ones above
+	Extra map[string]any `json:"-"`
+}
+
+// Audience is a list of recipients, in json it may be both a single string and an array
+type Audience []string
+
+func (a Audience) MarshalJSON() ([]byte, error) {
+	if len(a) == 1 {
+		return json.Marshal(a[0])
+	}
+	return json.Marshal([]string(a))
+}
+
+func (a *Audience) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*a = Audience{single}
+		return nil
+	}
+
+	var many []string
+	if err := json.Unmarshal(data, &many); err != nil {
+		return fmt.Errorf("aud is neither string nor array of strings: %w", err)
+	}
+	*a = many
+	return nil
+}
+
+func (a Audience) Contains(aud string) bool {
+	return slices.Contains(a, aud)
+}
+
+// Expectations describe what is checked in registered claims during validation,
+// empty Issuer or Audience aren't checked
+type Expectations struct {
+	Issuer   string
+	Audience string
+	Now      time.Time
+	Leeway   time.Duration
+}
+
+// Validate checks time based claims with leeway, issuer and audience
+func (p Payload) Validate(exp Expectations) error {
+	now := exp.Now
+	if now.IsZero() {
+		now = time.Now()
+	}
+
+	if p.ExpiresAt == 0 {
+		return fmt.Errorf("%w: no exp claim", ErrMalformed)
+	}
+	if !now.Add(-exp.Leeway).Before(time.Unix(p.ExpiresAt, 0)) {
+		return ErrExpired
+	}
+	if p.NotBefore != 0 && now.Add(exp.Leeway).Before(time.Unix(p.NotBefore, 0)) {
+		return ErrNotYetValid
+	}
+	if p.IssuedAt != 0 && now.Add(exp.Leeway).Before(time.Unix(p.IssuedAt, 0)) {
+		return fmt.Errorf("%w: issued in future", ErrNotYetValid)
+	}
+
+	if exp.Issuer != "" && p.Issuer != exp.Issuer {
+		return ErrIssuer
+	}
+	if exp.Audience != "" && !p.Audience.Contains(exp.Audience) {
+		return ErrAudience
+	}
+
+	return nil
+}
+
+func GenerateID() string {
+	val := make([]byte, 32)
+	rand.Read(val)
+	return base64.RawURLEncoding.EncodeToString(val)
 }
 
 type Signature string
@@ -28,21 +122,22 @@ type PreAccessToken struct {
 	Payload Payload
 }
 
-func (p PreAccessToken) Encode(key string) AccessToken {
-	if p.Payload.RandomValue == "" {
-		val := make([]byte, 64)
-		rand.Read(val)
-		p.Payload.RandomValue = string(val)
+// Encode signs the token, algorithm in header is always taken from signer
+func (p PreAccessToken) Encode(ctx context.Context, signer Signer) (AccessToken, error) {
+	if p.Payload.ID == "" {
+		p.Payload.ID = GenerateID()
 	}
+	p.Header.Algorithm = signer.Algorithm()
+	p.Header.KeyID = signer.KeyID()
 
 	headerJSON, err := json.Marshal(p.Header)
 	if err != nil {
-		panic(err)
+		return "", fmt.Errorf("can't marshal header: %w", err)
 	}
 
 	payloadJSON, err := json.Marshal(p.Payload)
 	if err != nil {
-		panic(err)
+		return "", fmt.Errorf("can't marshal payload: %w", err)
 	}
 
 	unsigned := fmt.Sprintf("%s.%s",
@@ -50,45 +145,112 @@ func (p PreAccessToken) Encode(key string) AccessToken {
 		base64.RawURLEncoding.EncodeToString(payloadJSON),
 	)
 
-	signature := doHmac(key, unsigned)
-	return AccessToken(fmt.Sprintf("%s.%s", unsigned, base64.RawURLEncoding.EncodeToString(signature)))
+	signature, err := signer.Sign(ctx, []byte(unsigned))
+	if err != nil {
+		return "", fmt.Errorf("can't sign token: %w", err)
+	}
+	return AccessToken(fmt.Sprintf("%s.%s", unsigned, base64.RawURLEncoding.EncodeToString(signature))), nil
 }
 
 type AccessToken string
 
-func (a AccessToken) Validate(key string) bool {
-	if strings.Count(string(a), ".") != 2 {
-		return false
+// Validate checks both signature and registered claims of the token
+func (a AccessToken) Validate(verifier Verifier, exp Expectations) error {
+	err := a.ValidateSignature(verifier)
+	if err != nil {
+		return err
 	}
 
-	signature := strings.Split(string(a), ".")[2]
-	body := a[:len(a)-len(signature)-1]
+	payload, err := a.GetPayload()
+	if err != nil {
+		return err
+	}
 
-	expectedSignature := base64.RawURLEncoding.EncodeToString(doHmac(key, string(body)))
-	return expectedSignature == signature
+	return payload.Validate(exp)
 }
 
-func (a AccessToken) GetPayload() (*Payload, error) {
+// ValidateSignature only checks that the token was signed by verifier's key, claims like exp aren't checked.
+// Algorithm in header must be the verifier's one, so neither "none" nor algorithm substitution pass
+func (a AccessToken) ValidateSignature(verifier Verifier) error {
 	parts := strings.Split(string(a), ".")
 	if len(parts) != 3 {
-		return nil, errors.New("invalid token")
+		return fmt.Errorf("%w: want 3 parts, has %d", ErrMalformed, len(parts))
 	}
-	middle := parts[1]
 
-	decoded, err := base64.RawURLEncoding.DecodeString(middle)
+	header, err := a.GetHeader()
+	if err != nil {
+		return err
+	}
+	if header.Algorithm == "" || header.Algorithm == "none" || header.Algorithm != verifier.Algorithm() {
+		return fmt.Errorf("%w: algorithm %q isn't allowed", ErrSignature, header.Algorithm)
+	}
+	if header.KeyID != "" && header.KeyID != verifier.KeyID() {
+		return fmt.Errorf("%w: kid %q", ErrUnknownKey, header.KeyID)
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return fmt.Errorf("%w: signature isn't in base64url: %w", ErrMalformed, err)
+	}
+	body := a[:len(a)-len(parts[2])-1]
+
+	if !verifier.Verify([]byte(body), signature) {
+		return ErrSignature
+	}
+	return nil
+}
+
+func (a AccessToken) GetHeader() (*Header, error) {
+	parts := strings.Split(string(a), ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("%w: want 3 parts, has %d", ErrMalformed, len(parts))
+	}
+
+	decoded, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return nil, fmt.Errorf("%w: header isn't in base64url: %w", ErrMalformed, err)
+	}
+
+	var header Header
+	err = json.Unmarshal(decoded, &header)
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to unmarshal header json: %w", ErrMalformed, err)
+	}
+
+	return &header, nil
+}
+
+func (a AccessToken) GetPayload() (*Payload, error) {
+	decoded, err := a.PayloadJSON()
 	if err != nil {
-		return nil, fmt.Errorf("middle isn't in base64url: %w", err)
+		return nil, err
 	}
 
 	var payload Payload
 	err = json.Unmarshal(decoded, &payload)
 	if err != nil {
-		return nil, fmt.Errorf("failed to unmarshal payload json: %w", err)
+		return nil, fmt.Errorf("%w: failed to unmarshal payload json: %w", ErrMalformed, err)
 	}
 
 	return &payload, nil
 }
 
+// PayloadJSON returns decoded but not parsed payload
+func (a AccessToken) PayloadJSON() ([]byte, error) {
+	parts := strings.Split(string(a), ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("%w: want 3 parts, has %d", ErrMalformed, len(parts))
+	}
+	middle := parts[1]
+
+	decoded, err := base64.RawURLEncoding.DecodeString(middle)
+	if err != nil {
+		return nil, fmt.Errorf("%w: middle isn't in base64url: %w", ErrMalformed, err)
+	}
+
+	return decoded, nil
+}
+
 type PreRefreshToken struct {
 	Access AccessToken
 }
@@ -103,10 +265,13 @@ func (p PreRefreshToken) Encode(refreshKey, refreshHashKey string) RefreshToken
 
 type RefreshToken string
 
-func (r RefreshToken) Validate(access AccessToken, refreshKey, refreshHashKey string) bool {
+func (r RefreshToken) Validate(access AccessToken, refreshKey, refreshHashKey string) error {
 	repeatRefresh := PreRefreshToken{Access: access}.Encode(refreshKey, refreshHashKey)
 
-	return r == repeatRefresh
+	if subtle.ConstantTimeCompare([]byte(r), []byte(repeatRefresh)) != 1 {
+		return ErrPairMismatch
+	}
+	return nil
 }
 
 func doHmac(key string, data string) []byte {
@@ -114,3 +279,27 @@ func doHmac(key string, data string) []byte {
 	hash.Write([]byte(data))
 	return hash.Sum(nil)
 }
+
+// authentication method references from RFC 8176
+const (
+	AMRPassword = "pwd"
+	AMROTP      = "otp"
+	AMRMFA      = "mfa"
+	// proof of possession of hardware-secured key, like passkey
+	AMRHardwareKey = "hwk"
+)
+
+// Authentication is how and when user proved who they are, it's put into amr and auth_time claims
+type Authentication struct {
+	Methods []string
+	// unix time
+	Time int64
+}
+
+// Authentication returns what amr and auth_time claims of the payload say
+func (p Payload) Authentication() Authentication {
+	return Authentication{
+		Methods: p.AuthMethods,
+		Time:    p.AuthTime,
+	}
+}
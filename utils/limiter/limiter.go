@@ -0,0 +1,100 @@
+package limiter
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	DefaultQueueTimeout = time.Second
+	DefaultRetryAfter   = time.Second
+)
+
+var ErrOverloaded = errors.New("too much work is waiting")
+
+// OverloadedError is returned when work is rejected, it matches ErrOverloaded
+type OverloadedError struct {
+	// when it makes sense to try again
+	RetryAfter time.Duration
+}
+
+func (e *OverloadedError) Error() string {
+	return fmt.Sprintf("%s, retry after %s", ErrOverloaded, e.RetryAfter)
+}
+
+func (e *OverloadedError) Unwrap() error {
+	return ErrOverloaded
+}
+
+// Limiter runs at most workers jobs at once, others wait in a bounded queue for at most queue timeout,
+// so work which can't be done in time is rejected right away instead of slowing down everything
+type Limiter struct {
+	slots   chan struct{}
+	waiting atomic.Int64
+
+	queueSize    int64
+	queueTimeout time.Duration
+	retryAfter   time.Duration
+}
+
+// New makes limiter, workers defaults to the number of CPUs, zero durations are replaced with defaults
+func New(workers, queueSize int, queueTimeout, retryAfter time.Duration) *Limiter {
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+	if queueTimeout <= 0 {
+		queueTimeout = DefaultQueueTimeout
+	}
+	if retryAfter <= 0 {
+		retryAfter = DefaultRetryAfter
+	}
+
+	return &Limiter{
+		slots:        make(chan struct{}, workers),
+		queueSize:    int64(max(queueSize, 0)),
+		queueTimeout: queueTimeout,
+		retryAfter:   retryAfter,
+	}
+}
+
+// Do runs work once there is a free worker, nil limiter runs it right away
+func (l *Limiter) Do(ctx context.Context, work func() error) error {
+	if l == nil {
+		return work()
+	}
+
+	select {
+	case l.slots <- struct{}{}:
+	default:
+		err := l.wait(ctx)
+		if err != nil {
+			return err
+		}
+	}
+	defer func() { <-l.slots }()
+
+	return work()
+}
+
+func (l *Limiter) wait(ctx context.Context) error {
+	defer l.waiting.Add(-1)
+	if l.waiting.Add(1) > l.queueSize {
+		return &OverloadedError{RetryAfter: l.retryAfter}
+	}
+
+	timer := time.NewTimer(l.queueTimeout)
+	defer timer.Stop()
+
+	select {
+	case l.slots <- struct{}{}:
+		return nil
+	case <-timer.C:
+		return &OverloadedError{RetryAfter: l.retryAfter}
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,77 @@
+package limiter_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/rinnothing/simple-jwt/utils/limiter"
+	"github.com/stretchr/testify/require"
+)
+
+func noop() error {
+	return nil
+}
+
+// busy occupies the only worker of limiter until returned func is called
+func busy(l *limiter.Limiter) func() {
+	started, release := make(chan struct{}), make(chan struct{})
+	go l.Do(context.Background(), func() error {
+		close(started)
+		<-release
+		return nil
+	})
+	<-started
+	return func() { close(release) }
+}
+
+func TestLimiter(t *testing.T) {
+	ctx := context.Background()
+	l := limiter.New(1, 1, 300*time.Millisecond, 3*time.Second)
+	release := busy(l)
+
+	// one job waits in the queue and gives up after timeout
+	queued := make(chan error)
+	go func() {
+		queued <- l.Do(ctx, noop)
+	}()
+	time.Sleep(50 * time.Millisecond)
+
+	// queue is full, so the next job is rejected right away
+	start := time.Now()
+	err := l.Do(ctx, noop)
+	require.Less(t, time.Since(start), 100*time.Millisecond)
+	var overloaded *limiter.OverloadedError
+	require.ErrorAs(t, err, &overloaded)
+	require.Equal(t, 3*time.Second, overloaded.RetryAfter)
+
+	require.ErrorIs(t, <-queued, limiter.ErrOverloaded)
+
+	// queued job runs once the worker is free
+	go func() {
+		queued <- l.Do(ctx, noop)
+	}()
+	time.Sleep(50 * time.Millisecond)
+	release()
+	require.NoError(t, <-queued)
+}
+
+func TestLimiterCancel(t *testing.T) {
+	l := limiter.New(1, 1, time.Minute, 0)
+	release := busy(l)
+	defer release()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	require.ErrorIs(t, l.Do(ctx, noop), context.DeadlineExceeded)
+}
+
+func TestNilLimiter(t *testing.T) {
+	var l *limiter.Limiter
+	called := false
+	require.NoError(t, l.Do(context.Background(), func() error {
+		called = true
+		return nil
+	}))
+	require.True(t, called)
+}
@@ -0,0 +1,131 @@
+package totp
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+const (
+	// SecretSize is 160 bits, as RFC 4226 recommends for HMAC-SHA1
+	SecretSize = 20
+
+	DefaultDigits = 6
+	DefaultPeriod = 30 * time.Second
+	DefaultSkew   = 1
+)
+
+// Options of code generation, zero values are replaced with defaults.
+// Only HMAC-SHA1 is used, it's the one every authenticator app understands
+type Options struct {
+	Digits int
+	Period time.Duration
+	// how many steps before and after the current one are accepted, to allow clock drift, negative means none
+	Skew int
+}
+
+func (o Options) withDefaults() Options {
+	if o.Digits <= 0 {
+		o.Digits = DefaultDigits
+	}
+	if o.Period <= 0 {
+		o.Period = DefaultPeriod
+	}
+	if o.Skew == 0 {
+		o.Skew = DefaultSkew
+	} else if o.Skew < 0 {
+		o.Skew = 0
+	}
+	return o
+}
+
+var encoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// GenerateSecret makes random secret of SecretSize
+func GenerateSecret() []byte {
+	secret := make([]byte, SecretSize)
+	rand.Read(secret)
+	return secret
+}
+
+// EncodeSecret returns secret in unpadded base32, the form users type into authenticator apps
+func EncodeSecret(secret []byte) string {
+	return encoding.EncodeToString(secret)
+}
+
+// Step is the number of the time step t belongs to
+func Step(t time.Time, opts Options) int64 {
+	opts = opts.withDefaults()
+	return t.Unix() / int64(opts.Period/time.Second)
+}
+
+// Code returns code for time t
+func Code(secret []byte, t time.Time, opts Options) string {
+	opts = opts.withDefaults()
+	return hotp(secret, uint64(Step(t, opts)), opts.Digits)
+}
+
+// Validate checks code against steps around t, it returns the step which matched,
+// callers should keep it and refuse steps which aren't after it, so a code can't be used twice
+func Validate(secret []byte, code string, t time.Time, opts Options) (int64, bool) {
+	opts = opts.withDefaults()
+	if len(code) != opts.Digits {
+		return 0, false
+	}
+
+	current := Step(t, opts)
+	matched, ok := int64(0), false
+	// every step is checked, so timing doesn't tell which one matched
+	for step := current - int64(opts.Skew); step <= current+int64(opts.Skew); step++ {
+		if step < 0 {
+			continue
+		}
+		if subtle.ConstantTimeCompare([]byte(hotp(secret, uint64(step), opts.Digits)), []byte(code)) == 1 {
+			matched, ok = step, true
+		}
+	}
+	return matched, ok
+}
+
+// URI returns otpauth uri of the secret, it's what QR codes for authenticator apps contain
+func URI(issuer, account string, secret []byte, opts Options) string {
+	opts = opts.withDefaults()
+
+	query := url.Values{}
+	query.Set("secret", EncodeSecret(secret))
+	query.Set("issuer", issuer)
+	query.Set("algorithm", "SHA1")
+	query.Set("digits", strconv.Itoa(opts.Digits))
+	query.Set("period", strconv.Itoa(int(opts.Period/time.Second)))
+
+	u := url.URL{
+		Scheme:   "otpauth",
+		Host:     "totp",
+		Path:     "/" + issuer + ":" + account,
+		RawQuery: query.Encode(),
+	}
+	return u.String()
+}
+
+// hotp is RFC 4226 code of the counter
+func hotp(secret []byte, counter uint64, digits int) string {
+	mac := hmac.New(sha1.New, secret)
+	binary.Write(mac, binary.BigEndian, counter)
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:]) & 0x7fffffff
+
+	modulo := uint32(1)
+	for range digits {
+		modulo *= 10
+	}
+	return fmt.Sprintf("%0*d", digits, value%modulo)
+}
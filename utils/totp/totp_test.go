@@ -0,0 +1,76 @@
+package totp
+
+import (
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+var rfcSecret = []byte("12345678901234567890")
+
+func TestHOTP(t *testing.T) {
+	// RFC 4226 appendix D
+	expected := []string{"755224", "287082", "359152", "969429", "338314", "254676", "287922", "162583", "399871", "520489"}
+	for counter, code := range expected {
+		require.Equal(t, code, hotp(rfcSecret, uint64(counter), 6))
+	}
+}
+
+func TestCode(t *testing.T) {
+	// RFC 6238 appendix B, SHA1 column
+	vectors := []struct {
+		unix int64
+		code string
+	}{
+		{59, "94287082"},
+		{1111111109, "07081804"},
+		{1111111111, "14050471"},
+		{1234567890, "89005924"},
+		{2000000000, "69279037"},
+		{20000000000, "65353130"},
+	}
+	for _, v := range vectors {
+		require.Equal(t, v.code, Code(rfcSecret, time.Unix(v.unix, 0), Options{Digits: 8}))
+	}
+}
+
+func TestValidate(t *testing.T) {
+	secret := GenerateSecret()
+	now := time.Unix(1700000000, 0)
+	opts := Options{}
+
+	step, ok := Validate(secret, Code(secret, now, opts), now, opts)
+	require.True(t, ok)
+	require.Equal(t, Step(now, opts), step)
+
+	// neighbour steps are accepted, further ones aren't
+	step, ok = Validate(secret, Code(secret, now.Add(-DefaultPeriod), opts), now, opts)
+	require.True(t, ok)
+	require.Equal(t, Step(now, opts)-1, step)
+	_, ok = Validate(secret, Code(secret, now.Add(2*DefaultPeriod), opts), now, opts)
+	require.False(t, ok)
+
+	_, ok = Validate(secret, Code(secret, now.Add(-DefaultPeriod), opts), now, Options{Skew: -1})
+	require.False(t, ok)
+
+	_, ok = Validate(secret, "12345", now, opts)
+	require.False(t, ok)
+	_, ok = Validate(GenerateSecret(), Code(secret, now, opts), now, opts)
+	require.False(t, ok)
+}
+
+func TestURI(t *testing.T) {
+	uri := URI("simple-jwt", "user", rfcSecret, Options{})
+
+	parsed, err := url.Parse(uri)
+	require.NoError(t, err)
+	require.Equal(t, "otpauth", parsed.Scheme)
+	require.Equal(t, "totp", parsed.Host)
+	require.Equal(t, "/simple-jwt:user", parsed.Path)
+	require.Equal(t, "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ", parsed.Query().Get("secret"))
+	require.Equal(t, "simple-jwt", parsed.Query().Get("issuer"))
+	require.Equal(t, "6", parsed.Query().Get("digits"))
+	require.Equal(t, "30", parsed.Query().Get("period"))
+}
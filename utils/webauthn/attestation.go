@@ -0,0 +1,153 @@
+package webauthn
+
+import (
+	"crypto/subtle"
+	"crypto/x509"
+	"encoding/asn1"
+	"fmt"
+	"slices"
+)
+
+const (
+	FormatNone   = "none"
+	FormatPacked = "packed"
+)
+
+// id-fido-gen-ce-aaguid, authenticator model of the attestation certificate
+var oidAAGUID = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 45724, 1, 1, 4}
+
+type attestationObject struct {
+	format   string
+	authData []byte
+	stmt     map[any]any
+}
+
+func parseAttestationObject(data []byte) (attestationObject, error) {
+	item, n, err := decodeCBOR(data)
+	if err != nil {
+		return attestationObject{}, err
+	}
+	if n != len(data) {
+		return attestationObject{}, fmt.Errorf("%w: trailing data after attestation object", ErrMalformed)
+	}
+
+	m, ok := item.(map[any]any)
+	if !ok {
+		return attestationObject{}, fmt.Errorf("%w: attestation object isn't a map", ErrMalformed)
+	}
+
+	var object attestationObject
+	object.format, ok = m["fmt"].(string)
+	if !ok {
+		return attestationObject{}, fmt.Errorf("%w: no attestation format", ErrMalformed)
+	}
+	object.authData, ok = m["authData"].([]byte)
+	if !ok {
+		return attestationObject{}, fmt.Errorf("%w: no authenticator data", ErrMalformed)
+	}
+	object.stmt, ok = m["attStmt"].(map[any]any)
+	if !ok {
+		return attestationObject{}, fmt.Errorf("%w: no attestation statement", ErrMalformed)
+	}
+
+	return object, nil
+}
+
+// verifyAttestation checks the statement is consistent with the credential. Certificates of packed attestation
+// aren't chained to vendor roots, so attestation only proves the authenticator holds the key, not its model
+func verifyAttestation(object attestationObject, authData AuthenticatorData, publicKey PublicKey, clientDataHash []byte) error {
+	switch object.format {
+	case FormatNone:
+		if len(object.stmt) != 0 {
+			return fmt.Errorf("%w: none attestation with statement", ErrAttestation)
+		}
+		return nil
+	case FormatPacked:
+		return verifyPacked(object, authData, publicKey, clientDataHash)
+	default:
+		return fmt.Errorf("%w: attestation format %q", ErrUnsupported, object.format)
+	}
+}
+
+// verifyPacked follows WebAuthn §8.2
+func verifyPacked(object attestationObject, authData AuthenticatorData, publicKey PublicKey, clientDataHash []byte) error {
+	alg, ok := object.stmt["alg"].(int64)
+	if !ok {
+		return fmt.Errorf("%w: packed attestation without alg", ErrAttestation)
+	}
+	sig, ok := object.stmt["sig"].([]byte)
+	if !ok {
+		return fmt.Errorf("%w: packed attestation without sig", ErrAttestation)
+	}
+	signed := slices.Concat(object.authData, clientDataHash)
+
+	x5c, hasX5C := object.stmt["x5c"].([]any)
+	if !hasX5C {
+		// self attestation is signed by the credential key itself
+		if alg != publicKey.Algorithm {
+			return fmt.Errorf("%w: self attestation alg differs from credential alg", ErrAttestation)
+		}
+		err := publicKey.Verify(signed, sig)
+		if err != nil {
+			return fmt.Errorf("%w: %w", ErrAttestation, err)
+		}
+		return nil
+	}
+
+	if len(x5c) == 0 {
+		return fmt.Errorf("%w: empty x5c", ErrAttestation)
+	}
+	der, ok := x5c[0].([]byte)
+	if !ok {
+		return fmt.Errorf("%w: x5c isn't a list of certificates", ErrAttestation)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return fmt.Errorf("%w: bad attestation certificate: %w", ErrAttestation, err)
+	}
+
+	err = checkPackedCertificate(cert, authData.AAGUID)
+	if err != nil {
+		return err
+	}
+
+	err = verifySignature(alg, cert.PublicKey, signed, sig)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrAttestation, err)
+	}
+	return nil
+}
+
+// checkPackedCertificate checks requirements of WebAuthn §8.2.1
+func checkPackedCertificate(cert *x509.Certificate, aaguid []byte) error {
+	if cert.Version != 3 {
+		return fmt.Errorf("%w: attestation certificate isn't v3", ErrAttestation)
+	}
+	subject := cert.Subject
+	if len(subject.Country) == 0 || len(subject.Organization) == 0 || subject.CommonName == "" ||
+		!slices.Equal(subject.OrganizationalUnit, []string{"Authenticator Attestation"}) {
+		return fmt.Errorf("%w: attestation certificate subject doesn't follow the spec", ErrAttestation)
+	}
+	if !cert.BasicConstraintsValid || cert.IsCA {
+		return fmt.Errorf("%w: attestation certificate is a CA", ErrAttestation)
+	}
+
+	for _, ext := range cert.Extensions {
+		if !ext.Id.Equal(oidAAGUID) {
+			continue
+		}
+		if ext.Critical {
+			return fmt.Errorf("%w: aaguid extension is critical", ErrAttestation)
+		}
+		var certAAGUID []byte
+		rest, err := asn1.Unmarshal(ext.Value, &certAAGUID)
+		if err != nil || len(rest) != 0 {
+			return fmt.Errorf("%w: bad aaguid extension", ErrAttestation)
+		}
+		if subtle.ConstantTimeCompare(certAAGUID, aaguid) != 1 {
+			return fmt.Errorf("%w: aaguid differs from the certificate one", ErrAttestation)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,86 @@
+package webauthn
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// authenticator data flags
+const (
+	FlagUserPresent      = 0x01
+	FlagUserVerified     = 0x04
+	FlagBackupEligible   = 0x08
+	FlagBackupState      = 0x10
+	FlagAttestedCredData = 0x40
+	FlagExtensionData    = 0x80
+
+	rpIDHashSize = 32
+	aaguidSize   = 16
+	// maximum credential id length from the spec
+	maxCredentialIDSize = 1023
+)
+
+// AuthenticatorData is parsed authenticator data, credential fields are set only for registration
+type AuthenticatorData struct {
+	RPIDHash  []byte
+	Flags     byte
+	SignCount uint32
+
+	AAGUID       []byte
+	CredentialID []byte
+	// COSE_Key
+	PublicKey []byte
+}
+
+func (a AuthenticatorData) Has(flag byte) bool {
+	return a.Flags&flag != 0
+}
+
+// ParseAuthenticatorData parses authenticator data, extensions are checked to be well formed and skipped
+func ParseAuthenticatorData(data []byte) (AuthenticatorData, error) {
+	if len(data) < rpIDHashSize+5 {
+		return AuthenticatorData{}, fmt.Errorf("%w: authenticator data is too short", ErrMalformed)
+	}
+
+	authData := AuthenticatorData{
+		RPIDHash:  data[:rpIDHashSize],
+		Flags:     data[rpIDHashSize],
+		SignCount: binary.BigEndian.Uint32(data[rpIDHashSize+1:]),
+	}
+	rest := data[rpIDHashSize+5:]
+
+	if authData.Has(FlagAttestedCredData) {
+		if len(rest) < aaguidSize+2 {
+			return AuthenticatorData{}, fmt.Errorf("%w: attested credential data is too short", ErrMalformed)
+		}
+		authData.AAGUID = rest[:aaguidSize]
+		idLength := int(binary.BigEndian.Uint16(rest[aaguidSize:]))
+		rest = rest[aaguidSize+2:]
+		if idLength == 0 || idLength > maxCredentialIDSize || idLength > len(rest) {
+			return AuthenticatorData{}, fmt.Errorf("%w: bad credential id length", ErrMalformed)
+		}
+		authData.CredentialID = rest[:idLength]
+		rest = rest[idLength:]
+
+		_, n, err := decodeCBOR(rest)
+		if err != nil {
+			return AuthenticatorData{}, err
+		}
+		authData.PublicKey = rest[:n]
+		rest = rest[n:]
+	}
+
+	if authData.Has(FlagExtensionData) {
+		_, n, err := decodeCBOR(rest)
+		if err != nil {
+			return AuthenticatorData{}, err
+		}
+		rest = rest[n:]
+	}
+
+	if len(rest) != 0 {
+		return AuthenticatorData{}, fmt.Errorf("%w: trailing data after authenticator data", ErrMalformed)
+	}
+
+	return authData, nil
+}
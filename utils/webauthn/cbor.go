@@ -0,0 +1,164 @@
+package webauthn
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+)
+
+// cbor major types from RFC 8949
+const (
+	majorUnsigned = 0
+	majorNegative = 1
+	majorBytes    = 2
+	majorText     = 3
+	majorArray    = 4
+	majorMap      = 5
+	majorTag      = 6
+	majorSimple   = 7
+
+	maxDepth = 16
+)
+
+// decodeCBOR decodes the first cbor item of data and tells how many bytes it took, authenticator data
+// has credential key followed by extensions, so it's not always the whole data.
+// Only what WebAuthn needs is supported: definite lengths, integers are int64, map keys are int64 or string
+func decodeCBOR(data []byte) (any, int, error) {
+	d := decoder{data: data}
+	item, err := d.item(0)
+	if err != nil {
+		return nil, 0, fmt.Errorf("%w: cbor: %w", ErrMalformed, err)
+	}
+	return item, d.pos, nil
+}
+
+type decoder struct {
+	data []byte
+	pos  int
+}
+
+func (d *decoder) item(depth int) (any, error) {
+	if depth > maxDepth {
+		return nil, fmt.Errorf("nested too deep")
+	}
+
+	major, arg, err := d.head()
+	if err != nil {
+		return nil, err
+	}
+
+	switch major {
+	case majorUnsigned:
+		if arg > math.MaxInt64 {
+			return nil, fmt.Errorf("integer %d is too big", arg)
+		}
+		return int64(arg), nil
+	case majorNegative:
+		if arg > math.MaxInt64 {
+			return nil, fmt.Errorf("integer -1-%d is too small", arg)
+		}
+		return -1 - int64(arg), nil
+	case majorBytes:
+		return d.take(arg)
+	case majorText:
+		text, err := d.take(arg)
+		return string(text), err
+	case majorArray:
+		if arg > uint64(len(d.data)-d.pos) {
+			return nil, fmt.Errorf("array is longer than data")
+		}
+		array := make([]any, arg)
+		for i := range array {
+			array[i], err = d.item(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+		}
+		return array, nil
+	case majorMap:
+		if arg > uint64(len(d.data)-d.pos)/2 {
+			return nil, fmt.Errorf("map is longer than data")
+		}
+		m := make(map[any]any, arg)
+		for range arg {
+			key, err := d.item(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+			switch key.(type) {
+			case int64, string:
+			default:
+				return nil, fmt.Errorf("unsupported map key %T", key)
+			}
+			if _, ok := m[key]; ok {
+				return nil, fmt.Errorf("duplicate map key %v", key)
+			}
+			m[key], err = d.item(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+		}
+		return m, nil
+	case majorTag:
+		// tags don't change the meaning of anything WebAuthn uses
+		return d.item(depth + 1)
+	default:
+		switch arg {
+		case 20:
+			return false, nil
+		case 21:
+			return true, nil
+		case 22, 23:
+			return nil, nil
+		}
+		return nil, fmt.Errorf("unsupported simple value %d", arg)
+	}
+}
+
+// head reads major type and its argument
+func (d *decoder) head() (byte, uint64, error) {
+	if d.pos >= len(d.data) {
+		return 0, 0, fmt.Errorf("unexpected end of data")
+	}
+	initial := d.data[d.pos]
+	d.pos++
+
+	major, info := initial>>5, initial&0x1f
+	if info < 24 {
+		return major, uint64(info), nil
+	}
+	if major == majorSimple && info > 24 {
+		return 0, 0, fmt.Errorf("floats aren't supported")
+	}
+
+	var size int
+	switch info {
+	case 24:
+		size = 1
+	case 25:
+		size = 2
+	case 26:
+		size = 4
+	case 27:
+		size = 8
+	default:
+		return 0, 0, fmt.Errorf("indefinite lengths aren't supported")
+	}
+
+	raw, err := d.take(uint64(size))
+	if err != nil {
+		return 0, 0, err
+	}
+	var padded [8]byte
+	copy(padded[8-size:], raw)
+	return major, binary.BigEndian.Uint64(padded[:]), nil
+}
+
+func (d *decoder) take(n uint64) ([]byte, error) {
+	if n > uint64(len(d.data)-d.pos) {
+		return nil, fmt.Errorf("unexpected end of data")
+	}
+	out := d.data[d.pos : d.pos+int(n)]
+	d.pos += int(n)
+	return out, nil
+}
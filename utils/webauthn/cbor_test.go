@@ -0,0 +1,69 @@
+package webauthn
+
+import (
+	"encoding/hex"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDecodeCBOR(t *testing.T) {
+	// RFC 8949 appendix A
+	vectors := []struct {
+		hex  string
+		item any
+	}{
+		{"00", int64(0)},
+		{"17", int64(23)},
+		{"1818", int64(24)},
+		{"1903e8", int64(1000)},
+		{"1b000000e8d4a51000", int64(1000000000000)},
+		{"20", int64(-1)},
+		{"3903e7", int64(-1000)},
+		{"4401020304", []byte{1, 2, 3, 4}},
+		{"6449455446", "IETF"},
+		{"83010203", []any{int64(1), int64(2), int64(3)}},
+		{"a201020304", map[any]any{int64(1): int64(2), int64(3): int64(4)}},
+		{"a26161016162820203", map[any]any{"a": int64(1), "b": []any{int64(2), int64(3)}}},
+		{"c11a514b67b0", int64(1363896240)},
+		{"f4", false},
+		{"f5", true},
+		{"f6", nil},
+	}
+
+	for _, v := range vectors {
+		data, err := hex.DecodeString(v.hex)
+		require.NoError(t, err)
+
+		item, n, err := decodeCBOR(data)
+		require.NoError(t, err, v.hex)
+		require.Equal(t, v.item, item, v.hex)
+		require.Equal(t, len(data), n, v.hex)
+	}
+
+	// only the first item is decoded
+	_, n, err := decodeCBOR([]byte{0x01, 0x02})
+	require.NoError(t, err)
+	require.Equal(t, 1, n)
+}
+
+func TestDecodeCBORMalformed(t *testing.T) {
+	for _, h := range []string{
+		"",
+		"18",               // argument is cut
+		"4501020304",       // bytes are cut
+		"5f42010243030405", // indefinite length
+		"f93c00",           // float
+		"a2010201",         // map is cut
+		"a201020103",       // duplicate key
+		"a1f402",           // key of unsupported type
+		"1bffffffffffffffff",
+		"818181818181818181818181818181818181", // nested too deep
+	} {
+		data, err := hex.DecodeString(h)
+		require.NoError(t, err)
+
+		_, _, err = decodeCBOR(data)
+		require.ErrorIs(t, err, ErrMalformed, h)
+	}
+}
@@ -0,0 +1,145 @@
+package webauthn
+
+import (
+	"crypto"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"fmt"
+	"math/big"
+)
+
+// COSE algorithms from IANA registry which are accepted for credentials
+const (
+	AlgES256 int64 = -7
+	AlgEdDSA int64 = -8
+	AlgRS256 int64 = -257
+)
+
+// SupportedAlgorithms are offered to authenticators in preference order
+var SupportedAlgorithms = []int64{AlgES256, AlgEdDSA, AlgRS256}
+
+// COSE key parameters (RFC 9053)
+const (
+	coseKty = 1
+	coseAlg = 3
+	coseCrv = -1
+	coseX   = -2
+	coseY   = -3
+	coseN   = -1
+	coseE   = -2
+
+	ktyOKP = 1
+	ktyEC2 = 2
+	ktyRSA = 3
+
+	crvP256    = 1
+	crvEd25519 = 6
+
+	minRSABits = 2048
+)
+
+// PublicKey is credential public key parsed from its COSE form
+type PublicKey struct {
+	Algorithm int64
+	Key       crypto.PublicKey
+}
+
+// ParsePublicKey parses COSE_Key, the whole data has to be the key
+func ParsePublicKey(cose []byte) (PublicKey, error) {
+	item, n, err := decodeCBOR(cose)
+	if err != nil {
+		return PublicKey{}, err
+	}
+	if n != len(cose) {
+		return PublicKey{}, fmt.Errorf("%w: trailing data after public key", ErrMalformed)
+	}
+	m, ok := item.(map[any]any)
+	if !ok {
+		return PublicKey{}, fmt.Errorf("%w: public key isn't a map", ErrMalformed)
+	}
+
+	kty, _ := m[int64(coseKty)].(int64)
+	alg, _ := m[int64(coseAlg)].(int64)
+
+	switch {
+	case kty == ktyEC2 && alg == AlgES256:
+		crv, _ := m[int64(coseCrv)].(int64)
+		x, _ := m[int64(coseX)].([]byte)
+		y, _ := m[int64(coseY)].([]byte)
+		if crv != crvP256 || len(x) != 32 || len(y) != 32 {
+			return PublicKey{}, fmt.Errorf("%w: bad P-256 key", ErrMalformed)
+		}
+		// ecdh checks the point is on the curve
+		_, err := ecdh.P256().NewPublicKey(append(append([]byte{4}, x...), y...))
+		if err != nil {
+			return PublicKey{}, fmt.Errorf("%w: bad P-256 point: %w", ErrMalformed, err)
+		}
+		return PublicKey{Algorithm: alg, Key: &ecdsa.PublicKey{
+			Curve: elliptic.P256(),
+			X:     new(big.Int).SetBytes(x),
+			Y:     new(big.Int).SetBytes(y),
+		}}, nil
+	case kty == ktyOKP && alg == AlgEdDSA:
+		crv, _ := m[int64(coseCrv)].(int64)
+		x, _ := m[int64(coseX)].([]byte)
+		if crv != crvEd25519 || len(x) != ed25519.PublicKeySize {
+			return PublicKey{}, fmt.Errorf("%w: bad Ed25519 key", ErrMalformed)
+		}
+		return PublicKey{Algorithm: alg, Key: ed25519.PublicKey(x)}, nil
+	case kty == ktyRSA && alg == AlgRS256:
+		n, _ := m[int64(coseN)].([]byte)
+		e, _ := m[int64(coseE)].([]byte)
+		if len(e) == 0 || len(e) > 4 {
+			return PublicKey{}, fmt.Errorf("%w: bad RSA exponent", ErrMalformed)
+		}
+		key := &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+		if key.N.BitLen() < minRSABits || key.E < 3 || key.E%2 == 0 {
+			return PublicKey{}, fmt.Errorf("%w: weak RSA key", ErrUnsupported)
+		}
+		return PublicKey{Algorithm: alg, Key: key}, nil
+	default:
+		return PublicKey{}, fmt.Errorf("%w: key type %d with algorithm %d", ErrUnsupported, kty, alg)
+	}
+}
+
+// Verify checks signature made by the key
+func (p PublicKey) Verify(data, sig []byte) error {
+	return verifySignature(p.Algorithm, p.Key, data, sig)
+}
+
+func verifySignature(alg int64, key crypto.PublicKey, data, sig []byte) error {
+	ok := false
+	switch alg {
+	case AlgES256:
+		pub, isECDSA := key.(*ecdsa.PublicKey)
+		if !isECDSA || pub.Curve != elliptic.P256() {
+			return fmt.Errorf("%w: ES256 needs P-256 key", ErrUnsupported)
+		}
+		digest := sha256.Sum256(data)
+		ok = ecdsa.VerifyASN1(pub, digest[:], sig)
+	case AlgEdDSA:
+		pub, isEd25519 := key.(ed25519.PublicKey)
+		if !isEd25519 {
+			return fmt.Errorf("%w: EdDSA needs Ed25519 key", ErrUnsupported)
+		}
+		ok = ed25519.Verify(pub, data, sig)
+	case AlgRS256:
+		pub, isRSA := key.(*rsa.PublicKey)
+		if !isRSA {
+			return fmt.Errorf("%w: RS256 needs RSA key", ErrUnsupported)
+		}
+		digest := sha256.Sum256(data)
+		ok = rsa.VerifyPKCS1v15(pub, crypto.SHA256, digest[:], sig) == nil
+	default:
+		return fmt.Errorf("%w: algorithm %d", ErrUnsupported, alg)
+	}
+
+	if !ok {
+		return ErrSignature
+	}
+	return nil
+}
@@ -0,0 +1,17 @@
+package webauthn
+
+import "errors"
+
+// errors returned by ceremony verification, check them with errors.Is
+var (
+	ErrMalformed        = errors.New("malformed webauthn data")
+	ErrUnsupported      = errors.New("unsupported webauthn algorithm or format")
+	ErrCeremony         = errors.New("client data is of another ceremony")
+	ErrChallenge        = errors.New("challenge doesn't match")
+	ErrOrigin           = errors.New("origin isn't allowed")
+	ErrRPID             = errors.New("authenticator data is for another relying party")
+	ErrUserPresence     = errors.New("user wasn't present")
+	ErrUserVerification = errors.New("user wasn't verified")
+	ErrSignature        = errors.New("invalid webauthn signature")
+	ErrAttestation      = errors.New("invalid attestation")
+)
@@ -0,0 +1,358 @@
+package webauthn
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+const (
+	ChallengeSize = 32
+
+	CeremonyCreate = "webauthn.create"
+	CeremonyGet    = "webauthn.get"
+
+	UserVerificationRequired    = "required"
+	UserVerificationPreferred   = "preferred"
+	UserVerificationDiscouraged = "discouraged"
+
+	AttestationNone   = "none"
+	AttestationDirect = "direct"
+
+	credentialType = "public-key"
+)
+
+// Base64URL is bytes which are unpadded base64url in json, as WebAuthn json serialization has them
+type Base64URL []byte
+
+func (b Base64URL) MarshalJSON() ([]byte, error) {
+	return json.Marshal(base64.RawURLEncoding.EncodeToString(b))
+}
+
+func (b *Base64URL) UnmarshalJSON(data []byte) error {
+	var text string
+	err := json.Unmarshal(data, &text)
+	if err != nil {
+		return err
+	}
+
+	decoded, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(text, "="))
+	if err != nil {
+		return fmt.Errorf("%w: bad base64url: %w", ErrMalformed, err)
+	}
+	*b = decoded
+	return nil
+}
+
+// RelyingParty verifies ceremonies for one rp id, origins are where browsers may run them from
+type RelyingParty struct {
+	ID      string
+	Name    string
+	Origins []string
+	// required, preferred or discouraged
+	UserVerification string
+	// none or direct
+	Attestation string
+	Timeout     time.Duration
+}
+
+type RPEntity struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+type UserEntity struct {
+	ID          Base64URL `json:"id"`
+	Name        string    `json:"name"`
+	DisplayName string    `json:"displayName"`
+}
+
+type CredentialParameter struct {
+	Type string `json:"type"`
+	Alg  int64  `json:"alg"`
+}
+
+type CredentialDescriptor struct {
+	Type string    `json:"type"`
+	ID   Base64URL `json:"id"`
+}
+
+type AuthenticatorSelection struct {
+	ResidentKey      string `json:"residentKey"`
+	UserVerification string `json:"userVerification"`
+}
+
+// CreationOptions are passed to navigator.credentials.create() after decoding with PublicKeyCredential.parseCreationOptionsFromJSON
+type CreationOptions struct {
+	RP                     RPEntity               `json:"rp"`
+	User                   UserEntity             `json:"user"`
+	Challenge              Base64URL              `json:"challenge"`
+	PubKeyCredParams       []CredentialParameter  `json:"pubKeyCredParams"`
+	Timeout                int64                  `json:"timeout,omitempty"`
+	ExcludeCredentials     []CredentialDescriptor `json:"excludeCredentials,omitempty"`
+	AuthenticatorSelection AuthenticatorSelection `json:"authenticatorSelection"`
+	Attestation            string                 `json:"attestation,omitempty"`
+}
+
+// RequestOptions are passed to navigator.credentials.get(), without allowed credentials any discoverable one may be used
+type RequestOptions struct {
+	Challenge        Base64URL              `json:"challenge"`
+	Timeout          int64                  `json:"timeout,omitempty"`
+	RPID             string                 `json:"rpId"`
+	AllowCredentials []CredentialDescriptor `json:"allowCredentials,omitempty"`
+	UserVerification string                 `json:"userVerification"`
+}
+
+// Credential is PublicKeyCredential in json form (PublicKeyCredential.toJSON()),
+// response has attestation object for registration and authenticator data with signature for assertion
+type Credential struct {
+	ID       string             `json:"id"`
+	RawID    Base64URL          `json:"rawId"`
+	Type     string             `json:"type"`
+	Response CredentialResponse `json:"response"`
+}
+
+type CredentialResponse struct {
+	ClientDataJSON    Base64URL `json:"clientDataJSON"`
+	AttestationObject Base64URL `json:"attestationObject,omitempty"`
+	AuthenticatorData Base64URL `json:"authenticatorData,omitempty"`
+	Signature         Base64URL `json:"signature,omitempty"`
+	UserHandle        Base64URL `json:"userHandle,omitempty"`
+}
+
+// ClientData is what browser signs together with authenticator data
+type ClientData struct {
+	Type      string `json:"type"`
+	Challenge string `json:"challenge"`
+	Origin    string `json:"origin"`
+}
+
+// Registration is verified new credential
+type Registration struct {
+	CredentialID []byte
+	// COSE_Key, it's what should be stored
+	PublicKey []byte
+	SignCount uint32
+	AAGUID    []byte
+	// attestation statement format
+	Format       string
+	UserVerified bool
+}
+
+// Assertion is verified login, sign count should be checked against the stored one
+type Assertion struct {
+	SignCount    uint32
+	UserVerified bool
+	UserHandle   []byte
+}
+
+func (rp *RelyingParty) timeout() int64 {
+	return rp.Timeout.Milliseconds()
+}
+
+// CreationOptions makes options of registration, credentials of the user are excluded, so they aren't registered twice
+func (rp *RelyingParty) CreationOptions(challenge []byte, user UserEntity, exclude [][]byte) CreationOptions {
+	params := make([]CredentialParameter, len(SupportedAlgorithms))
+	for i, alg := range SupportedAlgorithms {
+		params[i] = CredentialParameter{Type: credentialType, Alg: alg}
+	}
+
+	return CreationOptions{
+		RP:                 RPEntity{ID: rp.ID, Name: rp.Name},
+		User:               user,
+		Challenge:          challenge,
+		PubKeyCredParams:   params,
+		Timeout:            rp.timeout(),
+		ExcludeCredentials: descriptors(exclude),
+		AuthenticatorSelection: AuthenticatorSelection{
+			ResidentKey:      "preferred",
+			UserVerification: rp.userVerification(),
+		},
+		Attestation: rp.attestation(),
+	}
+}
+
+// RequestOptions makes options of login, allow may be empty to let user pick any discoverable credential
+func (rp *RelyingParty) RequestOptions(challenge []byte, allow [][]byte) RequestOptions {
+	return RequestOptions{
+		Challenge:        challenge,
+		Timeout:          rp.timeout(),
+		RPID:             rp.ID,
+		AllowCredentials: descriptors(allow),
+		UserVerification: rp.userVerification(),
+	}
+}
+
+func descriptors(ids [][]byte) []CredentialDescriptor {
+	out := make([]CredentialDescriptor, len(ids))
+	for i, id := range ids {
+		out[i] = CredentialDescriptor{Type: credentialType, ID: id}
+	}
+	return out
+}
+
+func (rp *RelyingParty) userVerification() string {
+	if rp.UserVerification == "" {
+		return UserVerificationPreferred
+	}
+	return rp.UserVerification
+}
+
+func (rp *RelyingParty) attestation() string {
+	if rp.Attestation == "" {
+		return AttestationNone
+	}
+	return rp.Attestation
+}
+
+// ChallengeOf returns challenge the credential answers, so the ceremony it belongs to can be found.
+// It isn't verified, that's what VerifyRegistration and VerifyAssertion do
+func ChallengeOf(credential Credential) ([]byte, error) {
+	clientData, err := parseClientData(credential.Response.ClientDataJSON)
+	if err != nil {
+		return nil, err
+	}
+
+	challenge, err := base64.RawURLEncoding.DecodeString(clientData.Challenge)
+	if err != nil {
+		return nil, fmt.Errorf("%w: bad challenge: %w", ErrMalformed, err)
+	}
+	return challenge, nil
+}
+
+// VerifyRegistration verifies new credential made for the challenge (WebAuthn §7.1)
+func (rp *RelyingParty) VerifyRegistration(challenge []byte, credential Credential) (Registration, error) {
+	err := rp.verifyClientData(CeremonyCreate, challenge, credential)
+	if err != nil {
+		return Registration{}, err
+	}
+
+	object, err := parseAttestationObject(credential.Response.AttestationObject)
+	if err != nil {
+		return Registration{}, err
+	}
+
+	authData, err := rp.verifyAuthenticatorData(object.authData)
+	if err != nil {
+		return Registration{}, err
+	}
+	if !authData.Has(FlagAttestedCredData) {
+		return Registration{}, fmt.Errorf("%w: no attested credential data", ErrMalformed)
+	}
+	if subtle.ConstantTimeCompare(authData.CredentialID, credential.RawID) != 1 {
+		return Registration{}, fmt.Errorf("%w: credential id differs from the attested one", ErrMalformed)
+	}
+
+	publicKey, err := ParsePublicKey(authData.PublicKey)
+	if err != nil {
+		return Registration{}, err
+	}
+
+	clientDataHash := sha256.Sum256(credential.Response.ClientDataJSON)
+	err = verifyAttestation(object, authData, publicKey, clientDataHash[:])
+	if err != nil {
+		return Registration{}, err
+	}
+
+	return Registration{
+		CredentialID: authData.CredentialID,
+		PublicKey:    authData.PublicKey,
+		SignCount:    authData.SignCount,
+		AAGUID:       authData.AAGUID,
+		Format:       object.format,
+		UserVerified: authData.Has(FlagUserVerified),
+	}, nil
+}
+
+// VerifyAssertion verifies login with stored credential public key (WebAuthn §7.2),
+// looking the credential up and checking its sign count is up to the caller
+func (rp *RelyingParty) VerifyAssertion(challenge []byte, credential Credential, publicKey []byte) (Assertion, error) {
+	err := rp.verifyClientData(CeremonyGet, challenge, credential)
+	if err != nil {
+		return Assertion{}, err
+	}
+
+	authData, err := rp.verifyAuthenticatorData(credential.Response.AuthenticatorData)
+	if err != nil {
+		return Assertion{}, err
+	}
+
+	key, err := ParsePublicKey(publicKey)
+	if err != nil {
+		return Assertion{}, err
+	}
+
+	clientDataHash := sha256.Sum256(credential.Response.ClientDataJSON)
+	signed := slices.Concat([]byte(credential.Response.AuthenticatorData), clientDataHash[:])
+	err = key.Verify(signed, credential.Response.Signature)
+	if err != nil {
+		return Assertion{}, err
+	}
+
+	return Assertion{
+		SignCount:    authData.SignCount,
+		UserVerified: authData.Has(FlagUserVerified),
+		UserHandle:   credential.Response.UserHandle,
+	}, nil
+}
+
+func (rp *RelyingParty) verifyClientData(ceremony string, challenge []byte, credential Credential) error {
+	if credential.Type != credentialType {
+		return fmt.Errorf("%w: credential type %q", ErrUnsupported, credential.Type)
+	}
+
+	clientData, err := parseClientData(credential.Response.ClientDataJSON)
+	if err != nil {
+		return err
+	}
+
+	if clientData.Type != ceremony {
+		return fmt.Errorf("%w: %q instead of %q", ErrCeremony, clientData.Type, ceremony)
+	}
+	if subtle.ConstantTimeCompare([]byte(clientData.Challenge), []byte(base64.RawURLEncoding.EncodeToString(challenge))) != 1 {
+		return ErrChallenge
+	}
+	if !slices.Contains(rp.Origins, clientData.Origin) {
+		return fmt.Errorf("%w: %s", ErrOrigin, clientData.Origin)
+	}
+
+	return nil
+}
+
+func (rp *RelyingParty) verifyAuthenticatorData(data []byte) (AuthenticatorData, error) {
+	authData, err := ParseAuthenticatorData(data)
+	if err != nil {
+		return AuthenticatorData{}, err
+	}
+
+	rpIDHash := sha256.Sum256([]byte(rp.ID))
+	if subtle.ConstantTimeCompare(authData.RPIDHash, rpIDHash[:]) != 1 {
+		return AuthenticatorData{}, ErrRPID
+	}
+	if !authData.Has(FlagUserPresent) {
+		return AuthenticatorData{}, ErrUserPresence
+	}
+	if rp.userVerification() == UserVerificationRequired && !authData.Has(FlagUserVerified) {
+		return AuthenticatorData{}, ErrUserVerification
+	}
+	// backup state can't be set on a credential which can't be backed up
+	if authData.Has(FlagBackupState) && !authData.Has(FlagBackupEligible) {
+		return AuthenticatorData{}, fmt.Errorf("%w: backup state without backup eligibility", ErrMalformed)
+	}
+
+	return authData, nil
+}
+
+func parseClientData(data []byte) (ClientData, error) {
+	var clientData ClientData
+	err := json.Unmarshal(data, &clientData)
+	if err != nil {
+		return ClientData{}, fmt.Errorf("%w: bad client data: %w", ErrMalformed, err)
+	}
+	return clientData, nil
+}
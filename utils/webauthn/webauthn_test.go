@@ -0,0 +1,192 @@
+package webauthn_test
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/rinnothing/simple-jwt/utils/webauthn"
+	"github.com/rinnothing/simple-jwt/utils/webauthn/webauthntest"
+	"github.com/stretchr/testify/require"
+)
+
+const origin = "https://login.example.com"
+
+var rp = &webauthn.RelyingParty{
+	ID:               "example.com",
+	Name:             "example",
+	Origins:          []string{origin},
+	UserVerification: webauthn.UserVerificationPreferred,
+	Timeout:          time.Minute,
+}
+
+var user = webauthn.UserEntity{ID: []byte("user handle"), Name: "guid", DisplayName: "guid"}
+
+func challenge() []byte {
+	c := make([]byte, webauthn.ChallengeSize)
+	rand.Read(c)
+	return c
+}
+
+// register makes a credential with the authenticator, it goes through json the way browsers send it
+func register(t *testing.T, rp *webauthn.RelyingParty, a *webauthntest.Authenticator) webauthn.Registration {
+	c := challenge()
+	credential, err := a.Create(rp.CreationOptions(c, user, nil))
+	require.NoError(t, err)
+	credential = roundTrip(t, credential)
+
+	got, err := webauthn.ChallengeOf(credential)
+	require.NoError(t, err)
+	require.Equal(t, c, got)
+
+	registration, err := rp.VerifyRegistration(c, credential)
+	require.NoError(t, err)
+	require.Equal(t, []byte(credential.RawID), registration.CredentialID)
+	require.Equal(t, a.AAGUID, registration.AAGUID)
+	return registration
+}
+
+func roundTrip(t *testing.T, credential webauthn.Credential) webauthn.Credential {
+	data, err := json.Marshal(credential)
+	require.NoError(t, err)
+
+	var out webauthn.Credential
+	require.NoError(t, json.Unmarshal(data, &out))
+	return out
+}
+
+func TestCeremonies(t *testing.T) {
+	for _, alg := range []int64{webauthn.AlgES256, webauthn.AlgEdDSA} {
+		a := webauthntest.New(origin)
+		a.Algorithm = alg
+
+		registration := register(t, rp, a)
+		require.Equal(t, webauthn.FormatNone, registration.Format)
+		require.True(t, registration.UserVerified)
+
+		for i := 1; i <= 2; i++ {
+			c := challenge()
+			credential, err := a.Get(rp.RequestOptions(c, [][]byte{registration.CredentialID}))
+			require.NoError(t, err)
+
+			assertion, err := rp.VerifyAssertion(c, roundTrip(t, credential), registration.PublicKey)
+			require.NoError(t, err)
+			require.Equal(t, uint32(i), assertion.SignCount)
+			require.Equal(t, []byte(user.ID), assertion.UserHandle)
+		}
+	}
+}
+
+func TestPackedAttestation(t *testing.T) {
+	direct := *rp
+	direct.Attestation = webauthn.AttestationDirect
+
+	for _, kind := range []string{webauthntest.AttestationPackedSelf, webauthntest.AttestationPackedX5C} {
+		a := webauthntest.New(origin)
+		a.Attestation = kind
+
+		registration := register(t, &direct, a)
+		require.Equal(t, webauthn.FormatPacked, registration.Format)
+	}
+
+	// aaguid of the certificate must be the one of the authenticator data
+	a := webauthntest.New(origin)
+	a.Attestation = webauthntest.AttestationPackedX5C
+	c := challenge()
+	credential, err := a.Create(direct.CreationOptions(c, user, nil))
+	require.NoError(t, err)
+
+	// the aaguid follows rp id hash, flags and sign count
+	credential.Response.AttestationObject = replace(credential.Response.AttestationObject, a.AAGUID, make([]byte, 16))
+	_, err = direct.VerifyRegistration(c, credential)
+	require.ErrorIs(t, err, webauthn.ErrAttestation)
+}
+
+func TestRegistrationRejected(t *testing.T) {
+	a := webauthntest.New(origin)
+	c := challenge()
+	credential, err := a.Create(rp.CreationOptions(c, user, nil))
+	require.NoError(t, err)
+
+	_, err = rp.VerifyRegistration(challenge(), credential)
+	require.ErrorIs(t, err, webauthn.ErrChallenge)
+
+	other := *rp
+	other.Origins = []string{"https://evil.example.com"}
+	_, err = other.VerifyRegistration(c, credential)
+	require.ErrorIs(t, err, webauthn.ErrOrigin)
+
+	other = *rp
+	other.ID = "evil.example.com"
+	_, err = other.VerifyRegistration(c, credential)
+	require.ErrorIs(t, err, webauthn.ErrRPID)
+
+	// assertion can't be used for registration
+	registration := register(t, rp, a)
+	c = challenge()
+	assertion, err := a.Get(rp.RequestOptions(c, [][]byte{registration.CredentialID}))
+	require.NoError(t, err)
+	assertion.Response.AttestationObject = credential.Response.AttestationObject
+	_, err = rp.VerifyRegistration(c, assertion)
+	require.ErrorIs(t, err, webauthn.ErrCeremony)
+
+	// excluded credentials aren't registered again
+	_, err = a.Create(rp.CreationOptions(challenge(), user, [][]byte{registration.CredentialID}))
+	require.Error(t, err)
+}
+
+func TestAssertionRejected(t *testing.T) {
+	a := webauthntest.New(origin)
+	registration := register(t, rp, a)
+
+	get := func() ([]byte, webauthn.Credential) {
+		c := challenge()
+		credential, err := a.Get(rp.RequestOptions(c, nil))
+		require.NoError(t, err)
+		return c, credential
+	}
+
+	c, credential := get()
+	_, err := rp.VerifyAssertion(challenge(), credential, registration.PublicKey)
+	require.ErrorIs(t, err, webauthn.ErrChallenge)
+
+	// counter is signed too
+	credential.Response.AuthenticatorData[len(credential.Response.AuthenticatorData)-1]++
+	_, err = rp.VerifyAssertion(c, credential, registration.PublicKey)
+	require.ErrorIs(t, err, webauthn.ErrSignature)
+
+	c, credential = get()
+	credential.Response.Signature[len(credential.Response.Signature)-1]++
+	_, err = rp.VerifyAssertion(c, credential, registration.PublicKey)
+	require.ErrorIs(t, err, webauthn.ErrSignature)
+
+	// key of another credential
+	other := register(t, rp, webauthntest.New(origin))
+	c, credential = get()
+	_, err = rp.VerifyAssertion(c, credential, other.PublicKey)
+	require.ErrorIs(t, err, webauthn.ErrSignature)
+
+	// verification is required but wasn't done
+	required := *rp
+	required.UserVerification = webauthn.UserVerificationRequired
+	a.UserVerified = false
+	c, credential = get()
+	_, err = required.VerifyAssertion(c, credential, registration.PublicKey)
+	require.ErrorIs(t, err, webauthn.ErrUserVerification)
+
+	assertion, err := rp.VerifyAssertion(c, credential, registration.PublicKey)
+	require.NoError(t, err)
+	require.False(t, assertion.UserVerified)
+}
+
+func replace(data, old, new []byte) []byte {
+	out := append([]byte(nil), data...)
+	for i := 0; i+len(old) <= len(out); i++ {
+		if string(out[i:i+len(old)]) == string(old) {
+			copy(out[i:], new)
+			return out
+		}
+	}
+	panic("nothing to replace")
+}
@@ -0,0 +1,314 @@
+// Package webauthntest has a software authenticator, so ceremonies can be tested without a browser or a security key
+package webauthntest
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"slices"
+	"time"
+
+	"github.com/rinnothing/simple-jwt/utils/webauthn"
+)
+
+// attestation kinds the authenticator can make
+const (
+	AttestationNone       = webauthn.FormatNone
+	AttestationPackedSelf = "packed-self"
+	AttestationPackedX5C  = "packed-x5c"
+)
+
+var ErrNoCredential = errors.New("authenticator has no credential for the request")
+
+// Authenticator keeps credentials in memory and answers ceremonies as a browser together with a security key would
+type Authenticator struct {
+	// origin browser puts into client data
+	Origin string
+	AAGUID []byte
+	// ES256 or EdDSA
+	Algorithm int64
+	// AttestationNone, AttestationPackedSelf or AttestationPackedX5C
+	Attestation  string
+	UserVerified bool
+	// sign counter is increased on every assertion, passkeys which are synced keep it zero
+	CountSignatures bool
+
+	credentials []*credential
+}
+
+type credential struct {
+	id         []byte
+	rpID       string
+	userHandle []byte
+	alg        int64
+	key        crypto.Signer
+	counter    uint32
+}
+
+// New makes authenticator with ES256 credentials, none attestation and user verification
+func New(origin string) *Authenticator {
+	aaguid := make([]byte, 16)
+	rand.Read(aaguid)
+
+	return &Authenticator{
+		Origin:          origin,
+		AAGUID:          aaguid,
+		Algorithm:       webauthn.AlgES256,
+		Attestation:     AttestationNone,
+		UserVerified:    true,
+		CountSignatures: true,
+	}
+}
+
+// Create makes a new credential, like navigator.credentials.create()
+func (a *Authenticator) Create(options webauthn.CreationOptions) (webauthn.Credential, error) {
+	if !slices.ContainsFunc(options.PubKeyCredParams, func(p webauthn.CredentialParameter) bool { return p.Alg == a.Algorithm }) {
+		return webauthn.Credential{}, fmt.Errorf("algorithm %d isn't offered", a.Algorithm)
+	}
+	for _, excluded := range options.ExcludeCredentials {
+		if a.find(options.RP.ID, excluded.ID) != nil {
+			return webauthn.Credential{}, fmt.Errorf("credential is already registered")
+		}
+	}
+
+	cred := &credential{
+		id:         make([]byte, 32),
+		rpID:       options.RP.ID,
+		userHandle: options.User.ID,
+		alg:        a.Algorithm,
+	}
+	rand.Read(cred.id)
+
+	var err error
+	cred.key, err = generateKey(a.Algorithm)
+	if err != nil {
+		return webauthn.Credential{}, err
+	}
+
+	clientData, err := a.clientData(webauthn.CeremonyCreate, options.Challenge)
+	if err != nil {
+		return webauthn.Credential{}, err
+	}
+
+	authData := a.authData(cred, webauthn.FlagAttestedCredData)
+	authData = binary.BigEndian.AppendUint16(append(authData, a.AAGUID...), uint16(len(cred.id)))
+	authData = append(append(authData, cred.id...), coseKey(cred.key.Public())...)
+
+	format, stmt, err := a.attest(cred, authData, clientData)
+	if err != nil {
+		return webauthn.Credential{}, err
+	}
+	object := encode(cborMap{
+		{"fmt", format},
+		{"attStmt", stmt},
+		{"authData", authData},
+	})
+
+	a.credentials = append(a.credentials, cred)
+	return webauthn.Credential{
+		ID:    base64.RawURLEncoding.EncodeToString(cred.id),
+		RawID: cred.id,
+		Type:  "public-key",
+		Response: webauthn.CredentialResponse{
+			ClientDataJSON:    clientData,
+			AttestationObject: object,
+		},
+	}, nil
+}
+
+// Get signs the challenge with a credential of the rp, like navigator.credentials.get()
+func (a *Authenticator) Get(options webauthn.RequestOptions) (webauthn.Credential, error) {
+	var cred *credential
+	if len(options.AllowCredentials) == 0 {
+		for _, c := range a.credentials {
+			if c.rpID == options.RPID {
+				cred = c
+				break
+			}
+		}
+	}
+	for _, allowed := range options.AllowCredentials {
+		cred = a.find(options.RPID, allowed.ID)
+		if cred != nil {
+			break
+		}
+	}
+	if cred == nil {
+		return webauthn.Credential{}, ErrNoCredential
+	}
+
+	clientData, err := a.clientData(webauthn.CeremonyGet, options.Challenge)
+	if err != nil {
+		return webauthn.Credential{}, err
+	}
+
+	if a.CountSignatures {
+		cred.counter++
+	}
+	authData := a.authData(cred, 0)
+
+	clientDataHash := sha256.Sum256(clientData)
+	sig, err := sign(cred.alg, cred.key, slices.Concat(authData, clientDataHash[:]))
+	if err != nil {
+		return webauthn.Credential{}, err
+	}
+
+	return webauthn.Credential{
+		ID:    base64.RawURLEncoding.EncodeToString(cred.id),
+		RawID: cred.id,
+		Type:  "public-key",
+		Response: webauthn.CredentialResponse{
+			ClientDataJSON:    clientData,
+			AuthenticatorData: authData,
+			Signature:         sig,
+			UserHandle:        cred.userHandle,
+		},
+	}, nil
+}
+
+// SetCounter changes sign counter of the credential, it's how a cloned authenticator looks like
+func (a *Authenticator) SetCounter(id []byte, counter uint32) {
+	for _, c := range a.credentials {
+		if slices.Equal(c.id, id) {
+			c.counter = counter
+		}
+	}
+}
+
+func (a *Authenticator) find(rpID string, id []byte) *credential {
+	for _, c := range a.credentials {
+		if c.rpID == rpID && slices.Equal(c.id, id) {
+			return c
+		}
+	}
+	return nil
+}
+
+func (a *Authenticator) clientData(ceremony string, challenge []byte) ([]byte, error) {
+	return json.Marshal(map[string]any{
+		"type":        ceremony,
+		"challenge":   base64.RawURLEncoding.EncodeToString(challenge),
+		"origin":      a.Origin,
+		"crossOrigin": false,
+	})
+}
+
+func (a *Authenticator) authData(cred *credential, flags byte) []byte {
+	flags |= webauthn.FlagUserPresent
+	if a.UserVerified {
+		flags |= webauthn.FlagUserVerified
+	}
+
+	rpIDHash := sha256.Sum256([]byte(cred.rpID))
+	out := append(rpIDHash[:], flags)
+	return binary.BigEndian.AppendUint32(out, cred.counter)
+}
+
+func (a *Authenticator) attest(cred *credential, authData, clientData []byte) (string, cborMap, error) {
+	clientDataHash := sha256.Sum256(clientData)
+	signed := slices.Concat(authData, clientDataHash[:])
+
+	switch a.Attestation {
+	case AttestationNone:
+		return webauthn.FormatNone, cborMap{}, nil
+	case AttestationPackedSelf:
+		sig, err := sign(cred.alg, cred.key, signed)
+		if err != nil {
+			return "", nil, err
+		}
+		return webauthn.FormatPacked, cborMap{{"alg", cred.alg}, {"sig", sig}}, nil
+	case AttestationPackedX5C:
+		key, cert, err := a.attestationCertificate()
+		if err != nil {
+			return "", nil, err
+		}
+		sig, err := sign(webauthn.AlgES256, key, signed)
+		if err != nil {
+			return "", nil, err
+		}
+		return webauthn.FormatPacked, cborMap{{"alg", webauthn.AlgES256}, {"sig", sig}, {"x5c", []any{cert}}}, nil
+	default:
+		return "", nil, fmt.Errorf("unknown attestation %q", a.Attestation)
+	}
+}
+
+// attestationCertificate makes certificate the way WebAuthn wants it for packed attestation
+func (a *Authenticator) attestationCertificate() (crypto.Signer, []byte, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	aaguid, err := asn1.Marshal(a.AAGUID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject: pkix.Name{
+			Country:            []string{"US"},
+			Organization:       []string{"simple-jwt test"},
+			OrganizationalUnit: []string{"Authenticator Attestation"},
+			CommonName:         "software authenticator",
+		},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		BasicConstraintsValid: true,
+		ExtraExtensions: []pkix.Extension{
+			{Id: asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 45724, 1, 1, 4}, Value: aaguid},
+		},
+	}
+	cert, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+	if err != nil {
+		return nil, nil, err
+	}
+	return key, cert, nil
+}
+
+func generateKey(alg int64) (crypto.Signer, error) {
+	switch alg {
+	case webauthn.AlgES256:
+		return ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	case webauthn.AlgEdDSA:
+		_, key, err := ed25519.GenerateKey(rand.Reader)
+		return key, err
+	default:
+		return nil, fmt.Errorf("algorithm %d isn't supported", alg)
+	}
+}
+
+func sign(alg int64, key crypto.Signer, data []byte) ([]byte, error) {
+	if alg == webauthn.AlgEdDSA {
+		return key.Sign(rand.Reader, data, crypto.Hash(0))
+	}
+	digest := sha256.Sum256(data)
+	return key.Sign(rand.Reader, digest[:], crypto.SHA256)
+}
+
+// coseKey encodes public key as COSE_Key
+func coseKey(key crypto.PublicKey) []byte {
+	switch pub := key.(type) {
+	case *ecdsa.PublicKey:
+		x, y := make([]byte, 32), make([]byte, 32)
+		pub.X.FillBytes(x)
+		pub.Y.FillBytes(y)
+		return encode(cborMap{{1, 2}, {3, webauthn.AlgES256}, {-1, 1}, {-2, x}, {-3, y}})
+	case ed25519.PublicKey:
+		return encode(cborMap{{1, 1}, {3, webauthn.AlgEdDSA}, {-1, 6}, {-2, []byte(pub)}})
+	default:
+		panic(fmt.Sprintf("unsupported key %T", key))
+	}
+}
@@ -0,0 +1,74 @@
+package webauthntest
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// cborMap keeps keys in the order they are written, authenticators write them in canonical order
+type cborMap []cborPair
+
+type cborPair struct {
+	key   any
+	value any
+}
+
+// encode writes cbor with definite lengths, it supports only what authenticators send
+func encode(item any) []byte {
+	return appendItem(nil, item)
+}
+
+func appendItem(out []byte, item any) []byte {
+	switch v := item.(type) {
+	case int:
+		return appendInt(out, int64(v))
+	case int64:
+		return appendInt(out, v)
+	case []byte:
+		return append(appendHead(out, 2, uint64(len(v))), v...)
+	case string:
+		return append(appendHead(out, 3, uint64(len(v))), v...)
+	case []any:
+		out = appendHead(out, 4, uint64(len(v)))
+		for _, element := range v {
+			out = appendItem(out, element)
+		}
+		return out
+	case cborMap:
+		out = appendHead(out, 5, uint64(len(v)))
+		for _, pair := range v {
+			out = appendItem(appendItem(out, pair.key), pair.value)
+		}
+		return out
+	case bool:
+		if v {
+			return append(out, 0xf5)
+		}
+		return append(out, 0xf4)
+	default:
+		panic(fmt.Sprintf("can't encode %T", item))
+	}
+}
+
+func appendInt(out []byte, v int64) []byte {
+	if v >= 0 {
+		return appendHead(out, 0, uint64(v))
+	}
+	return appendHead(out, 1, uint64(-1-v))
+}
+
+func appendHead(out []byte, major byte, arg uint64) []byte {
+	major <<= 5
+	switch {
+	case arg < 24:
+		return append(out, major|byte(arg))
+	case arg <= 0xff:
+		return append(out, major|24, byte(arg))
+	case arg <= 0xffff:
+		return binary.BigEndian.AppendUint16(append(out, major|25), uint16(arg))
+	case arg <= 0xffffffff:
+		return binary.BigEndian.AppendUint32(append(out, major|26), uint32(arg))
+	default:
+		return binary.BigEndian.AppendUint64(append(out, major|27), arg)
+	}
+}